@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AggregateReport combines the JSON results of several repositories (e.g. a family
+// of crates documenting the usage of tnuctipun), for `doc-checker aggregate`
+type AggregateReport struct {
+	Totals       AggregateCounts     `json:"totals"`
+	Repositories []RepositoryResults `json:"repositories"`
+	Shared       []SharedCategory    `json:"shared_categories"` // Failing in several repositories, most widespread first
+	Verdict      string              `json:"verdict"`           // failed as soon as a repository failed
+}
+
+// AggregateCounts are the main counts of the results of a repository, or of all of them
+type AggregateCounts struct {
+	Files    int `json:"files"`
+	Snippets int `json:"snippets"`
+	Valid    int `json:"valid"`
+	Failed   int `json:"failed"`
+	Warnings int `json:"warnings"`
+}
+
+// RepositoryResults are the results of a repository
+type RepositoryResults struct {
+	Name             string          `json:"name"`
+	File             string          `json:"file"` // JSON results of the repository
+	Counts           AggregateCounts `json:"counts"`
+	ErrorsByCategory map[string]int  `json:"errors_by_category"`
+	Verdict          string          `json:"verdict"`
+}
+
+// SharedCategory is an error category failing in several repositories
+type SharedCategory struct {
+	Category     string   `json:"category"`
+	Failures     int      `json:"failures"`
+	Repositories []string `json:"repositories"`
+}
+
+// aggregateInput parses an argument of `doc-checker aggregate`: NAME=FILE,
+// or FILE (named by its base name, e.g. tnuctipun for tnuctipun.json)
+func aggregateInput(arg string) (string, string) {
+	if name, path, found := strings.Cut(arg, "="); found && name != "" {
+		return name, path
+	}
+
+	return strings.TrimSuffix(filepath.Base(arg), filepath.Ext(arg)), arg
+}
+
+// aggregateResults combines the results of the repositories, in the given order
+func aggregateResults(names []string, files []string, results []*Results) (*AggregateReport, error) {
+	report := &AggregateReport{Repositories: []RepositoryResults{}, Shared: []SharedCategory{}, Verdict: verdictPassed}
+	shared := make(map[string]*SharedCategory)
+	seen := make(map[string]bool)
+
+	for i, result := range results {
+		if seen[names[i]] {
+			return nil, fmt.Errorf("%s: repository %s given twice (name the results as NAME=FILE)", files[i], names[i])
+		}
+
+		seen[names[i]] = true
+
+		if result.SchemaVersion != schemaVersion {
+			return nil, fmt.Errorf("%s: schema version %d, expected %d", files[i], result.SchemaVersion, schemaVersion)
+		}
+
+		s := result.Summary
+		counts := AggregateCounts{
+			Files:    s.FilesProcessed,
+			Snippets: s.TotalSnippets,
+			Valid:    s.ValidSnippets,
+			Failed:   s.FailedSnippets,
+			Warnings: s.Warnings,
+		}
+
+		byCategory := s.ErrorsByCategory
+
+		if byCategory == nil {
+			byCategory = map[string]int{}
+		}
+
+		report.Repositories = append(report.Repositories, RepositoryResults{
+			Name:             names[i],
+			File:             files[i],
+			Counts:           counts,
+			ErrorsByCategory: byCategory,
+			Verdict:          result.Verdict,
+		})
+
+		report.Totals.Files += counts.Files
+		report.Totals.Snippets += counts.Snippets
+		report.Totals.Valid += counts.Valid
+		report.Totals.Failed += counts.Failed
+		report.Totals.Warnings += counts.Warnings
+
+		if result.Verdict == verdictFailed {
+			report.Verdict = verdictFailed
+		}
+
+		for category, count := range byCategory {
+			if count == 0 {
+				continue
+			}
+
+			if shared[category] == nil {
+				shared[category] = &SharedCategory{Category: category}
+			}
+
+			shared[category].Failures += count
+			shared[category].Repositories = append(shared[category].Repositories, names[i])
+		}
+	}
+
+	for _, category := range shared {
+		if len(category.Repositories) > 1 {
+			report.Shared = append(report.Shared, *category)
+		}
+	}
+
+	sort.Slice(report.Shared, func(i, j int) bool {
+		a, b := report.Shared[i], report.Shared[j]
+
+		if len(a.Repositories) != len(b.Repositories) {
+			return len(a.Repositories) > len(b.Repositories)
+		}
+
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+
+		return a.Category < b.Category
+	})
+
+	return report, nil
+}
+
+// writeAggregateReport prints the combined report in a human readable way
+func writeAggregateReport(w io.Writer, report *AggregateReport) {
+	width := len("Repository")
+
+	for _, repo := range report.Repositories {
+		width = max(width, len(repo.Name))
+	}
+
+	row := func(name string, counts AggregateCounts, verdict string) {
+		fmt.Fprintf(w, "%-*s  %6d  %8d  %6d  %6d  %8d  %s\n",
+			width, name, counts.Files, counts.Snippets, counts.Valid, counts.Failed, counts.Warnings, verdict)
+	}
+
+	fmt.Fprintf(w, "%-*s  %6s  %8s  %6s  %6s  %8s  %s\n", width, "Repository", "Files", "Snippets", "Valid", "Failed", "Warnings", "Verdict")
+
+	for _, repo := range report.Repositories {
+		row(repo.Name, repo.Counts, repo.Verdict)
+	}
+
+	row("Total", report.Totals, report.Verdict)
+
+	if len(report.Shared) > 0 {
+		fmt.Fprintln(w, "\nError categories failing in several repositories:")
+
+		for _, category := range report.Shared {
+			fmt.Fprintf(w, "  • %s: %d failure(s) in %s (%s)\n", category.Category, category.Failures,
+				strings.Join(category.Repositories, ", "), categoryDescription(category.Category))
+		}
+	}
+}
+
+// runAggregate prints the report combining the JSON results of the repositories
+// given as arguments, and returns the exit code (1 if a repository failed)
+func runAggregate(config *Config, w io.Writer) int {
+	if len(config.Files) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no results to aggregate (e.g. doc-checker aggregate tnuctipun=results.json ...)")
+		return 2
+	}
+
+	var names, files []string
+	var results []*Results
+
+	for _, arg := range config.Files {
+		name, path := aggregateInput(arg)
+		content, err := os.ReadFile(path)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to read results: %v\n", err)
+			return 2
+		}
+
+		var result Results
+
+		if err := json.Unmarshal(content, &result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: invalid results: %v\n", path, err)
+			return 2
+		}
+
+		names, files = append(names, name), append(files, path)
+		results = append(results, &result)
+	}
+
+	report, err := aggregateResults(names, files, results)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	if config.OutputFormat == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		writeAggregateReport(w, report)
+	}
+
+	if report.Verdict == verdictFailed {
+		return 1
+	}
+
+	return 0
+}
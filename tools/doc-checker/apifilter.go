@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Identifiers of a crate path (e.g. "updates::set")
+var apiPathRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(::[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// parseAPIFilter parses the comma-separated paths of --api-filter
+func parseAPIFilter(value string) ([]string, error) {
+	var paths []string
+
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+
+		if !apiPathRegex.MatchString(path) {
+			return nil, fmt.Errorf("invalid --api-filter path '%s' (e.g. updates::set)", path)
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// referencesAPI checks whether the code references a crate path: as is
+// (e.g. "filters::eq" in "tnuctipun::filters::eq"), or through its parent,
+// the last segment being called (e.g. ".set::<...>(" after "updates::empty()")
+// or named (e.g. "use tnuctipun::updates::{set, unset}")
+func referencesAPI(code, path string) bool {
+	const before, after = `(^|[^A-Za-z0-9_])`, `($|[^A-Za-z0-9_])`
+
+	if regexp.MustCompile(before + regexp.QuoteMeta(path) + after).MatchString(code) {
+		return true
+	}
+
+	sep := strings.LastIndex(path, "::")
+
+	if sep < 0 {
+		return false
+	}
+
+	parent, name := path[:sep], path[sep+2:]
+
+	if i := strings.LastIndex(parent, "::"); i >= 0 {
+		parent = parent[i+2:] // e.g. "updates" for "tnuctipun::updates::set"
+	}
+
+	if !regexp.MustCompile(before + regexp.QuoteMeta(parent) + after).MatchString(code) {
+		return false
+	}
+
+	name = regexp.QuoteMeta(name)
+
+	return regexp.MustCompile(`(\.` + name + `\s*(::<|\())|(` + regexp.QuoteMeta(parent) + `::\{[^}]*\b` + name + `\b)`).MatchString(code)
+}
+
+// selectedByAPIFilter checks whether a snippet references one of
+// the --api-filter paths (all the snippets being selected without filter)
+func (dc *DocChecker) selectedByAPIFilter(snippet Snippet) bool {
+	if len(dc.config.APIFilter) == 0 {
+		return true
+	}
+
+	for _, path := range dc.config.APIFilter {
+		if referencesAPI(snippet.Content, path) {
+			return true
+		}
+	}
+
+	return false
+}
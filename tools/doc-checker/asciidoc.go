@@ -0,0 +1,164 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Extensions of the AsciiDoc documents, checked as the markdown files
+var asciidocExtensions = []string{".adoc", ".asciidoc"}
+
+// Attribute line of a source block, e.g. [source,rust], [source%linenums,rust,no_run] or [,rust]
+var asciidocSourceRegex = regexp.MustCompile(`^\[(?:source)?(?:%[\w%]*)?(?:,\s*([^,\]]*?)\s*(?:,(.*))?)?\]$`)
+
+// Document attribute giving the language of the source blocks without one
+var asciidocLanguageRegex = regexp.MustCompile(`^:source-language:\s*(\S+)\s*$`)
+
+// Include directive of a source block, e.g. include::../examples/model.rs[tag=model]
+var asciidocIncludeRegex = regexp.MustCompile(`^include::([^\[]+)\[(.*)\]$`)
+
+// Callout at the end of a line of code, without comment (e.g. "let filter = doc! {}; <1>")
+var asciidocCalloutRegex = regexp.MustCompile(`\s+<\d+>$`)
+
+// isAsciiDoc checks whether a discovered file is an AsciiDoc document
+func isAsciiDoc(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	for _, candidate := range asciidocExtensions {
+		if ext == candidate {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Patterns of the documents discovered with git
+var docFilePatterns = []string{"*.md", "*.adoc", "*.asciidoc", "*.ipynb"}
+
+// isDocFile checks whether a file is a markdown or AsciiDoc document, or a Jupyter notebook
+func isDocFile(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".md") || isAsciiDoc(path) || isNotebook(path)
+}
+
+// asciidocDelimiter checks whether a line delimits a listing ("----")
+// or literal ("....") block
+func asciidocDelimiter(line string) bool {
+	return len(line) >= 4 && (strings.Trim(line, "-") == "" || strings.Trim(line, ".") == "")
+}
+
+// asciidocInclude returns the mdBook include directive of an AsciiDoc one,
+// with its line range (lines=FROM..TO) or its tagged region (tag=NAME), e.g.
+// {{#include model.rs:10:25}} for include::model.rs[lines=10..25]
+func asciidocInclude(path, attrs string) string {
+	selector := ""
+
+	for _, attr := range strings.Split(attrs, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		value = strings.Trim(value, `"`)
+
+		switch key {
+		case "tag", "tags":
+			selector = value
+
+		case "lines":
+			if from, to, isRange := strings.Cut(value, ".."); isRange && !strings.ContainsAny(value, ";,") {
+				selector = from + ":" + strings.TrimPrefix(to, "-1")
+			} else {
+				selector = value // Not supported if several ranges (reported as such)
+			}
+		}
+	}
+
+	if selector != "" {
+		path += ":" + selector
+	}
+
+	return "{{#include " + path + "}}"
+}
+
+// asciidocMarkdown returns the source blocks of an AsciiDoc document as
+// markdown code blocks, each other line being blank (but the doc-checker:off
+// and doc-checker:on comments), so the lines of the snippets are the ones of
+// the document. The include directives of the source blocks are resolved as
+// the mdBook ones, relative to the document.
+func asciidocMarkdown(source string) string {
+	lines := strings.Split(source, "\n")
+	language := ""
+	info, pending := "", false // Source block attributes, waiting for the block
+	delimiter, paragraph := "", false
+	inComment := false
+
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, " \t\r")
+
+		switch {
+		case inComment:
+			inComment = trimmed != "////"
+			lines[i] = ""
+
+		case delimiter != "" || paragraph:
+			if trimmed == delimiter || paragraph && trimmed == "" {
+				delimiter, paragraph = "", false
+				lines[i] = "```"
+			} else if match := asciidocIncludeRegex.FindStringSubmatch(trimmed); match != nil {
+				lines[i] = asciidocInclude(match[1], match[2])
+			} else {
+				lines[i] = asciidocCalloutRegex.ReplaceAllString(trimmed, "")
+			}
+
+		case trimmed == "////":
+			inComment = true
+			lines[i] = ""
+
+		case asciidocLanguageRegex.MatchString(trimmed):
+			language = asciidocLanguageRegex.FindStringSubmatch(trimmed)[1]
+			lines[i] = ""
+
+		case asciidocSourceRegex.MatchString(trimmed) && (strings.HasPrefix(trimmed, "[source") || strings.HasPrefix(trimmed, "[,")):
+			match := asciidocSourceRegex.FindStringSubmatch(trimmed)
+			info, pending = match[1], true
+
+			if info == "" {
+				info = language
+			}
+
+			if match[2] != "" {
+				info += "," + match[2]
+			}
+
+			lines[i] = ""
+
+		case asciidocDelimiter(trimmed):
+			// A listing block without source attributes is not tagged
+			if !pending {
+				info = ""
+			}
+
+			delimiter, pending = trimmed, false
+			lines[i] = "```" + info
+
+		case pending && trimmed != "" && !strings.HasPrefix(trimmed, "."):
+			// Source paragraph, up to the next blank line: its attribute line opens the block
+			lines[i-1] = "```" + info
+			pending, paragraph = false, true
+
+			if match := asciidocIncludeRegex.FindStringSubmatch(trimmed); match != nil {
+				lines[i] = asciidocInclude(match[1], match[2])
+			}
+
+		default:
+			switch strings.TrimSpace(strings.TrimPrefix(trimmed, "//")) {
+			case "doc-checker:off":
+				lines[i] = skipRegionStart
+			case "doc-checker:on":
+				lines[i] = skipRegionEnd
+			default:
+				lines[i] = ""
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
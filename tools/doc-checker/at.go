@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// checkAtRevision checks the markdown files as they existed at the --at revision,
+// against the crates at this same revision, in a temporary git worktree.
+// The paths of the results are mapped back to the project root.
+func checkAtRevision(ctx context.Context, config *Config) (*Results, error) {
+	var results *Results
+
+	err := withWorktree(config, config.At, func(projectRoot string) error {
+		atConfig, err := worktreeConfig(config, projectRoot)
+
+		if err != nil {
+			return fmt.Errorf("at %s: %w", config.At, err)
+		}
+
+		if results, err = NewDocChecker(atConfig).RunContext(ctx); err != nil {
+			return err
+		}
+
+		remapResults(results, atConfig.ProjectRoot, config.ProjectRoot)
+
+		return nil
+	})
+
+	return results, err
+}
+
+// withWorktree calls fn with the project root in a temporary git worktree
+// of the repository, at the given revision (detached)
+func withWorktree(config *Config, rev string, fn func(projectRoot string) error) error {
+	topLevel, err := gitOutput(config.ProjectRoot, "rev-parse", "--show-toplevel")
+
+	if err != nil {
+		return fmt.Errorf("a git repository is required: %w", err)
+	}
+
+	commit, err := gitOutput(config.ProjectRoot, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+
+	if err != nil {
+		return fmt.Errorf("unknown revision '%s'", rev)
+	}
+
+	worktree, err := os.MkdirTemp("", "doc-checker-at-")
+
+	if err != nil {
+		return fmt.Errorf("failed to create worktree directory: %w", err)
+	}
+
+	defer os.RemoveAll(worktree)
+
+	if _, err := gitOutput(config.ProjectRoot, "worktree", "add", "--detach", worktree, commit); err != nil {
+		return fmt.Errorf("failed to create worktree at %s: %w", rev, err)
+	}
+
+	defer gitOutput(config.ProjectRoot, "worktree", "remove", "--force", worktree)
+
+	// The project may be in a subdirectory of the repository
+	rootInRepo, err := filepath.Rel(topLevel, config.ProjectRoot)
+
+	if err != nil {
+		return err
+	}
+
+	return fn(filepath.Join(worktree, rootInRepo))
+}
+
+// worktreeConfig returns the configuration to check the given files
+// under the project root of a worktree, with the configuration file
+// of the worktree (unless one is given)
+func worktreeConfig(config *Config, projectRoot string) (*Config, error) {
+	wtConfig := *config
+	wtConfig.ProjectRoot = projectRoot
+	wtConfig.Files = nil
+
+	for _, file := range config.Files {
+		path, err := movePath(file, config.ProjectRoot, projectRoot)
+
+		if err != nil {
+			return nil, err
+		}
+
+		wtConfig.Files = append(wtConfig.Files, path)
+	}
+
+	if err := loadConfigFile(&wtConfig); err != nil {
+		return nil, err
+	}
+
+	return &wtConfig, nil
+}
+
+// movePath returns the path of a file under another root directory,
+// given its path (possibly relative to the working directory) under the root
+func movePath(path, fromRoot, toRoot string) (string, error) {
+	abs, err := filepath.Abs(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(fromRoot, abs)
+
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the project %s", path, fromRoot)
+	}
+
+	return filepath.Join(toRoot, rel), nil
+}
+
+// remapResults moves the paths of the results from a root directory to another
+func remapResults(results *Results, fromRoot, toRoot string) *Results {
+	remap := func(path string) string {
+		if moved, err := movePath(path, fromRoot, toRoot); err == nil {
+			return moved
+		}
+
+		return path
+	}
+
+	files := make(map[string]FileResult, len(results.Files))
+
+	for file, result := range results.Files {
+		files[remap(file)] = result
+	}
+
+	results.Files = files
+
+	for i, warning := range results.Warnings {
+		if warning.File != "" {
+			results.Warnings[i].File = remap(warning.File)
+		}
+	}
+
+	if first := results.Summary.FirstFailure; first != nil && first.File != "" {
+		first.File = remap(first.File)
+	}
+
+	return results
+}
+
+// gitOutput runs a git command in a directory, and returns its trimmed output
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+
+	return strings.TrimSpace(string(output)), err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Badge is a shields.io endpoint badge (https://shields.io/badges/endpoint-badge)
+type Badge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// newBadge returns the badge of the results: the valid/total snippet counts,
+// green when all the checked snippets are valid, red otherwise
+func newBadge(results *Results) Badge {
+	summary := results.Summary
+	badge := Badge{
+		SchemaVersion: 1,
+		Label:         "docs examples",
+		Message:       fmt.Sprintf("%d/%d valid", summary.ValidSnippets, summary.TotalSnippets),
+		Color:         "brightgreen",
+	}
+
+	if summary.FailedSnippets > 0 {
+		badge.Color = "red"
+	} else if summary.TotalSnippets == 0 {
+		badge.Message = "none"
+		badge.Color = "lightgrey"
+	} else if summary.Warnings > 0 {
+		badge.Color = "yellow"
+	}
+
+	return badge
+}
+
+// writeBadge writes the badge of the results to a file, to be published by CI
+func writeBadge(path string, results *Results) error {
+	content, err := json.MarshalIndent(newBadge(results), "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write badge file: %w", err)
+	}
+
+	return nil
+}
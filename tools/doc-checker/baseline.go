@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// Baseline lists the known failures (e.g. the examples of an API being
+// changed), reported as excluded rather than failed with --baseline
+type Baseline struct {
+	Failures []BaselineEntry `json:"failures"`
+}
+
+// BaselineEntry is a known failure of a snippet, designated by its identifier
+// (stable across the edits of the file when given with id=NAME)
+type BaselineEntry struct {
+	File      string `json:"file"` // Relative to the project root
+	SnippetID string `json:"snippet_id"`
+	Category  string `json:"category"`
+}
+
+// loadBaseline reads the baseline file, which may not exist yet
+// with --update-baseline
+func loadBaseline(path string, update bool) ([]BaselineEntry, error) {
+	content, err := os.ReadFile(path)
+
+	if update && errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the baseline: %w", err)
+	}
+
+	var baseline Baseline
+
+	if err := json.Unmarshal(content, &baseline); err != nil {
+		return nil, fmt.Errorf("%s: invalid baseline: %w", path, err)
+	}
+
+	return baseline.Failures, nil
+}
+
+// baselineEntry returns the entry of a failure in the baseline
+func (dc *DocChecker) baselineEntry(failure Failure) BaselineEntry {
+	return BaselineEntry{
+		File:      dc.relativePath(dc.manifest[failure.Snippet].File),
+		SnippetID: failure.SnippetID,
+		Category:  failure.Category,
+	}
+}
+
+// inBaseline checks whether a failure is a known one of the --baseline
+func (dc *DocChecker) inBaseline(failure Failure) bool {
+	entry := dc.baselineEntry(failure)
+
+	for _, known := range dc.config.KnownFailures {
+		if known == entry {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeBaseline replaces the baseline with the failures of the run, keeping
+// the entries of the snippets which were not checked (e.g. not selected by --filter)
+func (dc *DocChecker) writeBaseline(path string) error {
+	checked := make(map[BaselineEntry]bool)
+
+	for _, source := range dc.manifest {
+		checked[BaselineEntry{File: dc.relativePath(source.File), SnippetID: source.SnippetID}] = true
+	}
+
+	baseline := Baseline{Failures: append([]BaselineEntry{}, dc.failures...)}
+
+	for _, known := range dc.config.KnownFailures {
+		if !checked[BaselineEntry{File: known.File, SnippetID: known.SnippetID}] {
+			baseline.Failures = append(baseline.Failures, known)
+		}
+	}
+
+	sort.Slice(baseline.Failures, func(i, j int) bool {
+		a, b := baseline.Failures[i], baseline.Failures[j]
+
+		if a.File != b.File {
+			return a.File < b.File
+		}
+
+		return a.SnippetID < b.SnippetID
+	})
+
+	content, err := json.MarshalIndent(baseline, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write the baseline: %w", err)
+	}
+
+	return nil
+}
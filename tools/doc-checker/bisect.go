@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Verdicts of git bisect on a revision
+const (
+	verdictGood = "good"
+	verdictBad  = "bad"
+	verdictSkip = "skip" // the snippet doesn't exist (or isn't checked, or can't be checked) at this revision
+)
+
+// SnippetSelector designates a snippet of a markdown file, by a line within
+// its fences or by its id=NAME attribute (e.g. README.md:120 or README.md:find_by_name)
+type SnippetSelector struct {
+	File string
+	Line int
+	ID   string // As in the id=NAME attribute of the fence
+}
+
+// parseSnippetSelector parses a FILE:LINE or FILE:ID selector
+func parseSnippetSelector(value string) (SnippetSelector, error) {
+	sep := strings.LastIndex(value, ":")
+
+	if sep <= 0 || sep == len(value)-1 {
+		return SnippetSelector{}, fmt.Errorf("invalid snippet '%s' (expected FILE:LINE or FILE:ID, e.g. README.md:120)", value)
+	}
+
+	// The positional identifiers (e.g. auto_3) designate other snippets at other revisions
+	if id := value[sep+1:]; isPositionalID(id) {
+		return SnippetSelector{}, fmt.Errorf("invalid snippet '%s' (%s is positional, the snippet must be designated by its line, or by its id=NAME attribute)", value, id)
+	}
+
+	selector := SnippetSelector{File: value[:sep]}
+
+	if line, err := strconv.Atoi(value[sep+1:]); err == nil {
+		if line <= 0 {
+			return SnippetSelector{}, fmt.Errorf("invalid snippet '%s' (line must be positive)", value)
+		}
+
+		selector.Line = line
+	} else {
+		selector.ID = value[sep+1:]
+	}
+
+	return selector, nil
+}
+
+// find returns the selected snippet, if any
+func (s SnippetSelector) find(snippets []Snippet) (Snippet, bool) {
+	for _, snippet := range snippets {
+		if (s.ID != "" && snippet.Attrs["id"] == s.ID) ||
+			(s.Line > 0 && s.Line >= snippet.StartLine && s.Line <= snippet.EndLine) {
+			return snippet, true
+		}
+	}
+
+	return Snippet{}, false
+}
+
+// isPositionalID checks whether an identifier is the one given to a snippet
+// by its position in the file (see snippetID)
+func isPositionalID(id string) bool {
+	for _, prefix := range []string{"auto_", "ignored_"} {
+		if n, err := strconv.Atoi(strings.TrimPrefix(id, prefix)); strings.HasPrefix(id, prefix) && err == nil && n > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BisectStep is the verdict on a revision, during the bisection
+type BisectStep struct {
+	Commit  string `json:"commit"`
+	Verdict string `json:"verdict"`
+}
+
+// BisectResult is the commit which broke a snippet, found by `doc-checker bisect`
+type BisectResult struct {
+	Snippet        string       `json:"snippet"`
+	FirstBadCommit string       `json:"first_bad_commit"`
+	Subject        string       `json:"subject"`
+	Failure        *Failure     `json:"failure,omitempty"` // At the first bad commit
+	Steps          []BisectStep `json:"steps"`
+}
+
+// bisectSnippet drives git bisect, between the --good and --bad revisions,
+// in a temporary worktree, to find the commit from which the selected snippet
+// fails to compile (each revision is checked against the crates at this revision)
+func bisectSnippet(ctx context.Context, config *Config, progress io.Writer) (*BisectResult, error) {
+	selector, err := parseSnippetSelector(config.BisectSnippet)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.BisectGood == "" {
+		return nil, fmt.Errorf("bisect requires --good (a revision where the snippet compiles)")
+	}
+
+	// Resolved in the project, as HEAD changes in the worktree
+	bad, err := gitOutput(config.ProjectRoot, "rev-parse", "--verify", "--quiet", config.BisectBad+"^{commit}")
+
+	if err != nil {
+		return nil, fmt.Errorf("unknown revision '%s'", config.BisectBad)
+	}
+
+	good, err := gitOutput(config.ProjectRoot, "rev-parse", "--verify", "--quiet", config.BisectGood+"^{commit}")
+
+	if err != nil {
+		return nil, fmt.Errorf("unknown revision '%s'", config.BisectGood)
+	}
+
+	result := &BisectResult{Snippet: config.BisectSnippet, Steps: []BisectStep{}}
+	failures := make(map[string]*Failure)
+
+	checkConfig := *config
+	checkConfig.Files = []string{selector.File}
+	checkConfig.OutputFormat = "json" // silent
+	checkConfig.ReportDir = ""
+	checkConfig.BadgeFile = ""
+
+	err = withWorktree(config, bad, func(projectRoot string) error {
+		// The check of the current revision of the worktree
+		check := func() (string, error) {
+			commit, err := gitOutput(projectRoot, "rev-parse", "HEAD")
+
+			if err != nil {
+				return "", err
+			}
+
+			verdict, failure, err := checkSnippetAt(ctx, &checkConfig, projectRoot, selector)
+
+			if err != nil {
+				return "", err
+			}
+
+			failures[commit] = failure
+			result.Steps = append(result.Steps, BisectStep{Commit: commit, Verdict: verdict})
+			fmt.Fprintf(progress, "%s %s\n", shortCommit(commit), verdict)
+
+			return verdict, nil
+		}
+
+		// The bounds are checked first, as git bisect assumes them
+		for _, bound := range []struct{ name, commit, expected string }{
+			{config.BisectBad, bad, verdictBad},
+			{config.BisectGood, good, verdictGood},
+		} {
+			if _, err := gitOutput(projectRoot, "checkout", "--quiet", "--detach", bound.commit); err != nil {
+				return fmt.Errorf("failed to checkout %s: %w", bound.name, err)
+			}
+
+			// The line designates a snippet at the bad revision, which is then
+			// followed by its id=NAME, as the lines (and so the positions of the
+			// snippets) change across revisions
+			if selector.Line > 0 {
+				_, snippet, found := findSnippetAt(&checkConfig, projectRoot, selector)
+
+				if !found {
+					return fmt.Errorf("no snippet at %s in %s", config.BisectSnippet, config.BisectBad)
+				}
+
+				name, named := snippet.Attrs["id"]
+
+				if !named || name == "" {
+					return fmt.Errorf("the snippet at %s has no id=NAME attribute, required to follow it across revisions", config.BisectSnippet)
+				}
+
+				selector = SnippetSelector{File: selector.File, ID: name}
+			}
+
+			verdict, err := check()
+
+			if err != nil {
+				return err
+			}
+
+			if verdict != bound.expected {
+				return fmt.Errorf("the snippet is %s at %s, while %s is expected", verdict, bound.name, bound.expected)
+			}
+		}
+
+		output, err := gitOutput(projectRoot, "bisect", "start", bad, good)
+
+		if err != nil {
+			return fmt.Errorf("failed to start git bisect: %w", err)
+		}
+
+		defer gitOutput(projectRoot, "bisect", "reset")
+
+		for !strings.Contains(output, "is the first bad commit") {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			verdict, err := check()
+
+			if err != nil {
+				return err
+			}
+
+			if output, err = gitOutput(projectRoot, "bisect", verdict); err != nil {
+				return fmt.Errorf("git bisect %s failed: %w", verdict, err)
+			}
+
+			// e.g. only skipped commits left
+			if strings.Contains(output, "There are only 'skip'ped commits left") {
+				return fmt.Errorf("the first bad commit could not be found:\n%s", output)
+			}
+		}
+
+		// e.g. "<sha> is the first bad commit"
+		for _, line := range strings.Split(output, "\n") {
+			if strings.HasSuffix(line, " is the first bad commit") {
+				result.FirstBadCommit = strings.Fields(line)[0]
+			}
+		}
+
+		result.Subject, _ = gitOutput(projectRoot, "log", "-1", "--format=%s", result.FirstBadCommit)
+		result.Failure = failures[result.FirstBadCommit]
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// findSnippetAt finds the selected snippet in the file under the given project root,
+// and returns the configuration to check it
+func findSnippetAt(config *Config, projectRoot string, selector SnippetSelector) (*Config, Snippet, bool) {
+	wtConfig, err := worktreeConfig(config, projectRoot)
+
+	if err != nil {
+		return nil, Snippet{}, false // e.g. invalid configuration at this revision
+	}
+
+	content, err := os.ReadFile(wtConfig.Files[0])
+
+	if err != nil {
+		return nil, Snippet{}, false
+	}
+
+	snippets, err := NewDocChecker(wtConfig).extractRustSnippetsWithIDs(wtConfig.Files[0], string(content))
+
+	if err != nil {
+		return nil, Snippet{}, false
+	}
+
+	snippet, found := selector.find(snippets)
+
+	return wtConfig, snippet, found
+}
+
+// checkSnippetAt checks the selected snippet, with the files and crates of the given project root
+func checkSnippetAt(ctx context.Context, config *Config, projectRoot string, selector SnippetSelector) (string, *Failure, error) {
+	wtConfig, snippet, found := findSnippetAt(config, projectRoot, selector)
+
+	// Not checked (ignored, or in a doc-checker:off region)
+	if !found || snippet.Ignore || snippet.Skipped {
+		return verdictSkip, nil, nil
+	}
+
+	results, err := NewDocChecker(wtConfig).RunContext(ctx)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, failure := range results.Files[wtConfig.Files[0]].Failures {
+		if failure.SnippetID == snippet.ID {
+			// Not due to the snippet (e.g. a dependency which could not be resolved)
+			if failure.environment {
+				return verdictSkip, nil, nil
+			}
+
+			failure := failure
+			return verdictBad, &failure, nil
+		}
+	}
+
+	return verdictGood, nil, nil
+}
+
+// shortCommit abbreviates a commit hash
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+
+	return commit
+}
+
+// printBisectResult prints the first bad commit, and the failure of the snippet at this commit
+func printBisectResult(w io.Writer, result *BisectResult) {
+	fmt.Fprintf(w, "\nFirst bad commit for %s: %s %s\n", result.Snippet, shortCommit(result.FirstBadCommit), result.Subject)
+
+	if result.Failure != nil {
+		fmt.Fprintf(w, "\n%s (%s):\n%s\n", result.Failure.SnippetID, result.Failure.Category, result.Failure.Message)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// resultCache records the outcome of the snippets (compiled successfully, or
+// their compilation error), keyed by their generated code and the inputs of the
+// compilation (Cargo.lock, sources of the crates, toolchain and dependencies),
+// so that a cached outcome means unchanged inputs
+type resultCache struct {
+	dir string // Directory of the entries for the current inputs
+}
+
+// resultCachesRoot returns the directory of the result caches (one per set of
+// inputs), in the user cache directory
+func resultCachesRoot() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve cache directory: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "doc-checker", "results"), nil
+}
+
+// openCache returns the cache of the results for the snippets of the given crate,
+// or nil if the cache is disabled (or the inputs can't be determined)
+func (dc *DocChecker) openCache(crate CrateConfig) *resultCache {
+	// With --diff-project, all the snippets are generated, so the project can be compared
+	if dc.config.NoCache || dc.config.Hermetic || dc.config.DiffProject {
+		return nil
+	}
+
+	if dc.inputsKey == "" {
+		key, err := dc.hashInputs()
+
+		if err != nil {
+			dc.logWarning(fmt.Sprintf("Result cache disabled: %v", err))
+			dc.config.NoCache = true
+
+			return nil
+		}
+
+		dc.inputsKey = key
+	}
+
+	root, err := resultCachesRoot()
+
+	if err != nil {
+		return nil
+	}
+
+	dependencies, _ := dc.extractDependencyVersions()
+	crateDependency, _ := dc.crateDependency(crate)
+	crateHash := sha256.Sum256([]byte(dc.inputsKey + "\n" + crate.Name + "\n" + crateDependency + "\n" + dependencies))
+
+	cache := &resultCache{dir: filepath.Join(root, hex.EncodeToString(crateHash[:8]))}
+
+	// Last used now, so it's not collected by `doc-checker gc` (as the ones
+	// of the previous inputs, e.g. before a toolchain update, eventually are)
+	if err := os.MkdirAll(cache.dir, 0755); err == nil {
+		_ = os.WriteFile(filepath.Join(cache.dir, targetDirStamp), []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644)
+	}
+
+	return cache
+}
+
+// hashInputs hashes the inputs shared by all the snippets: Cargo.lock,
+// the manifests and sources of the crates of the project, and the toolchain
+func (dc *DocChecker) hashInputs() (string, error) {
+	hash := sha256.New()
+
+	if lockfile, err := os.ReadFile(filepath.Join(dc.config.ProjectRoot, "Cargo.lock")); err == nil {
+		fmt.Fprintf(hash, "Cargo.lock\n%s\n", lockfile)
+	}
+
+	crateDirs, err := dc.crateDirs()
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, crateDir := range crateDirs {
+		if err := hashTree(hash, dc.config.ProjectRoot, filepath.Join(crateDir, "Cargo.toml")); err != nil {
+			return "", err
+		}
+
+		if err := hashTree(hash, dc.config.ProjectRoot, filepath.Join(crateDir, "src")); err != nil {
+			return "", err
+		}
+	}
+
+	// e.g. "rustc 1.94.0 (...)\nbinary: rustc\ncommit-hash: ...\nhost: ..."
+	toolchain, err := dc.rustcCommand(dc.tempDir, "-vV").Output()
+
+	if err != nil {
+		return "", fmt.Errorf("failed to get the rustc version: %w", err)
+	}
+
+	hash.Write(toolchain)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashTree writes the relative paths and contents of the files under root
+// (or of the file itself) to the hash, in a stable order
+func hashTree(hash io.Writer, base, root string) error {
+	var files []string
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+
+		if err != nil {
+			return err
+		}
+
+		fileHash := sha256.Sum256(content)
+		fmt.Fprintf(hash, "%s %x\n", relativeTo(base, file), fileHash)
+	}
+
+	return nil
+}
+
+// entry returns the path of the cache entry for the generated code of a snippet
+func (c *resultCache) entry(code string) string {
+	codeHash := sha256.Sum256([]byte(code))
+
+	return filepath.Join(c.dir, hex.EncodeToString(codeHash[:16]))
+}
+
+// passed checks whether the code already compiled successfully with the same inputs
+func (c *resultCache) passed(code string) bool {
+	if c == nil {
+		return false
+	}
+
+	_, err := os.Stat(c.entry(code))
+
+	return err == nil
+}
+
+// store records that the code compiled successfully
+func (c *resultCache) store(code string) {
+	if c == nil {
+		return
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err == nil {
+		_ = os.WriteFile(c.entry(code), nil, 0644)
+	}
+}
+
+// failedEntry returns the path of the cache entry for the compilation error of a
+// snippet binary, whose location is also part of the key, as the error refers to
+// it (e.g. src/bin/README-12.rs:3:5, or README.md:14:5 for the parts of an example)
+func (c *resultCache) failedEntry(location, code string) string {
+	return c.entry(location+"\n"+code) + ".failed"
+}
+
+// failed returns the compilation error of the code at a location (see
+// snippetLocation), if it already failed with the same inputs
+func (c *resultCache) failed(location, code string) (compileError, bool) {
+	var compileErr compileError
+
+	if c == nil {
+		return compileErr, false
+	}
+
+	content, err := os.ReadFile(c.failedEntry(location, code))
+
+	if err != nil || json.Unmarshal(content, &compileErr) != nil {
+		return compileErr, false
+	}
+
+	return compileErr, true
+}
+
+// storeFailure records the compilation error of the code at a location (only
+// the errors of the code itself are to be recorded, see compileError.inSnippet)
+func (c *resultCache) storeFailure(location, code string, compileErr compileError) {
+	if c == nil {
+		return
+	}
+
+	content, err := json.Marshal(compileErr)
+
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err == nil {
+		_ = os.WriteFile(c.failedEntry(location, code), content, 0644)
+	}
+}
+
+// snippetLocation returns the location of a snippet binary: its name,
+// its markdown file (relative to the project root) and its line
+func (dc *DocChecker) snippetLocation(binName string) string {
+	source := dc.manifest[binName]
+
+	return fmt.Sprintf("%s %s:%d", binName, dc.relativePath(source.File), source.StartLine)
+}
+
+// generatedCode returns the code of a snippet binary, as compiled
+// (without the provenance header, which contains the line numbers)
+func (dc *DocChecker) generatedCode(binName string, crate CrateConfig) string {
+	content, err := os.ReadFile(filepath.Join(dc.tempDir, binName+".rs"))
+
+	if err != nil {
+		return ""
+	}
+
+	_, code := splitProvenance(dc.wrapSnippet(string(content), crate, dc.manifest[binName].NoMain))
+
+	// The same code may compile with an edition, but not with another one
+	if edition := dc.manifest[binName].Edition; edition != "" {
+		code = "// edition " + edition + "\n" + code
+	}
+
+	// Nor with another version of its dependencies
+	for _, dep := range dc.manifest[binName].Deps {
+		code = fmt.Sprintf("// dependency %s = %q\n%s", dep.Name, dep.Req, code)
+	}
+
+	return strings.TrimSpace(code)
+}
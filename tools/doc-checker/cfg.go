@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Name of a configuration option (e.g. target_os)
+var rustIdentRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// cfgPredicate is a configuration predicate of the cfg= fence attribute, as
+// in the Rust #[cfg(...)] attributes: an option (e.g. unix), a key-value pair
+// (e.g. target_arch="wasm32"), or all(...), any(...) and not(...)
+type cfgPredicate struct {
+	op    string // all, any, not, or "" for an option
+	name  string
+	value string // Value of a key-value pair (e.g. wasm32), or "" for an option
+	args  []cfgPredicate
+}
+
+// String returns the predicate as written in Rust (e.g. all(unix, target_arch="x86_64"))
+func (p cfgPredicate) String() string {
+	if p.op == "" {
+		if p.value == "" {
+			return p.name
+		}
+
+		return fmt.Sprintf("%s=%q", p.name, p.value)
+	}
+
+	args := make([]string, len(p.args))
+
+	for i, arg := range p.args {
+		args[i] = arg.String()
+	}
+
+	return p.op + "(" + strings.Join(args, ", ") + ")"
+}
+
+// parseCfg parses the predicate of a cfg= attribute, whose values can be
+// quoted or not (e.g. target_arch="wasm32" or target_arch=wasm32)
+func parseCfg(text string) (cfgPredicate, error) {
+	rest, predicate, err := parseCfgPredicate(strings.TrimSpace(text))
+
+	if err == nil && strings.TrimSpace(rest) != "" {
+		err = fmt.Errorf("unexpected '%s'", strings.TrimSpace(rest))
+	}
+
+	if err != nil {
+		return cfgPredicate{}, fmt.Errorf("invalid cfg=%s: %w", text, err)
+	}
+
+	return predicate, nil
+}
+
+// parseCfgPredicate parses the predicate at the start of the text, and returns the text after it
+func parseCfgPredicate(text string) (string, cfgPredicate, error) {
+	text = strings.TrimLeft(text, " ")
+	end := strings.IndexAny(text, "=(), ")
+
+	if end < 0 {
+		end = len(text)
+	}
+
+	name := text[:end]
+	rest := strings.TrimLeft(text[end:], " ")
+
+	if !rustIdentRegex.MatchString(name) {
+		return "", cfgPredicate{}, fmt.Errorf("expected an option (e.g. unix), got '%s'", text)
+	}
+
+	switch {
+	case strings.HasPrefix(rest, "("):
+		if name != "all" && name != "any" && name != "not" {
+			return "", cfgPredicate{}, fmt.Errorf("unknown %s(...), expected all, any or not", name)
+		}
+
+		predicate := cfgPredicate{op: name}
+		rest = strings.TrimLeft(rest[1:], " ")
+
+		for !strings.HasPrefix(rest, ")") {
+			var arg cfgPredicate
+			var err error
+
+			if rest, arg, err = parseCfgPredicate(rest); err != nil {
+				return "", cfgPredicate{}, err
+			}
+
+			predicate.args = append(predicate.args, arg)
+
+			if rest = strings.TrimLeft(rest, " "); strings.HasPrefix(rest, ",") {
+				rest = strings.TrimLeft(rest[1:], " ")
+			} else if !strings.HasPrefix(rest, ")") {
+				return "", cfgPredicate{}, fmt.Errorf("expected ',' or ')' in %s(...)", name)
+			}
+		}
+
+		if name == "not" && len(predicate.args) != 1 {
+			return "", cfgPredicate{}, fmt.Errorf("not(...) takes a single predicate")
+		}
+
+		return rest[1:], predicate, nil
+
+	case strings.HasPrefix(rest, "="):
+		rest = strings.TrimLeft(rest[1:], " ")
+		value := ""
+
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+
+			if end < 0 {
+				return "", cfgPredicate{}, fmt.Errorf("unterminated value of %s", name)
+			}
+
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, "), ")
+
+			if end < 0 {
+				end = len(rest)
+			}
+
+			value, rest = rest[:end], rest[end:]
+		}
+
+		if value == "" {
+			return "", cfgPredicate{}, fmt.Errorf("empty value of %s", name)
+		}
+
+		return rest, cfgPredicate{name: name, value: value}, nil
+	}
+
+	return rest, cfgPredicate{name: name}, nil
+}
+
+// matches evaluates the predicate against a configuration (e.g. the one of the host),
+// given as its options and key-value pairs (e.g. unix and target_os=linux)
+func (p cfgPredicate) matches(cfg map[string]bool) bool {
+	switch p.op {
+	case "all":
+		for _, arg := range p.args {
+			if !arg.matches(cfg) {
+				return false
+			}
+		}
+
+		return true
+
+	case "any":
+		for _, arg := range p.args {
+			if arg.matches(cfg) {
+				return true
+			}
+		}
+
+		return false
+
+	case "not":
+		return !p.args[0].matches(cfg)
+	}
+
+	if p.value == "" {
+		return cfg[p.name]
+	}
+
+	return cfg[p.name+"="+p.value]
+}
+
+// parseRustcCfg parses the output of `rustc --print cfg` (e.g. unix, or
+// target_os="linux"), as the options and key-value pairs of the configuration
+func parseRustcCfg(output string) map[string]bool {
+	cfg := make(map[string]bool)
+
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			cfg[strings.ReplaceAll(line, `"`, "")] = true
+		}
+	}
+
+	return cfg
+}
+
+// goHostCfg returns the main configuration of the host, from the platform
+// of doc-checker, when rustc can't tell it
+func goHostCfg() map[string]bool {
+	arch := map[string]string{"amd64": "x86_64", "arm64": "aarch64", "386": "x86", "arm": "arm", "wasm": "wasm32"}[runtime.GOARCH]
+	targetOS := map[string]string{"darwin": "macos"}[runtime.GOOS]
+
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+
+	if targetOS == "" {
+		targetOS = runtime.GOOS
+	}
+
+	family := "unix"
+
+	if runtime.GOOS == "windows" {
+		family = "windows"
+	}
+
+	return map[string]bool{
+		family:                    true,
+		"target_family=" + family: true,
+		"target_os=" + targetOS:   true,
+		"target_arch=" + arch:     true,
+	}
+}
+
+// hostCfg returns the configuration of the host, which the snippets are
+// compiled for, as given by rustc (loaded on first use)
+func (dc *DocChecker) hostCfg() map[string]bool {
+	if dc.cfg != nil {
+		return dc.cfg
+	}
+
+	output, err := dc.rustcCommand(dc.tempDir, "--print", "cfg").Output()
+
+	if err != nil || strings.TrimSpace(string(output)) == "" {
+		dc.cfg = goHostCfg()
+	} else {
+		dc.cfg = parseRustcCfg(string(output))
+	}
+
+	return dc.cfg
+}
@@ -1,50 +1,129 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type DocChecker struct {
-	config     *Config
-	results    *Results
-	tempDir    string
-	snippetMap map[int]string // maps snippet index to source file path
+	ctx       context.Context // cancels the running cargo commands when done
+	config    *Config
+	results   *Results
+	tempDir   string
+	targetDir string          // cargo target dir of the generated projects, shared by the runs ("" in hermetic mode)
+	workLock  *workLock       // lock of the persistent work directory, held during the run
+	manifest  Manifest        // maps the generated snippets to their source
+	stream    io.Writer       // where the snippet outcomes are streamed, with `-o jsonl`
+	progress  io.Writer       // where the progress is reported, with --progress-json
+	pending   []generatedFile // snippet files not written yet, with --write-batch
+	compiled  int             // snippets whose outcome is known, for the progress
+
+	compilerWarnings map[string][]string         // warnings of the snippets which compiled with some
+	snippetRuns      map[string]SnippetRun       // outcome of the snippets run with --run or --check-output
+	clippyRuns       map[string]cargoDiagnostics // clippy diagnostics of the generated projects, with --clippy
+	clippyLints      map[string][]string         // lints of the snippets which passed with some, with --clippy
+
+	inputsKey string           // hash of the inputs of the compilation, for the result cache
+	snippets  []string         // code of the checked snippets, for the parity report
+	discovery []DiscoveryEntry // why the markdown files are checked or not
+
+	crateVersions   map[string]string // dependency versions of the crates, loaded on first use
+	cfg             map[string]bool   // configuration of the host, for the cfg= attributes, loaded on first use
+	pathCommands    map[string]bool   // commands of the shell blocks, whether found in the PATH
+	cargoHelps      map[string]string // help of the cargo subcommands of the shell blocks, loaded on first use
+	cargoList       []string          // subcommands listed by cargo, nil if it can't be run
+	cargoListLoaded bool
+	links           *blobLinks // GitHub links to the snippets, if on GitHub
+	linksLoaded     bool
+
+	previousProject map[string]string // generated project of the previous run, with --diff-project
+
+	codes         map[string]string // code of the generated snippets, by binary name
+	validSnippets []string          // binary names of the snippets which compiled, for the coverage
+	failures      []BaselineEntry   // failures of the run, for --update-baseline
 }
 
 func NewDocChecker(config *Config) *DocChecker {
+	var stream, progress io.Writer
+
+	if config.OutputFormat == "jsonl" {
+		stream = os.Stdout
+	}
+
+	if config.ProgressJSON {
+		progress = os.Stderr
+	}
+
+	results := newResults()
+	results.Shard = config.Shard
+
 	return &DocChecker{
-		config: config,
-		results: &Results{
-			Summary: Summary{
-				ErrorsByCategory: make(map[string]int),
-			},
-			Files: make(map[string]FileResult),
+		stream:   stream,
+		progress: progress,
+		ctx:      context.Background(),
+		config:   config,
+		results:  results,
+		manifest: make(Manifest),
+
+		compilerWarnings: make(map[string][]string),
+		snippetRuns:      make(map[string]SnippetRun),
+		clippyRuns:       make(map[string]cargoDiagnostics),
+		clippyLints:      make(map[string][]string),
+		codes:            make(map[string]string),
+	}
+}
+
+// newResults returns empty results, with the current schema version
+func newResults() *Results {
+	return &Results{
+		SchemaVersion: schemaVersion,
+		Summary: Summary{
+			ErrorsByCategory: make(map[string]int),
+			ErrorsByCode:     make(map[string]int),
+			IgnoreReasons:    make(map[string]int),
+			WarningsByCode:   make(map[string]int),
 		},
-		snippetMap: make(map[int]string),
+		Files:    make(map[string]FileResult),
+		Warnings: []Warning{},
+		Modes:    make(map[string]ModeResult),
 	}
 }
 
 func (dc *DocChecker) Run() (*Results, error) {
-	// Create temporary directory
-	tempDir, err := os.MkdirTemp("", "doc-checker-*")
+	return dc.RunContext(context.Background())
+}
+
+// RunContext is like Run, but the cargo commands are killed
+// as soon as the given context is cancelled
+func (dc *DocChecker) RunContext(ctx context.Context) (*Results, error) {
+	dc.ctx = ctx
+
+	tempDir, err := dc.prepareWorkDir()
+	defer dc.releaseWorkDir()
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+		return nil, err
 	}
 
 	dc.tempDir = tempDir
 
-	if !dc.config.KeepTempDir {
+	if !dc.keepsWorkDir() {
 		defer os.RemoveAll(tempDir)
 	}
 
 	// Discover files to process
+	dc.emitProgress(ProgressEvent{Phase: phaseDiscover})
+
 	files, err := dc.discoverFiles()
 
 	if err != nil {
@@ -55,23 +134,26 @@ func (dc *DocChecker) Run() (*Results, error) {
 		dc.logInfo("No Markdown files found")
 
 		if dc.config.KeepTempDir {
-			// Print in green color at the end
-			fmt.Printf("\033[1;32m[doc-checker]\033[0m Temporary directory kept: \033[1;36m%s\033[0m\n", tempDir)
+			dc.printKeptDir(tempDir)
 		}
 
+		dc.results.summarizeModes(dc.config)
+
 		return dc.results, nil
 	}
 
 	dc.logInfo(fmt.Sprintf("Found %d Markdown files", len(files)))
 
 	// Process each file
-	for _, file := range files {
-		if err := dc.processFile(file); err != nil {
+	for i, file := range dc.loadFiles(files) {
+		dc.emitProgress(ProgressEvent{Phase: phaseExtract, Done: i, Total: len(files), File: file.path})
+
+		if err := dc.processLoaded(file); err != nil {
 			if dc.config.ExitOnError {
-				return nil, fmt.Errorf("processing file %s: %w", file, err)
+				return nil, fmt.Errorf("processing file %s: %w", file.path, err)
 			}
 
-			dc.logError(fmt.Sprintf("Error processing %s: %v", file, err))
+			dc.logError(fmt.Sprintf("Error processing %s: %v", file.path, err))
 		}
 	}
 
@@ -80,15 +162,316 @@ func (dc *DocChecker) Run() (*Results, error) {
 		return nil, fmt.Errorf("failed to compile snippets: %w", err)
 	}
 
+	if len(dc.config.Toolchains) > 0 {
+		dc.checkToolchains()
+	}
+
+	if len(dc.config.FeaturesMatrix) > 0 {
+		dc.checkFeaturesMatrix()
+	}
+
+	if dc.config.DiffProject {
+		if err := dc.printProjectDiff(); err != nil {
+			return nil, fmt.Errorf("failed to diff the generated project: %w", err)
+		}
+	}
+
+	if dc.config.Parity {
+		parity, err := dc.checkParity(dc.snippets)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to check examples parity: %w", err)
+		}
+
+		dc.results.Parity = parity
+	}
+
+	if dc.config.Coverage {
+		coverage, err := dc.checkCoverage()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to check the examples coverage: %w", err)
+		}
+
+		dc.results.Coverage = coverage
+	}
+
+	if dc.config.UpdateBaseline {
+		if err := dc.writeBaseline(dc.config.Baseline); err != nil {
+			return nil, err
+		}
+	}
+
+	// Written before the work directory is removed, with the generated snippets
+	if dc.config.ReportDir != "" {
+		if err := dc.writeReports(dc.config.ReportDir); err != nil {
+			return nil, fmt.Errorf("failed to write reports: %w", err)
+		}
+	}
+
 	if dc.config.KeepTempDir {
-		// Print in green color at the end
-		fmt.Printf("\033[1;32m[doc-checker]\033[0m Temporary directory kept: \033[1;36m%s\033[0m\n", tempDir)
+		dc.printKeptDir(tempDir)
+	}
+
+	dc.emitProgress(ProgressEvent{Phase: phaseDone, Done: dc.compiled, Total: len(dc.manifest)})
+
+	dc.results.summarizeModes(dc.config)
+
+	return dc.results, nil
+}
+
+// printKeptDir prints the path of the kept temporary directory, in green color
+// (on stderr with the machine-readable output formats)
+func (dc *DocChecker) printKeptDir(tempDir string) {
+	w := os.Stdout
+
+	if dc.config.OutputFormat != "human" {
+		w = os.Stderr
+	}
+
+	fmt.Fprintf(w, "\033[1;32m[doc-checker]\033[0m Temporary directory kept: \033[1;36m%s\033[0m\n", tempDir)
+}
+
+// CheckSnippet compiles a single snippet of code (e.g. received over RPC),
+// reported in the results as a pseudo markdown file
+func (dc *DocChecker) CheckSnippet(ctx context.Context, code string, prelude []string) (*Results, error) {
+	dc.ctx = ctx
+
+	tempDir, err := dc.prepareWorkDir()
+	defer dc.releaseWorkDir()
+
+	if err != nil {
+		return nil, err
+	}
+
+	dc.tempDir = tempDir
+
+	if !dc.keepsWorkDir() {
+		defer os.RemoveAll(tempDir)
+	}
+
+	filePath := "snippet.md"
+	snippet := Snippet{
+		ID:        snippetID(1, false),
+		Content:   code,
+		Prelude:   prelude,
+		StartLine: 1,
+		EndLine:   strings.Count(code, "\n") + 1,
 	}
 
+	dc.results.Summary.FilesProcessed++
+	dc.results.Summary.TotalSnippets++
+	dc.results.Files[filePath] = FileResult{
+		SnippetsFound: 1,
+		Errors:        []string{},
+		Failures:      []Failure{},
+		Snippets:      []SnippetResult{snippetResult(snippet, "unchecked")},
+	}
+
+	if err := dc.writeSnippetFile(filePath, snippet); err != nil {
+		return nil, err
+	}
+
+	if err := dc.compileSnippets(); err != nil {
+		return nil, fmt.Errorf("failed to compile snippet: %w", err)
+	}
+
+	dc.results.summarizeModes(dc.config)
+
 	return dc.results, nil
 }
 
+// prepareWorkDir returns the directory where the snippet project is generated:
+// either a new temporary directory, or the persistent directory of the project
+// for the work key (e.g. work/tnuctipun-1a2b3c4d-ci), so that repeated runs with
+// the same key reuse the project (the target dir being shared by all the runs,
+// see prepareTargetDir); a persistent directory is locked until releaseWorkDir
+func (dc *DocChecker) prepareWorkDir() (string, error) {
+	// Also a directory name in the target dir, so never outside the cache
+	if dc.config.WorkKey != "" && !isValidWorkKey(dc.config.WorkKey) {
+		return "", fmt.Errorf("invalid work key '%s'", dc.config.WorkKey)
+	}
+
+	targetDir, err := dc.prepareTargetDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	dc.targetDir = targetDir
+
+	if dc.config.Hermetic {
+		// Only write in the declared output directory
+		if err := os.MkdirAll(dc.config.OutDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create output directory: %w", err)
+		}
+
+		return dc.config.OutDir, dc.lockWorkDir(dc.config.OutDir)
+	}
+
+	if dc.config.WorkKey == "" {
+		// Create temporary directory
+		tempDir, err := os.MkdirTemp("", "doc-checker-*")
+
+		if err != nil {
+			return "", fmt.Errorf("failed to create temp directory: %w", err)
+		}
+
+		return tempDir, nil
+	}
+
+	cacheDir, err := os.UserCacheDir()
+
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve cache directory: %w", err)
+	}
+
+	// Not shared with the other projects using the same key
+	name, err := projectDirName(dc.config.ProjectRoot)
+
+	if err != nil {
+		return "", err
+	}
+
+	workDir := filepath.Join(cacheDir, "doc-checker", "work", name+"-"+dc.config.WorkKey)
+
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create work directory: %w", err)
+	}
+
+	return workDir, dc.lockWorkDir(workDir)
+}
+
+// lockWorkDir takes the lock of a persistent work directory (waiting for the
+// concurrent run using it, if any), then cleans it for the run
+func (dc *DocChecker) lockWorkDir(workDir string) error {
+	ctx := dc.ctx
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	lock, err := lockWorkDir(ctx, workDir, func() {
+		dc.logInfo(fmt.Sprintf("Waiting for another run using the work directory %s", workDir))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	dc.workLock = lock
+
+	return dc.reuseWorkDir(workDir)
+}
+
+// releaseWorkDir releases the lock of the persistent work directory, if any
+func (dc *DocChecker) releaseWorkDir() {
+	dc.workLock.release()
+	dc.workLock = nil
+}
+
+// keepsWorkDir checks whether the work directory must be kept after the run
+func (dc *DocChecker) keepsWorkDir() bool {
+	return dc.config.KeepTempDir || dc.config.WorkKey != "" || dc.config.Hermetic
+}
+
+// cleanWorkDir removes the snippets of a previous run (but keeps the target dir)
+func cleanWorkDir(workDir string) error {
+	staleFiles, _ := filepath.Glob(filepath.Join(workDir, "*-*.rs"))
+	staleBins, _ := filepath.Glob(filepath.Join(workDir, "test_project*", "src", "bin", "*.rs"))
+
+	for _, file := range append(staleFiles, staleBins...) {
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("failed to clean work directory: %w", err)
+		}
+	}
+
+	return nil
+}
+
 func (dc *DocChecker) discoverFiles() ([]string, error) {
+	files, err := dc.discoverDocFiles()
+
+	if err != nil || !dc.config.Community && !dc.config.Rustdoc {
+		return files, err
+	}
+
+	var extraFiles []string
+
+	if dc.config.Community {
+		communityFiles, err := dc.findCommunityFiles()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to find community files: %w", err)
+		}
+
+		extraFiles = append(extraFiles, communityFiles...)
+	}
+
+	if dc.config.Rustdoc {
+		rustdocFiles, err := dc.findRustdocFiles()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the crate source files: %w", err)
+		}
+
+		extraFiles = append(extraFiles, rustdocFiles...)
+	}
+
+	// Community and source files are possibly already discovered (e.g. from git)
+	known := make(map[string]bool)
+
+	for _, file := range files {
+		if absPath, err := filepath.Abs(file); err == nil {
+			known[absPath] = true
+		}
+	}
+
+	for _, file := range extraFiles {
+		if !known[file] {
+			known[file] = true
+			files = append(files, file)
+		} else {
+			dc.markDuplicate(file)
+		}
+	}
+
+	return files, nil
+}
+
+// findCommunityFiles finds the community documents where small API examples
+// also appear: CONTRIBUTING.md, and the markdown files under .github/
+// (issue and pull request templates, ...)
+func (dc *DocChecker) findCommunityFiles() ([]string, error) {
+	var files []string
+
+	for _, name := range []string{"CONTRIBUTING.md", filepath.Join("docs", "CONTRIBUTING.md")} {
+		path := filepath.Join(dc.config.ProjectRoot, name)
+
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+			dc.noteDiscovery(path, true, discoveryCommunity, "community file")
+		}
+	}
+
+	githubDir := filepath.Join(dc.config.ProjectRoot, ".github")
+
+	if stat, err := os.Stat(githubDir); err != nil || !stat.IsDir() {
+		return files, nil
+	}
+
+	githubFiles, err := dc.findMarkdownFilesInDir(githubDir, discoveryCommunity)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(files, githubFiles...), nil
+}
+
+// discoverDocFiles finds the markdown files, either from the specified paths,
+// or all the ones under git control
+func (dc *DocChecker) discoverDocFiles() ([]string, error) {
 	if len(dc.config.Files) > 0 {
 		// Use specified files
 		var files []string
@@ -101,7 +484,7 @@ func (dc *DocChecker) discoverFiles() ([]string, error) {
 
 			if stat.IsDir() {
 				// If it's a directory, find all .md files recursively
-				dirFiles, err := dc.findMarkdownFilesInDir(path)
+				dirFiles, err := dc.findMarkdownFilesInDir(path, discoveryDirectory)
 
 				if err != nil {
 					return nil, fmt.Errorf("failed to find markdown files in directory %s: %w", path, err)
@@ -111,6 +494,7 @@ func (dc *DocChecker) discoverFiles() ([]string, error) {
 			} else {
 				// If it's a file, add it directly
 				files = append(files, path)
+				dc.noteDiscovery(path, true, discoveryExplicit, "given on the command line")
 			}
 		}
 
@@ -118,29 +502,31 @@ func (dc *DocChecker) discoverFiles() ([]string, error) {
 	}
 
 	// Discover files using git
-	cmd := exec.Command("git", "ls-files", "*.md")
-	cmd.Dir = dc.config.ProjectRoot
-	output, err := cmd.Output()
+	tracked, err := dc.gitFiles(append([]string{"ls-files"}, docFilePatterns...)...)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to list git files (are you in a git repository?): %w", err)
+		return nil, err
 	}
 
 	var files []string
-	scanner := bufio.NewScanner(bytes.NewReader(output))
 
-	for scanner.Scan() {
-		file := strings.TrimSpace(scanner.Text())
+	for _, file := range tracked {
+		path := filepath.Join(dc.config.ProjectRoot, file)
 
-		if file != "" && !strings.HasPrefix(file, "target/") {
-			files = append(files, filepath.Join(dc.config.ProjectRoot, file))
+		if strings.HasPrefix(file, "target/") {
+			dc.noteDiscovery(path, false, discoveryTargetDir, "tracked by git, but under target/")
+		} else if !strings.Contains(file, notebookCheckpoints) {
+			files = append(files, path)
+			dc.noteDiscovery(path, true, discoveryGitTracked, "tracked by git, matches *"+filepath.Ext(file))
 		}
 	}
 
-	return files, scanner.Err()
+	return files, nil
 }
 
-func (dc *DocChecker) findMarkdownFilesInDir(dirPath string) ([]string, error) {
+// findMarkdownFilesInDir finds the markdown files under a directory
+// (except under target/), discovered for the given reason
+func (dc *DocChecker) findMarkdownFilesInDir(dirPath string, reason string) ([]string, error) {
 	var files []string
 
 	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
@@ -148,11 +534,19 @@ func (dc *DocChecker) findMarkdownFilesInDir(dirPath string) ([]string, error) {
 			return err
 		}
 
-		// Skip directories and only process .md files
-		if !info.IsDir() && strings.HasSuffix(strings.ToLower(info.Name()), ".md") {
+		// Skip directories and only process the markdown (AsciiDoc and notebook) files
+		if !info.IsDir() && isDocFile(info.Name()) {
+			// The copies of the notebooks saved by Jupyter are not documents
+			if strings.Contains(path, notebookCheckpoints) {
+				return nil
+			}
+
 			// Skip files in target/ directory
 			if !strings.Contains(path, "/target/") && !strings.Contains(path, "\\target\\") {
 				files = append(files, path)
+				dc.noteDiscovery(path, true, reason, "matches *"+filepath.Ext(info.Name())+" under "+dc.relativePath(dirPath))
+			} else {
+				dc.noteDiscovery(path, false, discoveryTargetDir, "under target/")
 			}
 		}
 
@@ -167,34 +561,44 @@ func (dc *DocChecker) findMarkdownFilesInDir(dirPath string) ([]string, error) {
 }
 
 func (dc *DocChecker) processFile(filePath string) error {
+	return dc.processLoaded(dc.loadFile(filePath))
+}
+
+// processLoaded records the snippets of a loaded markdown file,
+// and generates the ones to compile
+func (dc *DocChecker) processLoaded(file *loadedFile) error {
+	filePath := file.path
+
 	dc.results.Summary.FilesProcessed++
 	dc.logInfo(fmt.Sprintf("Processing: %s", filePath))
 
 	// Initialize file result
 	fileResult := FileResult{
-		Errors: []string{},
+		Errors:   []string{},
+		Failures: []Failure{},
+		Snippets: []SnippetResult{},
 	}
 
-	// Extract Rust code blocks with IDs
-	content, err := os.ReadFile(filePath)
-
-	if err != nil {
-		fileResult.Errors = append(fileResult.Errors, fmt.Sprintf("Failed to read file: %v", err))
+	if file.readErr != nil {
+		fileResult.Errors = append(fileResult.Errors, fmt.Sprintf("Failed to read file: %v", file.readErr))
 		dc.results.Files[filePath] = fileResult
 
-		return err
+		return file.readErr
 	}
 
-	snippets, err := dc.extractRustSnippets(string(content))
-	if err != nil {
-		fileResult.Errors = append(fileResult.Errors, fmt.Sprintf("Failed to extract snippets: %v", err))
+	snippets := file.snippets
+
+	if file.extractErr != nil {
+		fileResult.Errors = append(fileResult.Errors, fmt.Sprintf("Failed to extract snippets: %v", file.extractErr))
 		dc.results.Files[filePath] = fileResult
-		return err
+		return file.extractErr
 	}
 
 	fileResult.SnippetsFound = len(snippets)
 	dc.results.Summary.TotalSnippets += len(snippets)
 
+	dc.lintMarkdown(filePath, file.content, snippets)
+
 	if len(snippets) == 0 {
 		dc.logInfo("  No Rust snippets found")
 		dc.results.Files[filePath] = fileResult
@@ -205,46 +609,95 @@ func (dc *DocChecker) processFile(filePath string) error {
 
 	// Process each snippet individually
 	for idx, snippet := range snippets {
+		// Checked by another shard, with its outcome (e.g. ignored)
+		if !dc.inShard(filePath, snippet) {
+			dc.results.Summary.ShardedSnippets++
+
+			dc.logInfo(fmt.Sprintf("  Skipping snippet %d (other shard than %s)", idx+1, dc.config.Shard))
+			dc.emitSnippet(filePath, snippet, statusOtherShard)
+			fileResult.Snippets = append(fileResult.Snippets, snippetResult(snippet, statusOtherShard))
+			continue
+		}
+
 		// Skip ignored snippets
 		if snippet.Ignore {
+			dc.results.Summary.IgnoredSnippets++
+
+			if snippet.IgnoreReason != "" {
+				dc.results.Summary.IgnoreReasons[snippet.IgnoreReason]++
+			}
+
 			dc.logInfo(fmt.Sprintf("  Skipping ignored snippet %d", idx+1))
+			dc.emitSnippet(filePath, snippet, "ignored")
+			fileResult.Snippets = append(fileResult.Snippets, snippetResult(snippet, "ignored"))
 			continue
 		}
 
-		code := snippet.Content
+		// Skip snippets within a doc-checker:off region
+		if snippet.Skipped {
+			fileResult.SnippetsSkipped++
+			dc.results.Summary.SkippedSnippets++
 
-		// Determine start line of snippet in markdown file, or use index as fallback
-		startLine := dc.findSnippetStartLine(filePath, code, idx)
+			dc.logInfo(fmt.Sprintf("  Skipping snippet %d (doc-checker:off region)", idx+1))
+			dc.emitSnippet(filePath, snippet, "skipped")
+			fileResult.Snippets = append(fileResult.Snippets, snippetResult(snippet, "skipped"))
+			continue
+		}
 
-		// Normalize markdown filename (remove .md, replace / and .)
-		base := filepath.Base(filePath)
-		norm := strings.TrimSuffix(base, ".md")
-		norm = strings.ReplaceAll(norm, ".", "_")
-		norm = strings.ReplaceAll(norm, "-", "_")
+		// Platform-specific, for other hosts (e.g. cfg=windows)
+		if snippet.Cfg != nil && !snippet.Cfg.matches(dc.hostCfg()) {
+			fileResult.SnippetsSkipped++
+			dc.results.Summary.SkippedSnippets++
 
-		snippetFile := filepath.Join(dc.tempDir, fmt.Sprintf("%s-%d.rs", norm, startLine))
+			dc.logInfo(fmt.Sprintf("  Skipping snippet %d (cfg=%s not matching the host)", idx+1, snippet.Cfg))
+			dc.emitSnippet(filePath, snippet, "skipped")
+			fileResult.Snippets = append(fileResult.Snippets, snippetResult(snippet, "skipped"))
+			continue
+		}
 
-		// Create a snippet with just the code (no additional imports)
-		var enhancedSnippet strings.Builder
+		// Not referencing the --api-filter paths
+		if !dc.selectedByAPIFilter(snippet) {
+			dc.results.Summary.FilteredSnippets++
+
+			dc.logInfo(fmt.Sprintf("  Skipping snippet %d (not referencing --api-filter)", idx+1))
+			dc.emitSnippet(filePath, snippet, "filtered")
+			fileResult.Snippets = append(fileResult.Snippets, snippetResult(snippet, "filtered"))
+			continue
+		}
 
-		// Check if the code already has imports
-		hasImports := strings.Contains(code, "use tnuctipun") || strings.Contains(code, "use serde")
+		// Not selected by its identifier
+		if !dc.selectedByFilter(filePath, snippet) {
+			dc.results.Summary.FilteredSnippets++
 
-		if !hasImports {
-			// Add imports only if they don't exist
-			enhancedSnippet.WriteString("use tnuctipun::{FieldWitnesses, MongoComparable, updates};\n")
-			enhancedSnippet.WriteString("use serde::{Deserialize, Serialize};\n\n")
+			dc.logInfo(fmt.Sprintf("  Skipping snippet %d (%s not matching --filter)", idx+1, snippet.ID))
+			dc.emitSnippet(filePath, snippet, "filtered")
+			fileResult.Snippets = append(fileResult.Snippets, snippetResult(snippet, "filtered"))
+			continue
 		}
 
-		// Add the original code as-is
-		enhancedSnippet.WriteString(code)
+		if snippet.Preview {
+			dc.results.Summary.PreviewSnippets++
+		}
 
-		if err := os.WriteFile(snippetFile, []byte(enhancedSnippet.String()), 0644); err != nil {
-			return fmt.Errorf("failed to write snippet file: %w", err)
+		// Unreleased API, so not in the published crate
+		if snippet.Preview && dc.config.AgainstPublished {
+			dc.logInfo(fmt.Sprintf("  Skipping preview snippet %d (--against-published)", idx+1))
+			dc.emitSnippet(filePath, snippet, "preview")
+			fileResult.Snippets = append(fileResult.Snippets, snippetResult(snippet, "preview"))
+			continue
 		}
 
+		// Until its outcome is known
+		fileResult.Snippets = append(fileResult.Snippets, snippetResult(snippet, "unchecked"))
+
+		if err := dc.writeSnippetFile(filePath, snippet); err != nil {
+			return err
+		}
+
+		dc.snippets = append(dc.snippets, snippet.Content)
+
 		if dc.config.Verbose && dc.config.OutputFormat == "human" {
-			dc.showSnippetPreview(code, idx+1)
+			dc.showSnippetPreview(snippet.Content, idx+1)
 		}
 	}
 
@@ -254,225 +707,737 @@ func (dc *DocChecker) processFile(filePath string) error {
 	return nil
 }
 
-// Find the start line of the snippet in the markdown file
-func (dc *DocChecker) findSnippetStartLine(filePath, snippet string, snippetIndex int) int {
-	content, err := os.ReadFile(filePath)
+// writeSnippetFile writes the snippet of the given markdown file
+// to the temporary directory, with the required imports
+func (dc *DocChecker) writeSnippetFile(filePath string, snippet Snippet) error {
+	code := snippet.Content
+	startLine := snippet.StartLine
+
+	crate, err := dc.crate(snippet.Crate)
+
 	if err != nil {
-		return snippetIndex + 1 // Use snippet index as fallback
+		return fmt.Errorf("snippet at line %d: %w", startLine, err)
 	}
 
-	lines := strings.Split(string(content), "\n")
-	snippetLines := strings.Split(snippet, "\n")
-	snippetsFound := 0
+	binName := dc.snippetBinName(filePath, snippet)
+	snippetFile := filepath.Join(dc.tempDir, binName+".rs")
 
-	// Look for the code block that contains this snippet
-	for i := 0; i < len(lines); i++ {
-		line := strings.TrimSpace(lines[i])
+	// Otherwise one of the snippets would silently not be checked
+	if existing, exists := dc.manifest[binName]; exists {
+		return fmt.Errorf("snippet at line %d: binary %s is already the one of the snippet at %s:%d (see --snippet-names)",
+			startLine, binName, dc.relativePath(existing.File), existing.StartLine)
+	}
 
-		// Found a rust code block start
-		if strings.HasPrefix(line, "```rust") || strings.HasPrefix(line, "```rs") {
-			// Check if the content after this marker matches our snippet
-			codeStart := i + 1
+	dc.manifest[binName] = ManifestEntry{
+		File:        filePath,
+		SnippetID:   snippet.ID,
+		StartLine:   snippet.StartLine,
+		EndLine:     snippet.EndLine,
+		Retries:     snippet.Retries,
+		Timeout:     snippet.Timeout,
+		Crate:       crate.Name,
+		CompileFail: snippet.CompileFail,
+		ErrorCodes:  snippet.ErrorCodes,
+		NoRun:       snippet.NoRun,
+		NoMain:      snippet.NoMain,
+		ShouldPanic: snippet.ShouldPanic,
+		Edition:     snippet.Edition,
+		Includes:    snippet.Includes,
+		Deps:        dc.extraDependencies(snippet, crate),
+		Env:         snippet.Env,
+		Parts:       len(snippet.PartLines),
+		Features:    snippet.Features,
+		IgnoreCodes: snippet.IgnoreCodes,
+		Unclosed:    snippet.Unclosed,
+
+		ExpectedOutput: snippet.Expected,
+		ExpectedLine:   snippet.ExpectedLine,
+	}
 
-			if codeStart < len(lines) {
-				// Extract the code block content
-				var codeLines []string
+	dc.codes[binName] = snippet.Content
 
-				for j := codeStart; j < len(lines); j++ {
-					if strings.HasPrefix(strings.TrimSpace(lines[j]), "```") {
-						break
-					}
+	// Create a snippet with just the code (no additional imports)
+	var enhancedSnippet strings.Builder
 
-					codeLines = append(codeLines, lines[j])
-				}
+	enhancedSnippet.WriteString(provenanceHeader(dc.relativePath(filePath), snippet))
 
-				// Compare the extracted code with our snippet
-				if len(codeLines) >= len(snippetLines) {
-					match := true
+	// Check if the code already has imports
+	hasImports := strings.Contains(snippet.Preamble+code, "use "+crate.ident()) || strings.Contains(snippet.Preamble+code, "use serde")
 
-					for k := 0; k < len(snippetLines) && match; k++ {
-						if k < len(codeLines) && strings.TrimSpace(codeLines[k]) != strings.TrimSpace(snippetLines[k]) {
-							match = false
-						}
-					}
+	prelude := crate.Prelude
 
-					if match && snippetsFound == snippetIndex {
-						return i + 1 // Return the line number of the ```rust marker (1-based)
-					}
+	if snippet.Prelude != nil {
+		prelude = snippet.Prelude
+	}
 
-					if match {
-						snippetsFound++
-					}
-				}
-			}
-		}
+	if !hasImports && len(prelude) > 0 {
+		// Add the prelude of the crate only if there are no imports
+		enhancedSnippet.WriteString(strings.Join(prelude, "\n"))
+		enhancedSnippet.WriteString("\n\n")
+	}
+
+	// The earlier snippets it builds on (e.g. the definition of a struct)
+	enhancedSnippet.WriteString(snippet.Preamble)
+
+	if len(snippet.Includes) > 0 {
+		// To locate the errors in the included files
+		entry := dc.manifest[binName]
+		entry.CodeLine = strings.Count(enhancedSnippet.String(), "\n") + 1
+		dc.manifest[binName] = entry
 	}
 
-	// Fallback: use snippet index as line number
-	return snippetIndex + 1
+	// Add the original code as-is
+	enhancedSnippet.WriteString(code)
+
+	if err := dc.writeGenerated(snippetFile, []byte(enhancedSnippet.String())); err != nil {
+		return fmt.Errorf("failed to write snippet file: %w", err)
+	}
+
+	return nil
 }
 
 type Snippet struct {
-	Content string
-	Ignore  bool // If true, this snippet should be ignored during compilation
+	ID           string // Identifier of the snippet within its file (e.g. "auto_1")
+	Content      string
+	Ignore       bool              // If true, this snippet should be ignored during compilation
+	IgnoreReason string            // Why the snippet is ignored (ignore(reason="...") attribute)
+	Preamble     string            // Code of the earlier snippets it builds on (setup snippets, continues= and requires= attributes)
+	Includes     []IncludedLines   // Lines included from files (mdBook {{#include}} and {{#rustdoc_include}}), or of the parts
+	PartLines    []IncludedLines   // Lines of the fences of an example in parts (part=N/M attributes)
+	Skipped      bool              // If true, the snippet is in a region excluded from checking
+	Retries      int               // Number of retries on failure (retries=N attribute)
+	Timeout      int               // Seconds it can run with --run (timeout=SECONDS attribute), or 0 for the default
+	Crate        string            // Documented crate (crate=NAME attribute), or "" for the default one
+	Deps         []Dependency      // Dependencies required by the snippet (deps=... attribute)
+	Env          []string          // Environment variables when run, as NAME=VALUE (env=... attribute)
+	Attrs        map[string]string // key=value attributes of the fence
+	Preview      bool              // Example of an unreleased API (preview attribute)
+	CompileFail  bool              // The compilation is expected to fail (compile_fail attribute)
+	ErrorCodes   []string          // Errors expected with compile_fail (e.g. E0308)
+	NoRun        bool              // Compiled but never run (no_run attribute)
+	NoMain       bool              // Only made of items, not wrapped in a main function (no_main attribute)
+	ShouldPanic  bool              // Expected to panic when run (should_panic attribute)
+	Setup        bool              // Prepended to the later snippets of the file (setup attribute)
+	Edition      string            // Rust edition (editionYYYY attribute), or "" for the default one
+	Features     []string          // Features of the crate enabled for the snippet (features= attribute, or frontmatter of its file)
+	Cfg          *cfgPredicate     // Only checked on the matching hosts (cfg= attribute), if not nil
+	Expected     string            // Output expected when run (text or console block right after the snippet)
+	ExpectedLine int               // Line of the fence of this expected output, or 0 if none
+	Prelude      []string          // Replaces the prelude of the crate if not nil (frontmatter of its file)
+	IgnoreCodes  []string          // Error codes of the failures excluded (frontmatter of its file)
+	Unclosed     bool              // The closing fence is missing, so the content is not compiled
+	StartLine    int               // Line of the opening fence in the markdown file (1-based)
+	EndLine      int               // Line of the closing fence in the markdown file (1-based)
+}
+
+const provenancePrefix = "// source: "
+
+// provenanceHeader returns the comment written at the top of every generated
+// snippet file, to trace it back to the markdown location it comes from
+// (e.g. "// source: docs/guide.md:120-145, id=auto_1").
+func provenanceHeader(relPath string, snippet Snippet) string {
+	return fmt.Sprintf("%s%s:%d-%d, id=%s\n",
+		provenancePrefix, relPath, snippet.StartLine, snippet.EndLine, snippet.ID)
+}
+
+// readProvenance returns the provenance of a generated snippet file
+// (e.g. "source: docs/guide.md:120-145, id=auto_1"), or "" if unknown
+func readProvenance(snippetFile string) string {
+	content, err := os.ReadFile(snippetFile)
+	if err != nil {
+		return ""
+	}
+
+	header, _ := splitProvenance(string(content))
+
+	return strings.TrimPrefix(strings.TrimSpace(header), "// ")
+}
+
+// splitProvenance separates the provenance header (if any) from the rest
+// of a generated snippet file
+func splitProvenance(content string) (header string, code string) {
+	if !strings.HasPrefix(content, provenancePrefix) {
+		return "", content
+	}
+
+	if idx := strings.Index(content, "\n"); idx >= 0 {
+		return content[:idx+1], content[idx+1:]
+	}
+
+	return content, ""
 }
 
-func (dc *DocChecker) extractRustSnippets(content string) ([]Snippet, error) {
+// snippetID returns the identifier of the n-th (1-based) snippet of a file
+func snippetID(n int, ignore bool) string {
+	if ignore {
+		return fmt.Sprintf("ignored_%d", n)
+	}
+
+	return fmt.Sprintf("auto_%d", n)
+}
+
+// Markers of the regions whose snippets must not be checked
+const (
+	skipRegionStart = "<!-- doc-checker:off -->"
+	skipRegionEnd   = "<!-- doc-checker:on -->"
+)
+
+// Language hint of an indented code block (e.g. <!-- lang: rust,ignore -->),
+// with --indented-blocks
+var languageHintRegex = regexp.MustCompile(`^<!--\s*lang:\s*(.*?)\s*-->$`)
+
+// indentedCodeLine returns a line of an indented code block without its indentation
+// (4 spaces or a tab), if it is one
+func indentedCodeLine(line string) (string, bool) {
+	if code, ok := strings.CutPrefix(line, "    "); ok {
+		return code, true
+	}
+
+	return strings.CutPrefix(line, "\t")
+}
+
+// extractRustSnippetsWithIDs extracts the Rust snippets of a markdown file,
+// whose path is the base of the included files (mdBook {{#include}})
+func (dc *DocChecker) extractRustSnippetsWithIDs(filePath string, content string) ([]Snippet, error) {
 	var snippets []Snippet
 
 	lines := strings.Split(content, "\n")
 	inCodeBlock := false
 	isRustBlock := false
 	shouldIgnore := false
+	ignoreReason := ""
+	inSkipRegion := false
 	currentSnippet := []string{}
+	startLine := 0
+	retries := 0
+	timeout := 0
+	crate := ""
+
+	var deps []Dependency
+	var env []string
+	var attrs map[string]string
+	preview := false
+	compileFail := false
+	var errorCodes []string
+	noRun := false
+	noMain := false
+	shouldPanic := false
+	setup := false
+	unclosed := false
+	edition := ""
+	var features []string
+	var cfg *cfgPredicate
+	var err error
+	var settings FileSettings
+
+	// Settings of the snippets of a markdown file, from its frontmatter
+	if strings.HasSuffix(filePath, ".md") {
+		if settings, err = parseFrontmatter(content); err != nil {
+			return nil, err
+		}
+	}
 
-	for _, line := range lines {
-		if strings.HasPrefix(line, "```") {
+	addSnippet := func(endLine int) {
+		if !isRustBlock || len(currentSnippet) == 0 {
+			return
+		}
+
+		// Filter out empty lines and markdown content
+		filteredSnippet := dc.filterSnippetContent(currentSnippet)
+		ignore, reason := shouldIgnore, ignoreReason
+		snippetFeatures := settings.Features
+
+		// The features of the snippet replace the ones of its file
+		if features != nil {
+			snippetFeatures = features
+		}
+
+		if !ignore && settings.Ignore {
+			ignore, reason = true, settings.IgnoreReason
+		}
+
+		if len(filteredSnippet) > 0 {
+			snippets = append(snippets, Snippet{
+				ID:           snippetID(len(snippets)+1, ignore),
+				Content:      strings.Join(filteredSnippet, "\n"),
+				Ignore:       ignore,
+				IgnoreReason: reason,
+				Skipped:      inSkipRegion,
+				Retries:      retries,
+				Timeout:      timeout,
+				Crate:        crate,
+				Deps:         deps,
+				Env:          env,
+				Attrs:        attrs,
+				Preview:      preview,
+				CompileFail:  compileFail,
+				ErrorCodes:   errorCodes,
+				NoRun:        noRun,
+				NoMain:       noMain,
+				ShouldPanic:  shouldPanic,
+				Setup:        setup,
+				Edition:      edition,
+				Features:     snippetFeatures,
+				Cfg:          cfg,
+				Prelude:      settings.Prelude,
+				IgnoreCodes:  settings.IgnoreCodes,
+				Unclosed:     unclosed,
+				StartLine:    startLine,
+				EndLine:      endLine,
+			})
+		}
+	}
+
+	var opening codeFence
+
+	// Indented code block with a language hint (--indented-blocks)
+	hinted := false
+	inIndentedBlock := false
+	indentedEnd := 0  // Last line of code of the block
+	indentedCode := 0 // Number of lines up to this last line of code
+
+	startBlock := func(fence FenceInfo, line int) error {
+		isRustBlock = fence.isRust(dc.rustAliases())
+		shouldIgnore = fence.Ignore
+		ignoreReason = fence.IgnoreReason
+		crate = fence.crate()
+		attrs = fence.Attrs
+		preview = fence.Preview
+		compileFail = fence.CompileFail
+		errorCodes = fence.ErrorCodes
+		noRun = fence.NoRun
+		noMain = fence.NoMain
+		shouldPanic = fence.ShouldPanic
+		setup = fence.Setup
+		unclosed = false
+
+		if retries, err = fence.retries(); isRustBlock && err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if timeout, err = fence.timeout(); isRustBlock && err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if deps, err = fence.deps(); isRustBlock && err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if env, err = fence.env(); isRustBlock && err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if edition, err = fence.edition(); isRustBlock && err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if features, err = fence.features(); isRustBlock && err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if cfg, err = fence.cfg(); isRustBlock && err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		currentSnippet = []string{}
+
+		return nil
+	}
+
+	endIndentedBlock := func() {
+		inIndentedBlock = false
+		// Without the blank lines after the code
+		currentSnippet = currentSnippet[:indentedCode]
+
+		addSnippet(indentedEnd)
+
+		currentSnippet = []string{}
+		isRustBlock = false
+		shouldIgnore = false
+	}
+
+	for i, line := range lines {
+		if inIndentedBlock {
+			if code, indented := indentedCodeLine(line); indented || strings.TrimSpace(line) == "" {
+				currentSnippet = append(currentSnippet, code)
+
+				if strings.TrimSpace(line) != "" {
+					indentedEnd = i + 1
+					indentedCode = len(currentSnippet)
+				}
+
+				continue
+			}
+
+			endIndentedBlock()
+		}
+
+		if hinted && !inCodeBlock {
+			if code, indented := indentedCodeLine(line); indented && strings.TrimSpace(line) != "" {
+				hinted = false
+				inIndentedBlock = true
+				currentSnippet = append(currentSnippet, code)
+				indentedEnd = i + 1
+				indentedCode = len(currentSnippet)
+
+				continue
+			}
+
+			// The hint only applies to the block right after it
+			if strings.TrimSpace(line) != "" {
+				hinted = false
+			}
+		}
+
+		// Unclosed block, ending before the next one (reported by lintMarkdown)
+		if inCodeBlock && opening.interruptedBy(line) {
+			inCodeBlock = false
+			unclosed = true
+
+			addSnippet(i)
+
+			currentSnippet = []string{}
+			isRustBlock = false
+			shouldIgnore = false
+		}
+
+		codeFence, isFence := parseCodeFence(line)
+
+		if isFence && (!inCodeBlock || opening.closedBy(line)) {
 			if !inCodeBlock {
 				// Starting a code block
 				inCodeBlock = true
-				codeBlockHeader := strings.TrimPrefix(line, "```")
-				codeBlockHeader = strings.TrimSpace(codeBlockHeader)
+				opening = codeFence
+				startLine = i + 1
 
-				// Parse language and attributes: "rust", "rust:ignore", "rs", "rs:ignore"
+				// Parse language and attributes: "rust", "rust:ignore", "rs", "rust,retries=3"...
+				if err := startBlock(parseFenceInfo(codeFence.info), i+1); err != nil {
+					return nil, err
+				}
+			} else {
+				// Ending a code block
+				inCodeBlock = false
+
+				addSnippet(i + 1)
+
+				currentSnippet = []string{}
 				isRustBlock = false
 				shouldIgnore = false
+			}
+		} else if inCodeBlock && isRustBlock {
+			currentSnippet = append(currentSnippet, opening.content(line))
+		} else if !inCodeBlock {
+			trimmed := strings.TrimSpace(line)
+
+			switch trimmed {
+			case skipRegionStart:
+				inSkipRegion = true
+			case skipRegionEnd:
+				inSkipRegion = false
+			}
+
+			if match := languageHintRegex.FindStringSubmatch(trimmed); match != nil && dc.config.IndentedBlocks {
+				hinted = true
+				startLine = i + 1
+
+				if err := startBlock(parseFenceInfo(match[1]), i+1); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// Handle case where file ends without closing code block
+	if inCodeBlock {
+		unclosed = true
+
+		addSnippet(len(lines))
+	}
+
+	if inIndentedBlock {
+		endIndentedBlock()
+	}
+
+	if snippets, err = dc.joinSnippetParts(filePath, snippets); err != nil {
+		return nil, err
+	}
+
+	// Output expected from the snippets (--check-output)
+	for i := range snippets {
+		snippets[i].Expected, snippets[i].ExpectedLine = expectedOutput(lines, snippets[i].EndLine)
+	}
+
+	if snippets, err = dc.resolveIncludes(snippets, filepath.Dir(filePath)); err != nil {
+		return nil, err
+	}
+
+	return resolveSnippetRefs(snippets)
+}
+
+// filterSnippetContent applies the rustdoc convention of the hidden lines,
+// compiled but not rendered: "# " and "#" lines are code without the marker,
+// and "##" escapes a line starting with "#" (while "#[" and "#!" are attributes).
+// The lines are kept one for one, so the errors still map to the markdown lines.
+func (dc *DocChecker) filterSnippetContent(lines []string) []string {
+	filtered := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "#":
+			line = ""
+
+		case strings.HasPrefix(trimmed, "# "):
+			line = trimmed[2:]
+
+		case strings.HasPrefix(trimmed, "##"):
+			line = trimmed[1:]
+		}
+
+		filtered = append(filtered, line)
+	}
+
+	return filtered
+}
+
+func (dc *DocChecker) showSnippetPreview(snippet string, snippetNum int) {
+	lines := strings.Split(snippet, "\n")
+
+	fmt.Printf("    Snippet %d preview:\n", snippetNum)
+
+	previewLines := 3
+
+	if len(lines) < previewLines {
+		previewLines = len(lines)
+	}
+
+	for i := 0; i < previewLines; i++ {
+		fmt.Printf("      %s\n", lines[i])
+	}
+
+	if len(lines) > 3 {
+		fmt.Println("      ...")
+	}
+
+	fmt.Println()
+}
+
+func (dc *DocChecker) compileSnippets() error {
+	if err := dc.flushGenerated(); err != nil {
+		return err
+	}
+
+	// Find all snippet files, from the manifest
+	var snippetFiles []string
+
+	for _, binName := range dc.manifest.binNames() {
+		snippetFiles = append(snippetFiles, filepath.Join(dc.tempDir, binName+".rs"))
+	}
+
+	if len(snippetFiles) == 0 {
+		return nil
+	}
+
+	if err := dc.manifest.save(dc.tempDir); err != nil {
+		return err
+	}
+
+	dc.logInfo(fmt.Sprintf("Compiling %d snippets...", len(snippetFiles)))
+
+	dc.checkToolchain(dc.tempDir)
+
+	// A Cargo project per documented crate, with its path dependency
+	groups := dc.manifest.byCrate()
+
+	for i, crate := range dc.crates() {
+		// And per set of features of the crate
+		for _, group := range dc.manifest.byFeatures(groups[crate.Name]) {
+			crate.Features = dc.manifest[group[0]].Features
+
+			if err := dc.compileCrateSnippets(dc.projectDir(i, crate), crate, group); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// projectDir returns the directory of the Cargo project generated
+// for the snippets of the i-th documented crate
+func (dc *DocChecker) projectDir(i int, crate CrateConfig) string {
+	projectDir := filepath.Join(dc.tempDir, "test_project")
+
+	if i > 0 {
+		projectDir += "_" + crate.ident()
+	}
 
-				if codeBlockHeader == "rust" || codeBlockHeader == "rs" {
-					isRustBlock = true
-				} else if codeBlockHeader == "rust:ignore" || codeBlockHeader == "rs:ignore" {
-					isRustBlock = true
-					shouldIgnore = true
-				}
+	// e.g. test_project_features_chrono
+	if len(crate.Features) > 0 {
+		projectDir += "_features_" + featureSuffixRegex.ReplaceAllString(strings.Join(crate.Features, "_"), "_")
+	}
 
-				currentSnippet = []string{}
-			} else {
-				// Ending a code block
-				inCodeBlock = false
+	return projectDir
+}
 
-				if isRustBlock && len(currentSnippet) > 0 {
-					// Filter out empty lines and markdown content
-					filteredSnippet := dc.filterSnippetContent(currentSnippet)
+// compileCrateSnippets checks the snippets targeting a documented crate
+func (dc *DocChecker) compileCrateSnippets(projectDir string, crate CrateConfig, binNames []string) error {
+	cache := dc.openCache(crate)
+	uncached := []string{}
+	compileFail := []string{}
 
-					if len(filteredSnippet) > 0 {
-						snippets = append(snippets, Snippet{
-							Content: strings.Join(filteredSnippet, "\n"),
-							Ignore:  shouldIgnore,
-						})
-					}
-				}
+	for _, binName := range binNames {
+		// Not compiled, as the block may have swallowed the rest of the file
+		if failure := dc.unclosedFence(binName); failure != nil {
+			dc.recordFailure(*failure, 0, 0)
+			dc.logError(fmt.Sprintf("Malformed markdown for %s: %s", dc.snippetName(binName), failure.Message))
 
-				currentSnippet = []string{}
-				isRustBlock = false
-				shouldIgnore = false
-			}
-		} else if inCodeBlock && isRustBlock {
-			currentSnippet = append(currentSnippet, line)
+			continue
 		}
-	}
 
-	// Handle case where file ends without closing code block
-	if inCodeBlock && isRustBlock && len(currentSnippet) > 0 {
-		filteredSnippet := dc.filterSnippetContent(currentSnippet)
+		// Reported at once, without compiling
+		if failure := dc.precheckSyntax(binName); failure != nil {
+			dc.recordFailure(*failure, 0, 0)
+			dc.logError(fmt.Sprintf("Syntax error in %s: %s", dc.snippetName(binName), failure.Message))
 
-		if len(filteredSnippet) > 0 {
-			snippets = append(snippets, Snippet{
-				Content: strings.Join(filteredSnippet, "\n"),
-				Ignore:  shouldIgnore,
-			})
+			continue
 		}
-	}
 
-	return snippets, nil
-}
+		// Not cached, as their outcome depends on the expected error codes
+		if dc.manifest[binName].CompileFail {
+			compileFail = append(compileFail, binName)
+			continue
+		}
 
-func (dc *DocChecker) filterSnippetContent(lines []string) []string {
-	var filtered []string
+		// Run (or linted) again with --run, --check-output or --clippy, as the cache only records that they compiled
+		if dc.runsSnippet(binName) || dc.config.Clippy {
+			uncached = append(uncached, binName)
+			continue
+		}
 
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
+		code := dc.generatedCode(binName, crate)
+
+		if cache.passed(code) {
+			dc.results.Summary.CacheHits++
+			dc.markValid(binName)
+			dc.recordAttempts(binName, 0, true)
+			dc.completeSnippet(binName, "valid", 0, 0, nil)
 
-		// Skip markdown headers that somehow got included, but preserve Rust attributes
-		if strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, "#[") {
 			continue
 		}
 
-		// Include all other lines - if it's in a rust fence, it should be rust code
-		filtered = append(filtered, line)
-	}
+		// Failed the same way as in the previous run
+		if compileErr, failed := cache.failed(dc.snippetLocation(binName), code); failed {
+			dc.results.Summary.CacheHits++
+			dc.recordAttempts(binName, 0, false)
 
-	return filtered
-}
+			if err := dc.reportCompileError(binName, compileErr, 0, 0); err != nil {
+				return err
+			}
 
-func (dc *DocChecker) showSnippetPreview(snippet string, snippetNum int) {
-	lines := strings.Split(snippet, "\n")
+			continue
+		}
 
-	fmt.Printf("    Snippet %d preview:\n", snippetNum)
+		if cache != nil {
+			dc.results.Summary.CacheMisses++
+		}
 
-	previewLines := 3
+		uncached = append(uncached, binName)
+	}
 
-	if len(lines) < previewLines {
-		previewLines = len(lines)
+	if len(uncached) == 0 && len(compileFail) == 0 {
+		dc.logSuccess(fmt.Sprintf("All snippets for %s are unchanged since they were checked", crate.Name))
+		return nil
 	}
 
-	for i := 0; i < previewLines; i++ {
-		fmt.Printf("      %s\n", lines[i])
+	if err := dc.createCargoProject(projectDir, crate, dc.snippetFiles(append(uncached, compileFail...))); err != nil {
+		return fmt.Errorf("failed to create cargo project: %w", err)
 	}
 
-	if len(lines) > 3 {
-		fmt.Println("      ...")
+	if len(uncached) > 0 {
+		if err := dc.compilePassingSnippets(projectDir, crate, uncached, len(compileFail) > 0, cache); err != nil {
+			return err
+		}
 	}
 
-	fmt.Println()
-}
+	if len(compileFail) == 0 {
+		return nil
+	}
 
-func (dc *DocChecker) compileSnippets() error {
-	// Find all snippet files - updated pattern to match new naming convention
-	snippetFiles, err := filepath.Glob(filepath.Join(dc.tempDir, "*-*.rs"))
+	// Checked one by one, as each one must fail on its own
+	dc.logInfo(fmt.Sprintf("Checking the %d compile_fail snippet(s) for %s...", len(compileFail), crate.Name))
 
-	if err != nil {
-		return fmt.Errorf("failed to find snippet files: %w", err)
-	}
+	return dc.compileIndividually(projectDir, dc.snippetFiles(compileFail), func(string) {}, func(string, compileError) {})
+}
 
-	if len(snippetFiles) == 0 {
-		return nil
+// snippetFiles returns the generated files of the snippet binaries
+func (dc *DocChecker) snippetFiles(binNames []string) []string {
+	var snippetFiles []string
+
+	for _, binName := range binNames {
+		snippetFiles = append(snippetFiles, filepath.Join(dc.tempDir, binName+".rs"))
 	}
 
-	dc.logInfo(fmt.Sprintf("Compiling %d snippets...", len(snippetFiles)))
+	return snippetFiles
+}
 
-	// Create Cargo project
+// compilePassingSnippets checks the snippets expected to compile: all at once,
+// then one by one if some fail (only these binaries of the project with onlyBins,
+// e.g. when it also contains compile_fail snippets)
+func (dc *DocChecker) compilePassingSnippets(projectDir string, crate CrateConfig, binNames []string, onlyBins bool, cache *resultCache) error {
+	snippetFiles := dc.snippetFiles(binNames)
+	var bins []string
 
-	projectDir := filepath.Join(dc.tempDir, "test_project")
-	if err := dc.createCargoProject(projectDir, snippetFiles); err != nil {
-		return fmt.Errorf("failed to create cargo project: %w", err)
+	if onlyBins {
+		bins = binNames
 	}
 
 	// Try workspace compilation first
-	if dc.compileWorkspace(projectDir) {
-		dc.logSuccess("All snippets compiled successfully")
+	dc.emitProgress(ProgressEvent{Phase: phaseCompile, Done: dc.compiled, Total: len(dc.manifest)})
+
+	onValid := func(binName string) {
+		cache.store(dc.generatedCode(binName, crate))
+	}
 
-		dc.results.Summary.ValidSnippets = len(snippetFiles)
+	// Unless the failure is due to the cancellation of the run, or not due to
+	// the snippet (e.g. a dependency which could not be resolved)
+	onFailed := func(binName string, compileErr compileError) {
+		if compileErr.inSnippet && dc.ctx.Err() == nil {
+			cache.storeFailure(dc.snippetLocation(binName), dc.generatedCode(binName, crate), compileErr)
+		}
+	}
 
-		dc.updateAllFilesSuccess()
+	if compiled, diagnostics := dc.compileWorkspace(projectDir, bins); compiled {
+		dc.logSuccess(fmt.Sprintf("All snippets for %s compiled successfully", crate.Name))
+
+		for _, binName := range binNames {
+			dc.completeCompiled(projectDir, binName, 0, diagnostics.Warnings(binName), onValid)
+		}
 
 		return nil
 	}
 
 	if dc.config.QuickMode {
-		dc.results.Summary.FailedSnippets = len(snippetFiles)
+		dc.results.Summary.FailedSnippets += len(snippetFiles)
 
 		dc.logWarning("Quick mode: Some snippets failed compilation")
 
+		// Which ones is not known, as they are not checked individually
+		for _, binName := range binNames {
+			dc.completeSnippet(binName, "unchecked", 0, 0, nil)
+		}
+
 		return nil
 	}
 
 	// Fall back to individual compilation
 	dc.logWarning("Some snippets failed, checking individually...")
 
-	return dc.compileIndividually(projectDir, snippetFiles)
+	return dc.compileIndividually(projectDir, snippetFiles, onValid, onFailed)
 }
 
-func (dc *DocChecker) createCargoProject(projectDir string, snippetFiles []string) error {
+func (dc *DocChecker) createCargoProject(projectDir string, crate CrateConfig, snippetFiles []string) error {
 	if err := os.MkdirAll(filepath.Join(projectDir, "src", "bin"), 0755); err != nil {
 		return fmt.Errorf("failed to create project structure: %w", err)
 	}
@@ -490,6 +1455,11 @@ func (dc *DocChecker) createCargoProject(projectDir string, snippetFiles []strin
 name = "%s"
 path = "src/bin/%s.rs"
 `, binName, binName))
+
+		// The edition of a target overrides the one of the package
+		if edition := dc.manifest[binName].Edition; edition != "" {
+			binDeclarations.WriteString(fmt.Sprintf("edition = \"%s\"\n", edition))
+		}
 	}
 
 	// Extract dependency versions from main project Cargo.toml
@@ -499,14 +1469,23 @@ path = "src/bin/%s.rs"
 		return fmt.Errorf("failed to extract dependency versions: %w", err)
 	}
 
+	crateDependency, err := dc.crateDependency(crate)
+
+	if err != nil {
+		return err
+	}
+
+	// Only the ones requested by these snippets
+	dependencies += dc.snippetDependencies(crate, snippetFiles)
+
 	cargoToml := fmt.Sprintf(`[package]
 name = "doc_snippet_test"
 version = "0.1.0"
 edition = "2021"
 
 [dependencies]
-tnuctipun = { path = "%s" }
-%s%s`, dc.config.ProjectRoot, dependencies, binDeclarations.String())
+%s = %s
+%s%s`, crate.Name, crateDependency, dependencies, binDeclarations.String())
 
 	// Write Cargo.toml to both projectDir and tempDir if KeepTempDir is set
 	cargoTomlPath := filepath.Join(projectDir, "Cargo.toml")
@@ -515,6 +1494,12 @@ tnuctipun = { path = "%s" }
 		return fmt.Errorf("failed to write Cargo.toml: %w", err)
 	}
 
+	if dc.config.Hermetic {
+		if err := dc.writeCargoConfig(projectDir); err != nil {
+			return err
+		}
+	}
+
 	if dc.config.KeepTempDir {
 		// Also keep a copy in the tempDir root for investigation
 		_ = os.WriteFile(filepath.Join(dc.tempDir, "Cargo.toml"), []byte(cargoToml), 0644)
@@ -531,7 +1516,7 @@ tnuctipun = { path = "%s" }
 		// Use the same naming logic as in binary declarations
 		baseName := filepath.Base(snippetFile)
 		binName := strings.TrimSuffix(baseName, ".rs") // Remove .rs extension for consistency
-		binContent := dc.wrapSnippet(string(snippet))
+		binContent := dc.wrapSnippet(string(snippet), crate, dc.manifest[binName].NoMain)
 		binPath := filepath.Join(projectDir, "src", "bin", binName+".rs") // Add .rs extension to file path
 
 		if err := os.WriteFile(binPath, []byte(binContent), 0644); err != nil {
@@ -542,6 +1527,17 @@ tnuctipun = { path = "%s" }
 	return nil
 }
 
+// Dependencies we need for testing, with fallback versions
+var testDependencies = map[string]string{
+	"bson":        `"2.15.0"`, // fallback version
+	"serde":       `"1.0"`,    // fallback version (will be overridden with features)
+	"mongodb":     `"3.0.0"`,  // testing-specific, reasonable version
+	"tokio":       `"1.47.1"`, // testing-specific, reasonable version
+	"chrono":      `"0.4"`,    // fallback version
+	"async-trait": `"0.1"`,    // testing-specific, reasonable version
+	"uuid":        `"1.17.0"`, // testing-specific, extracted from Cargo.lock
+}
+
 // extractDependencyVersions reads the main Cargo.toml and extracts dependency versions
 func (dc *DocChecker) extractDependencyVersions() (string, error) {
 	cargoTomlPath := filepath.Join(dc.config.ProjectRoot, "Cargo.toml")
@@ -554,15 +1550,10 @@ func (dc *DocChecker) extractDependencyVersions() (string, error) {
 	lines := strings.Split(string(content), "\n")
 	var dependencies strings.Builder
 
-	// Dependencies we need for testing, with fallback versions
-	neededDeps := map[string]string{
-		"bson":        `"2.15.0"`, // fallback version
-		"serde":       `"1.0"`,    // fallback version (will be overridden with features)
-		"mongodb":     `"3.0.0"`,  // testing-specific, reasonable version
-		"tokio":       `"1.47.1"`, // testing-specific, reasonable version
-		"chrono":      `"0.4"`,    // fallback version
-		"async-trait": `"0.1"`,    // testing-specific, reasonable version
-		"uuid":        `"1.17.0"`, // testing-specific, extracted from Cargo.lock
+	neededDeps := make(map[string]string, len(testDependencies))
+
+	for dep, version := range testDependencies {
+		neededDeps[dep] = version
 	}
 
 	// Parse main Cargo.toml to find actual versions
@@ -619,8 +1610,18 @@ func (dc *DocChecker) extractDependencyVersions() (string, error) {
 		}
 	}
 
-	// Build the dependencies string
-	for dep, version := range neededDeps {
+	// Build the dependencies string, in a stable order (the result cache depends on it)
+	depNames := make([]string, 0, len(neededDeps))
+
+	for dep := range neededDeps {
+		depNames = append(depNames, dep)
+	}
+
+	sort.Strings(depNames)
+
+	for _, dep := range depNames {
+		version := neededDeps[dep]
+
 		switch dep {
 		case "serde":
 			dependencies.WriteString(fmt.Sprintf("serde = { version = %s, features = [\"derive\"] }\n", version))
@@ -638,12 +1639,25 @@ func (dc *DocChecker) extractDependencyVersions() (string, error) {
 	return dependencies.String(), nil
 }
 
-func (dc *DocChecker) wrapSnippet(snippet string) string {
+// wrapSnippet returns the code of the binary of a snippet: within an async main
+// function, unless it has its own, or it's only made of items (no_main), then
+// compiled as is, before an empty main function
+func (dc *DocChecker) wrapSnippet(content string, crate CrateConfig, noMain bool) string {
+	// Keep the provenance header at the top of the generated file
+	header, snippet := splitProvenance(content)
+
+	// As rustdoc, not to warn about what an example doesn't use (e.g. the imports)
 	if strings.Contains(snippet, "fn main") {
-		return snippet
+		return header + "#![allow(unused)]\n" + snippet
+	}
+
+	// Only a glob import, which the imports of the snippet shadow (unlike other imports)
+	if noMain {
+		return header + fmt.Sprintf("#![allow(unused)]\nuse %s::*;\n\n%s\n\nfn main() {}\n", crate.ident(), snippet)
 	}
 
-	return fmt.Sprintf(`use tnuctipun::*;
+	return header + fmt.Sprintf(`#![allow(unused)]
+use %s::*;
 use bson::{doc, Document};
 use serde::{Deserialize, Serialize};
 
@@ -651,24 +1665,37 @@ use serde::{Deserialize, Serialize};
 async fn main() -> Result<(), Box<dyn std::error::Error>> {
 %s
 	Ok(())
-}`, snippet)
+}`, crate.ident(), snippet)
 }
 
-func (dc *DocChecker) compileWorkspace(projectDir string) bool {
-	cmd := exec.Command("cargo", "check", "--workspace")
-	cmd.Dir = projectDir
+// compileWorkspace checks all the binaries of the project at once (or only the given ones),
+// and returns the compiler diagnostics (e.g. the warnings of the binaries)
+func (dc *DocChecker) compileWorkspace(projectDir string, bins []string) (bool, cargoDiagnostics) {
+	args := []string{"check", "--workspace"}
+
+	if len(bins) > 0 {
+		args = []string{"check"}
+
+		for _, bin := range bins {
+			args = append(args, "--bin", bin)
+		}
+	}
+
+	cmd := dc.projectCargoCommand(projectDir, append(append(args, "--message-format=json"), dc.cargoJobs()...)...)
 
 	output, err := cmd.CombinedOutput()
+	diagnostics := parseCargoDiagnostics(output)
+	diagnostics.Failed = err != nil
 
 	if err != nil {
-		if dc.config.Verbose {
-			fmt.Printf("Workspace compilation failed:\n%s\n", string(output))
+		if dc.config.Verbose && dc.config.OutputFormat == "human" {
+			fmt.Printf("Workspace compilation failed:\n%s\n", diagnostics.Rendered())
 		}
 
-		return false
+		return false, diagnostics
 	}
 
-	return true
+	return true, diagnostics
 }
 
 func (dc *DocChecker) categorizeError(errorOutput string) string {
@@ -695,65 +1722,91 @@ func (dc *DocChecker) categorizeError(errorOutput string) string {
 	return "COMPILATION_ERROR"
 }
 
-func (dc *DocChecker) compileIndividually(projectDir string, snippetFiles []string) error {
+// compileError is the error of a snippet which failed to compile, as cached
+type compileError struct {
+	Category    string       `json:"category"`
+	Log         string       `json:"log"`     // Output of the compiler
+	Message     string       `json:"message"` // With the errors in the included files, not truncated
+	Codes       []string     `json:"codes,omitempty"`
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+
+	// Whether the compiler reported errors in the code of the snippet itself, so
+	// the failure is the same with the same inputs (not a failure of cargo, e.g.
+	// to resolve the dependencies)
+	inSnippet bool
+
+	// Whether cargo failed without any error of the compiler for the snippet
+	// (e.g. "no matching package named `bson` found")
+	environment bool
+}
+
+// compileIndividually checks the snippets one by one, calling onValid for each
+// valid one, and onFailed for each one failing to compile
+func (dc *DocChecker) compileIndividually(projectDir string, snippetFiles []string, onValid func(binName string), onFailed func(binName string, compileErr compileError)) error {
+	var binNames []string
+
 	for _, snippetFile := range snippetFiles {
 		// Use the same name pattern as in createCargoProject
-		baseName := filepath.Base(snippetFile)
-		binName := strings.TrimSuffix(baseName, ".rs")
+		binNames = append(binNames, strings.TrimSuffix(filepath.Base(snippetFile), ".rs"))
+	}
 
-		cmd := exec.Command("cargo", "check", "--bin", binName, "--quiet")
-		cmd.Dir = projectDir
+	// Checked concurrently with --jobs, but reported in order
+	checks, stop := dc.checkSnippets(projectDir, binNames)
+	defer stop()
 
-		if cmd.Run() == nil {
-			dc.results.Summary.ValidSnippets++
+	for i, snippetFile := range snippetFiles {
+		binName := binNames[i]
+		source := dc.manifest[binName]
 
-			// Find the original markdown file for this snippet
-			originalFile := dc.getOriginalFileFromSnippet(baseName)
+		dc.emitCompileProgress(binName)
 
-			if originalFile != "" {
-				// Update the file result with success
-				if result, exists := dc.results.Files[originalFile]; exists {
-					result.SnippetsValid++
+		check := <-checks[i]
+		passed, diagnostics, duration := check.passed, check.diagnostics, check.duration
 
-					dc.results.Files[originalFile] = result
-				}
+		if passed {
+			var warnings []string
+
+			if !source.CompileFail {
+				warnings = diagnostics.Warnings(binName)
 			}
-		} else {
-			dc.results.Summary.FailedSnippets++
 
-			// Get detailed error for reporting
-			errorCmd := exec.Command("cargo", "check", "--bin", binName)
-			errorCmd.Dir = projectDir
-			errorOutput, _ := errorCmd.CombinedOutput()
+			dc.completeCompiled(projectDir, binName, duration, warnings, onValid)
+		} else {
+			dc.recordAttempts(binName, 1, false)
 
-			// Categorize the error
-			errorStr := string(errorOutput)
-			errorCategory := dc.categorizeError(errorStr)
-			dc.results.Summary.ErrorsByCategory[errorCategory]++
+			compileErr := compileError{
+				Codes:       diagnostics.ErrorCodes(),
+				Suggestions: dc.markdownSuggestions(source, binName, snippetFile, diagnostics.Suggestions()),
+				inSnippet:   diagnostics.failedInSnippet(binName),
+				environment: diagnostics.failedBeforeCompiling(binName),
+			}
 
-			if len(errorStr) > 500 {
-				errorStr = errorStr[:500] + "... (truncated)"
+			if source.CompileFail {
+				compileErr.Log = diagnostics.compileFailError(source.ErrorCodes)
+				compileErr.Category = "COMPILE_FAIL"
+			} else {
+				// Categorize the error, from the compiler diagnostics
+				compileErr.Log = diagnostics.Rendered()
+				compileErr.Category = dc.categorizeError(compileErr.Log)
 			}
 
-			// Find the original markdown file for this snippet
-			originalFile := dc.getOriginalFileFromSnippet(baseName)
+			compileErr.Message = compileErr.Log
+
+			// Errors in the files included by the snippet (or in its parts), not only in the generated code
+			if included := dc.includedErrors(source, binName, snippetFile, diagnostics); len(included) > 0 {
+				title := "In the included files"
 
-			if originalFile != "" {
-				// Update the file result with the error
-				if result, exists := dc.results.Files[originalFile]; exists {
-					result.SnippetsFailed++
-					result.Errors = append(result.Errors, fmt.Sprintf("Snippet %s (%s): %s", binName, errorCategory, errorStr))
-					dc.results.Files[originalFile] = result
+				if source.Parts > 0 {
+					title = "In the parts of the example"
 				}
-			} else {
-				// If mapping failed, still log it but continue with global tracking
-				dc.logError(fmt.Sprintf("Could not map snippet %s to original file", baseName))
+
+				compileErr.Message = fmt.Sprintf("%s\n%s:\n%s", strings.TrimRight(compileErr.Log, "\n"), title, strings.Join(included, "\n"))
 			}
 
-			dc.logError(fmt.Sprintf("Compilation failed for %s (%s): %s", binName, errorCategory, errorStr))
+			onFailed(binName, compileErr)
 
-			if dc.config.ExitOnError {
-				return fmt.Errorf("compilation failed for %s", binName)
+			if err := dc.reportCompileError(binName, compileErr, 1, duration); err != nil {
+				return err
 			}
 		}
 	}
@@ -761,41 +1814,415 @@ func (dc *DocChecker) compileIndividually(projectDir string, snippetFiles []stri
 	return nil
 }
 
-// getOriginalFileFromSnippet maps a snippet filename back to the original markdown file
-func (dc *DocChecker) getOriginalFileFromSnippet(snippetBaseName string) string {
-	// Remove .rs extension first
-	snippetName := strings.TrimSuffix(snippetBaseName, ".rs")
+// reportCompileError records the failure of a snippet which failed to compile
+// (or the error of a previous run, from the cache), unless excluded by its error codes
+func (dc *DocChecker) reportCompileError(binName string, compileErr compileError, attempts int, duration time.Duration) error {
+	source := dc.manifest[binName]
+	excluded := !source.CompileFail && dc.excludedByCodes(compileErr.Codes, source.IgnoreCodes)
 
-	// Snippet files are named like "normalized_filename-123" where normalized_filename comes from markdown file
-	// and 123 is the line number
-	parts := strings.Split(snippetName, "-")
+	logFile, err := dc.writeErrorLog(binName, compileErr.Log)
 
-	if len(parts) < 2 {
-		return ""
+	if err != nil {
+		dc.logWarning(fmt.Sprintf("Failed to write the error log of %s: %v", binName, err))
+	}
+
+	errorStr := truncateError(compileErr.Message, dc.config.MaxErrorBytes, logFile)
+	snippetName := dc.snippetName(binName)
+
+	failure := dc.snippetFailure(binName, compileErr.Category, errorStr, compileErr.Codes...)
+	failure.Suggestions = compileErr.Suggestions
+	failure.LogFile = logFile
+	failure.environment = compileErr.environment
+
+	// Still reported with the snippets of the file, but not as a failure
+	if excluded {
+		dc.results.Summary.ExcludedFailures++
+		dc.completeSnippet(binName, "excluded", attempts, duration, &failure)
+		dc.logWarning(fmt.Sprintf("Failure of %s excluded by the error codes (%s)", snippetName, strings.Join(compileErr.Codes, ", ")))
+
+		return nil
+	}
+
+	dc.recordFailure(failure, attempts, duration)
+
+	dc.logError(fmt.Sprintf("Compilation failed for %s (%s): %s", snippetName, compileErr.Category, errorStr))
+
+	if dc.config.ExitOnError {
+		return fmt.Errorf("compilation failed for %s", binName)
+	}
+
+	return nil
+}
+
+// checkDiagnostics checks a snippet binary, and returns the compiler diagnostics
+// (in another target dir than the one of the project, if not "")
+func (dc *DocChecker) checkDiagnostics(projectDir, binName, targetDir string) cargoDiagnostics {
+	cmd := dc.projectCargoCommand(projectDir, append([]string{"check", "--bin", binName, "--message-format=json"}, dc.cargoJobs()...)...)
+
+	if targetDir != "" {
+		cmd.Env = targetDirEnv(cmd.Env, targetDir)
+	}
+
+	output, err := cmd.CombinedOutput()
+	diagnostics := parseCargoDiagnostics(output)
+	diagnostics.Failed = err != nil
+
+	return diagnostics
+}
+
+// writeErrorLog writes the full compiler output of a failing snippet
+// in the --error-log-dir directory, if any, and returns the path of the log
+func (dc *DocChecker) writeErrorLog(binName, output string) (string, error) {
+	if dc.config.ErrorLogDir == "" {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(dc.config.ErrorLogDir, 0755); err != nil {
+		return "", err
+	}
+
+	logFile := filepath.Join(dc.config.ErrorLogDir, binName+".log")
+
+	if err := os.WriteFile(logFile, []byte(output), 0644); err != nil {
+		return "", err
+	}
+
+	return logFile, nil
+}
+
+// truncateError truncates an error message to the given number of bytes
+// (without splitting a character), unless the limit is 0
+func truncateError(message string, maxBytes int, logFile string) string {
+	if maxBytes <= 0 || len(message) <= maxBytes {
+		return message
+	}
+
+	end := maxBytes
+
+	for end > 0 && !utf8.RuneStart(message[end]) {
+		end--
+	}
+
+	if logFile != "" {
+		return fmt.Sprintf("%s... (truncated, full output in %s)", message[:end], logFile)
+	}
+
+	return message[:end] + "... (truncated)"
+}
+
+// snippetBaseName returns the normalized name of a markdown file, used as prefix
+// of the generated snippet files (suffixed with the id or line of the snippet).
+// It's unique per file: derived from the path relative to the project root
+// (e.g. "docs_a_intro" for "docs/a/intro.md", suffixed with a hash of the path
+// when the normalization loses characters, e.g. "docs_a_b_5e6f7a8b" for
+// "docs/a-b.md", which would collide with "docs/a_b.md") or with the "hash"
+// naming scheme, from the file name and a hash of its path (e.g. "intro_1a2b3c4d").
+func (dc *DocChecker) snippetBaseName(filePath string) string {
+	relPath := dc.relativePath(filePath)
+	name := strings.TrimSuffix(relPath, filepath.Ext(relPath))
+	pathHash := sha256.Sum256([]byte(relPath))
+
+	if dc.config.SnippetNames == "hash" {
+		name = fmt.Sprintf("%s_%x", filepath.Base(name), pathHash[:4])
+	} else if !normalizedPathRegex.MatchString(relPath) {
+		name = fmt.Sprintf("%s_%x", name, pathHash[:4])
+	}
+
+	// Only keep characters valid in a cargo binary name, with '-' as line separator
+	norm := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+
+		return '_'
+	}, name)
+
+	return strings.Trim(norm, "_")
+}
+
+// normalizedPathRegex matches the relative paths whose normalized names can't be
+// the ones of other paths: only '/' is replaced (by '_'), and the extension is .md
+var normalizedPathRegex = regexp.MustCompile(`^[A-Za-z0-9]+(/[A-Za-z0-9]+)*\.md$`)
+
+// snippetBinName returns the name of the generated binary of a snippet: the
+// base name of its file, suffixed with its id=NAME if named (e.g.
+// "docs_guide-find_by_name"), so that it doesn't change when the file is
+// edited above it, or else with its line (e.g. "docs_guide-120")
+func (dc *DocChecker) snippetBinName(filePath string, snippet Snippet) string {
+	// Not a numeric id, which could be the line of another snippet
+	if name, named := snippet.Attrs["id"]; named && strings.Trim(name, "0123456789") != "" {
+		return dc.snippetBaseName(filePath) + "-" + name
+	}
+
+	return fmt.Sprintf("%s-%d", dc.snippetBaseName(filePath), snippet.StartLine)
+}
+
+// relativePath returns the path of a file relative to the project root,
+// with forward slashes, or the path unchanged if it's outside the project
+func (dc *DocChecker) relativePath(filePath string) string {
+	return relativeTo(dc.config.ProjectRoot, filePath)
+}
+
+// relativeTo returns the path of a file relative to the root directory,
+// with forward slashes, or the path unchanged if it's outside the root
+func relativeTo(root, filePath string) string {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return filepath.ToSlash(filePath)
+	}
+
+	rel, err := filepath.Rel(root, absPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(filePath)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// failureFingerprint computes a stable identifier for a failure,
+// from the markdown file (relative to the project root), the hash of the snippet
+// content and the error codes of the compiler (or the error category if there
+// are none); so the same failure keeps the same ID across runs, even if the
+// snippet is moved within the file.
+func (dc *DocChecker) failureFingerprint(filePath, snippetFile, category string, codes []string) string {
+	relPath := dc.relativePath(filePath)
+
+	// Hash the code without its provenance header, which includes line numbers
+	content, _ := os.ReadFile(snippetFile)
+	_, code := splitProvenance(string(content))
+	snippetHash := sha256.Sum256([]byte(code))
+
+	errorID := category
+
+	if len(codes) > 0 {
+		sorted := append([]string(nil), codes...)
+		sort.Strings(sorted)
+		errorID = strings.Join(sorted, ",")
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%x\x00%s", relPath, snippetHash, errorID)
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// recordAttempts reports the attempts to check a snippet with retries=N (its
+// runs, or its only compilation if it's not run)
+func (dc *DocChecker) recordAttempts(binName string, attempts int, passed bool) {
+	source := dc.manifest[binName]
+
+	if source.Retries == 0 {
+		return
+	}
+
+	if result, exists := dc.results.Files[source.File]; exists {
+		result.Retries = append(result.Retries, SnippetAttempts{
+			SnippetID: source.SnippetID,
+			Line:      source.StartLine,
+			Attempts:  attempts,
+			Passed:    passed,
+		})
+		dc.results.Files[source.File] = result
+	}
+}
+
+// snippetResult returns the result of a snippet, with the given status
+func snippetResult(snippet Snippet, status string) SnippetResult {
+	result := SnippetResult{
+		ID:      snippet.ID,
+		Line:    snippet.StartLine,
+		EndLine: snippet.EndLine,
+		Status:  status,
+		Preview: snippet.Preview,
+	}
+
+	if snippet.Ignore {
+		result.IgnoreReason = snippet.IgnoreReason
+	}
+
+	if len(snippet.Attrs) > 0 {
+		result.Attributes = snippet.Attrs
 	}
 
-	// Remove the line number part (last part) and reconstruct the normalized name
-	normalizedName := strings.Join(parts[:len(parts)-1], "-")
+	return result
+}
+
+// completeSnippet records the outcome of a generated snippet in the result
+// of its markdown file, and reports it (progress, and stream with `-o jsonl`)
+func (dc *DocChecker) completeSnippet(binName, status string, attempts int, duration time.Duration, failure *Failure) {
+	source := dc.manifest[binName]
+
+	if result, exists := dc.results.Files[source.File]; exists {
+		for i, snippet := range result.Snippets {
+			if snippet.ID == source.SnippetID {
+				result.Snippets[i].Status = status
+				result.Snippets[i].Snippet = binName
+				result.Snippets[i].Attempts = attempts
+				result.Snippets[i].DurationMs = duration.Milliseconds()
+				result.Snippets[i].Failure = failure
+			}
+		}
+	}
+
+	if warnings, warned := dc.compilerWarnings[binName]; warned {
+		if result, exists := dc.results.Files[source.File]; exists {
+			for i, snippet := range result.Snippets {
+				if snippet.ID == source.SnippetID {
+					result.Snippets[i].CompilerWarnings = warnings
+				}
+			}
+		}
+	}
 
-	// Look for the file in our results by comparing normalized names
-	for filePath := range dc.results.Files {
-		base := filepath.Base(filePath)
-		expectedNorm := strings.TrimSuffix(base, ".md")
-		expectedNorm = strings.ReplaceAll(expectedNorm, ".", "_")
-		expectedNorm = strings.ReplaceAll(expectedNorm, "-", "_")
+	if lints, linted := dc.clippyLints[binName]; linted {
+		if result, exists := dc.results.Files[source.File]; exists {
+			for i, snippet := range result.Snippets {
+				if snippet.ID == source.SnippetID {
+					result.Snippets[i].ClippyLints = lints
+				}
+			}
+		}
+	}
 
-		if normalizedName == expectedNorm {
-			return filePath
+	if run, ran := dc.snippetRuns[binName]; ran {
+		if result, exists := dc.results.Files[source.File]; exists {
+			for i, snippet := range result.Snippets {
+				if snippet.ID == source.SnippetID {
+					result.Snippets[i].Run = &run
+				}
+			}
 		}
 	}
 
-	return ""
+	dc.compiled++
+	dc.emitCompileProgress(binName)
+	dc.emitCompiled(binName, status, attempts, failure)
+}
+
+// snippetName locates a snippet binary in the documentation, from the provenance
+// header of its generated file (e.g. README-3 [source: README.md:12-20, id=auto_3])
+func (dc *DocChecker) snippetName(binName string) string {
+	if provenance := readProvenance(filepath.Join(dc.tempDir, binName+".rs")); provenance != "" {
+		return fmt.Sprintf("%s [%s]", binName, provenance)
+	}
+
+	return binName
+}
+
+// snippetFailure returns the failure of a snippet binary, located in the documentation,
+// with the error codes of the compiler if any
+func (dc *DocChecker) snippetFailure(binName, category, message string, codes ...string) Failure {
+	source := dc.manifest[binName]
+
+	failure := Failure{
+		Snippet:     binName,
+		SnippetID:   source.SnippetID,
+		Line:        source.StartLine,
+		EndLine:     source.EndLine,
+		Category:    category,
+		Message:     message,
+		Codes:       codes,
+		Fingerprint: dc.failureFingerprint(source.File, filepath.Join(dc.tempDir, binName+".rs"), category, codes),
+		Link:        dc.loadBlobLinks().link(source.File, source.StartLine),
+	}
+
+	if dc.config.LinkBase != "" {
+		failure.ReportLink = dc.config.LinkBase + "#" + failureAnchor(failure)
+	}
+
+	return failure
+}
+
+// recordFailure counts a failing snippet, and updates the result of its markdown file with the failure
+func (dc *DocChecker) recordFailure(failure Failure, attempts int, duration time.Duration) {
+	source := dc.manifest[failure.Snippet]
+	dc.failures = append(dc.failures, dc.baselineEntry(failure))
+
+	// Still reported with the snippets of the file, but not as a failure
+	if dc.inBaseline(failure) {
+		dc.results.Summary.ExcludedFailures++
+		dc.completeSnippet(failure.Snippet, "excluded", attempts, duration, &failure)
+		dc.logWarning(fmt.Sprintf("Failure of %s excluded by the baseline (%s)", dc.snippetName(failure.Snippet), failure.Category))
+
+		return
+	}
+
+	dc.results.Summary.FailedSnippets++
+	dc.results.Summary.ErrorsByCategory[failure.Category]++
+
+	for _, code := range failure.Codes {
+		dc.results.Summary.ErrorsByCode[code]++
+	}
+
+	if result, exists := dc.results.Files[source.File]; exists {
+		result.SnippetsFailed++
+		result.Errors = append(result.Errors, fmt.Sprintf("Snippet %s (%s): %s", dc.snippetName(failure.Snippet), failure.Category, failure.Message))
+		result.Failures = append(result.Failures, failure)
+		dc.results.Files[source.File] = result
+	}
+
+	dc.completeSnippet(failure.Snippet, "failed", attempts, duration, &failure)
+}
+
+// completeValid completes a snippet which compiled successfully, with the
+// "warnings" status if the compiler (or clippy) warned about it (then not passed
+// to onValid, e.g. not cached, so the warnings are reported again by the next runs)
+func (dc *DocChecker) completeValid(binName string, attempts int, duration time.Duration, warnings []string, onValid func(binName string)) {
+	dc.markValid(binName)
+
+	lints := dc.clippyLints[binName]
+
+	if len(warnings) == 0 && len(lints) == 0 {
+		onValid(binName)
+		dc.completeSnippet(binName, "valid", attempts, duration, nil)
+
+		return
+	}
+
+	source := dc.manifest[binName]
+	dc.results.Summary.WarnedSnippets++
+
+	if len(warnings) > 0 {
+		dc.compilerWarnings[binName] = warnings
+	}
+
+	for _, lint := range lints {
+		title, _, _ := strings.Cut(lint, "\n")
+
+		dc.addWarning(Warning{
+			Code:    warnClippy,
+			File:    source.File,
+			Line:    source.StartLine,
+			Message: fmt.Sprintf("Snippet %s reported by clippy: %s", source.SnippetID, title),
+		})
+	}
+
+	for _, warning := range warnings {
+		title, _, _ := strings.Cut(warning, "\n")
+
+		dc.addWarning(Warning{
+			Code:    warnCompiler,
+			File:    source.File,
+			Line:    source.StartLine,
+			Message: fmt.Sprintf("Snippet %s compiled with a %s", source.SnippetID, title),
+		})
+	}
+
+	dc.completeSnippet(binName, "warnings", attempts, duration, nil)
 }
 
-func (dc *DocChecker) updateAllFilesSuccess() {
-	for filePath, result := range dc.results.Files {
-		result.SnippetsValid = result.SnippetsFound
-		dc.results.Files[filePath] = result
+// markValid counts a snippet which compiled successfully
+func (dc *DocChecker) markValid(binName string) {
+	dc.results.Summary.ValidSnippets++
+	dc.validSnippets = append(dc.validSnippets, binName)
+
+	// Update the result of the original markdown file with success
+	originalFile := dc.manifest[binName].File
+
+	if result, exists := dc.results.Files[originalFile]; exists {
+		result.SnippetsValid++
+
+		dc.results.Files[originalFile] = result
 	}
 }
 
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// snippetCode returns the code to check with `doc-checker check-snippet`:
+// the one of --code, or else read from stdin (also with --code -)
+func snippetCode(config *Config, stdin io.Reader) (string, error) {
+	code := config.SnippetCode
+
+	if code == "" || code == "-" {
+		content, err := io.ReadAll(stdin)
+
+		if err != nil {
+			return "", fmt.Errorf("failed to read the snippet from stdin: %w", err)
+		}
+
+		code = string(content)
+	}
+
+	if strings.TrimSpace(code) == "" {
+		return "", fmt.Errorf("no code to check (e.g. doc-checker check-snippet --code 'let x = 1;')")
+	}
+
+	return code, nil
+}
+
+// snippetPrelude returns the prelude of a snippet checked with --prelude:
+// the import of the given items of the crate (e.g. "updates,filters::empty"
+// for `use tnuctipun::{updates, filters::empty};`), replacing its own prelude;
+// or nil for the prelude of the crate, without --prelude
+func snippetPrelude(crate CrateConfig, items string) ([]string, error) {
+	if items == "" {
+		return nil, nil
+	}
+
+	var paths []string
+
+	for _, item := range strings.Split(items, ",") {
+		item = strings.TrimSpace(item)
+
+		if !rustPathRegex.MatchString(item) {
+			return nil, fmt.Errorf("invalid --prelude item '%s' (expected paths of %s, e.g. updates,filters::empty)", item, crate.Name)
+		}
+
+		paths = append(paths, item)
+	}
+
+	return []string{fmt.Sprintf("use %s::{%s};", crate.ident(), strings.Join(paths, ", "))}, nil
+}
+
+// checkSnippetCommand checks the snippet of `doc-checker check-snippet`
+func checkSnippetCommand(checker *DocChecker, stdin io.Reader) (*Results, error) {
+	code, err := snippetCode(checker.config, stdin)
+
+	if err != nil {
+		return nil, err
+	}
+
+	prelude, err := snippetPrelude(checker.crates()[0], checker.config.SnippetPrelude)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return checker.CheckSnippet(context.Background(), code, prelude)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Error category of the snippets failing the lints of clippy (--clippy-level deny)
+const categoryClippyLint = "CLIPPY_LINT"
+
+// Levels of the clippy lints of the snippets, with --clippy
+const (
+	clippyWarn = "warn" // Reported as warnings, the snippets being valid
+	clippyDeny = "deny" // Reported as failures
+)
+
+// clippyConfDir returns the directory of the clippy configuration of the project
+// (clippy.toml or .clippy.toml), or "" if it has none
+func clippyConfDir(projectRoot string) string {
+	for _, name := range []string{"clippy.toml", ".clippy.toml"} {
+		if _, err := os.Stat(filepath.Join(projectRoot, name)); err == nil {
+			dir, _ := filepath.Abs(projectRoot)
+			return dir
+		}
+	}
+
+	return ""
+}
+
+// clippyDiagnostics runs clippy over the snippet binaries of a generated project
+// (once per project), with the lints of the clippy::all group at the --clippy-level,
+// and the clippy configuration of the project (e.g. its disallowed methods)
+func (dc *DocChecker) clippyDiagnostics(projectDir string) cargoDiagnostics {
+	if diagnostics, linted := dc.clippyRuns[projectDir]; linted {
+		return diagnostics
+	}
+
+	level := "-W"
+
+	if dc.config.ClippyLevel == clippyDeny {
+		level = "-D"
+	}
+
+	// Linting the other binaries when some fail to compile (e.g. the compile_fail ones)
+	cmd := dc.projectCargoCommand(projectDir, "clippy", "--keep-going", "--message-format=json", "--bins", "--", level, "clippy::all")
+
+	if confDir := clippyConfDir(dc.config.ProjectRoot); confDir != "" {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+
+		cmd.Env = append(cmd.Env, "CLIPPY_CONF_DIR="+confDir)
+	}
+
+	output, err := cmd.CombinedOutput()
+	diagnostics := parseCargoDiagnostics(output)
+	diagnostics.Failed = err != nil
+
+	// e.g. clippy not installed with the toolchain
+	if diagnostics.Failed && len(diagnostics.Diagnostics) == 0 {
+		dc.logWarning(fmt.Sprintf("Failed to run clippy in %s: %s", projectDir, strings.TrimSpace(diagnostics.Text)))
+	}
+
+	dc.clippyRuns[projectDir] = diagnostics
+
+	return diagnostics
+}
+
+// checkClippy lints a snippet which compiled, with --clippy, and returns the
+// failure if clippy reports about it at the deny level; at the warn level, the
+// lints are kept to be reported as warnings
+func (dc *DocChecker) checkClippy(projectDir, binName string) *Failure {
+	if !dc.config.Clippy {
+		return nil
+	}
+
+	lints := dc.clippyDiagnostics(projectDir).Lints(binName)
+
+	if len(lints) == 0 {
+		return nil
+	}
+
+	if dc.config.ClippyLevel != clippyDeny {
+		dc.clippyLints[binName] = lints
+		return nil
+	}
+
+	failure := dc.snippetFailure(binName, categoryClippyLint,
+		fmt.Sprintf("Clippy lints (--clippy-level deny):\n%s", strings.Join(lints, "\n")))
+
+	return &failure
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 )
 
 // ANSI color codes
@@ -43,6 +44,24 @@ func colorError(text string) string {
 	return colorize(ColorRed, text)
 }
 
+// colorDiff colors the removed (-) and added (+) lines of a diff
+func colorDiff(diff string) string {
+	lines := strings.Split(diff, "\n")
+
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "---"):
+			lines[i] = colorize(ColorRed, line)
+		case strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++"):
+			lines[i] = colorize(ColorGreen, line)
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = colorize(ColorCyan, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 // Check if the terminal supports color
 func supportsColor() bool {
 	// Disable colors if output is not a terminal
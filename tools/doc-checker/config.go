@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Name of the configuration file, at the project root
+const configFileName = ".doc-checker.toml"
+
+// Path of a Rust item (e.g. tnuctipun::updates::UpdateBuilder)
+var rustPathRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(::[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// Language of a code fence, the first word of its info string (e.g. tnuctipun)
+var fenceLanguageRegex = regexp.MustCompile(`^[A-Za-z0-9_+.-]+$`)
+
+// CrateConfig is a documented crate, which the snippets target
+// with the crate=NAME fence attribute
+type CrateConfig struct {
+	Name    string   // Package name (e.g. tnuctipun-derive)
+	Path    string   // Directory of the crate
+	Prelude []string // Lines added before the code of the snippets (e.g. imports)
+
+	Features []string // Features enabled to compile the snippets (from the frontmatter of their file)
+
+	NoDefaultFeatures bool // Compiled without its default features (feature set of --features-matrix)
+}
+
+// ident returns the name of the crate as used in Rust code (e.g. tnuctipun_derive)
+func (c CrateConfig) ident() string {
+	return strings.ReplaceAll(c.Name, "-", "_")
+}
+
+// PathRename is an outdated path of the API (e.g. still re-exported),
+// flagged in the snippets in favor of the canonical one
+type PathRename struct {
+	Old string // e.g. tnuctipun::update
+	New string // e.g. tnuctipun::updates
+}
+
+// defaultCrates returns the documented crates without configuration file:
+// only tnuctipun, with the imports required by most snippets
+func defaultCrates(projectRoot string) []CrateConfig {
+	return []CrateConfig{{
+		Name: "tnuctipun",
+		Path: projectRoot,
+		Prelude: []string{
+			"use tnuctipun::{FieldWitnesses, MongoComparable, updates};",
+			"use serde::{Deserialize, Serialize};",
+		},
+	}}
+}
+
+// loadConfigFile reads the configuration file (the one given with --config,
+// or .doc-checker.toml at the project root if any), e.g.
+//
+//	default_crate = "tnuctipun"
+//
+//	[crates.tnuctipun]
+//	path = "."
+//	prelude = ["use tnuctipun::{FieldWitnesses, MongoComparable, updates};"]
+//
+//	[crates.tnuctipun-derive]
+//	path = "tnuctipun-derive"
+//
+//	[renames]
+//	"tnuctipun::update" = "tnuctipun::updates"
+//
+//	[content]
+//	todo = ""
+//
+//	[shell]
+//	commands = ["mongosh"]
+//
+//	[languages]
+//	rust = ["tnuctipun"]
+//
+//	[coverage]
+//	"tnuctipun::filters" = 1
+func loadConfigFile(config *Config) error {
+	config.Crates = defaultCrates(config.ProjectRoot)
+	config.ContentRules = defaultContentRules()
+	path := config.ConfigFile
+
+	if path == "" {
+		path = filepath.Join(config.ProjectRoot, configFileName)
+
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+	}
+
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return fmt.Errorf("failed to read configuration: %w", err)
+	}
+
+	doc, err := parseTOML(string(content))
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := checkConfigSchema(path, doc); err != nil {
+		return err
+	}
+
+	if config.Renames, err = loadRenames(doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if config.ContentRules, err = loadContentRules(doc, config.ContentRules); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if config.ShellCommands, _, err = doc.stringsValue("shell.commands"); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if config.RustAliases, err = loadRustAliases(doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if config.CoveragePolicies, err = loadCoveragePolicies(doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	var crates []CrateConfig
+
+	for _, table := range doc.Tables {
+		name, isCrate := strings.CutPrefix(table, "crates.")
+
+		if !isCrate || strings.Contains(name, ".") {
+			continue
+		}
+
+		crate := CrateConfig{Name: name}
+		crateDir, _, err := doc.stringValue(table + ".path")
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if crate.Prelude, _, err = doc.stringsValue(table + ".prelude"); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		crate.Path = filepath.Join(config.ProjectRoot, crateDir)
+
+		if _, err := os.Stat(filepath.Join(crate.Path, "Cargo.toml")); err != nil {
+			return fmt.Errorf("%s: crate %s: no Cargo.toml in %s", path, name, crate.Path)
+		}
+
+		crates = append(crates, crate)
+	}
+
+	if len(crates) == 0 {
+		return nil
+	}
+
+	// The default crate comes first
+	defaultCrate, found, err := doc.stringValue("default_crate")
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if found {
+		index := -1
+
+		for i, crate := range crates {
+			if crate.Name == defaultCrate {
+				index = i
+			}
+		}
+
+		if index < 0 {
+			return fmt.Errorf("%s: line %d: default_crate %s is not declared in [crates]",
+				path, doc.Values["default_crate"].Line, defaultCrate)
+		}
+
+		crates[0], crates[index] = crates[index], crates[0]
+	}
+
+	config.Crates = crates
+
+	return nil
+}
+
+// loadRenames reads the outdated paths from the [renames] table,
+// in the order of definition
+func loadRenames(doc *tomlDocument) ([]PathRename, error) {
+	var renames []PathRename
+
+	for _, key := range doc.Keys {
+		old, isRename := strings.CutPrefix(key, "renames.")
+
+		if !isRename {
+			continue
+		}
+
+		newPath, _, err := doc.stringValue(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !rustPathRegex.MatchString(old) || !rustPathRegex.MatchString(newPath) {
+			return nil, fmt.Errorf("line %d: invalid rename %s = %s (expected Rust paths, e.g. \"a::b\" = \"a::c\")",
+				doc.Values[key].Line, old, newPath)
+		}
+
+		renames = append(renames, PathRename{Old: old, New: newPath})
+	}
+
+	return renames, nil
+}
+
+// loadRustAliases reads the other languages of the Rust snippets from the
+// [languages] table (e.g. rust = ["tnuctipun"])
+func loadRustAliases(doc *tomlDocument) ([]string, error) {
+	aliases, _, err := doc.stringsValue("languages.rust")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, alias := range aliases {
+		if !fenceLanguageRegex.MatchString(alias) {
+			return nil, fmt.Errorf("line %d: invalid language %q in languages.rust (expected the first word of the info strings, e.g. \"tnuctipun\")",
+				doc.Values["languages.rust"].Line, alias)
+		}
+	}
+
+	return aliases, nil
+}
+
+// rustAliases returns the other languages of the fences checked as Rust snippets
+func (dc *DocChecker) rustAliases() []string {
+	if dc.config == nil {
+		return nil
+	}
+
+	return dc.config.RustAliases
+}
+
+// crates returns the documented crates, the default one first
+func (dc *DocChecker) crates() []CrateConfig {
+	if len(dc.config.Crates) == 0 {
+		return defaultCrates(dc.config.ProjectRoot)
+	}
+
+	return dc.config.Crates
+}
+
+// crate returns the documented crate with the given name (the default one if empty)
+func (dc *DocChecker) crate(name string) (CrateConfig, error) {
+	crates := dc.crates()
+
+	if name == "" {
+		return crates[0], nil
+	}
+
+	for _, crate := range crates {
+		if crate.Name == name {
+			return crate, nil
+		}
+	}
+
+	return CrateConfig{}, fmt.Errorf("unknown crate '%s' (not declared in %s)", name, configFileName)
+}
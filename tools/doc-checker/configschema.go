@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Types of the values of the configuration file
+const (
+	configString  = "a string"
+	configStrings = "an array of strings"
+	configInteger = "an integer"
+)
+
+// configKey is a key of the configuration file, whose pattern may contain "*"
+// standing for any name (e.g. the one of a crate in "crates.*.path")
+type configKey struct {
+	Pattern    string
+	Type       string
+	Deprecated string // What to use instead, if deprecated
+}
+
+// configSchema describes the keys of the configuration file
+var configSchema = []configKey{
+	{Pattern: "default_crate", Type: configString},
+	{Pattern: "crates.*.path", Type: configString},
+	{Pattern: "crates.*.prelude", Type: configStrings},
+	{Pattern: "renames.*", Type: configString},
+	{Pattern: "content.*", Type: configString},
+	{Pattern: "shell.commands", Type: configStrings},
+	{Pattern: "languages.rust", Type: configStrings},
+	{Pattern: "coverage.*", Type: configInteger},
+}
+
+// matchesConfigKey checks whether a dotted key matches a pattern of the schema
+func matchesConfigKey(pattern, key string) bool {
+	patternParts, keyParts := strings.Split(pattern, "."), strings.Split(key, ".")
+
+	// A "*" stands for a single part (e.g. the name of a crate, or a Rust path of the renames)
+	if len(patternParts) != len(keyParts) {
+		return false
+	}
+
+	for i, part := range patternParts {
+		if part != "*" && part != keyParts[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// configValueType returns the type of a value, as named in the schema
+func configValueType(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return configString
+	case int64:
+		return configInteger
+	case float64:
+		return "a float"
+	case bool:
+		return "a boolean"
+	case time.Time, toml.LocalDate, toml.LocalDateTime, toml.LocalTime:
+		return "a date"
+	case map[string]interface{}:
+		return "an inline table"
+	case []interface{}:
+		for _, item := range v {
+			if _, ok := item.(string); !ok {
+				return "an array"
+			}
+		}
+
+		return configStrings
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// configProblem is an error (or warning) of the configuration file, at a line
+type configProblem struct {
+	Line    int
+	Message string
+}
+
+func (p configProblem) String() string {
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// configTablePatterns returns the patterns of the tables of the schema
+// (e.g. "crates" and "crates.*" for "crates.*.path")
+func configTablePatterns(schema []configKey) []string {
+	var patterns []string
+
+	for _, key := range schema {
+		parts := strings.Split(key.Pattern, ".")
+
+		for n := 1; n < len(parts); n++ {
+			patterns = append(patterns, strings.Join(parts[:n], "."))
+		}
+	}
+
+	return patterns
+}
+
+// validateConfig checks the keys of the configuration file against the schema:
+// the unknown keys (or tables) and the type mismatches are returned as errors,
+// and the deprecated keys as warnings, sorted by line
+func validateConfig(doc *tomlDocument, schema []configKey) (errs []configProblem, warnings []configProblem) {
+	tablePatterns := configTablePatterns(schema)
+	var keyPatterns []string
+
+	for _, key := range schema {
+		keyPatterns = append(keyPatterns, key.Pattern)
+	}
+
+	// The keys of an unknown table are not reported on their own
+	var unknownTables []string
+
+	for _, table := range doc.Tables {
+		known := false
+
+		for _, pattern := range tablePatterns {
+			known = known || matchesConfigKey(pattern, table)
+		}
+
+		if !known {
+			unknownTables = append(unknownTables, table)
+			errs = append(errs, configProblem{doc.TableLines[table],
+				fmt.Sprintf("unknown table [%s]%s", table, suggestConfigName(table, tablePatterns))})
+		}
+	}
+
+	for _, key := range doc.Keys {
+		value := doc.Values[key]
+		inUnknownTable := false
+
+		for _, table := range unknownTables {
+			inUnknownTable = inUnknownTable || strings.HasPrefix(key, table+".")
+		}
+
+		if inUnknownTable {
+			continue
+		}
+
+		var known *configKey
+
+		for i := range schema {
+			if matchesConfigKey(schema[i].Pattern, key) {
+				known = &schema[i]
+				break
+			}
+		}
+
+		switch {
+		case known == nil:
+			errs = append(errs, configProblem{value.Line,
+				fmt.Sprintf("unknown key %s%s", key, suggestConfigName(key, keyPatterns))})
+
+		case configValueType(value.Value) != known.Type:
+			errs = append(errs, configProblem{value.Line,
+				fmt.Sprintf("%s must be %s, not %s", key, known.Type, configValueType(value.Value))})
+
+		case known.Deprecated != "":
+			warnings = append(warnings, configProblem{value.Line,
+				fmt.Sprintf("%s is deprecated, use %s instead", key, known.Deprecated)})
+		}
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+
+	return errs, warnings
+}
+
+// suggestConfigName returns a hint about the closest pattern to a misspelled
+// key or table (e.g. " (did you mean crates.tnuctipun.prelude?)"), if any
+func suggestConfigName(name string, patterns []string) string {
+	parts := strings.Split(name, ".")
+	best, bestDistance := "", 3 // Only the typos
+
+	for _, pattern := range patterns {
+		patternParts := strings.Split(pattern, ".")
+
+		if len(patternParts) != len(parts) {
+			continue
+		}
+
+		candidate := make([]string, len(parts))
+
+		for i, part := range patternParts {
+			candidate[i] = part
+
+			if part == "*" {
+				candidate[i] = parts[i]
+			}
+		}
+
+		suggestion := strings.Join(candidate, ".")
+
+		if distance := editDistance(name, suggestion); distance < bestDistance {
+			best, bestDistance = suggestion, distance
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" (did you mean %s?)", best)
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// checkConfigSchema validates the configuration file, printing the warnings
+// on stderr, and returns the errors as one
+func checkConfigSchema(path string, doc *tomlDocument) error {
+	errs, warnings := validateConfig(doc, configSchema)
+
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", path, warning)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(errs))
+
+	for i, problem := range errs {
+		messages[i] = fmt.Sprintf("%s: %s", path, problem)
+	}
+
+	return fmt.Errorf("invalid configuration\n%s", strings.Join(messages, "\n"))
+}
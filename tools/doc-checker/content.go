@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ContentRule is a content of the code blocks which is flagged (e.g. a local
+// path of the author), as published examples must be portable
+type ContentRule struct {
+	Name    string // e.g. home_path
+	Pattern *regexp.Regexp
+}
+
+// defaultContentRules returns the rules checked without configuration,
+// which the [content] table of the configuration file can disable or extend
+func defaultContentRules() []ContentRule {
+	return []ContentRule{
+		{Name: "home_path", Pattern: regexp.MustCompile(`(?:^|[\s"'=(])(/home/[A-Za-z0-9._-]+|/Users/[A-Za-z0-9._-]+|[A-Za-z]:\\Users\\[A-Za-z0-9._-]+)`)},
+		{Name: "local_mongodb", Pattern: regexp.MustCompile(`(?:localhost|127\.0\.0\.1):27017`)},
+		{Name: "todo", Pattern: regexp.MustCompile(`\b(?:TODO|FIXME)\b`)},
+	}
+}
+
+// loadContentRules reads the [content] table, whose keys are the names of the
+// rules, and values their pattern (a regular expression), or "" to disable one
+// of the default rules, e.g.
+//
+//	[content]
+//	todo = ""
+//	internal_host = 'mongo\.corp\.example\.com'
+func loadContentRules(doc *tomlDocument, rules []ContentRule) ([]ContentRule, error) {
+	for _, key := range doc.Keys {
+		name, isRule := strings.CutPrefix(key, "content.")
+
+		if !isRule {
+			continue
+		}
+
+		pattern, _, err := doc.stringValue(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var compiled *regexp.Regexp
+
+		if pattern != "" {
+			if compiled, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("line %d: invalid pattern of the content rule %s: %w", doc.Values[key].Line, name, err)
+			}
+		}
+
+		replaced := false
+
+		for i, rule := range rules {
+			if rule.Name == name {
+				rules[i].Pattern, replaced = compiled, true
+			}
+		}
+
+		if !replaced {
+			rules = append(rules, ContentRule{Name: name, Pattern: compiled})
+		}
+	}
+
+	// Without the disabled rules
+	enabled := rules[:0]
+
+	for _, rule := range rules {
+		if rule.Pattern != nil {
+			enabled = append(enabled, rule)
+		}
+	}
+
+	return enabled, nil
+}
+
+// lintContent flags the lines of the code blocks matching a content rule
+// (e.g. /home/alice/data, or localhost:27017 where a placeholder is expected),
+// outside of the skipped regions
+func (dc *DocChecker) lintContent(filePath string, lines []string) {
+	if len(dc.config.ContentRules) == 0 {
+		return
+	}
+
+	var opening codeFence
+	inCodeBlock := false
+	inSkipRegion := false
+
+	for i, line := range lines {
+		if !inCodeBlock {
+			if fence, isFence := parseCodeFence(line); isFence {
+				inCodeBlock = true
+				opening = fence
+
+				continue
+			}
+
+			switch strings.TrimSpace(line) {
+			case skipRegionStart:
+				inSkipRegion = true
+			case skipRegionEnd:
+				inSkipRegion = false
+			}
+
+			continue
+		}
+
+		if opening.interruptedBy(line) {
+			opening, _ = parseCodeFence(line)
+			continue
+		}
+
+		if opening.closedBy(line) {
+			inCodeBlock = false
+			continue
+		}
+
+		if inSkipRegion {
+			continue
+		}
+
+		for _, rule := range dc.config.ContentRules {
+			if match := rule.Pattern.FindStringSubmatch(line); match != nil {
+				found := match[len(match)-1]
+
+				if found == "" {
+					found = match[0]
+				}
+
+				dc.addWarning(Warning{
+					Code:    warnContent,
+					File:    filePath,
+					Line:    i + 1,
+					Message: fmt.Sprintf("Code block contains %s (%s)", strings.TrimSpace(found), rule.Name),
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CoverageReport counts the compiled snippets using each public type of the
+// documented crates, with the gaps of the coverage policy ([coverage] table)
+type CoverageReport struct {
+	Types []TypeCoverage `json:"types"`
+	Gaps  []TypeCoverage `json:"gaps"` // Types with fewer examples than required by the policy
+}
+
+// TypeCoverage is a public type (e.g. a builder) of a documented crate,
+// with the number of compiled snippets referencing it
+type TypeCoverage struct {
+	Path     string `json:"path"` // e.g. tnuctipun::filters::FilterBuilder
+	Kind     string `json:"kind"` // struct, enum, union, trait or type
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Examples int    `json:"examples"`
+	Required int    `json:"required,omitempty"` // Minimum number of examples of the policy, if any
+}
+
+// CoveragePolicy requires the public types of a module (and its submodules)
+// to be used in a minimum number of compiled snippets
+type CoveragePolicy struct {
+	Module   string // e.g. tnuctipun::filters
+	Examples int
+}
+
+// Kinds of the rustdoc JSON items which are types (typedef before the format 24)
+var rustdocTypeKinds = map[string]string{
+	"struct":     "struct",
+	"enum":       "enum",
+	"union":      "union",
+	"trait":      "trait",
+	"type_alias": "type",
+	"typedef":    "type",
+}
+
+// rustdocCrate is the part of the rustdoc JSON of a crate which is used
+// (`cargo rustdoc -- -Z unstable-options --output-format json`)
+type rustdocCrate struct {
+	Index map[string]struct {
+		Visibility interface{} `json:"visibility"` // "public", or an object for pub(in path)
+		Span       *struct {
+			Filename string `json:"filename"`
+			Begin    []int  `json:"begin"`
+		} `json:"span"`
+	} `json:"index"`
+	Paths map[string]struct {
+		CrateID int      `json:"crate_id"`
+		Path    []string `json:"path"`
+		Kind    string   `json:"kind"`
+	} `json:"paths"`
+}
+
+// loadCoveragePolicies reads the [coverage] table, whose keys are the
+// modules, and values the minimum number of examples of each of their types
+//
+//	[coverage]
+//	"tnuctipun::filters" = 1
+func loadCoveragePolicies(doc *tomlDocument) ([]CoveragePolicy, error) {
+	var policies []CoveragePolicy
+
+	for _, key := range doc.Keys {
+		module, isPolicy := strings.CutPrefix(key, "coverage.")
+
+		if !isPolicy {
+			continue
+		}
+
+		examples, isInt := doc.Values[key].Value.(int64)
+
+		if !isInt || examples < 0 {
+			return nil, fmt.Errorf("line %d: %s must be a positive integer", doc.Values[key].Line, key)
+		}
+
+		if !rustPathRegex.MatchString(module) {
+			return nil, fmt.Errorf("line %d: invalid module path of the coverage policy %s", doc.Values[key].Line, module)
+		}
+
+		policies = append(policies, CoveragePolicy{Module: module, Examples: int(examples)})
+	}
+
+	return policies, nil
+}
+
+// requiredExamples returns the number of examples required for a type, by
+// the policy of its closest module (0 if none)
+func requiredExamples(policies []CoveragePolicy, path string) int {
+	required, closest := 0, ""
+
+	for _, policy := range policies {
+		if strings.HasPrefix(path, policy.Module+"::") && len(policy.Module) > len(closest) {
+			required, closest = policy.Examples, policy.Module
+		}
+	}
+
+	return required
+}
+
+// rustdocTypes returns the public types of a crate, from its rustdoc JSON
+func rustdocTypes(path string) ([]TypeCoverage, error) {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var crate rustdocCrate
+
+	if err := json.Unmarshal(content, &crate); err != nil {
+		return nil, fmt.Errorf("%s: invalid rustdoc JSON: %w", path, err)
+	}
+
+	var types []TypeCoverage
+
+	for id, summary := range crate.Paths {
+		kind, isType := rustdocTypeKinds[summary.Kind]
+
+		// Only the types of the crate itself (0), not of its dependencies
+		if !isType || summary.CrateID != 0 {
+			continue
+		}
+
+		item, indexed := crate.Index[id]
+
+		if !indexed || item.Visibility != "public" {
+			continue
+		}
+
+		typ := TypeCoverage{Path: strings.Join(summary.Path, "::"), Kind: kind}
+
+		if item.Span != nil && len(item.Span.Begin) > 0 {
+			typ.File, typ.Line = filepath.ToSlash(item.Span.Filename), item.Span.Begin[0]
+		}
+
+		types = append(types, typ)
+	}
+
+	return types, nil
+}
+
+// rustdocJSONFiles returns the rustdoc JSON of the documented crates: the
+// ones given with --rustdoc-json, or else generated with the nightly toolchain
+// (the JSON output being unstable) in the work directory
+func (dc *DocChecker) rustdocJSONFiles() ([]string, error) {
+	if len(dc.config.RustdocJSON) > 0 {
+		return dc.config.RustdocJSON, nil
+	}
+
+	targetDir := filepath.Join(dc.tempDir, "rustdoc")
+	var files []string
+
+	for _, crate := range dc.crates() {
+		dc.logInfo(fmt.Sprintf("Generating the rustdoc JSON of %s...", crate.Name))
+
+		cmd := dc.cargoCommand(crate.Path, "+nightly", "rustdoc", "--lib", "--quiet", "--",
+			"-Z", "unstable-options", "--output-format", "json")
+		cmd.Env = append(os.Environ(), "CARGO_TARGET_DIR="+targetDir)
+
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("failed to generate the rustdoc JSON of %s (--rustdoc-json to give it): %w\n%s",
+				crate.Name, err, strings.TrimSpace(string(output)))
+		}
+
+		files = append(files, filepath.Join(targetDir, "doc", crate.ident()+".json"))
+	}
+
+	return files, nil
+}
+
+// checkCoverage counts the compiled snippets referencing each public type of
+// the documented crates (not the compile_fail ones), and reports the types
+// below the coverage policy
+func (dc *DocChecker) checkCoverage() (*CoverageReport, error) {
+	files, err := dc.rustdocJSONFiles()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []string
+
+	for _, binName := range dc.validSnippets {
+		if !dc.manifest[binName].CompileFail {
+			codes = append(codes, dc.codes[binName])
+		}
+	}
+
+	report := &CoverageReport{Types: []TypeCoverage{}, Gaps: []TypeCoverage{}}
+
+	for _, file := range files {
+		types, err := rustdocTypes(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, typ := range types {
+			name := typ.Path[strings.LastIndex(typ.Path, "::")+2:]
+			item := ParityItem{Kind: typ.Kind, name: name}
+
+			for _, code := range codes {
+				if item.referencedIn(code) {
+					typ.Examples++
+				}
+			}
+
+			typ.Required = requiredExamples(dc.config.CoveragePolicies, typ.Path)
+			report.Types = append(report.Types, typ)
+
+			if typ.Examples < typ.Required {
+				report.Gaps = append(report.Gaps, typ)
+			}
+		}
+	}
+
+	for _, types := range [][]TypeCoverage{report.Types, report.Gaps} {
+		sort.Slice(types, func(i, j int) bool {
+			return types[i].Path < types[j].Path
+		})
+	}
+
+	return report, nil
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dependency is a version requirement on a crate (e.g. bson = "3.1")
+type Dependency struct {
+	Name string `json:"name"`
+	Req  string `json:"req"`
+	Line int    `json:"line,omitempty"` // Line in the TOML document, if any
+}
+
+// Tables of the dependencies in a Cargo manifest
+var dependencyTables = []string{"dependencies.", "dev-dependencies.", "build-dependencies."}
+
+// cargoDependencies returns the dependencies declared in a Cargo manifest
+// (or a TOML block of the documentation), either as `name = "req"`,
+// `name = { version = "req" }` or in a [dependencies.name] table
+func cargoDependencies(doc *tomlDocument) []Dependency {
+	var deps []Dependency
+
+	for _, key := range doc.Keys {
+		rest := strings.TrimPrefix(key, "workspace.")
+		found := false
+
+		for _, table := range dependencyTables {
+			if after, ok := strings.CutPrefix(rest, table); ok {
+				rest, found = after, true
+				break
+			}
+		}
+
+		if !found {
+			continue
+		}
+
+		value := doc.Values[key]
+		name, field, _ := strings.Cut(rest, ".")
+		req := ""
+
+		switch v := value.Value.(type) {
+		case string:
+			if field == "" || field == "version" {
+				req = v
+			}
+
+		case map[string]interface{}:
+			if field == "" {
+				req, _ = v["version"].(string)
+			}
+		}
+
+		if req != "" {
+			deps = append(deps, Dependency{Name: name, Req: req, Line: value.Line})
+		}
+	}
+
+	return deps
+}
+
+// crateVersion returns the current version of a documented crate, from its manifest
+func crateVersion(crate CrateConfig) (string, error) {
+	content, err := os.ReadFile(filepath.Join(crate.Path, "Cargo.toml"))
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read the manifest of %s: %w", crate.Name, err)
+	}
+
+	doc, err := parseTOML(string(content))
+
+	if err != nil {
+		return "", fmt.Errorf("%s/Cargo.toml: %w", crate.Path, err)
+	}
+
+	version, _, err := doc.stringValue("package.version")
+
+	if err != nil {
+		return "", fmt.Errorf("no published version of %s: %w", crate.Name, err)
+	}
+
+	return version, nil
+}
+
+// documentedVersions returns the current versions of the documented crates
+// (the ones whose manifest can't be read are left out)
+func (dc *DocChecker) documentedVersions() map[string]string {
+	versions := make(map[string]string)
+
+	for _, crate := range dc.crates() {
+		if version, err := crateVersion(crate); err == nil {
+			versions[crate.Name] = version
+		}
+	}
+
+	return versions
+}
+
+// loadCrateVersions returns the versions used by the documented crates:
+// their own version, and the ones of their dependencies (the first crate
+// declaring a dependency wins), including the workspace ones
+func (dc *DocChecker) loadCrateVersions() map[string]string {
+	if dc.crateVersions != nil {
+		return dc.crateVersions
+	}
+
+	dc.crateVersions = make(map[string]string)
+	manifests := []string{filepath.Join(dc.config.ProjectRoot, "Cargo.toml")}
+
+	for _, crate := range dc.crates() {
+		manifests = append(manifests, filepath.Join(crate.Path, "Cargo.toml"))
+	}
+
+	for _, manifest := range manifests {
+		content, err := os.ReadFile(manifest)
+
+		if err != nil {
+			continue // e.g. a virtual workspace
+		}
+
+		doc, err := parseTOML(string(content))
+
+		if err != nil {
+			dc.logWarning(fmt.Sprintf("Cannot check the dependency versions with %s: %v", manifest, err))
+			continue
+		}
+
+		if name, _, err := doc.stringValue("package.name"); err == nil {
+			if version, _, err := doc.stringValue("package.version"); err == nil {
+				dc.crateVersions[name] = version
+			}
+		}
+
+		for _, dep := range cargoDependencies(doc) {
+			if _, exists := dc.crateVersions[dep.Name]; !exists {
+				dc.crateVersions[dep.Name] = dep.Req
+			}
+		}
+	}
+
+	return dc.crateVersions
+}
+
+// compatibilityRank returns the version of a requirement up to its leftmost
+// non-zero component (e.g. [2 0 0] for "2.15", [0 4 0] for "^0.4.4"),
+// as cargo considers the versions with the same rank compatible.
+// Ranges (e.g. ">=1.2, <2") and wildcards are not ranked.
+func compatibilityRank(req string) ([3]int, bool) {
+	var rank [3]int
+
+	req = strings.TrimLeft(strings.TrimSpace(req), "^~= ")
+
+	if req == "" || strings.ContainsAny(req, "<>*, ") {
+		return rank, false
+	}
+
+	for i, part := range strings.SplitN(req, ".", 3) {
+		if part == "x" || part == "X" {
+			break
+		}
+
+		// e.g. 1.0.0-beta.1 or 1.0.0+build
+		if end := strings.IndexAny(part, "-+"); end >= 0 {
+			part = part[:end]
+		}
+
+		n, err := strconv.Atoi(part)
+
+		if err != nil {
+			return rank, false
+		}
+
+		rank[i] = n
+
+		if n > 0 {
+			break
+		}
+	}
+
+	return rank, true
+}
+
+// isBehind checks whether a requirement is incompatible with,
+// and older than, the version used by the crates
+func isBehind(req, used string) bool {
+	reqRank, ok := compatibilityRank(req)
+
+	if !ok {
+		return false
+	}
+
+	usedRank, ok := compatibilityRank(used)
+
+	if !ok {
+		return false
+	}
+
+	for i := range reqRank {
+		if reqRank[i] != usedRank[i] {
+			return reqRank[i] < usedRank[i]
+		}
+	}
+
+	return false
+}
+
+// sameCompatibility checks whether a requirement is compatible with a version
+// (e.g. "0.2" with 0.2.1, but not "0.1.1"), as cargo would resolve it;
+// the ranges and wildcards (not ranked) are assumed to be
+func sameCompatibility(req, version string) bool {
+	reqRank, ok := compatibilityRank(req)
+
+	if !ok {
+		return true
+	}
+
+	versionRank, ok := compatibilityRank(version)
+
+	return !ok || reqRank == versionRank
+}
+
+// providedVersion returns the version of a dependency the generated project
+// of a crate always has (the documented crate, or a dependency for testing),
+// if it's one
+func (dc *DocChecker) providedVersion(name string, crate CrateConfig) (string, bool) {
+	fallback, builtin := testDependencies[name]
+
+	if !builtin && name != crate.Name {
+		return "", false
+	}
+
+	if version, exists := dc.loadCrateVersions()[name]; exists {
+		return version, true
+	}
+
+	return strings.Trim(fallback, `"`), true
+}
+
+// extraDependencies returns the deps= of a snippet which the generated project
+// doesn't already have: the ones it provides are left aside, as their version
+// can't be changed (the incompatible requirements are reported by lintDependencyDrift)
+func (dc *DocChecker) extraDependencies(snippet Snippet, crate CrateConfig) []Dependency {
+	var extra []Dependency
+
+	for _, dep := range snippet.Deps {
+		if _, provided := dc.providedVersion(dep.Name, crate); !provided {
+			extra = append(extra, dep)
+		}
+	}
+
+	return extra
+}
+
+// snippetDependencies returns the [dependencies] of the generated project
+// requested by its snippets (deps= attributes, but the ones it already has,
+// see extraDependencies): each one once, sorted, with the highest requirement
+// if the snippets don't agree
+func (dc *DocChecker) snippetDependencies(crate CrateConfig, snippetFiles []string) string {
+	requested := make(map[string]string)
+
+	for _, snippetFile := range snippetFiles {
+		for _, dep := range dc.manifest[strings.TrimSuffix(filepath.Base(snippetFile), ".rs")].Deps {
+			if _, builtin := testDependencies[dep.Name]; builtin || dep.Name == crate.Name {
+				continue
+			}
+
+			if req, exists := requested[dep.Name]; !exists || isBehind(req, dep.Req) {
+				requested[dep.Name] = dep.Req
+			}
+		}
+	}
+
+	names := make([]string, 0, len(requested))
+
+	for name := range requested {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var dependencies strings.Builder
+
+	for _, name := range names {
+		fmt.Fprintf(&dependencies, "%s = %q\n", name, requested[name])
+	}
+
+	return dependencies.String()
+}
+
+// lintDependencyDrift flags the dependency requirements of the documentation
+// (in the ```toml blocks, e.g. install instructions, and the deps= attributes
+// of the snippets) which are behind the versions used by the crates
+// (e.g. bson = "2" while the crate depends on bson 3.1), and the ```toml
+// blocks which are invalid or don't depend on the current version of the
+// documented crates
+func (dc *DocChecker) lintDependencyDrift(filePath string, lines []string, snippets []Snippet) {
+	versions := dc.loadCrateVersions()
+	var documented map[string]string
+
+	for _, snippet := range snippets {
+		crate, err := dc.crate(snippet.Crate)
+
+		for _, dep := range snippet.Deps {
+			// The snippet is compiled with the version of the generated project, whatever its requirement
+			if provided, exists := dc.providedVersion(dep.Name, crate); err == nil && exists {
+				if !sameCompatibility(dep.Req, provided) {
+					dc.addWarning(Warning{
+						Code:    warnProvidedDep,
+						File:    filePath,
+						Line:    snippet.StartLine,
+						Message: fmt.Sprintf("Snippet %s requires %s %s, but it's provided by the generated project in version %s, which can't be changed", snippet.ID, dep.Name, dep.Req, provided),
+					})
+				}
+
+				continue
+			}
+
+			if used, exists := versions[dep.Name]; exists && isBehind(dep.Req, used) {
+				dc.addWarning(Warning{
+					Code:    warnDepDrift,
+					File:    filePath,
+					Line:    snippet.StartLine,
+					Message: fmt.Sprintf("Snippet %s requires %s %s, behind the version used by the crate (%s)", snippet.ID, dep.Name, dep.Req, used),
+				})
+			}
+		}
+	}
+
+	var opening codeFence
+	inCodeBlock := false
+	fenceLine := 0
+	var block []string
+
+	for i, line := range lines {
+		if !inCodeBlock {
+			if fence, isFence := parseCodeFence(line); isFence {
+				inCodeBlock = true
+				opening = fence
+				fenceLine = i + 1
+				block = nil
+			}
+
+			continue
+		}
+
+		interrupted := opening.interruptedBy(line)
+
+		if !interrupted && !opening.closedBy(line) {
+			block = append(block, opening.content(line))
+			continue
+		}
+
+		inCodeBlock = false
+
+		if fence := parseFenceInfo(opening.info); fence.Lang == "toml" && !fence.Ignore {
+			if documented == nil {
+				documented = dc.documentedVersions()
+			}
+
+			dc.lintTOMLDependencies(filePath, fenceLine, block, versions, documented)
+		}
+
+		// Unclosed block, ending before the next one
+		if interrupted {
+			inCodeBlock = true
+			opening, _ = parseCodeFence(line)
+			fenceLine = i + 1
+			block = nil
+		}
+	}
+}
+
+// lintTOMLDependencies flags the dependencies of a ```toml block (opened at fenceLine)
+// which are behind the versions used by the crates, or which are on a documented
+// crate (e.g. tnuctipun) but not on its current version; or the block if invalid
+func (dc *DocChecker) lintTOMLDependencies(filePath string, fenceLine int, block []string, versions, documented map[string]string) {
+	doc, err := parseTOML(strings.Join(block, "\n"))
+
+	if err != nil {
+		line := 0
+		fmt.Sscanf(err.Error(), "line %d:", &line)
+		_, reason, _ := strings.Cut(err.Error(), ": ")
+
+		dc.addWarning(Warning{
+			Code:    warnInvalidTOML,
+			File:    filePath,
+			Line:    fenceLine + line,
+			Message: fmt.Sprintf("Invalid TOML block: %s", reason),
+		})
+
+		return
+	}
+
+	for _, dep := range cargoDependencies(doc) {
+		if current, exists := documented[dep.Name]; exists {
+			if !sameCompatibility(dep.Req, current) {
+				dc.addWarning(Warning{
+					Code:    warnCrateVersion,
+					File:    filePath,
+					Line:    fenceLine + dep.Line,
+					Message: fmt.Sprintf("%s = \"%s\" doesn't match the current version of the crate (%s)", dep.Name, dep.Req, current),
+				})
+			}
+
+			continue
+		}
+
+		if used, exists := versions[dep.Name]; exists && isBehind(dep.Req, used) {
+			dc.addWarning(Warning{
+				Code:    warnDepDrift,
+				File:    filePath,
+				Line:    fenceLine + dep.Line,
+				Message: fmt.Sprintf("%s = \"%s\" is behind the version used by the crate (%s)", dep.Name, dep.Req, used),
+			})
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DeterminismReport is the outcome of --verify-deterministic
+type DeterminismReport struct {
+	Deterministic bool     `json:"deterministic"`
+	Snippets      int      `json:"snippets"`    // Extracted by the first extraction
+	Differences   []string `json:"differences"` // Between the two extractions, then the two compilations
+}
+
+// extractionSnapshot describes the snippets extracted from the files, one line
+// per snippet (file, identifier, lines, included lines and code), in order
+func (dc *DocChecker) extractionSnapshot(files []*loadedFile) []string {
+	var snapshot []string
+
+	for _, file := range files {
+		path := dc.relativePath(file.path)
+
+		if file.readErr != nil || file.extractErr != nil {
+			snapshot = append(snapshot, fmt.Sprintf("%s: error %v %v", path, file.readErr, file.extractErr))
+			continue
+		}
+
+		for _, snippet := range file.snippets {
+			code := sha256.Sum256([]byte(snippet.Preamble + snippet.Content))
+
+			snapshot = append(snapshot, fmt.Sprintf("%s: %s at lines %d-%d, includes %v, ignored %t, skipped %t, code %x",
+				path, snippet.ID, snippet.StartLine, snippet.EndLine, snippet.Includes, snippet.Ignore, snippet.Skipped, code[:8]))
+		}
+	}
+
+	return snapshot
+}
+
+// compilationSnapshot describes the outcome of each snippet of the results,
+// one line per snippet (file, identifier, status, error category and codes)
+func compilationSnapshot(results *Results, projectRoot string) []string {
+	var snapshot []string
+
+	for file, result := range results.Files {
+		for _, snippet := range result.Snippets {
+			outcome := snippet.Status
+
+			if snippet.Failure != nil {
+				outcome += fmt.Sprintf(" (%s %v)", snippet.Failure.Category, snippet.Failure.Codes)
+			}
+
+			snapshot = append(snapshot, fmt.Sprintf("%s: %s %s", relativeTo(projectRoot, file), snippet.ID, outcome))
+		}
+	}
+
+	sort.Strings(snapshot)
+
+	return snapshot
+}
+
+// diffSnapshots returns the differences between two snapshots of a phase
+// (e.g. "extraction"), or none if they are the same
+func diffSnapshots(phase string, first, second []string) []string {
+	if strings.Join(first, "\n") == strings.Join(second, "\n") {
+		return nil
+	}
+
+	counts := make(map[string]int)
+
+	for _, line := range first {
+		counts[line]++
+	}
+
+	for _, line := range second {
+		counts[line]--
+	}
+
+	var differences []string
+
+	for _, line := range first {
+		if counts[line] > 0 {
+			counts[line]--
+			differences = append(differences, fmt.Sprintf("%s: only in the first run: %s", phase, line))
+		}
+	}
+
+	for _, line := range second {
+		if counts[line] < 0 {
+			counts[line]++
+			differences = append(differences, fmt.Sprintf("%s: only in the second run: %s", phase, line))
+		}
+	}
+
+	if len(differences) == 0 {
+		differences = append(differences, fmt.Sprintf("%s: the same snippets, in another order", phase))
+	}
+
+	return differences
+}
+
+// VerifyDeterministic extracts the snippets twice, then checks them twice
+// without the result cache, and reports the differences between the two runs
+// of each phase (e.g. a snippet found at other lines, or failing only once)
+func (dc *DocChecker) VerifyDeterministic() (*DeterminismReport, error) {
+	files, err := dc.discoverFiles()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover files: %w", err)
+	}
+
+	firstExtraction := dc.extractionSnapshot(dc.loadFiles(files))
+	report := &DeterminismReport{
+		Snippets:    len(firstExtraction),
+		Differences: diffSnapshots("extraction", firstExtraction, dc.extractionSnapshot(dc.loadFiles(files))),
+	}
+
+	var compilations [2][]string
+
+	for i := range compilations {
+		config := *dc.config
+		config.NoCache = true
+		config.OutputFormat = "json" // Nothing printed by the runs
+		config.ReportDir, config.BadgeFile = "", ""
+		config.DiffProject = false
+
+		results, err := NewDocChecker(&config).Run()
+
+		if err != nil {
+			return nil, fmt.Errorf("check %d of 2: %w", i+1, err)
+		}
+
+		compilations[i] = compilationSnapshot(results, dc.config.ProjectRoot)
+	}
+
+	report.Differences = append(report.Differences, diffSnapshots("compilation", compilations[0], compilations[1])...)
+	report.Deterministic = len(report.Differences) == 0
+
+	if report.Differences == nil {
+		report.Differences = []string{}
+	}
+
+	return report, nil
+}
+
+// writeDeterminismReport writes the report of --verify-deterministic, as JSON
+// or in a human readable way
+func writeDeterminismReport(w io.Writer, report *DeterminismReport, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(report)
+	}
+
+	if report.Deterministic {
+		fmt.Fprintln(w, colorSuccess(fmt.Sprintf("Deterministic: the %d snippets were extracted and checked twice, with the same results", report.Snippets)))
+		return nil
+	}
+
+	fmt.Fprintln(w, colorError(fmt.Sprintf("Not deterministic: %d difference(s) between two runs", len(report.Differences))))
+
+	for _, difference := range report.Differences {
+		fmt.Fprintf(w, "  • %s\n", difference)
+	}
+
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// cargoMessage is a line of `cargo check --message-format=json`
+type cargoMessage struct {
+	Reason string `json:"reason"`
+	Target struct {
+		Name string `json:"name"`
+	} `json:"target"`
+	Message *rustcDiagnostic `json:"message"`
+}
+
+// rustcDiagnostic is a diagnostic reported by the compiler
+type rustcDiagnostic struct {
+	Message string `json:"message"`
+	Code    *struct {
+		Code string `json:"code"`
+	} `json:"code"`
+	Level    string            `json:"level"`
+	Rendered string            `json:"rendered"`
+	Spans    []diagnosticSpan  `json:"spans"`
+	Children []rustcDiagnostic `json:"children"`
+
+	target string // Binary of the diagnostic (e.g. README-12)
+}
+
+type diagnosticSpan struct {
+	FileName                string  `json:"file_name"`
+	LineStart               int     `json:"line_start"`
+	LineEnd                 int     `json:"line_end"`
+	ColumnStart             int     `json:"column_start"`
+	ColumnEnd               int     `json:"column_end"`
+	IsPrimary               bool    `json:"is_primary"`
+	SuggestedReplacement    *string `json:"suggested_replacement"`
+	SuggestionApplicability *string `json:"suggestion_applicability"`
+}
+
+// Suggestion is a machine-applicable fix proposed by the compiler
+type Suggestion struct {
+	Message     string `json:"message"`
+	Replacement string `json:"replacement"`
+	Line        int    `json:"line"`   // Line in the markdown file
+	Column      int    `json:"column"` // Column in the markdown file
+
+	file string // Generated file of the binary, where the compiler located it
+}
+
+// cargoDiagnostics is the outcome of a cargo command run with JSON messages
+type cargoDiagnostics struct {
+	Diagnostics []rustcDiagnostic // Compiler messages
+	Text        string            // Output lines which are not JSON messages
+	Failed      bool              // Whether the command failed
+}
+
+// parseCargoDiagnostics separates the compiler messages from the rest of
+// the output of `cargo check --message-format=json`
+func parseCargoDiagnostics(output []byte) cargoDiagnostics {
+	var result cargoDiagnostics
+	var text strings.Builder
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "{") {
+			var msg cargoMessage
+
+			if err := json.Unmarshal([]byte(line), &msg); err == nil {
+				if msg.Reason == "compiler-message" && msg.Message != nil {
+					msg.Message.target = msg.Target.Name
+					result.Diagnostics = append(result.Diagnostics, *msg.Message)
+				}
+
+				continue
+			}
+		}
+
+		text.WriteString(line)
+		text.WriteString("\n")
+	}
+
+	result.Text = text.String()
+
+	return result
+}
+
+// Rendered returns the human readable errors, as printed by cargo without JSON
+// (or the raw output if there are no compiler errors, e.g. dependency resolution failure)
+func (d cargoDiagnostics) Rendered() string {
+	var rendered strings.Builder
+
+	for _, diag := range d.Diagnostics {
+		if diag.Level == "error" {
+			rendered.WriteString(diag.Rendered)
+		}
+	}
+
+	if rendered.Len() == 0 {
+		return d.Text
+	}
+
+	return rendered.String()
+}
+
+// Warnings returns the compiler warnings of a binary, as printed by cargo
+// (but the summary ones without location, e.g. "1 warning emitted")
+func (d cargoDiagnostics) Warnings(target string) []string {
+	var warnings []string
+
+	for _, diag := range d.Diagnostics {
+		if diag.Level == "warning" && diag.target == target && len(diag.Spans) > 0 {
+			warnings = append(warnings, strings.TrimRight(diag.Rendered, "\n"))
+		}
+	}
+
+	return warnings
+}
+
+// Lints returns the clippy lints about a binary (warnings or errors, with
+// --clippy-level deny), as printed by cargo clippy
+func (d cargoDiagnostics) Lints(target string) []string {
+	var lints []string
+
+	for _, diag := range d.Diagnostics {
+		if diag.target == target && diag.Code != nil && strings.HasPrefix(diag.Code.Code, "clippy::") {
+			lints = append(lints, strings.TrimRight(diag.Rendered, "\n"))
+		}
+	}
+
+	return lints
+}
+
+// Suggestions returns the machine-applicable suggestions of the compiler errors,
+// located in the generated files (see markdownSuggestions)
+func (d cargoDiagnostics) Suggestions() []Suggestion {
+	var suggestions []Suggestion
+
+	for _, diag := range d.Diagnostics {
+		if diag.Level != "error" {
+			continue
+		}
+
+		for _, child := range diag.Children {
+			for _, span := range child.Spans {
+				if span.SuggestedReplacement == nil || span.SuggestionApplicability == nil ||
+					*span.SuggestionApplicability != "MachineApplicable" {
+					continue
+				}
+
+				suggestions = append(suggestions, Suggestion{
+					Message:     child.Message,
+					Replacement: *span.SuggestedReplacement,
+					Line:        span.LineStart,
+					Column:      span.ColumnStart,
+					file:        span.FileName,
+				})
+			}
+		}
+	}
+
+	return suggestions
+}
+
+// failedInSnippet checks whether the compiler reported errors located in the
+// generated file of a binary (src/bin/BINARY.rs), rather than only a failure of
+// cargo (e.g. "no matching package named `bson` found")
+func (d cargoDiagnostics) failedInSnippet(target string) bool {
+	file := "src/bin/" + target + ".rs"
+
+	for _, diag := range d.Diagnostics {
+		if diag.Level != "error" || diag.target != target {
+			continue
+		}
+
+		for _, span := range diag.Spans {
+			if filepath.ToSlash(span.FileName) == file {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// failedBeforeCompiling checks whether cargo failed without any error of the
+// compiler for a binary (e.g. it couldn't resolve the dependencies)
+func (d cargoDiagnostics) failedBeforeCompiling(target string) bool {
+	if !d.Failed {
+		return false
+	}
+
+	for _, diag := range d.Diagnostics {
+		if diag.Level == "error" && diag.target == target {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ErrorCodes returns the distinct codes of the compiler errors (e.g. E0609), in order
+func (d cargoDiagnostics) ErrorCodes() []string {
+	var codes []string
+
+	for _, diag := range d.Diagnostics {
+		if diag.Level == "error" && diag.Code != nil && diag.Code.Code != "" && !containsCode(codes, diag.Code.Code) {
+			codes = append(codes, diag.Code.Code)
+		}
+	}
+
+	return codes
+}
+
+// failedAsExpected checks whether a compile_fail snippet failed to compile,
+// with one of the expected error codes if any (e.g. E0308)
+func (d cargoDiagnostics) failedAsExpected(expectedCodes []string) bool {
+	if !d.Failed {
+		return false
+	}
+
+	for _, code := range expectedCodes {
+		if containsCode(d.ErrorCodes(), code) {
+			return true
+		}
+	}
+
+	return len(expectedCodes) == 0
+}
+
+// compileFailError describes why a compile_fail snippet is not valid:
+// either it compiled, or it failed with other errors than the expected ones
+func (d cargoDiagnostics) compileFailError(expectedCodes []string) string {
+	if !d.Failed {
+		return "The snippet compiled, while it is expected to fail (compile_fail)"
+	}
+
+	codes := "no error code"
+
+	if found := d.ErrorCodes(); len(found) > 0 {
+		codes = strings.Join(found, ", ")
+	}
+
+	return fmt.Sprintf("Expected error %s (compile_fail), got %s:\n%s",
+		strings.Join(expectedCodes, " or "), codes, d.Rendered())
+}
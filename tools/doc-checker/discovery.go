@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Reasons why a markdown file is included in (or excluded from) the check
+const (
+	discoveryExplicit   = "EXPLICIT"     // given on the command line
+	discoveryDirectory  = "IN_DIRECTORY" // under a directory given on the command line
+	discoveryGitTracked = "GIT_TRACKED"  // tracked by git, matching *.md
+	discoveryCommunity  = "COMMUNITY"    // community file, with --community
+	discoveryRustdoc    = "RUSTDOC"      // crate source file, with --rustdoc
+	discoveryTargetDir  = "TARGET_DIR"   // under a target/ directory
+	discoveryGitignored = "GITIGNORED"   // ignored by a .gitignore rule
+	discoveryUntracked  = "UNTRACKED"    // not tracked by git (nor ignored)
+	discoveryDuplicate  = "DUPLICATE"    // already discovered otherwise
+)
+
+// DiscoveryEntry explains why a markdown file is checked or not,
+// as reported by --explain-discovery
+type DiscoveryEntry struct {
+	File     string `json:"file"` // Relative to the project root
+	Included bool   `json:"included"`
+	Reason   string `json:"reason"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// noteDiscovery records the decision about a discovered markdown file
+func (dc *DocChecker) noteDiscovery(file string, included bool, reason, detail string) {
+	dc.discovery = append(dc.discovery, DiscoveryEntry{
+		File:     dc.relativePath(file),
+		Included: included,
+		Reason:   reason,
+		Detail:   detail,
+	})
+}
+
+// markDuplicate excludes a community file already discovered otherwise
+func (dc *DocChecker) markDuplicate(file string) {
+	relPath := dc.relativePath(file)
+
+	for i := len(dc.discovery) - 1; i >= 0; i-- {
+		if entry := &dc.discovery[i]; entry.File == relPath && entry.Reason == discoveryCommunity {
+			entry.Included = false
+			entry.Reason = discoveryDuplicate
+			entry.Detail = "community file already discovered"
+
+			return
+		}
+	}
+}
+
+// ExplainDiscovery discovers the markdown files as Run would, without checking
+// them, and returns the reason why each file is included or excluded
+// (including the markdown files which git doesn't track, when no file is given)
+func (dc *DocChecker) ExplainDiscovery() ([]DiscoveryEntry, error) {
+	dc.discovery = nil
+
+	if _, err := dc.discoverFiles(); err != nil {
+		return nil, err
+	}
+
+	if len(dc.config.Files) == 0 {
+		if err := dc.explainUntrackedFiles(); err != nil {
+			return nil, err
+		}
+	}
+
+	entries := append([]DiscoveryEntry{}, dc.discovery...)
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].File < entries[j].File
+	})
+
+	return entries, nil
+}
+
+// explainUntrackedFiles records the markdown files not tracked by git,
+// with the .gitignore rule for the ignored ones
+func (dc *DocChecker) explainUntrackedFiles() error {
+	ignored, err := dc.gitFiles(append([]string{"ls-files", "--others", "--ignored", "--exclude-standard", "--"}, docFilePatterns...)...)
+
+	if err != nil {
+		return err
+	}
+
+	rules := make(map[string]string)
+
+	if len(ignored) > 0 {
+		// Output lines are "<source>:<line>:<pattern>\t<path>"
+		cmd := exec.Command("git", "check-ignore", "--verbose", "--stdin")
+		cmd.Dir = dc.config.ProjectRoot
+		cmd.Stdin = strings.NewReader(strings.Join(ignored, "\n") + "\n")
+
+		output, _ := cmd.Output() // exits with 1 when nothing matches
+
+		for _, line := range strings.Split(string(output), "\n") {
+			rule, path, found := strings.Cut(line, "\t")
+
+			if found {
+				rules[path] = rule
+			}
+		}
+	}
+
+	for _, file := range ignored {
+		detail := "ignored by git"
+
+		if rule := rules[file]; rule != "" {
+			source, pattern := rule, ""
+
+			// The pattern may itself contain ':'
+			if parts := strings.SplitN(rule, ":", 3); len(parts) == 3 {
+				source, pattern = parts[0]+":"+parts[1], parts[2]
+			}
+
+			detail = fmt.Sprintf("ignored by %s (%s)", source, pattern)
+		}
+
+		dc.noteDiscovery(filepath.Join(dc.config.ProjectRoot, file), false, discoveryGitignored, detail)
+	}
+
+	untracked, err := dc.gitFiles(append([]string{"ls-files", "--others", "--exclude-standard", "--"}, docFilePatterns...)...)
+
+	if err != nil {
+		return err
+	}
+
+	for _, file := range untracked {
+		dc.noteDiscovery(filepath.Join(dc.config.ProjectRoot, file), false, discoveryUntracked, "not tracked by git")
+	}
+
+	return nil
+}
+
+// gitFiles runs a git command listing files (one per line) in the project
+func (dc *DocChecker) gitFiles(args ...string) ([]string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dc.config.ProjectRoot
+	output, err := cmd.Output()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list git files (are you in a git repository?): %w", err)
+	}
+
+	var files []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+
+	for scanner.Scan() {
+		if file := strings.TrimSpace(scanner.Text()); file != "" {
+			files = append(files, file)
+		}
+	}
+
+	return files, scanner.Err()
+}
+
+// writeDiscovery writes the discovery explanation, as a table for humans,
+// as a JSON document (`-o json`) or as one JSON object per file (`-o jsonl`)
+func writeDiscovery(w io.Writer, entries []DiscoveryEntry, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(map[string]interface{}{"files": entries})
+
+	case "jsonl":
+		for _, entry := range entries {
+			if err := writeEvent(w, entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	included := 0
+
+	for _, entry := range entries {
+		decision := "excluded"
+
+		if entry.Included {
+			decision = "included"
+			included++
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", decision, entry.File, entry.Reason, entry.Detail)
+	}
+
+	tw.Flush()
+
+	_, err := fmt.Fprintf(w, "\n%d file(s) included, %d excluded\n", included, len(entries)-included)
+
+	return err
+}
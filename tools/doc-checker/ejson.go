@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decimal128 value of $numberDecimal (e.g. "1.5E+3")
+var decimalRegex = regexp.MustCompile(`^(?:[+-]?(?:[0-9]+(?:\.[0-9]*)?|\.[0-9]+)(?:[eE][+-]?[0-9]+)?|-?Infinity|NaN)$`)
+
+// Object ID of $oid
+var objectIDRegex = regexp.MustCompile(`^[0-9a-fA-F]{24}$`)
+
+// ejsonTypes checks the value of the keys of the MongoDB Extended JSON types
+// (e.g. {"$oid": "..."}), as specified for the canonical and relaxed formats
+var ejsonTypes = map[string]func(value interface{}) error{
+	"$oid": func(value interface{}) error {
+		if s, ok := value.(string); !ok || !objectIDRegex.MatchString(s) {
+			return fmt.Errorf("expected 24 hexadecimal digits")
+		}
+
+		return nil
+	},
+	"$date": func(value interface{}) error {
+		switch v := value.(type) {
+		case string:
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				return fmt.Errorf("expected an ISO-8601 date (e.g. 2024-01-02T03:04:05Z)")
+			}
+
+			return nil
+
+		case map[string]interface{}:
+			if len(v) == 1 && v["$numberLong"] != nil {
+				return checkNumberLong(v["$numberLong"])
+			}
+		}
+
+		return fmt.Errorf(`expected an ISO-8601 date, or {"$numberLong": "..."}`)
+	},
+	"$numberInt": func(value interface{}) error {
+		if s, ok := value.(string); ok {
+			if _, err := strconv.ParseInt(s, 10, 32); err == nil {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("expected a 32-bit integer as a string")
+	},
+	"$numberLong": checkNumberLong,
+	"$numberDouble": func(value interface{}) error {
+		if s, ok := value.(string); ok {
+			if _, err := strconv.ParseFloat(s, 64); err == nil || s == "Infinity" || s == "-Infinity" || s == "NaN" {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("expected a double as a string")
+	},
+	"$numberDecimal": func(value interface{}) error {
+		if s, ok := value.(string); !ok || !decimalRegex.MatchString(s) {
+			return fmt.Errorf("expected a decimal as a string")
+		}
+
+		return nil
+	},
+	"$binary": func(value interface{}) error {
+		v, ok := value.(map[string]interface{})
+		data, isString := v["base64"].(string)
+		subType, isSubType := v["subType"].(string)
+
+		if !ok || len(v) != 2 || !isString || !isSubType {
+			return fmt.Errorf(`expected {"base64": "...", "subType": "..."}`)
+		}
+
+		if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+			return fmt.Errorf("invalid base64 data")
+		}
+
+		if _, err := strconv.ParseUint(subType, 16, 8); err != nil || len(subType) > 2 {
+			return fmt.Errorf("expected a subType of 1 or 2 hexadecimal digits")
+		}
+
+		return nil
+	},
+	"$regularExpression": func(value interface{}) error {
+		v, ok := value.(map[string]interface{})
+		_, isPattern := v["pattern"].(string)
+		_, isOptions := v["options"].(string)
+
+		if !ok || len(v) != 2 || !isPattern || !isOptions {
+			return fmt.Errorf(`expected {"pattern": "...", "options": "..."}`)
+		}
+
+		return nil
+	},
+	"$timestamp": func(value interface{}) error {
+		v, ok := value.(map[string]interface{})
+		_, isT := v["t"].(float64)
+		_, isI := v["i"].(float64)
+
+		if !ok || len(v) != 2 || !isT || !isI {
+			return fmt.Errorf(`expected {"t": ..., "i": ...}`)
+		}
+
+		return nil
+	},
+	"$minKey": func(value interface{}) error {
+		if value != float64(1) {
+			return fmt.Errorf("expected 1")
+		}
+
+		return nil
+	},
+	"$maxKey": func(value interface{}) error {
+		if value != float64(1) {
+			return fmt.Errorf("expected 1")
+		}
+
+		return nil
+	},
+	"$symbol": func(value interface{}) error {
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("expected a string")
+		}
+
+		return nil
+	},
+	"$code": func(value interface{}) error {
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("expected a string")
+		}
+
+		return nil
+	},
+}
+
+// checkNumberLong checks the value of $numberLong (also in $date)
+func checkNumberLong(value interface{}) error {
+	if s, ok := value.(string); ok {
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected a 64-bit integer as a string")
+}
+
+// jsonError is an error of a JSON document, at an offset of its content
+type jsonError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *jsonError) Error() string {
+	return e.Err.Error()
+}
+
+// checkEJSON checks a JSON document (or a sequence of them, e.g. the documents
+// of a collection), with the MongoDB Extended JSON types (e.g. {"$oid": "..."})
+func checkEJSON(content string) *jsonError {
+	// The syntax first, with the messages of the decoder rather than of its tokens
+	syntax := json.NewDecoder(strings.NewReader(content))
+
+	for {
+		var value interface{}
+		err := syntax.Decode(&value)
+
+		if err == io.EOF {
+			break
+		}
+
+		var syntaxErr *json.SyntaxError
+
+		switch {
+		// At the offending character (the offset of the error is just after it)
+		case errors.As(err, &syntaxErr):
+			return &jsonError{Offset: syntaxErr.Offset - 1, Err: err}
+		case err == io.ErrUnexpectedEOF:
+			return &jsonError{Offset: int64(len(strings.TrimRight(content, " \t\n"))), Err: fmt.Errorf("unexpected end of JSON input")}
+		case err != nil:
+			return &jsonError{Offset: syntax.InputOffset(), Err: err}
+		}
+	}
+
+	dec := json.NewDecoder(strings.NewReader(content))
+
+	for {
+		err := checkEJSONValue(dec)
+
+		if err == io.EOF {
+			return nil
+		}
+
+		// Only the errors of the Extended JSON types, the syntax being valid
+		var jsonErr *jsonError
+
+		if errors.As(err, &jsonErr) {
+			return jsonErr
+		}
+
+		if err != nil {
+			return &jsonError{Offset: dec.InputOffset(), Err: err}
+		}
+	}
+}
+
+// checkEJSONValue reads a value of the document, and checks its Extended JSON types
+func checkEJSONValue(dec *json.Decoder) error {
+	token, err := dec.Token()
+
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('['):
+		for dec.More() {
+			if err := checkEJSONValue(dec); err != nil {
+				return unexpectedEOF(err)
+			}
+		}
+
+	case json.Delim('{'):
+		keys := 0
+		typeKey, typeOffset := "", int64(0)
+
+		for dec.More() {
+			token, err := dec.Token()
+
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+
+			key, _ := token.(string)
+			keys++
+
+			if check, isType := ejsonTypes[key]; isType {
+				typeKey, typeOffset = key, dec.InputOffset()
+
+				var value interface{}
+
+				if err := dec.Decode(&value); err != nil {
+					return unexpectedEOF(err)
+				}
+
+				if err := check(value); err != nil {
+					return &jsonError{Offset: typeOffset, Err: fmt.Errorf("invalid %s: %w", key, err)}
+				}
+			} else if err := checkEJSONValue(dec); err != nil {
+				return unexpectedEOF(err)
+			}
+		}
+
+		if typeKey != "" && keys > 1 {
+			return &jsonError{Offset: typeOffset, Err: fmt.Errorf("%s must be the only key of its object", typeKey)}
+		}
+
+	default:
+		return nil
+	}
+
+	// Closing delimiter
+	if _, err := dec.Token(); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	return nil
+}
+
+// unexpectedEOF reports the end of the input within a value as unexpected
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// lintJSONBlocks flags the ```json blocks (e.g. the documents built by the
+// examples) which are not valid JSON, or MongoDB Extended JSON, at the line of the error
+func (dc *DocChecker) lintJSONBlocks(filePath string, lines []string) {
+	for _, block := range codeBlocks(lines) {
+		if block.Info.Lang != "json" || block.Info.Ignore {
+			continue
+		}
+
+		content := strings.Join(block.Lines, "\n")
+		err := checkEJSON(content)
+
+		if err == nil {
+			continue
+		}
+
+		offset := min(int(err.Offset), len(content))
+		before := content[:offset]
+		line := strings.Count(before, "\n") + 1
+		column := offset - strings.LastIndex(before, "\n")
+
+		dc.addWarning(Warning{
+			Code:    warnInvalidJSON,
+			File:    filePath,
+			Line:    block.Line + line,
+			Message: fmt.Sprintf("Invalid JSON block (column %d): %v", column, err),
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Prefix of the environment variables setting the options (e.g. DOC_CHECKER_OUTPUT for --output)
+const envPrefix = "DOC_CHECKER_"
+
+// envVarName returns the environment variable of an option (e.g. DOC_CHECKER_WORK_KEY for --work-key)
+func envVarName(option string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(option, "-", "_"))
+}
+
+// applyEnv sets the options of the given flag set (not parsed yet) from the
+// DOC_CHECKER_* variables of the environment (as "NAME=VALUE"), so the flags
+// still take precedence, and returns the variable of each option it set.
+// The unknown DOC_CHECKER_* variables are reported as warnings.
+func applyEnv(flags *flag.FlagSet, environ []string, warnings io.Writer) (map[string]string, error) {
+	options := make(map[string]*flag.Flag)
+
+	flags.VisitAll(func(f *flag.Flag) {
+		if _, isAlias := flagAliases[f.Name]; !isAlias {
+			options[envVarName(f.Name)] = f
+		}
+	})
+
+	applied := make(map[string]string)
+	var unknown []string
+
+	for _, entry := range environ {
+		name, value, _ := strings.Cut(entry, "=")
+
+		if !strings.HasPrefix(name, envPrefix) {
+			continue
+		}
+
+		f, exists := options[name]
+
+		if !exists {
+			unknown = append(unknown, name)
+			continue
+		}
+
+		if err := f.Value.Set(value); err != nil {
+			return nil, fmt.Errorf("invalid %s '%s': %v", name, value, err)
+		}
+
+		applied[f.Name] = name
+	}
+
+	if len(unknown) > 0 {
+		names := make([]string, 0, len(options))
+
+		for name := range options {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		sort.Strings(unknown)
+
+		for _, name := range unknown {
+			fmt.Fprintf(warnings, "Warning: unknown environment variable %s%s\n", name, suggestConfigName(name, names))
+		}
+	}
+
+	return applied, nil
+}
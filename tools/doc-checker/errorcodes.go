@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Codes of the compiler diagnostics (e.g. E0609), or names of the lints denied as errors
+var errorCodeRegex = regexp.MustCompile(`^(E[0-9]{4}|[a-z][a-z0-9_]*(::[a-z][a-z0-9_]*)*)$`)
+
+// parseErrorCodes parses the comma-separated error codes of --select or --ignore-codes
+func parseErrorCodes(option, value string) ([]string, error) {
+	var codes []string
+
+	for _, code := range strings.Split(value, ",") {
+		code = strings.TrimSpace(code)
+
+		if !errorCodeRegex.MatchString(code) {
+			return nil, fmt.Errorf("invalid --%s error code '%s' (e.g. E0609)", option, code)
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// containsCode checks whether a list of codes contains one of the given ones
+func containsCode(codes []string, code string) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// excludedByCodes checks whether the failure with the given error codes is
+// excluded by --select (none of its codes is selected) or --ignore-codes
+// (all its codes are ignored, with the ignore_codes of the frontmatter of its file)
+func (dc *DocChecker) excludedByCodes(codes []string, fileIgnoreCodes []string) bool {
+	if len(dc.config.SelectCodes) > 0 {
+		selected := false
+
+		for _, code := range codes {
+			selected = selected || containsCode(dc.config.SelectCodes, code)
+		}
+
+		if !selected {
+			return true
+		}
+	}
+
+	ignoreCodes := append(append([]string{}, dc.config.IgnoreCodes...), fileIgnoreCodes...)
+
+	if len(ignoreCodes) == 0 || len(codes) == 0 {
+		return false
+	}
+
+	for _, code := range codes {
+		if !containsCode(ignoreCodes, code) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortedCodes returns the error codes of the summary, the most frequent first
+func sortedCodes(errorsByCode map[string]int) []string {
+	codes := make([]string, 0, len(errorsByCode))
+
+	for code := range errorsByCode {
+		codes = append(codes, code)
+	}
+
+	sort.Slice(codes, func(i, j int) bool {
+		ci, cj := errorsByCode[codes[i]], errorsByCode[codes[j]]
+
+		if ci != cj {
+			return ci > cj
+		}
+
+		return codes[i] < codes[j]
+	})
+
+	return codes
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// FeatureSetResult is the outcome of the compilation of the snippets with a
+// feature set of the --features-matrix
+type FeatureSetResult struct {
+	Features string `json:"features"` // e.g. "uuid,chrono", or "default"
+
+	MatrixResult
+}
+
+// parseFeaturesMatrix parses the feature sets of --features-matrix, separated
+// by semicolons (e.g. "default;chrono;uuid,chrono")
+func parseFeaturesMatrix(value string) ([][]string, error) {
+	var matrix [][]string
+	seen := make(map[string]bool)
+
+	for _, set := range strings.Split(value, ";") {
+		var features []string
+
+		for _, feature := range strings.Split(set, ",") {
+			feature = strings.TrimSpace(feature)
+
+			if !featureNameRegex.MatchString(feature) {
+				return nil, fmt.Errorf("invalid feature %q in --features-matrix %s", feature, value)
+			}
+
+			if !containsCode(features, feature) {
+				features = append(features, feature)
+			}
+		}
+
+		if key := strings.Join(features, ","); !seen[key] {
+			seen[key] = true
+			matrix = append(matrix, features)
+		}
+	}
+
+	return matrix, nil
+}
+
+// featureSetCrate returns the default crate as compiled with a feature set of
+// the matrix: without its default features, unless the set has "default"
+func featureSetCrate(crate CrateConfig, set []string) CrateConfig {
+	crate.Features = nil
+	crate.NoDefaultFeatures = true
+
+	for _, feature := range set {
+		if feature == "default" {
+			crate.NoDefaultFeatures = false
+		} else {
+			crate.Features = append(crate.Features, feature)
+		}
+	}
+
+	return crate
+}
+
+// checkFeaturesMatrix compiles the snippets of the default crate again with each
+// feature set of --features-matrix, in a generated project per set, and reports
+// the matrix in the summary, e.g. to reveal the examples which only work with a
+// non-default feature; the snippets with their own features (features= attribute,
+// or frontmatter of their file), the compile_fail ones and the unclosed ones are
+// not part of it
+func (dc *DocChecker) checkFeaturesMatrix() {
+	crate := dc.crates()[0]
+
+	var binNames []string
+
+	for _, binName := range dc.manifest.byCrate()[crate.Name] {
+		if len(dc.manifest[binName].Features) == 0 {
+			binNames = append(binNames, binName)
+		}
+	}
+
+	for _, set := range dc.config.FeaturesMatrix {
+		result := FeatureSetResult{Features: strings.Join(set, ",")}
+
+		if len(binNames) > 0 {
+			name := featureSuffixRegex.ReplaceAllString(strings.Join(set, "_"), "_")
+			projectDir := filepath.Join(dc.tempDir, "features_matrix", name)
+
+			dc.logInfo(fmt.Sprintf("Compiling the snippets with the features %s...", result.Features))
+
+			err := dc.createCargoProject(projectDir, featureSetCrate(crate, set), dc.snippetFiles(binNames))
+
+			if err == nil {
+				err = dc.checkMatrixSnippets(projectDir, dc.matrixTargetDir(projectDir, "features", name), "the features "+result.Features, binNames, &result.MatrixResult)
+			}
+
+			if err != nil {
+				result.Error = err.Error()
+				dc.logError(fmt.Sprintf("Failed to compile the snippets with the features %s: %v", result.Features, err))
+			}
+		}
+
+		dc.results.Summary.FeatureSets = append(dc.results.Summary.FeatureSets, result)
+	}
+}
+
+// mergeFeatureSets adds the feature matrix of a shard to the one of the
+// previous shards, each shard compiling its own snippets
+func mergeFeatureSets(merged, shard []FeatureSetResult) []FeatureSetResult {
+	for _, result := range shard {
+		found := false
+
+		for i := range merged {
+			if merged[i].Features == result.Features {
+				found = true
+				merged[i].add(result.MatrixResult)
+			}
+		}
+
+		if !found {
+			merged = append(merged, result)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Features mentioned in the prose (e.g. `tnuctipun = { version = "0.2", features = ["chrono"] }`,
+// or just `features = ["chrono"]`), with the dependency they are given to, if any
+var featuresMentionRegex = regexp.MustCompile(`(?:([A-Za-z0-9_-]+)\s*=\s*\{[^}]*?)?\bfeatures\s*=\s*\[([^\]]*)\]`)
+
+// featureMention is a list of features of a documented crate, in the documentation
+type featureMention struct {
+	Crate    string
+	Features []string
+	Line     int // Line in the TOML document, or in the markdown file for the prose
+}
+
+// crateFeatures returns the features of a crate, from its manifest: the ones
+// of its [features] table, and its optional dependencies (unless only used as dep:NAME)
+func crateFeatures(crate CrateConfig) ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(crate.Path, "Cargo.toml"))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest of %s: %w", crate.Name, err)
+	}
+
+	doc, err := parseTOML(string(content))
+
+	if err != nil {
+		return nil, fmt.Errorf("%s/Cargo.toml: %w", crate.Path, err)
+	}
+
+	features := map[string]bool{"default": true}
+	explicitDeps := make(map[string]bool) // Optional dependencies enabled as dep:NAME
+
+	for _, key := range doc.Keys {
+		name, found := strings.CutPrefix(key, "features.")
+
+		if !found {
+			continue
+		}
+
+		features[name] = true
+		enabled, _, _ := doc.stringsValue(key)
+
+		for _, feature := range enabled {
+			if dep, found := strings.CutPrefix(feature, "dep:"); found {
+				explicitDeps[dep] = true
+			}
+		}
+	}
+
+	for _, key := range doc.Keys {
+		rest, found := strings.CutPrefix(key, "dependencies.")
+
+		if !found {
+			continue
+		}
+
+		name, field, _ := strings.Cut(rest, ".")
+		optional := false
+
+		switch v := doc.Values[key].Value.(type) {
+		case map[string]interface{}:
+			optional, _ = v["optional"].(bool)
+		case bool:
+			optional = field == "optional" && v
+		}
+
+		if optional && !explicitDeps[name] {
+			features[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(features))
+
+	for name := range features {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// documentedFeatures returns the features of the documented crates
+// (the ones whose manifest can't be read are left out)
+func (dc *DocChecker) documentedFeatures() map[string][]string {
+	features := make(map[string][]string)
+
+	for _, crate := range dc.crates() {
+		if names, err := crateFeatures(crate); err == nil {
+			features[crate.Name] = names
+		}
+	}
+
+	return features
+}
+
+// dependencyFeatures returns the features enabled for the dependencies
+// of a Cargo manifest (or a TOML block of the documentation), either as
+// `name = { features = [...] }` or in a [dependencies.name] table
+func dependencyFeatures(doc *tomlDocument) []featureMention {
+	var mentions []featureMention
+
+	for _, key := range doc.Keys {
+		rest := strings.TrimPrefix(key, "workspace.")
+		found := false
+
+		for _, table := range dependencyTables {
+			if after, ok := strings.CutPrefix(rest, table); ok {
+				rest, found = after, true
+				break
+			}
+		}
+
+		if !found {
+			continue
+		}
+
+		name, field, _ := strings.Cut(rest, ".")
+		var features []string
+
+		switch v := doc.Values[key].Value.(type) {
+		case map[string]interface{}:
+			if field == "" {
+				features = tomlStrings(v["features"])
+			}
+
+		case []interface{}:
+			if field == "features" {
+				features = tomlStrings(v)
+			}
+		}
+
+		if len(features) > 0 {
+			mentions = append(mentions, featureMention{Crate: name, Features: features, Line: doc.Values[key].Line})
+		}
+	}
+
+	return mentions
+}
+
+// tomlStrings returns the strings of a TOML array (or nil if not an array)
+func tomlStrings(value interface{}) []string {
+	values, _ := value.([]interface{})
+	var strs []string
+
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+
+	return strs
+}
+
+// lintFeatureNames flags the features of the documented crates which don't
+// exist (e.g. a typo, or a removed feature), as given to their dependency in
+// the ```toml blocks, or mentioned in the prose (as `features = ["..."]`,
+// then of the default crate unless given to a dependency)
+func (dc *DocChecker) lintFeatureNames(filePath string, lines []string) {
+	features := dc.documentedFeatures()
+
+	if len(features) == 0 {
+		return
+	}
+
+	defaultCrate := dc.crates()[0].Name
+	var mentions []featureMention
+
+	var opening codeFence
+	inCodeBlock := false
+	fenceLine := 0
+	var block []string
+
+	for i, line := range lines {
+		if !inCodeBlock {
+			if fence, isFence := parseCodeFence(line); isFence {
+				inCodeBlock = true
+				opening = fence
+				fenceLine = i + 1
+				block = nil
+
+				continue
+			}
+
+			for _, match := range featuresMentionRegex.FindAllStringSubmatch(line, -1) {
+				crate := match[1]
+
+				if crate == "" {
+					crate = defaultCrate
+				}
+
+				var names []string
+
+				// Not the placeholders (e.g. features = ["..."])
+				for _, name := range strings.Split(match[2], ",") {
+					if name = strings.Trim(strings.TrimSpace(name), `"'`); featureNameRegex.MatchString(name) {
+						names = append(names, name)
+					}
+				}
+
+				mentions = append(mentions, featureMention{Crate: crate, Features: names, Line: i + 1})
+			}
+
+			continue
+		}
+
+		interrupted := opening.interruptedBy(line)
+
+		if !interrupted && !opening.closedBy(line) {
+			block = append(block, opening.content(line))
+			continue
+		}
+
+		inCodeBlock = false
+
+		// Invalid blocks are reported as INVALID_TOML
+		if fence := parseFenceInfo(opening.info); fence.Lang == "toml" && !fence.Ignore {
+			if doc, err := parseTOML(strings.Join(block, "\n")); err == nil {
+				for _, mention := range dependencyFeatures(doc) {
+					mention.Line += fenceLine
+					mentions = append(mentions, mention)
+				}
+			}
+		}
+
+		// Unclosed block, ending before the next one
+		if interrupted {
+			inCodeBlock = true
+			opening, _ = parseCodeFence(line)
+			fenceLine = i + 1
+			block = nil
+		}
+	}
+
+	for _, mention := range mentions {
+		known, documented := features[mention.Crate]
+
+		if !documented {
+			continue
+		}
+
+		for _, feature := range mention.Features {
+			if containsCode(known, feature) {
+				continue
+			}
+
+			dc.addWarning(Warning{
+				Code:    warnUnknownFeature,
+				File:    filePath,
+				Line:    mention.Line,
+				Message: fmt.Sprintf("Feature %s of %s doesn't exist%s", feature, mention.Crate, suggestConfigName(feature, known)),
+			})
+		}
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FenceInfo is the parsed info string of a code fence,
+// e.g. "rust", "rust:ignore", "rust,retries=3" or `rust deps="rand=0.8,futures=0.3"`
+type FenceInfo struct {
+	Lang         string
+	Ignore       bool
+	IgnoreReason string            // Why the snippet is ignored, e.g. `ignore(reason="pseudo-code")`
+	Preview      bool              // Example of an unreleased or experimental API
+	Attrs        map[string]string // key=value attributes
+
+	CompileFail bool     // The compilation is expected to fail (e.g. type-safety examples)
+	ErrorCodes  []string // Errors expected with compile_fail (e.g. E0308), as in rustdoc
+	NoRun       bool     // Compiled but never run (e.g. examples needing a live MongoDB)
+	NoMain      bool     // Only made of items (e.g. structs and impls), not wrapped in a main function
+	ShouldPanic bool     // Expected to panic when run (e.g. validation errors)
+	Setup       bool     // Prepended to the later snippets of the file (e.g. the structs of a tutorial)
+	Edition     string   // Rust edition of the snippet (e.g. "2018" for edition2018), "" for the default one
+}
+
+// Ignore flag with its reason, e.g. `ignore(reason="pseudo-code")`
+var ignoreReasonRegex = regexp.MustCompile(`^ignore\(reason="([^"]*)"\)$`)
+
+// parseIgnore parses an ignore flag, possibly with its reason
+func parseIgnore(token string) (string, bool) {
+	if token == "ignore" {
+		return "", true
+	}
+
+	if m := ignoreReasonRegex.FindStringSubmatch(token); m != nil {
+		return strings.TrimSpace(m[1]), true
+	}
+
+	return "", false
+}
+
+// Error codes of the compiler (e.g. E0308)
+var fenceErrorCodeRegex = regexp.MustCompile(`^E[0-9]{4}$`)
+
+// Edition attributes, as in rustdoc (e.g. edition2018)
+var fenceEditionRegex = regexp.MustCompile(`^edition([0-9]+)$`)
+
+// Rust editions supported by the edition attributes
+var rustEditions = []string{"2015", "2018", "2021", "2024"}
+
+// parseFenceInfo parses the info string of a code fence: the language
+// (possibly with the ":ignore" suffix, or `:ignore(reason="...")`), then attributes
+// separated by commas or spaces, either flags (e.g. "ignore") or key=value pairs
+// (the value being possibly double-quoted, e.g. to contain commas)
+func parseFenceInfo(info string) FenceInfo {
+	fence := FenceInfo{Attrs: make(map[string]string)}
+
+	quoted := false
+	depth := 0 // Of the parentheses, e.g. in cfg=all(unix,target_pointer_width="64")
+	tokens := strings.FieldsFunc(info, func(r rune) bool {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '(' && !quoted:
+			depth++
+		case r == ')' && !quoted && depth > 0:
+			depth--
+		}
+
+		return !quoted && depth == 0 && (r == ',' || r == ' ' || r == '\t')
+	})
+
+	lastKey := "" // Key of the previous token, if key=value
+
+	for i, token := range tokens {
+		key := ""
+
+		if i == 0 {
+			fence.Lang = token
+
+			if lang, suffix, ok := strings.Cut(token, ":"); ok {
+				if reason, isIgnore := parseIgnore(suffix); isIgnore {
+					fence.Lang = lang
+					fence.Ignore = true
+					fence.IgnoreReason = reason
+				}
+			}
+
+			continue
+		}
+
+		if reason, isIgnore := parseIgnore(token); isIgnore {
+			fence.Ignore = true
+			fence.IgnoreReason = reason
+		} else if name, value, ok := strings.Cut(token, "="); ok {
+			key = name
+			fence.Attrs[key] = strings.ReplaceAll(value, `"`, "")
+		} else if token == "preview" {
+			fence.Preview = true
+		} else if token == "compile_fail" {
+			fence.CompileFail = true
+		} else if token == "no_run" {
+			fence.NoRun = true
+		} else if token == "no_main" {
+			fence.NoMain = true
+		} else if token == "should_panic" {
+			fence.ShouldPanic = true
+		} else if token == "setup" {
+			fence.Setup = true
+		} else if m := fenceEditionRegex.FindStringSubmatch(token); m != nil {
+			fence.Edition = m[1]
+		} else if fenceErrorCodeRegex.MatchString(token) {
+			fence.ErrorCodes = append(fence.ErrorCodes, token)
+		} else if lastKey == "features" {
+			// e.g. "mongodb" in "rust,features=chrono,mongodb"
+			key = lastKey
+			fence.Attrs[key] += "," + token
+		}
+
+		lastKey = key
+	}
+
+	return fence
+}
+
+// Category of the failures of the code blocks without closing fence
+const categoryMalformedMarkdown = "MALFORMED_MARKDOWN"
+
+// unclosedFence returns the MALFORMED_MARKDOWN failure of a snippet whose
+// closing fence is missing, or nil: its content, up to the next fence or the
+// end of the file, is most likely not only code (e.g. the prose after it)
+func (dc *DocChecker) unclosedFence(binName string) *Failure {
+	source := dc.manifest[binName]
+
+	if !source.Unclosed {
+		return nil
+	}
+
+	failure := dc.snippetFailure(binName, categoryMalformedMarkdown,
+		fmt.Sprintf("%s:%d: code block not closed, so its content (up to line %d) is not compiled",
+			dc.relativePath(source.File), source.StartLine, source.EndLine))
+
+	return &failure
+}
+
+// isRust checks whether the fence is a Rust code block: tagged `rust` or `rs`,
+// or with one of the other languages of the Rust snippets (e.g. "tnuctipun")
+func (f FenceInfo) isRust(aliases []string) bool {
+	return f.Lang == "rust" || f.Lang == "rs" || containsCode(aliases, f.Lang)
+}
+
+// crate returns the documented crate targeted by the snippet
+// (the `crate=NAME` attribute), or "" for the default one
+func (f FenceInfo) crate() string {
+	return f.Attrs["crate"]
+}
+
+// retries returns the number of times a failing snippet is retried
+// (the `retries=N` attribute), e.g. for the timing-sensitive examples
+func (f FenceInfo) retries() (int, error) {
+	value, exists := f.Attrs["retries"]
+
+	if !exists {
+		return 0, nil
+	}
+
+	retries, err := strconv.Atoi(value)
+
+	if err != nil || retries < 0 {
+		return 0, fmt.Errorf("invalid retries=%s: must be a positive number", value)
+	}
+
+	return retries, nil
+}
+
+// timeout returns the number of seconds a snippet can run with --run (the
+// `timeout=SECONDS` attribute), e.g. for a slower example, or 0 for --run-timeout
+func (f FenceInfo) timeout() (int, error) {
+	value, exists := f.Attrs["timeout"]
+
+	if !exists {
+		return 0, nil
+	}
+
+	timeout, err := strconv.Atoi(value)
+
+	if err != nil || timeout < 1 {
+		return 0, fmt.Errorf("invalid timeout=%s: must be a number of seconds", value)
+	}
+
+	return timeout, nil
+}
+
+// edition returns the Rust edition of the snippet (the `editionYYYY` attribute),
+// or "" for the one of the generated project
+func (f FenceInfo) edition() (string, error) {
+	if f.Edition == "" {
+		return "", nil
+	}
+
+	for _, edition := range rustEditions {
+		if f.Edition == edition {
+			return edition, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid edition%s: must be one of %s", f.Edition, strings.Join(rustEditions, ", "))
+}
+
+// features returns the features of the crate enabled to compile the snippet,
+// sorted (the `features=NAME,...` attribute, none with `features=""`),
+// or nil without this attribute
+func (f FenceInfo) features() ([]string, error) {
+	value, exists := f.Attrs["features"]
+
+	if !exists {
+		return nil, nil
+	}
+
+	features := []string{}
+
+	if strings.TrimSpace(value) == "" {
+		return features, nil
+	}
+
+	for _, feature := range strings.Split(value, ",") {
+		feature = strings.TrimSpace(feature)
+
+		if !featureNameRegex.MatchString(feature) {
+			return nil, fmt.Errorf("invalid features=%s: must be feature names (e.g. chrono,mongodb)", value)
+		}
+
+		if !containsCode(features, feature) {
+			features = append(features, feature)
+		}
+	}
+
+	sort.Strings(features)
+
+	return features, nil
+}
+
+// cfg returns the configuration predicate of the hosts where the snippet is
+// checked (the `cfg=PREDICATE` attribute), or nil without this attribute
+func (f FenceInfo) cfg() (*cfgPredicate, error) {
+	value, exists := f.Attrs["cfg"]
+
+	if !exists {
+		return nil, nil
+	}
+
+	predicate, err := parseCfg(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &predicate, nil
+}
+
+// deps returns the dependencies required by the snippet, from the
+// `deps="NAME=VERSION,..."` attribute (or `dep=NAME=VERSION` for a single one)
+func (f FenceInfo) deps() ([]Dependency, error) {
+	var deps []Dependency
+
+	for _, key := range []string{"dep", "deps"} {
+		value, exists := f.Attrs[key]
+
+		if !exists {
+			continue
+		}
+
+		for _, item := range strings.Split(value, ",") {
+			name, req, _ := strings.Cut(strings.TrimSpace(item), "=")
+
+			if !crateNameRegex.MatchString(name) || req == "" || strings.ContainsAny(req, `"\'`) {
+				return nil, fmt.Errorf("invalid %s=%s: must be NAME=VERSION (e.g. rand=0.8)", key, value)
+			}
+
+			deps = append(deps, Dependency{Name: name, Req: req})
+		}
+	}
+
+	return deps, nil
+}
+
+// Name of an environment variable (e.g. MONGODB_URI)
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// env returns the environment variables of the snippet when run, as NAME=VALUE
+// (the `env="NAME=VALUE,..."` attribute), a value being possibly a list
+// (e.g. env="MONGODB_URI=mongodb://a,b,DB=test" for two variables)
+func (f FenceInfo) env() ([]string, error) {
+	value, exists := f.Attrs["env"]
+
+	if !exists {
+		return nil, nil
+	}
+
+	var env []string
+
+	for _, item := range strings.Split(value, ",") {
+		name, _, isVariable := strings.Cut(item, "=")
+
+		switch {
+		case isVariable && envNameRegex.MatchString(strings.TrimSpace(name)):
+			env = append(env, strings.TrimSpace(item))
+		case len(env) > 0:
+			env[len(env)-1] += "," + item // e.g. a host of a MongoDB URI
+		default:
+			return nil, fmt.Errorf("invalid env=%s: must be NAME=VALUE (e.g. env=\"MONGODB_URI=mongodb://localhost\")", value)
+		}
+	}
+
+	return env, nil
+}
+
+// Name of a crate, as a dependency of the generated project (e.g. serde_json or async-trait)
+var crateNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// codeFence is the opening line of a fenced code block
+type codeFence struct {
+	char   byte   // '`' or '~'
+	length int    // at least 3
+	info   string // e.g. "rust,ignore"
+	quotes int    // Levels of blockquote around the block (e.g. 1 for "> ```rust")
+	indent int    // Column of the fence, without the quote markers (e.g. 2 for "- ```rust")
+}
+
+// List item markers (e.g. "- ", "* ", "1. ", "2) ")
+var listMarkerRegex = regexp.MustCompile(`^ *(?:[-*+]|[0-9]{1,9}[.)]) +`)
+
+// stripQuotes removes up to max blockquote markers (">", possibly
+// indented and followed by a space) of a line, and returns their number
+func stripQuotes(line string, max int) (string, int) {
+	quotes := 0
+
+	for quotes < max {
+		rest := strings.TrimLeft(line, " ")
+
+		if !strings.HasPrefix(rest, ">") {
+			break
+		}
+
+		line = strings.TrimPrefix(rest[1:], " ")
+		quotes++
+	}
+
+	return line, quotes
+}
+
+// parseCodeFence parses a line opening a code block: a run of at least
+// 3 backticks (e.g. "```rust") or tildes (e.g. "~~~~rust"), then the info
+// string (which can't contain backticks after backticks). The fence can be
+// nested in blockquotes and list items (e.g. "> - ```rust").
+func parseCodeFence(line string) (codeFence, bool) {
+	line, quotes := stripQuotes(line, len(line))
+	indent := 0
+
+	for {
+		marker := listMarkerRegex.FindString(line[indent:])
+
+		if marker == "" {
+			break
+		}
+
+		indent += len(marker)
+	}
+
+	indent += len(line[indent:]) - len(strings.TrimLeft(line[indent:], " "))
+	line = line[indent:]
+
+	if !strings.HasPrefix(line, "```") && !strings.HasPrefix(line, "~~~") {
+		return codeFence{}, false
+	}
+
+	fence := codeFence{char: line[0], quotes: quotes, indent: indent}
+
+	for fence.length < len(line) && line[fence.length] == fence.char {
+		fence.length++
+	}
+
+	fence.info = strings.TrimSpace(line[fence.length:])
+
+	if fence.char == '`' && strings.Contains(fence.info, "`") {
+		return codeFence{}, false // e.g. an inline code span
+	}
+
+	return fence, true
+}
+
+// content returns a line of the code block without the prefix of its
+// containers: the blockquote markers, and up to the indentation of the fence
+func (f codeFence) content(line string) string {
+	line, _ = stripQuotes(line, f.quotes)
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+
+	if indent > f.indent {
+		indent = f.indent
+	}
+
+	return line[indent:]
+}
+
+// closedBy checks whether a line closes the code block: a run of the same
+// character, at least as long as the opening one, and nothing else
+func (f codeFence) closedBy(line string) bool {
+	line, _ = stripQuotes(line, f.quotes)
+	trimmed := strings.TrimLeft(line, " ")
+
+	if !strings.HasPrefix(trimmed, "```") && !strings.HasPrefix(trimmed, "~~~") {
+		return false
+	}
+
+	closing, ok := parseCodeFence(trimmed)
+
+	return ok && closing.char == f.char && closing.length >= f.length && closing.info == ""
+}
+
+// interruptedBy checks whether a line of the code block opens another block
+// with the same fence (e.g. "```rust" in a "```" block): the block was most
+// likely not closed, so the extraction resynchronizes on this line
+func (f codeFence) interruptedBy(line string) bool {
+	next, ok := parseCodeFence(line)
+
+	return ok && next.char == f.char && next.length >= f.length && next.info != ""
+}
+
+// codeBlock is a fenced code block of a markdown file
+type codeBlock struct {
+	Info  FenceInfo
+	Line  int      // Line of the opening fence (1-based)
+	Lines []string // Content, without the fences
+}
+
+// codeBlocks returns the fenced code blocks of a markdown file, an unclosed
+// block ending before the fence opening the next one (or at the end of the file)
+func codeBlocks(lines []string) []codeBlock {
+	var blocks []codeBlock
+	var opening codeFence
+	var current *codeBlock
+
+	for i, line := range lines {
+		if current == nil {
+			if fence, isFence := parseCodeFence(line); isFence {
+				opening = fence
+				current = &codeBlock{Info: parseFenceInfo(fence.info), Line: i + 1}
+			}
+
+			continue
+		}
+
+		if opening.interruptedBy(line) {
+			blocks = append(blocks, *current)
+			opening, _ = parseCodeFence(line)
+			current = &codeBlock{Info: parseFenceInfo(opening.info), Line: i + 1}
+
+			continue
+		}
+
+		if opening.closedBy(line) {
+			blocks = append(blocks, *current)
+			current = nil
+
+			continue
+		}
+
+		current.Lines = append(current.Lines, opening.content(line))
+	}
+
+	if current != nil {
+		blocks = append(blocks, *current)
+	}
+
+	return blocks
+}
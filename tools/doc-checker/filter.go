@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// SnippetFilter selects snippets by their identifier (e.g. find_by_name),
+// in any file or in a given one (e.g. docs/guide.md:find_by_name), as
+// glob patterns (e.g. setup_*)
+type SnippetFilter struct {
+	File string // Relative to the project root, any file if empty
+	ID   string
+}
+
+// parseSnippetFilters parses the comma-separated ID or FILE:ID patterns of --filter
+func parseSnippetFilters(value string) ([]SnippetFilter, error) {
+	var filters []SnippetFilter
+
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		filter := SnippetFilter{ID: pattern}
+
+		if sep := strings.LastIndex(pattern, ":"); sep >= 0 {
+			filter = SnippetFilter{File: pattern[:sep], ID: pattern[sep+1:]}
+		}
+
+		for _, glob := range []string{filter.File, filter.ID} {
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("invalid --filter pattern '%s': %w", pattern, err)
+			}
+		}
+
+		if filter.ID == "" || (filter.File == "" && strings.Contains(pattern, ":")) {
+			return nil, fmt.Errorf("invalid --filter pattern '%s' (expected ID or FILE:ID, e.g. docs/guide.md:find_by_name)", pattern)
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+// matches checks whether the filter selects a snippet of a file
+// (relative to the project root)
+func (f SnippetFilter) matches(relPath, id string) bool {
+	if f.File != "" {
+		if matched, _ := path.Match(f.File, relPath); !matched {
+			return false
+		}
+	}
+
+	matched, _ := path.Match(f.ID, id)
+
+	return matched
+}
+
+// selectedByFilter checks whether a snippet is selected by one of the
+// --filter patterns (all the snippets being selected without filter)
+func (dc *DocChecker) selectedByFilter(filePath string, snippet Snippet) bool {
+	if len(dc.config.Filter) == 0 {
+		return true
+	}
+
+	relPath := dc.relativePath(filePath)
+
+	for _, filter := range dc.config.Filter {
+		if filter.matches(relPath, snippet.ID) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Key of the settings of doc-checker in the YAML frontmatter of a markdown file
+const frontmatterKey = "doc_checker"
+
+// Keys of the settings of a file, in its frontmatter
+var frontmatterKeys = []string{"features", "prelude", "ignore", "ignore_codes"}
+
+// Cargo feature of a crate (e.g. chrono, or serde/derive for a feature of a dependency)
+var featureNameRegex = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_+.-]*(/[A-Za-z0-9_][A-Za-z0-9_+.-]*)?$`)
+
+// Characters of the features not kept in the name of a generated project
+var featureSuffixRegex = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// Line of the doc_checker key, possibly quoted
+var frontmatterKeyRegex = regexp.MustCompile(`^["']?` + frontmatterKey + `["']?\s*:`)
+
+// FileSettings are the settings of the snippets of a markdown file, from its
+// frontmatter, e.g.
+//
+//	---
+//	title: Dates
+//	doc_checker: { features: ["chrono"], prelude: "use tnuctipun::*;" }
+//	---
+type FileSettings struct {
+	Features     []string // Features of the crate, enabled to compile the snippets
+	Prelude      []string // Replaces the prelude of the crate if not nil (none if empty)
+	Ignore       bool     // All the snippets are ignored
+	IgnoreReason string
+	IgnoreCodes  []string // Failures with only these error codes are excluded (as --ignore-codes)
+}
+
+// frontmatterLines returns the lines of the YAML frontmatter of a markdown
+// file (between a "---" first line and a "---" or "..." one), if any
+func frontmatterLines(content string) []string {
+	lines := strings.Split(content, "\n")
+
+	if strings.TrimRight(lines[0], " \r") != "---" {
+		return nil
+	}
+
+	for i, line := range lines[1:] {
+		if trimmed := strings.TrimRight(line, " \r"); trimmed == "---" || trimmed == "..." {
+			return lines[1 : i+1]
+		}
+	}
+
+	return nil
+}
+
+// parseFrontmatter returns the settings of the doc_checker key of the
+// frontmatter of a markdown file (e.g. a flow mapping { key: value, ... },
+// or a block one of indented "key: value" lines)
+func parseFrontmatter(content string) (FileSettings, error) {
+	lines := frontmatterLines(content)
+	var settings FileSettings
+	var document map[string]interface{}
+
+	if len(lines) == 0 {
+		return settings, nil
+	}
+
+	if err := yaml.Unmarshal([]byte(strings.Join(lines, "\n")), &document); err != nil {
+		// Only an error if it has settings (not e.g. the one of a static site generator)
+		for _, line := range lines {
+			if frontmatterKeyRegex.MatchString(line) {
+				return settings, fmt.Errorf("frontmatter: invalid %s: %s", frontmatterKey, strings.TrimPrefix(err.Error(), "yaml: "))
+			}
+		}
+
+		return settings, nil
+	}
+
+	value, exists := document[frontmatterKey]
+
+	if !exists || value == nil {
+		return settings, nil
+	}
+
+	return settingsFromYAML(value)
+}
+
+// settingsFromYAML returns the settings of a file from the value of its doc_checker key
+func settingsFromYAML(value interface{}) (FileSettings, error) {
+	var settings FileSettings
+	mapping, isMapping := value.(map[string]interface{})
+
+	if !isMapping {
+		return settings, fmt.Errorf("frontmatter: %s must be a mapping (e.g. { features: [\"chrono\"] })", frontmatterKey)
+	}
+
+	for key, value := range mapping {
+		name := frontmatterKey + "." + key
+
+		switch key {
+		case "features":
+			features, err := yamlStrings(value)
+
+			if err != nil {
+				return settings, fmt.Errorf("frontmatter: %s %w", name, err)
+			}
+
+			for _, feature := range features {
+				if !featureNameRegex.MatchString(feature) {
+					return settings, fmt.Errorf("frontmatter: invalid %s '%s'", name, feature)
+				}
+			}
+
+			sort.Strings(features)
+			settings.Features = features
+
+		case "prelude":
+			prelude, err := yamlStrings(value)
+
+			if err != nil {
+				return settings, fmt.Errorf("frontmatter: %s %w", name, err)
+			}
+
+			settings.Prelude = []string{}
+
+			for _, line := range prelude {
+				if line != "" {
+					settings.Prelude = append(settings.Prelude, line)
+				}
+			}
+
+		case "ignore":
+			switch ignore := value.(type) {
+			case bool:
+				settings.Ignore = ignore
+			case string:
+				settings.Ignore, settings.IgnoreReason = true, ignore
+			default:
+				return settings, fmt.Errorf("frontmatter: %s must be true, false or a reason", name)
+			}
+
+		case "ignore_codes":
+			codes, err := yamlStrings(value)
+
+			if err != nil {
+				return settings, fmt.Errorf("frontmatter: %s %w", name, err)
+			}
+
+			if settings.IgnoreCodes, err = parseErrorCodes("ignore-codes", strings.Join(codes, ",")); err != nil {
+				return settings, fmt.Errorf("frontmatter: %s: %w", name, err)
+			}
+
+		default:
+			patterns := make([]string, len(frontmatterKeys))
+
+			for i, known := range frontmatterKeys {
+				patterns[i] = frontmatterKey + "." + known
+			}
+
+			return settings, fmt.Errorf("frontmatter: unknown key %s%s", name, suggestConfigName(name, patterns))
+		}
+	}
+
+	return settings, nil
+}
+
+// yamlStrings returns a string, or a list of strings, as a list
+func yamlStrings(value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case string:
+		return []string{value}, nil
+
+	case []interface{}:
+		values := make([]string, len(value))
+
+		for i, item := range value {
+			s, isString := item.(string)
+
+			if !isString {
+				return nil, fmt.Errorf("must be a list of strings")
+			}
+
+			values[i] = s
+		}
+
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("must be a string or a list of strings")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// writeGitHubAnnotations prints a GitHub Actions `::error` workflow command
+// per failure (and `::warning` per warning), so the failing snippets are annotated inline on PR diffs
+// (see https://docs.github.com/actions/using-workflows/workflow-commands-for-github-actions)
+func writeGitHubAnnotations(w io.Writer, results *Results, projectRoot string) {
+	files := make([]string, 0, len(results.Files))
+
+	for file := range results.Files {
+		files = append(files, file)
+	}
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		for _, failure := range results.Files[file].Failures {
+			properties := []string{
+				"file=" + escapeGitHubProperty(relativeTo(projectRoot, file)),
+			}
+
+			if failure.Line > 0 {
+				properties = append(properties, fmt.Sprintf("line=%d", failure.Line))
+			}
+
+			if failure.EndLine > 0 {
+				properties = append(properties, fmt.Sprintf("endLine=%d", failure.EndLine))
+			}
+
+			title := fmt.Sprintf("Documentation snippet %s (%s)", failure.Snippet, failure.Category)
+
+			// To de-duplicate the annotations across runs
+			if failure.Fingerprint != "" {
+				title = fmt.Sprintf("Documentation snippet %s (%s, fingerprint %s)", failure.Snippet, failure.Category, failure.Fingerprint)
+			}
+
+			properties = append(properties, "title="+escapeGitHubProperty(title))
+
+			fmt.Fprintf(w, "::error %s::%s\n",
+				strings.Join(properties, ","), escapeGitHubData(failure.Message))
+		}
+	}
+
+	for _, warning := range results.Warnings {
+		var properties []string
+
+		if warning.File != "" {
+			properties = append(properties, "file="+escapeGitHubProperty(relativeTo(projectRoot, warning.File)))
+		}
+
+		if warning.Line > 0 {
+			properties = append(properties, fmt.Sprintf("line=%d", warning.Line))
+		}
+
+		properties = append(properties, "title="+escapeGitHubProperty("Documentation warning "+warning.Code))
+
+		fmt.Fprintf(w, "::%s %s::%s\n",
+			warning.Level, strings.Join(properties, ","), escapeGitHubData(warning.Message))
+	}
+}
+
+func escapeGitHubData(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+
+	return strings.ReplaceAll(s, "\n", "%0A")
+}
+
+func escapeGitHubProperty(s string) string {
+	s = escapeGitHubData(s)
+	s = strings.ReplaceAll(s, ":", "%3A")
+
+	return strings.ReplaceAll(s, ",", "%2C")
+}
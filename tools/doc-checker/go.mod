@@ -1,3 +1,8 @@
 module github.com/cchantep/tnuctipun/tools/doc-checker
 
-go 1.21
+go 1.21.0
+
+require (
+	github.com/pelletier/go-toml/v2 v2.4.3
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Formats of `doc-checker graph`
+var graphFormats = []string{"dot", "mermaid"}
+
+// graphEdge is a snippet building on an earlier one of its file (continues= or requires=)
+type graphEdge struct {
+	From, To int    // Indexes of the snippets in the file
+	Kind     string // continues or requires
+}
+
+// graphFile is a file whose snippets build on each other
+type graphFile struct {
+	Path     string // Relative to the project root
+	Snippets []Snippet
+	Edges    []graphEdge
+}
+
+// snippetGraphEdges returns the direct references between the snippets of a file,
+// already resolved when they were extracted (so the referenced ones exist)
+func snippetGraphEdges(snippets []Snippet) []graphEdge {
+	index := make(map[string]int)
+	var edges []graphEdge
+
+	for i, snippet := range snippets {
+		index[snippet.ID] = i
+
+		for _, kind := range []string{"continues", "requires"} {
+			names, exists := snippet.Attrs[kind]
+
+			if !exists {
+				continue
+			}
+
+			for _, name := range strings.Split(names, ",") {
+				if from, found := index[strings.TrimSpace(name)]; found {
+					edges = append(edges, graphEdge{From: from, To: i, Kind: kind})
+				}
+			}
+		}
+	}
+
+	return edges
+}
+
+// linked returns the indexes of the snippets of the file which are part of an edge, in order
+func (f graphFile) linked() []int {
+	seen := make(map[int]bool)
+
+	for _, edge := range f.Edges {
+		seen[edge.From], seen[edge.To] = true, true
+	}
+
+	var indexes []int
+
+	for i := range f.Snippets {
+		if seen[i] {
+			indexes = append(indexes, i)
+		}
+	}
+
+	return indexes
+}
+
+// writeGraphDOT writes the graph of the snippets as Graphviz DOT, with a cluster per file
+func writeGraphDOT(w io.Writer, files []graphFile) {
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+
+	node := func(file graphFile, i int) string {
+		return quote(file.Path + "#" + file.Snippets[i].ID)
+	}
+
+	fmt.Fprintln(w, "digraph snippets {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+
+	for n, file := range files {
+		fmt.Fprintf(w, "\n  subgraph cluster_%d {\n", n)
+		fmt.Fprintf(w, "    label=%s;\n", quote(file.Path))
+
+		for _, i := range file.linked() {
+			fmt.Fprintf(w, "    %s [label=%s];\n", node(file, i),
+				quote(fmt.Sprintf("%s (line %d)", file.Snippets[i].ID, file.Snippets[i].StartLine)))
+		}
+
+		for _, edge := range file.Edges {
+			style := ""
+
+			if edge.Kind == "requires" {
+				style = ", style=dashed"
+			}
+
+			fmt.Fprintf(w, "    %s -> %s [label=%s%s];\n", node(file, edge.From), node(file, edge.To), edge.Kind, style)
+		}
+
+		fmt.Fprintln(w, "  }")
+	}
+
+	fmt.Fprintln(w, "}")
+}
+
+// writeGraphMermaid writes the graph of the snippets as a Mermaid flowchart
+// (e.g. rendered in the markdown files on GitHub), with a subgraph per file
+func writeGraphMermaid(w io.Writer, files []graphFile) {
+	quote := func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+	}
+
+	fmt.Fprintln(w, "flowchart LR")
+
+	for n, file := range files {
+		fmt.Fprintf(w, "  subgraph f%d[%s]\n", n, quote(file.Path))
+
+		for _, i := range file.linked() {
+			fmt.Fprintf(w, "    f%d_%d[%s]\n", n, i,
+				quote(fmt.Sprintf("%s (line %d)", file.Snippets[i].ID, file.Snippets[i].StartLine)))
+		}
+
+		for _, edge := range file.Edges {
+			arrow := "-->"
+
+			if edge.Kind == "requires" {
+				arrow = "-.->"
+			}
+
+			fmt.Fprintf(w, "    f%d_%d %s|%s| f%d_%d\n", n, edge.From, arrow, edge.Kind, n, edge.To)
+		}
+
+		fmt.Fprintln(w, "  end")
+	}
+}
+
+// runGraph prints the graph of the snippets building on each other (continues=
+// and requires=), for the files to check, and returns the exit code
+func runGraph(config *Config, w io.Writer) int {
+	if !containsCode(graphFormats, config.GraphFormat) {
+		fmt.Fprintf(os.Stderr, "Error: invalid graph format '%s' (expected %s)\n",
+			config.GraphFormat, strings.Join(graphFormats, " or "))
+		return 2
+	}
+
+	dc := NewDocChecker(config)
+	paths, err := dc.discoverFiles()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to discover files: %v\n", err)
+		return 2
+	}
+
+	var files []graphFile
+
+	for _, file := range dc.loadFiles(paths) {
+		err := file.readErr
+
+		if err == nil {
+			err = file.extractErr
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", dc.relativePath(file.path), err)
+			return 2
+		}
+
+		if edges := snippetGraphEdges(file.snippets); len(edges) > 0 {
+			files = append(files, graphFile{Path: dc.relativePath(file.path), Snippets: file.snippets, Edges: edges})
+		}
+	}
+
+	if config.GraphFormat == "mermaid" {
+		writeGraphMermaid(w, files)
+	} else {
+		writeGraphDOT(w, files)
+	}
+
+	return 0
+}
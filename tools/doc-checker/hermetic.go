@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// validateHermetic checks the options of the hermetic mode, where every input
+// and output path is declared (as for a Bazel/Buck build action), and resolves them
+func validateHermetic(config *Config) error {
+	if config.WorkKey != "" {
+		return fmt.Errorf("--work-key cannot be used with --hermetic (use --out-dir)")
+	}
+
+	if config.TargetDir != "" {
+		return fmt.Errorf("--target-dir cannot be used with --hermetic (the target dir is in --out-dir)")
+	}
+
+	if len(config.Toolchains) > 0 {
+		return fmt.Errorf("--toolchains cannot be used with --hermetic (the toolchain is --toolchain)")
+	}
+
+	if config.CheckUpdate {
+		return fmt.Errorf("--check-update cannot be used with --hermetic (no network access)")
+	}
+
+	if len(config.Files) == 0 {
+		return fmt.Errorf("--hermetic requires the files to check (no discovery from git)")
+	}
+
+	paths := []struct {
+		option string
+		value  *string
+		exists bool // must be an existing input directory
+	}{
+		{"--cargo-home", &config.CargoHome, true},
+		{"--registry", &config.RegistryDir, true},
+		{"--toolchain", &config.ToolchainDir, true},
+		{"--out-dir", &config.OutDir, false},
+	}
+
+	for _, path := range paths {
+		if *path.value == "" {
+			return fmt.Errorf("--hermetic requires %s", path.option)
+		}
+
+		abs, err := filepath.Abs(*path.value)
+
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", path.option, err)
+		}
+
+		*path.value = abs
+
+		if !path.exists {
+			continue
+		}
+
+		if stat, err := os.Stat(abs); err != nil || !stat.IsDir() {
+			return fmt.Errorf("%s: directory not found: %s", path.option, abs)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(config.ToolchainDir, "bin", "cargo")); err != nil {
+		return fmt.Errorf("--toolchain: cargo not found in %s", filepath.Join(config.ToolchainDir, "bin"))
+	}
+
+	return nil
+}
+
+// cargoCommand returns the cargo command to run in the generated project;
+// in hermetic mode, with the declared toolchain and cargo home, and offline
+func (dc *DocChecker) cargoCommand(projectDir string, args ...string) *exec.Cmd {
+	return dc.toolCommand(projectDir, "cargo", args...)
+}
+
+// rustcCommand returns the rustc command used to compile the snippets
+func (dc *DocChecker) rustcCommand(projectDir string, args ...string) *exec.Cmd {
+	return dc.toolCommand(projectDir, "rustc", args...)
+}
+
+func (dc *DocChecker) toolCommand(projectDir, tool string, args ...string) *exec.Cmd {
+	if !dc.config.Hermetic {
+		cmd := exec.CommandContext(dc.ctx, tool, args...)
+		cmd.Dir = projectDir
+
+		return cmd
+	}
+
+	if tool == "cargo" {
+		args = append(args, "--offline")
+	}
+
+	toolchainBin := filepath.Join(dc.config.ToolchainDir, "bin")
+	tmpDir := filepath.Join(dc.config.OutDir, "tmp")
+
+	cmd := exec.CommandContext(dc.ctx, filepath.Join(toolchainBin, tool), args...)
+	cmd.Dir = projectDir
+	cmd.Env = append(os.Environ(),
+		"CARGO_HOME="+dc.config.CargoHome,
+		"CARGO_NET_OFFLINE=true",
+		"CARGO_TARGET_DIR="+filepath.Join(dc.config.OutDir, "target"),
+		"RUSTC="+filepath.Join(toolchainBin, "rustc"),
+		"RUSTDOC="+filepath.Join(toolchainBin, "rustdoc"),
+		"RUSTUP_TOOLCHAIN=", // the declared toolchain, not a rustup one
+		"TMPDIR="+tmpDir,
+		"PATH="+toolchainBin+string(os.PathListSeparator)+os.Getenv("PATH"),
+	)
+
+	return cmd
+}
+
+// writeCargoConfig configures the generated project to only resolve
+// the dependencies from the declared registry directory (e.g. from `cargo vendor`)
+func (dc *DocChecker) writeCargoConfig(projectDir string) error {
+	configDir := filepath.Join(projectDir, ".cargo")
+
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return fmt.Errorf("failed to create cargo config directory: %w", err)
+	}
+
+	// Also used as TMPDIR by the cargo commands
+	if err := os.MkdirAll(filepath.Join(dc.config.OutDir, "tmp"), 0755); err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	cargoConfig := fmt.Sprintf(`[source.crates-io]
+replace-with = "hermetic-registry"
+
+[source.hermetic-registry]
+directory = %q
+
+[net]
+offline = true
+`, dc.config.RegistryDir)
+
+	return os.WriteFile(filepath.Join(configDir, "config.toml"), []byte(cargoConfig), 0644)
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// catalog maps the identifiers of the user-facing messages to their text,
+// possibly with fmt verbs (translations can reorder them, e.g. %[2]d)
+type catalog map[string]string
+
+// Languages of the built-in catalogs
+var catalogs = map[string]catalog{
+	"en": {
+		"summary.header":                 "=== SUMMARY ===",
+		"summary.total":                  "Total Rust snippets found: %d",
+		"summary.valid":                  "Valid snippets: %d",
+		"summary.skipped":                "Skipped snippets (doc-checker:off): %d",
+		"summary.ignored":                "Ignored snippets: %d",
+		"summary.ignore_reason":          "  - %s: %d",
+		"summary.filtered":               "Filtered snippets (--api-filter): %d",
+		"summary.sharded":                "Snippets of the other shards (--shard %[2]s): %[1]d",
+		"summary.excluded":               "Failures excluded by error code (--select, --ignore-codes): %d",
+		"summary.cache":                  "Result cache: %d hit(s), %d miss(es)",
+		"summary.warned":                 "Snippets with compiler warnings: %d",
+		"summary.toolchains":             "Toolchain matrix (--toolchains):",
+		"summary.toolchain":              "  - %s: %d/%d snippet(s) compiled (%s)",
+		"summary.feature_sets":           "Feature matrix (--features-matrix):",
+		"summary.feature_set":            "  - %s: %d/%d snippet(s) compiled",
+		"summary.matrix_error":           "  - %s: %s",
+		"summary.mode_passed":            "Mode %s passed: %d checked, %d finding(s), %d failing",
+		"summary.mode_failed":            "Mode %s failed: %d checked, %d finding(s), %d failing",
+		"summary.retry_passed":           "Snippet %s (%s:%d) passed after %d attempts",
+		"summary.retry_failed":           "Snippet %s (%s:%d) failed after %d attempts",
+		"summary.failed":                 "Failed snippets: %d",
+		"summary.first_failure":          "First failure: %s:%d (snippet %s, %s)",
+		"summary.categories":             "Error breakdown by category:",
+		"summary.codes":                  "Error breakdown by rustc code:",
+		"summary.suggestions":            "💡 Suggestions to fix these errors:",
+		"summary.some_failed":            "Some documentation snippets failed to compile!",
+		"summary.update":                 "Please update the failing snippets to match the current API.",
+		"summary.details":                "Detailed results:",
+		"summary.file_failed":            "%s: %d failed out of %d snippets",
+		"summary.truncated":              "... (error truncated)",
+		"summary.fingerprint":            "Fingerprint %s: %s (%s)",
+		"summary.link":                   "🔗 %s",
+		"summary.report_link":            "📄 %s",
+		"summary.fix":                    "💡 %s: `%s` (line %d, column %d)",
+		"summary.all_valid":              "All documentation snippets are valid! 🎉",
+		"update.available":               "A newer doc-checker release is available: %s (running %s)",
+		"update.failed":                  "Cannot check for a newer doc-checker release: %v",
+		"warnings.header":                "=== WARNINGS ===",
+		"warnings.project":               "project",
+		"warnings.as_errors":             "Warnings are treated as errors (--warnings-as-errors)",
+		"parity.header":                  "=== EXAMPLES PARITY ===",
+		"preview.header":                 "=== PREVIEW EXAMPLES ===",
+		"parity.same":                    "Markdown and rustdoc examples cover the same public items",
+		"parity.rustdoc_only":            "%d item(s) with rustdoc example, not used in markdown:",
+		"parity.markdown_only":           "%d item(s) used in markdown, without rustdoc example:",
+		"coverage.header":                "=== EXAMPLES COVERAGE ===",
+		"coverage.summary":               "%d of %d public type(s) used in compiled snippets",
+		"coverage.gaps":                  "%d type(s) with fewer examples than required by the [coverage] policy:",
+		"markdown.title":                 "Documentation snippets",
+		"markdown.all_valid":             "✅ All documentation snippets are valid",
+		"markdown.failed":                "❌ %d documentation snippet(s) failed to compile",
+		"markdown.first_failure":         "First failure: `%s:%d` (snippet `%s`, `%s`)",
+		"markdown.as_errors":             "❌ %d warning(s), treated as errors",
+		"markdown.counts":                "| Files | Snippets | Valid | Failed | Skipped | Warnings |",
+		"markdown.categories":            "| Error category | Count | Description |",
+		"markdown.codes":                 "| Error code | Count |",
+		"markdown.file_failed":           "`%s`: %d failed out of %d snippets",
+		"markdown.warnings":              "⚠️ %d warning(s)",
+		"category.MISSING_FIELD_WITNESS": "Missing field witness modules (need struct definitions with FieldWitnesses derive)",
+		"category.UNKNOWN_FIELD":         "References to non-existent fields",
+		"category.SYNTAX_ERROR":          "Syntax errors (unclosed delimiters, malformed expressions)",
+		"category.MISSING_TRAIT":         "Missing trait implementations (e.g., Deserialize, Serialize)",
+		"category.COMPILATION_ERROR":     "General compilation errors",
+		"category.COMPILE_FAIL":          "compile_fail snippets which compiled, or failed with other errors than the expected ones",
+		"category.OUTPUT_MISMATCH":       "Snippets whose output differs from the text block after them (--check-output)",
+		"category.RUN_FAILED":            "Snippets which failed when run, e.g. panicking (--run, --check-output)",
+		"category.RUN_TIMEOUT":           "Snippets still running after their timeout, so killed (--run)",
+		"category.MALFORMED_MARKDOWN":    "Snippets whose code block is not closed (not compiled)",
+		"category.CLIPPY_LINT":           "Snippets reported by clippy (--clippy-level deny)",
+		"suggestion.MISSING_FIELD_WITNESS": `MISSING_FIELD_WITNESS: Each code snippet should either:
+• Include the full struct definition with #[derive(FieldWitnesses)] in the same snippet
+• Or be split into separate documentation sections showing struct definition first
+• Example: Move struct definitions to the beginning of each code example`,
+		"suggestion.UNKNOWN_FIELD": `UNKNOWN_FIELD: Field name mismatches detected:
+• Check if the field names in the examples match the struct definitions
+• Ensure consistency between struct fields and update operations
+• Run 'cargo expand' to see what field modules are generated`,
+		"suggestion.SYNTAX_ERROR": `SYNTAX_ERROR: Code formatting issues:
+• Check for unclosed braces, parentheses, or brackets
+• Ensure proper indentation and line endings
+• Test code snippets in a Rust playground first`,
+		"suggestion.MISSING_TRAIT": `MISSING_TRAIT: Add required derive macros:
+• Add #[derive(Deserialize, Serialize)] to structs used with MongoDB
+• Include #[derive(Debug, Clone)] for better usability
+• Consider adding #[derive(Default)] for struct initialization`,
+		"warning.STALE_IGNORE":        "doc-checker:off/on markers which don't skip any snippet",
+		"warning.OVERSIZED_SNIPPET":   "Snippets longer than %d lines",
+		"warning.UNTAGGED_RUST_BLOCK": "Code blocks without language, which look like Rust (and so are not checked)",
+		"warning.TOOLCHAIN_SKEW":      "Snippets compiled with another toolchain than the one of the project",
+		"warning.OUTDATED_PATH":       "Snippets using an outdated path of the API (see [renames] in the configuration)",
+		"warning.DEP_DRIFT":           "Dependency versions of the documentation behind the ones used by the crates",
+		"warning.MARKDOWN_STRUCTURE":  "Code blocks not closed (the following snippets are still checked)",
+		"warning.COMPILER_WARNING":    "Snippets which compiled with warnings of the compiler",
+		"warning.CLIPPY_LINT":         "Snippets reported by clippy (--clippy)",
+		"warning.STYLE":               "Code lines of the snippets wider than the limit (%s)",
+		"warning.INVALID_TOML":        "TOML blocks which are not valid (e.g. a copy-pasted Cargo.toml section)",
+		"warning.CRATE_VERSION":       "TOML blocks depending on another version of the documented crates than the current one",
+		"warning.UNKNOWN_FEATURE":     "Features of the documented crates which don't exist (e.g. a typo, or a removed feature)",
+		"warning.CONTENT":             "Code blocks with a non-portable content (e.g. a local path, see [content] in the configuration)",
+		"warning.INVALID_JSON":        "JSON blocks which are not valid JSON, or MongoDB Extended JSON",
+		"warning.UNKNOWN_COMMAND":     "Commands of the shell blocks which are not found (e.g. a typo, or a missing script)",
+		"warning.BROKEN_FLAG":         "Flags of the shell blocks which can't work (e.g. a typographic dash, or unknown to cargo)",
+		"warning.PROVIDED_DEPENDENCY": "Dependencies of the snippets provided by the generated project, in an incompatible version",
+		"warning.OTHER":               "Other warnings",
+	},
+	"fr": {
+		"summary.header":                 "=== RÉSUMÉ ===",
+		"summary.total":                  "Extraits Rust trouvés : %d",
+		"summary.valid":                  "Extraits valides : %d",
+		"summary.skipped":                "Extraits ignorés (doc-checker:off) : %d",
+		"summary.ignored":                "Extraits marqués ignore : %d",
+		"summary.ignore_reason":          "  - %s : %d",
+		"summary.filtered":               "Extraits filtrés (--api-filter) : %d",
+		"summary.sharded":                "Extraits des autres lots (--shard %[2]s) : %[1]d",
+		"summary.excluded":               "Échecs exclus par code d'erreur (--select, --ignore-codes) : %d",
+		"summary.cache":                  "Cache des résultats : %d trouvé(s), %d manquant(s)",
+		"summary.toolchains":             "Matrice des toolchains (--toolchains) :",
+		"summary.toolchain":              "  - %s : %d/%d extrait(s) compilé(s) (%s)",
+		"summary.feature_sets":           "Matrice des features (--features-matrix) :",
+		"summary.feature_set":            "  - %s : %d/%d extrait(s) compilé(s)",
+		"summary.matrix_error":           "  - %s : %s",
+		"summary.warned":                 "Extraits avec des avertissements du compilateur : %d",
+		"summary.mode_passed":            "Mode %s réussi : %d vérifié(s), %d constat(s), %d en échec",
+		"summary.mode_failed":            "Mode %s échoué : %d vérifié(s), %d constat(s), %d en échec",
+		"summary.retry_passed":           "Extrait %s (%s:%d) valide après %d tentatives",
+		"summary.retry_failed":           "Extrait %s (%s:%d) en échec après %d tentatives",
+		"summary.failed":                 "Extraits en échec : %d",
+		"summary.first_failure":          "Premier échec : %s:%d (extrait %s, %s)",
+		"summary.categories":             "Erreurs par catégorie :",
+		"summary.codes":                  "Erreurs par code rustc :",
+		"summary.suggestions":            "💡 Suggestions pour corriger ces erreurs :",
+		"summary.some_failed":            "Des extraits de la documentation ne compilent pas !",
+		"summary.update":                 "Veuillez mettre à jour les extraits en échec selon l'API actuelle.",
+		"summary.details":                "Résultats détaillés :",
+		"summary.file_failed":            "%s : %d en échec sur %d extraits",
+		"summary.truncated":              "... (erreur tronquée)",
+		"summary.fingerprint":            "Empreinte %s : %s (%s)",
+		"summary.link":                   "🔗 %s",
+		"summary.report_link":            "📄 %s",
+		"summary.fix":                    "💡 %s : `%s` (ligne %d, colonne %d)",
+		"summary.all_valid":              "Tous les extraits de la documentation sont valides ! 🎉",
+		"update.available":               "Une nouvelle version de doc-checker est disponible : %s (version actuelle %s)",
+		"update.failed":                  "Impossible de vérifier les nouvelles versions de doc-checker : %v",
+		"warnings.header":                "=== AVERTISSEMENTS ===",
+		"warnings.project":               "projet",
+		"warnings.as_errors":             "Les avertissements sont traités comme des erreurs (--warnings-as-errors)",
+		"parity.header":                  "=== PARITÉ DES EXEMPLES ===",
+		"preview.header":                 "=== EXEMPLES EN AVANT-PREMIÈRE ===",
+		"parity.same":                    "Les exemples markdown et rustdoc couvrent les mêmes éléments publics",
+		"parity.rustdoc_only":            "%d élément(s) avec un exemple rustdoc, non utilisé(s) dans le markdown :",
+		"parity.markdown_only":           "%d élément(s) utilisé(s) dans le markdown, sans exemple rustdoc :",
+		"coverage.header":                "=== COUVERTURE DES EXEMPLES ===",
+		"coverage.summary":               "%d type(s) public(s) sur %d utilisé(s) dans des exemples compilés",
+		"coverage.gaps":                  "%d type(s) avec moins d'exemples que requis par la politique [coverage] :",
+		"markdown.title":                 "Extraits de la documentation",
+		"markdown.all_valid":             "✅ Tous les extraits de la documentation sont valides",
+		"markdown.failed":                "❌ %d extrait(s) de la documentation ne compilent pas",
+		"markdown.first_failure":         "Premier échec : `%s:%d` (extrait `%s`, `%s`)",
+		"markdown.as_errors":             "❌ %d avertissement(s), traités comme des erreurs",
+		"markdown.counts":                "| Fichiers | Extraits | Valides | En échec | Ignorés | Avertissements |",
+		"markdown.categories":            "| Catégorie d'erreur | Nombre | Description |",
+		"markdown.codes":                 "| Code d'erreur | Nombre |",
+		"markdown.file_failed":           "`%s` : %d en échec sur %d extraits",
+		"markdown.warnings":              "⚠️ %d avertissement(s)",
+		"category.MISSING_FIELD_WITNESS": "Modules de témoins de champs manquants (définitions de structures avec le derive FieldWitnesses requises)",
+		"category.UNKNOWN_FIELD":         "Références à des champs inexistants",
+		"category.SYNTAX_ERROR":          "Erreurs de syntaxe (délimiteurs non fermés, expressions mal formées)",
+		"category.MISSING_TRAIT":         "Implémentations de traits manquantes (par ex. Deserialize, Serialize)",
+		"category.COMPILATION_ERROR":     "Erreurs de compilation générales",
+		"category.COMPILE_FAIL":          "Extraits compile_fail qui compilent, ou échouent avec d'autres erreurs que celles attendues",
+		"category.OUTPUT_MISMATCH":       "Extraits dont la sortie diffère du bloc de texte qui les suit (--check-output)",
+		"category.RUN_FAILED":            "Extraits en échec à l'exécution, par exemple en panique (--run, --check-output)",
+		"category.RUN_TIMEOUT":           "Extraits toujours en cours après leur délai, donc interrompus (--run)",
+		"category.MALFORMED_MARKDOWN":    "Extraits dont le bloc de code n'est pas fermé (non compilés)",
+		"category.CLIPPY_LINT":           "Extraits signalés par clippy (--clippy-level deny)",
+		"suggestion.MISSING_FIELD_WITNESS": `MISSING_FIELD_WITNESS : chaque extrait de code doit soit :
+• Inclure la définition complète de la structure avec #[derive(FieldWitnesses)] dans le même extrait
+• Soit être découpé en sections de documentation montrant d'abord la définition de la structure
+• Exemple : déplacer les définitions de structures au début de chaque exemple de code`,
+		"suggestion.UNKNOWN_FIELD": `UNKNOWN_FIELD : noms de champs incohérents :
+• Vérifier que les noms de champs des exemples correspondent aux définitions des structures
+• Assurer la cohérence entre les champs des structures et les opérations de mise à jour
+• Lancer 'cargo expand' pour voir les modules de champs générés`,
+		"suggestion.SYNTAX_ERROR": `SYNTAX_ERROR : problèmes de mise en forme du code :
+• Vérifier les accolades, parenthèses ou crochets non fermés
+• Vérifier l'indentation et les fins de lignes
+• Tester d'abord les extraits de code dans un Rust playground`,
+		"suggestion.MISSING_TRAIT": `MISSING_TRAIT : ajouter les macros derive requises :
+• Ajouter #[derive(Deserialize, Serialize)] aux structures utilisées avec MongoDB
+• Inclure #[derive(Debug, Clone)] pour une meilleure utilisabilité
+• Envisager #[derive(Default)] pour l'initialisation des structures`,
+		"warning.STALE_IGNORE":        "Marqueurs doc-checker:off/on qui n'ignorent aucun extrait",
+		"warning.OVERSIZED_SNIPPET":   "Extraits de plus de %d lignes",
+		"warning.UNTAGGED_RUST_BLOCK": "Blocs de code sans langage, qui ressemblent à du Rust (et ne sont donc pas vérifiés)",
+		"warning.TOOLCHAIN_SKEW":      "Extraits compilés avec une autre toolchain que celle du projet",
+		"warning.OUTDATED_PATH":       "Extraits utilisant un chemin obsolète de l'API (voir [renames] dans la configuration)",
+		"warning.DEP_DRIFT":           "Versions de dépendances de la documentation en retard sur celles utilisées par les crates",
+		"warning.MARKDOWN_STRUCTURE":  "Blocs de code non fermés (les extraits suivants sont tout de même vérifiés)",
+		"warning.COMPILER_WARNING":    "Extraits compilés avec des avertissements du compilateur",
+		"warning.CLIPPY_LINT":         "Extraits signalés par clippy (--clippy)",
+		"warning.STYLE":               "Lignes de code des extraits plus larges que la limite (%s)",
+		"warning.INVALID_TOML":        "Blocs TOML invalides (par ex. une section de Cargo.toml à copier-coller)",
+		"warning.CRATE_VERSION":       "Blocs TOML dépendant d'une autre version des crates documentées que l'actuelle",
+		"warning.UNKNOWN_FEATURE":     "Features des crates documentées qui n'existent pas (par ex. une faute de frappe, ou une feature supprimée)",
+		"warning.CONTENT":             "Blocs de code au contenu non portable (par ex. un chemin local, voir [content] dans la configuration)",
+		"warning.INVALID_JSON":        "Blocs JSON invalides, en JSON ou en MongoDB Extended JSON",
+		"warning.UNKNOWN_COMMAND":     "Commandes des blocs shell introuvables (par ex. une faute de frappe, ou un script absent)",
+		"warning.BROKEN_FLAG":         "Options des blocs shell invalides (par ex. un tiret typographique, ou inconnue de cargo)",
+		"warning.PROVIDED_DEPENDENCY": "Dépendances des extraits fournies par le projet généré, dans une version incompatible",
+		"warning.OTHER":               "Autres avertissements",
+	},
+}
+
+// Catalog of the messages, in the language selected with --lang
+var messages = catalogs["en"]
+
+// setLanguage selects the catalog of the messages: a built-in language (e.g. fr),
+// or a TOML file of messages (e.g. de.toml), missing messages being in English
+func setLanguage(lang string) error {
+	if builtin, exists := catalogs[lang]; exists {
+		messages = builtin
+		return nil
+	}
+
+	if !strings.HasSuffix(lang, ".toml") {
+		languages := make([]string, 0, len(catalogs))
+
+		for name := range catalogs {
+			languages = append(languages, name)
+		}
+
+		sort.Strings(languages)
+
+		return fmt.Errorf("unknown language '%s'. Must be one of: %s, or a TOML file of messages",
+			lang, strings.Join(languages, ", "))
+	}
+
+	content, err := os.ReadFile(lang)
+
+	if err != nil {
+		return fmt.Errorf("failed to read messages: %w", err)
+	}
+
+	doc, err := parseTOML(string(content))
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", lang, err)
+	}
+
+	custom := make(catalog)
+
+	for _, key := range doc.Keys {
+		if _, known := catalogs["en"][key]; !known {
+			return fmt.Errorf("%s: line %d: unknown message %s", lang, doc.Values[key].Line, key)
+		}
+
+		text, _, err := doc.stringValue(key)
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", lang, err)
+		}
+
+		custom[key] = text
+	}
+
+	messages = custom
+
+	return nil
+}
+
+// msg returns the message with the given identifier, in the selected language
+// (or in English if not translated), formatted with the arguments if any
+func msg(key string, args ...interface{}) string {
+	text, exists := messages[key]
+
+	if !exists {
+		if text, exists = catalogs["en"][key]; !exists {
+			text = key
+		}
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+
+	return fmt.Sprintf(text, args...)
+}
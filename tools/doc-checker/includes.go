@@ -0,0 +1,389 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// mdBook include directive (e.g. {{#include ../examples/filter.rs}}, or
+// {{#rustdoc_include ../examples/filter.rs:usage}}), which is kept as is
+// when escaped by a backslash
+var includeRegex = regexp.MustCompile(`(\\?)\{\{#(include|rustdoc_include)\s+([^}]+?)\s*\}\}`)
+
+// mdBook anchors (or AsciiDoc tags, e.g. "// tag::model[]"), delimiting a region of an included file
+var (
+	anchorStartRegex = regexp.MustCompile(`(?:ANCHOR:\s*|tag::)([\w-]+)`)
+	anchorEndRegex   = regexp.MustCompile(`(?:ANCHOR_END:\s*|end::)([\w-]+)`)
+	anchorNameRegex  = regexp.MustCompile(`^[\w-]+$`)
+)
+
+// Maximum depth of the nested includes, as mdBook
+const maxIncludeDepth = 10
+
+// IncludedLines are consecutive lines of a snippet included from a file
+type IncludedLines struct {
+	File  string `json:"file"`  // Included file, relative to the project root
+	Line  int    `json:"line"`  // Line of the first one in the included file (1-based)
+	At    int    `json:"at"`    // Line of the first one in the code of the snippet (1-based)
+	Count int    `json:"count"` // Number of lines
+}
+
+// locate returns the line of the included file for a line of the code of the snippet
+func (l IncludedLines) locate(line int) (int, bool) {
+	if line < l.At || line >= l.At+l.Count {
+		return 0, false
+	}
+
+	return l.Line + line - l.At, true
+}
+
+// appendIncluded appends included lines, merged with the last ones if consecutive
+func appendIncluded(included []IncludedLines, lines IncludedLines) []IncludedLines {
+	if n := len(included); n > 0 {
+		last := &included[n-1]
+
+		if last.File == lines.File && last.Line+last.Count == lines.Line && last.At+last.Count == lines.At {
+			last.Count += lines.Count
+			return included
+		}
+	}
+
+	return append(included, lines)
+}
+
+// selectLines returns the lines of an included file (with their number) selected
+// as by mdBook: the region of an anchor ("NAME"), a range of lines ("FROM:TO",
+// "FROM:", ":TO" or "LINE"), or all of them (""). With rustdoc_include, all the
+// lines are selected, the ones out of the region being hidden but compiled.
+func selectLines(content, selector string, rustdoc bool) ([]string, []int, error) {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	numbers := make([]int, len(lines))
+
+	for i := range lines {
+		numbers[i] = i + 1
+	}
+
+	if selector == "" {
+		return lines, numbers, nil
+	}
+
+	from, to, isRange := strings.Cut(selector, ":")
+
+	if _, err := strconv.Atoi(from); err == nil || from == "" || isRange {
+		if rustdoc {
+			return lines, numbers, nil
+		}
+
+		first, last := 1, len(lines)
+
+		if from != "" {
+			if first, err = strconv.Atoi(from); err != nil || first < 1 {
+				return nil, nil, fmt.Errorf("invalid line range %s", selector)
+			}
+		}
+
+		if !isRange {
+			last = first
+		} else if to != "" {
+			if last, err = strconv.Atoi(to); err != nil || last < first {
+				return nil, nil, fmt.Errorf("invalid line range %s", selector)
+			}
+		}
+
+		// Out of the file, the range is truncated (as by mdBook)
+		first, last = min(first, len(lines)+1), min(last, len(lines))
+
+		return lines[first-1 : last], numbers[first-1 : last], nil
+	}
+
+	if !anchorNameRegex.MatchString(from) {
+		return nil, nil, fmt.Errorf("invalid anchor or line range %s", selector)
+	}
+
+	// Region of the anchor (which can be repeated), without the anchor lines
+	var selected []string
+	var selectedNumbers []int
+	inRegion, found := false, false
+
+	for i, line := range lines {
+		if match := anchorStartRegex.FindStringSubmatch(line); match != nil {
+			found = found || match[1] == from
+			inRegion = inRegion || match[1] == from
+			continue
+		}
+
+		if match := anchorEndRegex.FindStringSubmatch(line); match != nil {
+			inRegion = inRegion && match[1] != from
+			continue
+		}
+
+		if inRegion || rustdoc {
+			selected = append(selected, line)
+			selectedNumbers = append(selectedNumbers, numbers[i])
+		}
+	}
+
+	if !found {
+		return nil, nil, fmt.Errorf("no anchor %s", from)
+	}
+
+	return selected, selectedNumbers, nil
+}
+
+// resolveIncludes replaces the mdBook {{#include}} and {{#rustdoc_include}}
+// directives of the snippets (but the ignored or skipped ones) by the lines
+// of the files, relative to the directory of the markdown file
+func (dc *DocChecker) resolveIncludes(snippets []Snippet, dir string) ([]Snippet, error) {
+	for i := range snippets {
+		snippet := &snippets[i]
+
+		if snippet.Ignore || snippet.Skipped || !includeRegex.MatchString(snippet.Content) {
+			continue
+		}
+
+		var lines []string
+		parts := snippet.Includes // Lines of the fences of an example in parts, if any
+		snippet.Includes = nil
+
+		for j, line := range strings.Split(snippet.Content, "\n") {
+			source := IncludedLines{Line: snippet.StartLine + j + 1, At: len(lines) + 1, Count: 1}
+
+			for _, part := range parts {
+				if l, ok := part.locate(j + 1); ok {
+					source.File, source.Line = part.File, l
+				}
+			}
+
+			expanded, included, err := dc.expandIncludes(line, dir, 0)
+
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", source.Line, err)
+			}
+
+			// Still a line of a part, unless replaced by the included ones
+			if source.File != "" && len(included) == 0 {
+				snippet.Includes = appendIncluded(snippet.Includes, source)
+			}
+
+			for _, run := range included {
+				run.At += len(lines)
+				snippet.Includes = appendIncluded(snippet.Includes, run)
+			}
+
+			lines = append(lines, expanded...)
+		}
+
+		snippet.Content = strings.Join(lines, "\n")
+	}
+
+	return snippets, nil
+}
+
+// expandIncludes replaces the include directives of a line by the lines of the
+// files (whose own includes are relative to their directory), and returns the
+// resulting lines, with the ones coming from the files
+func (dc *DocChecker) expandIncludes(line, dir string, depth int) ([]string, []IncludedLines, error) {
+	var expanded strings.Builder
+	var included []IncludedLines
+	end := 0
+
+	for _, match := range includeRegex.FindAllStringSubmatchIndex(line, -1) {
+		expanded.WriteString(line[end:match[0]])
+		end = match[1]
+
+		directive, name, arg := line[match[0]:match[1]], line[match[4]:match[5]], line[match[6]:match[7]]
+
+		if match[3] > match[2] {
+			expanded.WriteString(strings.TrimPrefix(directive, `\`))
+			continue
+		}
+
+		if depth == maxIncludeDepth {
+			return nil, nil, fmt.Errorf("{{#%s %s}}: more than %d nested includes", name, arg, maxIncludeDepth)
+		}
+
+		file, selector, _ := strings.Cut(arg, ":")
+		path := filepath.Join(dir, file)
+		content, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("{{#%s %s}}: %w", name, arg, err)
+		}
+
+		lines, numbers, err := selectLines(string(content), selector, name == "rustdoc_include")
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("{{#%s %s}}: %w", name, arg, err)
+		}
+
+		// Hidden lines of the included code, as in the snippets
+		lines = dc.filterSnippetContent(lines)
+
+		for i, includedLine := range lines {
+			if i > 0 {
+				expanded.WriteString("\n")
+			}
+
+			at := strings.Count(expanded.String(), "\n") + 1
+			nested, nestedIncluded, err := dc.expandIncludes(includedLine, filepath.Dir(path), depth+1)
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			expanded.WriteString(strings.Join(nested, "\n"))
+
+			if len(nestedIncluded) == 0 {
+				included = appendIncluded(included, IncludedLines{File: dc.relativePath(path), Line: numbers[i], At: at, Count: 1})
+			}
+
+			for _, run := range nestedIncluded {
+				run.At += at - 1
+				included = appendIncluded(included, run)
+			}
+		}
+	}
+
+	expanded.WriteString(line[end:])
+
+	return strings.Split(expanded.String(), "\n"), included, nil
+}
+
+// wrapOffset returns the number of lines added before the content of a snippet
+// file in its binary (e.g. the wrapping main function, see wrapSnippet)
+func (dc *DocChecker) wrapOffset(content string, crate CrateConfig, noMain bool) int {
+	header, body := splitProvenance(content)
+	wrapped := dc.wrapSnippet(content, crate, noMain)
+
+	return strings.Count(wrapped[:strings.Index(wrapped, body)], "\n") - strings.Count(header, "\n")
+}
+
+// markdownSuggestions locates the suggestions of the compiler in the markdown
+// file of a snippet, rather than in its binary: the lines of the wrapping code,
+// the provenance header, the prelude and the preamble are taken off, then the
+// line of the opening fence is added (or the line of the part of the example),
+// and the column is shifted by what precedes the code in the markdown line (e.g.
+// the indentation of a list item, or the marker of a hidden line); the ones out
+// of the code of the snippet (e.g. in an included file) are left out
+func (dc *DocChecker) markdownSuggestions(source ManifestEntry, binName, snippetFile string, suggestions []Suggestion) []Suggestion {
+	if len(suggestions) == 0 {
+		return nil
+	}
+
+	content, err := os.ReadFile(snippetFile)
+	code := dc.codes[binName]
+
+	if err != nil || !strings.HasSuffix(string(content), code) {
+		return nil
+	}
+
+	crate, err := dc.crate(source.Crate)
+
+	if err != nil {
+		return nil
+	}
+
+	markdown, err := os.ReadFile(source.File)
+
+	if err != nil {
+		return nil
+	}
+
+	offset := dc.wrapOffset(string(content), crate, source.NoMain)
+	codeLine := strings.Count(string(content[:len(content)-len(code)]), "\n") + 1
+	codeLines := strings.Split(code, "\n")
+	markdownLines := strings.Split(string(markdown), "\n")
+	relPath := dc.relativePath(source.File)
+
+	var located []Suggestion
+
+	for _, suggestion := range suggestions {
+		if filepath.Base(suggestion.file) != binName+".rs" {
+			continue
+		}
+
+		line := suggestion.Line - offset - codeLine + 1 // In the code of the snippet
+
+		if line < 1 || line > len(codeLines) {
+			continue
+		}
+
+		markdownLine := source.StartLine + line
+
+		// The lines of the parts of the example, or of the included files
+		if len(source.Includes) > 0 {
+			markdownLine = 0
+
+			for _, lines := range source.Includes {
+				if partLine, ok := lines.locate(line); ok && lines.File == relPath {
+					markdownLine = partLine
+				}
+			}
+		}
+
+		if markdownLine < 1 || markdownLine > len(markdownLines) {
+			continue
+		}
+
+		text := strings.TrimSuffix(markdownLines[markdownLine-1], "\r")
+
+		if strings.HasSuffix(text, codeLines[line-1]) {
+			suggestion.Column += len(text) - len(codeLines[line-1])
+		}
+
+		suggestion.Line = markdownLine
+		located = append(located, suggestion)
+	}
+
+	return located
+}
+
+// includedErrors locates the errors of a snippet in the files it includes,
+// from the compiler diagnostics of its binary (e.g. "examples/model.rs:12:5: mismatched types")
+func (dc *DocChecker) includedErrors(source ManifestEntry, binName, snippetFile string, diagnostics cargoDiagnostics) []string {
+	if len(source.Includes) == 0 {
+		return nil
+	}
+
+	content, err := os.ReadFile(snippetFile)
+
+	if err != nil {
+		return nil
+	}
+
+	crate, err := dc.crate(source.Crate)
+
+	if err != nil {
+		return nil
+	}
+
+	offset := dc.wrapOffset(string(content), crate, source.NoMain)
+
+	var located []string
+
+	for _, diag := range diagnostics.Diagnostics {
+		if diag.Level != "error" {
+			continue
+		}
+
+		for _, span := range diag.Spans {
+			if !span.IsPrimary || filepath.Base(span.FileName) != binName+".rs" {
+				continue
+			}
+
+			line := span.LineStart - offset - source.CodeLine + 1
+
+			for _, lines := range source.Includes {
+				if includedLine, ok := lines.locate(line); ok {
+					located = append(located, fmt.Sprintf("%s:%d:%d: %s", lines.File, includedLine, span.ColumnStart, diag.Message))
+				}
+			}
+		}
+	}
+
+	return located
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Edition of the generated projects, unless overridden by an edition attribute
+const generatedEdition = "2021"
+
+// Imports of the snippets (single line), candidates for the prelude of their crate
+var useLineRegex = regexp.MustCompile(`^use [A-Za-z_][A-Za-z0-9_]*(::.+)?;$`)
+
+// Minimum number of snippets using an import for it to be in the inferred prelude,
+// and maximum number of imports of a prelude
+const (
+	preludeMinUses    = 2
+	preludeMaxImports = 5
+)
+
+// surveyedCrate is a crate found by `doc-checker init`
+type surveyedCrate struct {
+	Name    string
+	Dir     string // Relative to the project root ("." for the root crate)
+	Edition string
+	Prelude []string // Most frequent imports of its snippets
+}
+
+// projectSurvey is what `doc-checker init` finds in a project
+type projectSurvey struct {
+	Crates     []surveyedCrate
+	Layout     map[string]int // Markdown files by top-level directory ("." for the root)
+	Files      int
+	Snippets   int
+	Ignored    int
+	Attributes map[string]int // Snippets by fence attribute (e.g. crate, retries, no_run)
+}
+
+// surveyProject inspects the crates, the markdown files and their snippets
+func surveyProject(config *Config) (*projectSurvey, error) {
+	survey := &projectSurvey{
+		Layout:     make(map[string]int),
+		Attributes: make(map[string]int),
+	}
+
+	dc := NewDocChecker(config)
+	crateDirs, err := dc.crateDirs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range crateDirs {
+		if _, err := os.Stat(filepath.Join(dir, "Cargo.toml")); err != nil {
+			continue
+		}
+
+		rel, _ := filepath.Rel(config.ProjectRoot, dir)
+		edition := packageField(dir, "edition")
+
+		if edition == "" {
+			edition = "2015" // As cargo
+		}
+
+		survey.Crates = append(survey.Crates, surveyedCrate{
+			Name:    packageName(dir),
+			Dir:     filepath.ToSlash(rel),
+			Edition: edition,
+		})
+	}
+
+	if len(survey.Crates) == 0 {
+		return nil, fmt.Errorf("no Cargo.toml in %s", config.ProjectRoot)
+	}
+
+	files, err := dc.discoverFiles()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover files: %w", err)
+	}
+
+	// Imports by crate, counted once per snippet
+	imports := make(map[string]map[string]int)
+
+	for _, file := range dc.loadFiles(files) {
+		rel, _ := filepath.Rel(config.ProjectRoot, file.path)
+		dir, _, nested := strings.Cut(filepath.ToSlash(rel), "/")
+
+		if !nested {
+			dir = "."
+		}
+
+		survey.Files++
+		survey.Layout[dir]++
+
+		for _, snippet := range file.snippets {
+			survey.Snippets++
+
+			for key := range snippet.Attrs {
+				survey.Attributes[key]++
+			}
+
+			for _, flag := range []struct {
+				name string
+				set  bool
+			}{
+				{"ignore", snippet.Ignore},
+				{"compile_fail", snippet.CompileFail},
+				{"no_run", snippet.NoRun},
+				{"no_main", snippet.NoMain},
+				{"should_panic", snippet.ShouldPanic},
+				{"setup", snippet.Setup},
+				{"preview", snippet.Preview},
+				{"edition" + snippet.Edition, snippet.Edition != ""},
+			} {
+				if flag.set {
+					survey.Attributes[flag.name]++
+				}
+			}
+
+			if snippet.Ignore {
+				survey.Ignored++
+				continue
+			}
+
+			crate := snippet.Crate
+
+			if crate == "" {
+				crate = survey.Crates[0].Name
+			}
+
+			if imports[crate] == nil {
+				imports[crate] = make(map[string]int)
+			}
+
+			seen := make(map[string]bool)
+
+			for _, line := range strings.Split(snippet.Content, "\n") {
+				line = strings.TrimSpace(line)
+
+				if useLineRegex.MatchString(line) && !seen[line] {
+					seen[line] = true
+					imports[crate][line]++
+				}
+			}
+		}
+	}
+
+	for i, crate := range survey.Crates {
+		survey.Crates[i].Prelude = inferPrelude(imports[crate.Name])
+	}
+
+	return survey, nil
+}
+
+// inferPrelude returns the imports used by several snippets, most frequent first,
+// without the ones importing a name already imported (which wouldn't compile)
+func inferPrelude(imports map[string]int) []string {
+	var candidates []string
+
+	for line, uses := range imports {
+		if uses >= preludeMinUses {
+			candidates = append(candidates, line)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if imports[candidates[i]] != imports[candidates[j]] {
+			return imports[candidates[i]] > imports[candidates[j]]
+		}
+
+		return candidates[i] < candidates[j]
+	})
+
+	var prelude []string
+	imported := make(map[string]bool)
+
+	for _, line := range candidates {
+		names, ok := importedNames(line)
+		conflict := !ok
+
+		for _, name := range names {
+			conflict = conflict || imported[name]
+		}
+
+		if conflict || len(prelude) == preludeMaxImports {
+			continue
+		}
+
+		for _, name := range names {
+			imported[name] = true
+		}
+
+		prelude = append(prelude, line)
+	}
+
+	return prelude
+}
+
+// importedNames returns the names imported by a use declaration, e.g. Document
+// and doc for "use bson::{doc, Document};" (none for a glob import), or false
+// if not supported (nested groups)
+func importedNames(line string) ([]string, bool) {
+	path := strings.TrimSuffix(strings.TrimPrefix(line, "use "), ";")
+	items := []string{path}
+
+	if prefix, group, isGroup := strings.Cut(path, "{"); isGroup {
+		group, closed := strings.CutSuffix(group, "}")
+
+		if !closed || strings.ContainsAny(group, "{}") {
+			return nil, false
+		}
+
+		items = nil
+
+		for _, item := range strings.Split(group, ",") {
+			item = strings.TrimSpace(item)
+
+			if item == "self" {
+				item = strings.TrimSuffix(prefix, "::")
+			}
+
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+
+	var names []string
+
+	for _, item := range items {
+		if _, alias, renamed := strings.Cut(item, " as "); renamed {
+			item = alias
+		}
+
+		if sep := strings.LastIndex(item, "::"); sep >= 0 {
+			item = item[sep+2:]
+		}
+
+		name := strings.TrimSpace(item)
+
+		if name != "*" && name != "_" {
+			names = append(names, name)
+		}
+	}
+
+	return names, true
+}
+
+// layout describes the markdown files by directory (e.g. "root (3), docs/ (24)")
+func (s *projectSurvey) layout() string {
+	dirs := make([]string, 0, len(s.Layout))
+
+	for dir := range s.Layout {
+		dirs = append(dirs, dir)
+	}
+
+	sort.Strings(dirs)
+
+	parts := make([]string, len(dirs))
+
+	for i, dir := range dirs {
+		name := dir + "/"
+
+		if dir == "." {
+			name = "root"
+		}
+
+		parts[i] = fmt.Sprintf("%s (%d)", name, s.Layout[dir])
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// attributes describes the fence attributes in use (e.g. "crate (2), retries (1)")
+func (s *projectSurvey) attributes() string {
+	names := make([]string, 0, len(s.Attributes))
+
+	for name := range s.Attributes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s (%d)", name, s.Attributes[name])
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// configFile returns the starter configuration file of the project
+func (s *projectSurvey) configFile() string {
+	var toml strings.Builder
+
+	fmt.Fprintf(&toml, "# Configuration of doc-checker, generated by `doc-checker init`\n#\n")
+	fmt.Fprintf(&toml, "# Markdown files: %d, by directory: %s\n", s.Files, s.layout())
+	fmt.Fprintf(&toml, "# Rust snippets: %d (%d ignored)\n", s.Snippets, s.Ignored)
+
+	if len(s.Attributes) > 0 {
+		fmt.Fprintf(&toml, "# Fence attributes: %s\n", s.attributes())
+	}
+
+	fmt.Fprintf(&toml, "\ndefault_crate = %q\n", s.Crates[0].Name)
+
+	for _, crate := range s.Crates {
+		fmt.Fprintf(&toml, "\n[crates.%s]\npath = %q\n", crate.Name, crate.Dir)
+
+		if crate.Edition != generatedEdition {
+			fmt.Fprintf(&toml, "# Edition %s: the snippets are compiled in edition %s, unless tagged with edition%s\n",
+				crate.Edition, generatedEdition, crate.Edition)
+		}
+
+		if len(crate.Prelude) == 0 {
+			fmt.Fprintf(&toml, "# Imports added to the snippets without any `use`\n# prelude = [\"use %s::*;\"]\n",
+				strings.ReplaceAll(crate.Name, "-", "_"))
+
+			continue
+		}
+
+		toml.WriteString("prelude = [\n")
+
+		for _, line := range crate.Prelude {
+			fmt.Fprintf(&toml, "  %q,\n", line)
+		}
+
+		toml.WriteString("]\n")
+	}
+
+	return toml.String()
+}
+
+// ciWorkflow returns a GitHub Actions workflow checking the snippets
+func ciWorkflow() string {
+	return `name: Documentation snippets
+
+on:
+  push:
+    paths:
+      - '**/*.md'
+      - '` + configFileName + `'
+  pull_request:
+    paths:
+      - '**/*.md'
+      - '` + configFileName + `'
+
+jobs:
+  doc_snippets:
+    name: Documentation Snippets
+    runs-on: ubuntu-latest
+    steps:
+    - uses: actions/checkout@v7
+
+    - name: Set up Go
+      uses: actions/setup-go@v7
+      with:
+        go-version: '1.21'
+
+    - name: Install Rust
+      uses: dtolnay/rust-toolchain@stable
+
+    - name: Install doc-checker
+      run: go install github.com/cchantep/tnuctipun/tools/doc-checker@latest
+
+    - name: Check documentation snippets
+      run: doc-checker -o github
+`
+}
+
+// runInit generates the starter configuration of the project (and its CI workflow
+// with --ci-workflow, printed otherwise), and returns the exit code
+func runInit(config *Config, w io.Writer) int {
+	path := filepath.Join(config.ProjectRoot, configFileName)
+	workflow := config.CIWorkflow
+
+	if workflow != "" && !filepath.IsAbs(workflow) {
+		workflow = filepath.Join(config.ProjectRoot, workflow)
+	}
+
+	// Nothing is written if any of the files already exists
+	for _, existing := range []string{path, workflow} {
+		if _, err := os.Stat(existing); existing != "" && err == nil && !config.InitForce {
+			fmt.Fprintf(os.Stderr, "Error: %s already exists (use --force to overwrite it)\n", existing)
+			return 2
+		}
+	}
+
+	survey, err := surveyProject(config)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	for _, crate := range survey.Crates {
+		fmt.Fprintf(w, "Crate %s (edition %s) in %s\n", crate.Name, crate.Edition, crate.Dir)
+	}
+
+	fmt.Fprintf(w, "%d Markdown file(s): %s\n", survey.Files, survey.layout())
+	fmt.Fprintf(w, "%d Rust snippet(s), %d ignored\n", survey.Snippets, survey.Ignored)
+
+	if err := os.WriteFile(path, []byte(survey.configFile()), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write configuration: %v\n", err)
+		return 2
+	}
+
+	fmt.Fprintf(w, "Wrote %s\n", path)
+
+	if workflow == "" {
+		fmt.Fprintf(w, "\nGitHub Actions workflow (e.g. .github/workflows/doc-checker.yml):\n\n%s", ciWorkflow())
+		return 0
+	}
+
+	if err := os.MkdirAll(filepath.Dir(workflow), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	if err := os.WriteFile(workflow, []byte(ciWorkflow()), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write the workflow: %v\n", err)
+		return 2
+	}
+
+	fmt.Fprintf(w, "Wrote %s\n", workflow)
+
+	return 0
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// snippetCheck is the outcome of the check of a snippet binary
+type snippetCheck struct {
+	passed   bool
+	duration time.Duration
+
+	// Compiler diagnostics (e.g. the error codes, for compile_fail)
+	diagnostics cargoDiagnostics
+}
+
+// checkSnippet checks a snippet binary, in the given target dir ("" for the one
+// of the project); as the compilation is deterministic, it's never retried
+// (retries=N only applies to the runs, see checkRun)
+func (dc *DocChecker) checkSnippet(projectDir, binName, targetDir string) snippetCheck {
+	source := dc.manifest[binName]
+	check := snippetCheck{}
+	start := time.Now()
+
+	check.diagnostics = dc.checkDiagnostics(projectDir, binName, targetDir)
+
+	if source.CompileFail {
+		check.passed = check.diagnostics.failedAsExpected(source.ErrorCodes)
+	} else {
+		check.passed = !check.diagnostics.Failed
+	}
+
+	check.duration = time.Since(start)
+
+	return check
+}
+
+// jobTargetDir returns the target dir of the i-th worker checking the snippets
+// with --jobs: the shared one (or the one of the project) for the first worker,
+// and one per other worker, so the cargo commands don't wait for the lock of
+// the same target dir
+func (dc *DocChecker) jobTargetDir(projectDir string, worker int) string {
+	if worker == 0 {
+		return ""
+	}
+
+	if dc.targetDir != "" {
+		return filepath.Join(dc.targetDir, "jobs", fmt.Sprint(worker))
+	}
+
+	return filepath.Join(projectDir, "target", "jobs", fmt.Sprint(worker))
+}
+
+// checkSnippets checks the snippet binaries with up to --jobs cargo commands
+// at the same time, and returns the channels of their outcomes, in the given
+// order; stop leaves the snippets not started yet unchecked, and waits for
+// the ones being checked
+func (dc *DocChecker) checkSnippets(projectDir string, binNames []string) (checks []chan snippetCheck, stop func()) {
+	jobs := dc.config.Jobs
+
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	checks = make([]chan snippetCheck, len(binNames))
+
+	for i := range checks {
+		checks[i] = make(chan snippetCheck, 1)
+	}
+
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+	stopped := make(chan struct{})
+
+	for worker := 0; worker < jobs && worker < len(binNames); worker++ {
+		wg.Add(1)
+
+		go func(targetDir string) {
+			defer wg.Done()
+
+			for i := range indexes {
+				checks[i] <- dc.checkSnippet(projectDir, binNames[i], targetDir)
+			}
+		}(dc.jobTargetDir(projectDir, worker))
+	}
+
+	go func() {
+		defer close(indexes)
+
+		for i := range binNames {
+			select {
+			case indexes <- i:
+			case <-stopped:
+				return
+			}
+		}
+	}()
+
+	return checks, func() {
+		close(stopped)
+		wg.Wait()
+	}
+}
+
+// targetDirEnv returns the environment of a cargo command using another target dir
+func targetDirEnv(env []string, targetDir string) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+
+	return append(env, "CARGO_TARGET_DIR="+targetDir)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Remote URLs of the GitHub repositories (https, ssh or scp-like), capturing owner/repository
+var githubRemoteRegex = regexp.MustCompile(`^(?:(?:https?|ssh|git)://)?(?:[^@/]+@)?github\.com[:/]([^/]+/[^/]+?)(?:\.git)?/?$`)
+
+// blobLinks builds the GitHub links to the lines of the markdown files,
+// at the checked out commit
+type blobLinks struct {
+	baseURL  string // e.g. https://github.com/cchantep/tnuctipun/blob/<sha>
+	topLevel string // Root of the repository
+}
+
+// githubRepository returns the owner/repository of a GitHub remote URL
+// (e.g. git@github.com:cchantep/tnuctipun.git), if it is one
+func githubRepository(remote string) (string, bool) {
+	match := githubRemoteRegex.FindStringSubmatch(strings.TrimSpace(remote))
+
+	if match == nil {
+		return "", false
+	}
+
+	return match[1], true
+}
+
+// loadBlobLinks returns the links of the project, if it's in a git repository
+// whose origin is on GitHub (nil otherwise)
+func (dc *DocChecker) loadBlobLinks() *blobLinks {
+	if dc.linksLoaded {
+		return dc.links
+	}
+
+	dc.linksLoaded = true
+
+	remote, err := gitOutput(dc.config.ProjectRoot, "remote", "get-url", "origin")
+
+	if err != nil {
+		return nil
+	}
+
+	repository, ok := githubRepository(remote)
+
+	if !ok {
+		return nil
+	}
+
+	commit, err := gitOutput(dc.config.ProjectRoot, "rev-parse", "HEAD")
+
+	if err != nil {
+		return nil
+	}
+
+	topLevel, err := gitOutput(dc.config.ProjectRoot, "rev-parse", "--show-toplevel")
+
+	if err != nil {
+		return nil
+	}
+
+	dc.links = &blobLinks{
+		baseURL:  fmt.Sprintf("https://github.com/%s/blob/%s", repository, commit),
+		topLevel: topLevel,
+	}
+
+	return dc.links
+}
+
+// link returns the link to a line of a file of the repository
+// (e.g. https://github.com/<owner>/<repo>/blob/<sha>/docs/guide.md#L42),
+// or "" if the file is outside of it
+func (l *blobLinks) link(file string, line int) string {
+	if l == nil {
+		return ""
+	}
+
+	abs, err := filepath.Abs(file)
+
+	if err != nil {
+		return ""
+	}
+
+	// The top-level is resolved by git, so possibly without symbolic links
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+
+	rel, err := filepath.Rel(l.topLevel, abs)
+
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+
+	return fmt.Sprintf("%s/%s#L%d", l.baseURL, filepath.ToSlash(rel), line)
+}
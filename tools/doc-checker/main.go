@@ -1,56 +1,282 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 const version = "1.0.0"
 
 type Config struct {
-	Files           []string
-	OutputFormat    string
-	Verbose         bool
-	Quiet           bool
-	QuickMode       bool
-	ExitOnError     bool
-	ShowVersion     bool
-	ShowHelp        bool
-	ForceColor      bool
-	NoColor         bool
-	ProjectRoot     string
-	TempDir         string
-	KeepTempDir     bool // New option to keep temp dir after execution
-	ShowSuggestions bool // Show suggestions for fixing common errors
+	Files               []string
+	OutputFormat        string
+	Verbose             bool
+	Quiet               bool
+	QuickMode           bool
+	ExitOnError         bool
+	ShowVersion         bool
+	CheckUpdate         bool              // Check whether a newer release is available
+	PrintConfig         bool              // Print the effective configuration, with the source of each value
+	EnvOptions          map[string]string // Options set from the environment, with their variable (e.g. DOC_CHECKER_OUTPUT)
+	ShowHelp            bool
+	ForceColor          bool
+	NoColor             bool
+	ProjectRoot         string
+	TempDir             string
+	KeepTempDir         bool             // New option to keep temp dir after execution
+	ShowSuggestions     bool             // Show suggestions for fixing common errors
+	WorkKey             string           // Name of the persistent work directory to reuse across runs
+	TargetDir           string           // Cargo target dir shared by the runs (default: the one of the project in the user cache dir)
+	MaxAgeDays          int              // Shared target dirs and result caches unused for more days are removed by gc
+	SnippetNames        string           // Naming scheme of the generated snippet files: path or hash
+	Community           bool             // Also check CONTRIBUTING.md and the .github/ templates
+	Rustdoc             bool             // Also check the examples of the doc comments of the crate sources
+	Parity              bool             // Compare the markdown examples with the rustdoc ones
+	Coverage            bool             // Count the compiled snippets using each public type, against the policy
+	RustdocJSON         []string         // Rustdoc JSON of the documented crates, for the coverage (generated if none)
+	ExplainDiscovery    bool             // Only explain why each markdown file is checked or not
+	VerifyDeterministic bool             // Only check that two runs extract and check the snippets the same way
+	BadgeFile           string           // Where to write the shields.io endpoint badge of the results
+	ReportDir           string           // Where to write the result of each markdown file
+	At                  string           // Git revision at which the files and crates are checked
+	MaxErrorBytes       int              // Length of the reported error messages (0 for no truncation)
+	MaxLineWidth        int              // Width of the code lines of the snippets, warned beyond (0 for no check)
+	ErrorLogDir         string           // Where to write the full compiler output of the failing snippets
+	ArtifactsDir        string           // Where to write the output and exit code of the snippets run
+	LinkBase            string           // URL of the rendered markdown summary, linked from each failure
+	CheckOutput         bool             // Run the snippets followed by their expected output, and compare it
+	Run                 bool             // Run all the snippets which compiled (but no_run, no_main and compile_fail ones)
+	RunTimeout          int              // Seconds a snippet can run with --run, unless it has a timeout= attribute
+	Toolchains          []string         // Rustup toolchains the snippets are also compiled with (e.g. stable, nightly)
+	FeaturesMatrix      [][]string       // Feature sets of the default crate the snippets are also compiled with
+	Clippy              bool             // Lint the snippets which compiled with clippy
+	ClippyLevel         string           // Level of the clippy lints: warn (warnings) or deny (failures)
+	CheckCargoCommands  bool             // Check the cargo commands of the shell blocks against their help
+	BisectBad           string           // Revision where the snippet fails (bisect)
+	InitForce           bool             // Overwrite the files generated by init
+	CIWorkflow          string           // File where init writes the CI workflow (printed otherwise)
+	GraphFormat         string           // Format of the graph of the snippets: dot or mermaid
+	SnippetCode         string           // Code checked by check-snippet (read from stdin if "" or "-")
+	SnippetPrelude      string           // Items of the default crate imported by the snippet of check-snippet
+	BisectGood          string           // Revision where the snippet compiles (bisect)
+	BisectSnippet       string           // Snippet to bisect, as FILE:LINE or FILE:ID (bisect)
+	Query               string           // JMESPath expression applied to the JSON results
+	APIFilter           []string         // Only check the snippets referencing these crate paths
+	Filter              []SnippetFilter  // Only check the snippets with these identifiers
+	Baseline            string           // File of the known failures, reported as excluded
+	UpdateBaseline      bool             // Replace the known failures of the baseline with the ones of the run
+	KnownFailures       []BaselineEntry  // Failures of the baseline
+	Shard               *ShardInfo       // Only check the snippets of this shard (nil for all of them)
+	SelectCodes         []string         // Only report the failures with these error codes
+	IgnoreCodes         []string         // Don't report the failures with only these error codes
+	AgainstPublished    bool             // Compile against the published versions of the crates
+	ProgressJSON        bool             // Report the progress as JSON lines on stderr
+	DiffProject         bool             // Print the changes of the generated project since the previous run
+	IndentedBlocks      bool             // Also check the indented code blocks with a language hint
+	ExtractJobs         int              // Markdown files read and parsed at the same time
+	CargoJobs           int              // Parallel jobs of cargo (0 for the cargo default)
+	Jobs                int              // Snippets checked at the same time when compiled one by one
+	WriteBatch          int              // Generated snippet files written together (0 or 1 to write each at once)
+	WarningsAsErrors    bool             // Fail when there are warnings
+	Hermetic            bool             // Only use the declared paths, without network access
+	CargoHome           string           // CARGO_HOME, in hermetic mode
+	RegistryDir         string           // Vendored dependencies (e.g. from `cargo vendor`), in hermetic mode
+	ToolchainDir        string           // Rust toolchain (with bin/cargo and bin/rustc), in hermetic mode
+	OutDir              string           // Output directory (generated project and target dir), in hermetic mode
+	NoCache             bool             // Don't use the result cache
+	NoSyntaxPrecheck    bool             // Compile the snippets even with blatant syntax errors
+	Stats               bool             // Append the usage stats of the run to the local stats file
+	ConfigFile          string           // Configuration file (default: .doc-checker.toml at the project root)
+	Crates              []CrateConfig    // Documented crates, the default one first
+	Renames             []PathRename     // Outdated paths, flagged in the snippets
+	ContentRules        []ContentRule    // Contents flagged in the code blocks (e.g. local paths)
+	ShellCommands       []string         // Commands of the shell blocks known to exist, even if not in the PATH
+	RustAliases         []string         // Other languages of the fences checked as Rust snippets (e.g. tnuctipun)
+	CoveragePolicies    []CoveragePolicy // Minimum number of examples of the public types, by module
 }
 
 type Results struct {
-	Summary Summary               `json:"summary"`
-	Files   map[string]FileResult `json:"files"`
+	SchemaVersion int `json:"schema_version"` // See `doc-checker schema`
+
+	Summary  Summary               `json:"summary"`
+	Files    map[string]FileResult `json:"files"`
+	Shard    *ShardInfo            `json:"shard,omitempty"` // Part of the snippets checked, with --shard
+	Parity   *ParityReport         `json:"parity,omitempty"`
+	Coverage *CoverageReport       `json:"coverage,omitempty"`
+	Warnings []Warning             `json:"warnings"`
+
+	// Results of each mode which ran (check, lint, parity, coverage), and the combined
+	// verdict: "failed" if any mode failed, "passed" otherwise
+	Modes   map[string]ModeResult `json:"modes"`
+	Verdict string                `json:"verdict"`
 }
 
 type Summary struct {
 	TotalSnippets    int            `json:"total_snippets"`
 	ValidSnippets    int            `json:"valid_snippets"`
+	WarnedSnippets   int            `json:"warned_snippets"` // Valid ones which compiled with warnings
 	FailedSnippets   int            `json:"failed_snippets"`
+	SkippedSnippets  int            `json:"skipped_snippets"`
+	IgnoredSnippets  int            `json:"ignored_snippets"`
+	IgnoreReasons    map[string]int `json:"ignore_reasons"`    // Ignored snippets by reason (ignore(reason="..."))
+	FilteredSnippets int            `json:"filtered_snippets"` // Not selected by --api-filter or --filter
+	ShardedSnippets  int            `json:"sharded_snippets"`  // Checked by the other shards, with --shard
+	PreviewSnippets  int            `json:"preview_snippets"`  // Examples of unreleased APIs (preview attribute)
 	FilesProcessed   int            `json:"files_processed"`
 	ErrorsByCategory map[string]int `json:"errors_by_category"`
+	ErrorsByCode     map[string]int `json:"errors_by_code"`    // Failed snippets by rustc error code (e.g. E0609)
+	ExcludedFailures int            `json:"excluded_failures"` // Failures excluded by --select, --ignore-codes or --baseline
+	Warnings         int            `json:"warnings"`
+	WarningsByCode   map[string]int `json:"warnings_by_code"`
+	CacheHits        int            `json:"cache_hits"`   // Snippets unchanged since they were checked (compiled successfully or not)
+	CacheMisses      int            `json:"cache_misses"` // Snippets not found in the cache, so compiled
+
+	// Outcome of the snippets compiled with each toolchain of --toolchains
+	Toolchains []ToolchainResult `json:"toolchains,omitempty"`
+
+	// Outcome of the snippets compiled with each feature set of --features-matrix
+	FeatureSets []FeatureSetResult `json:"feature_sets,omitempty"`
+
+	// Where to start fixing: the failure which comes first in the documentation
+	FirstFailure *FailurePointer `json:"first_failure,omitempty"`
+}
+
+// FailurePointer locates a failure of the results
+type FailurePointer struct {
+	File      string `json:"file"` // As in the files of the results
+	Line      int    `json:"line"`
+	SnippetID string `json:"snippet_id"`
+	Category  string `json:"category"`
 }
 
 type FileResult struct {
-	SnippetsFound  int      `json:"snippets_found"`
-	SnippetsValid  int      `json:"snippets_valid"`
-	SnippetsFailed int      `json:"snippets_failed"`
-	Errors         []string `json:"errors"`
+	SnippetsFound   int       `json:"snippets_found"`
+	SnippetsValid   int       `json:"snippets_valid"`
+	SnippetsFailed  int       `json:"snippets_failed"`
+	SnippetsSkipped int       `json:"snippets_skipped"`
+	Errors          []string  `json:"errors"`
+	Failures        []Failure `json:"failures"`
+
+	// Every snippet of the file, in order, with its outcome
+	Snippets []SnippetResult `json:"snippets"`
+
+	// Attempts of the snippets with retries=N
+	Retries []SnippetAttempts `json:"retries,omitempty"`
+}
+
+// SnippetAttempts records how many attempts were needed to check a snippet
+type SnippetAttempts struct {
+	SnippetID string `json:"snippet_id"`
+	Line      int    `json:"line"`
+	Attempts  int    `json:"attempts"`
+	Passed    bool   `json:"passed"`
+}
+
+// SnippetResult is the outcome of a snippet of a markdown file
+type SnippetResult struct {
+	ID           string            `json:"id"`
+	Line         int               `json:"line"` // Line of the opening fence in the markdown file
+	EndLine      int               `json:"end_line"`
+	Attributes   map[string]string `json:"attributes,omitempty"`    // key=value attributes of the fence (e.g. retries)
+	Status       string            `json:"status"`                  // valid, warnings, failed, excluded, ignored, skipped, filtered, other_shard, preview or unchecked
+	Preview      bool              `json:"preview,omitempty"`       // Example of an unreleased API
+	IgnoreReason string            `json:"ignore_reason,omitempty"` // Why an ignored snippet is ignored
+	Snippet      string            `json:"snippet,omitempty"`       // Name of the generated binary
+	Attempts     int               `json:"attempts,omitempty"`
+
+	// Time spent compiling the snippet on its own (not set when compiled
+	// with the others at once, or found in the result cache)
+	DurationMs int64 `json:"duration_ms,omitempty"`
+
+	// Warnings of the compiler, for a snippet which compiled with some (warnings status)
+	CompilerWarnings []string `json:"compiler_warnings,omitempty"`
+
+	// Lints of clippy, for a snippet which passed with some (warnings status, --clippy)
+	ClippyLints []string `json:"clippy_lints,omitempty"`
+
+	// Outcome of the run of the snippet (--run, --check-output)
+	Run *SnippetRun `json:"run,omitempty"`
+
+	Failure *Failure `json:"failure,omitempty"`
+}
+
+// SnippetRun is the outcome of the run of a snippet binary, with its output
+// (truncated as the error messages, with --max-error-bytes)
+type SnippetRun struct {
+	ExitCode   int    `json:"exit_code"` // -1 if killed (e.g. timed out)
+	DurationMs int64  `json:"duration_ms"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+
+	// Files of the full output and exit code, in the --artifacts-dir
+	StdoutFile string `json:"stdout_file,omitempty"`
+	StderrFile string `json:"stderr_file,omitempty"`
+	ExitFile   string `json:"exit_file,omitempty"`
+}
+
+// Failure describes a snippet which failed to compile
+type Failure struct {
+	Snippet   string `json:"snippet"`
+	SnippetID string `json:"snippet_id"`
+	Line      int    `json:"line"` // Line of the opening fence in the markdown file
+	EndLine   int    `json:"end_line"`
+	Category  string `json:"category"`
+	Message   string `json:"message"`
+
+	// Codes of the compiler errors (e.g. E0609)
+	Codes []string `json:"codes,omitempty"`
+
+	// Stable identifier (file + snippet content + category), suitable to
+	// de-duplicate the same finding across runs
+	Fingerprint string `json:"fingerprint"`
+
+	// Machine-applicable suggestions from the compiler
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+
+	// Full compiler output, with --error-log-dir
+	LogFile string `json:"log_file,omitempty"`
+
+	// Link to the snippet on GitHub, at the checked commit, when the origin is on GitHub
+	Link string `json:"link,omitempty"`
+
+	// Link to the section of the failure in the rendered markdown summary, with --link-base
+	ReportLink string `json:"report_link,omitempty"`
+
+	// Whether the failure isn't due to the snippet (e.g. a dependency which could not be resolved)
+	environment bool
+}
+
+// Warning is a non-fatal finding (e.g. a code block looking like Rust but not tagged as such),
+// which only fails the check with --warnings-as-errors
+type Warning struct {
+	Code    string `json:"code"`
+	Level   string `json:"level"`          // "warning", or "error" with --warnings-as-errors
+	File    string `json:"file,omitempty"` // Empty for the project-wide warnings
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
 }
 
 func main() {
-	config, err := parseFlags()
+	args := os.Args[1:]
+	command := ""
+
+	// Subcommands are given before the options (e.g. "doc-checker rpc --work-key editor")
+	if len(args) > 0 && (args[0] == "rpc" || args[0] == "status" || args[0] == "schema" || args[0] == "bisect" || args[0] == "warmup" || args[0] == "init" || args[0] == "stats" || args[0] == "graph" || args[0] == "merge" || args[0] == "aggregate" || args[0] == "check-snippet" || args[0] == "gc") {
+		command = args[0]
+		args = args[1:]
+	}
+
+	config, err := parseFlags(args)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(2)
@@ -61,8 +287,75 @@ func main() {
 		os.Exit(0)
 	}
 
+	if config.CheckUpdate {
+		printUpdateNotice()
+	}
+
 	if config.ShowVersion {
-		fmt.Printf("doc-checker version %s\n", version)
+		fmt.Printf("doc-checker version %s\n", versionString())
+		os.Exit(0)
+	}
+
+	if config.PrintConfig {
+		if err := printConfig(os.Stdout, flag.CommandLine, config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+
+		os.Exit(0)
+	}
+
+	if command == "rpc" {
+		if err := serveRPC(config, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+
+		os.Exit(0)
+	}
+
+	if command == "status" {
+		os.Exit(showStatus(config))
+	}
+
+	if command == "bisect" {
+		os.Exit(runBisect(config))
+	}
+
+	if command == "init" {
+		os.Exit(runInit(config, os.Stdout))
+	}
+
+	if command == "stats" {
+		os.Exit(showStats(config))
+	}
+
+	if command == "graph" {
+		os.Exit(runGraph(config, os.Stdout))
+	}
+
+	if command == "aggregate" {
+		os.Exit(runAggregate(config, os.Stdout))
+	}
+
+	if command == "gc" {
+		os.Exit(runGC(config, os.Stdout))
+	}
+
+	if command == "warmup" {
+		if err := NewDocChecker(config).Warmup(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+
+		os.Exit(0)
+	}
+
+	if command == "schema" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(resultsSchema())
+
 		os.Exit(0)
 	}
 
@@ -74,15 +367,57 @@ func main() {
 	}
 
 	checker := NewDocChecker(config)
-	results, err := checker.Run()
+
+	if config.ExplainDiscovery {
+		entries, err := checker.ExplainDiscovery()
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+
+		writeDiscovery(os.Stdout, entries, config.OutputFormat)
+		os.Exit(0)
+	}
+
+	if config.VerifyDeterministic {
+		report, err := checker.VerifyDeterministic()
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+
+		writeDeterminismReport(os.Stdout, report, config.OutputFormat)
+
+		if !report.Deterministic {
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	var results *Results
+	startedAt := time.Now()
+
+	if command == "merge" {
+		results, err = mergeShardFiles(config.Files)
+	} else if command == "check-snippet" {
+		results, err = checkSnippetCommand(checker, os.Stdin)
+	} else if config.At != "" {
+		results, err = checkAtRevision(context.Background(), config)
+	} else {
+		results, err = checker.Run()
+	}
 
 	if err != nil {
-		if config.OutputFormat == "json" {
-			errorResult := Results{
-				Summary: Summary{},
-				Files:   make(map[string]FileResult),
-			}
-			json.NewEncoder(os.Stdout).Encode(errorResult)
+		if config.OutputFormat == "jsonl" {
+			writeEvent(os.Stdout, ErrorEvent{Type: "error", Message: err.Error()})
+		} else if config.OutputFormat == "json" {
+			results := newResults()
+			results.Verdict = verdictFailed
+
+			json.NewEncoder(os.Stdout).Encode(results)
 		} else {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		}
@@ -90,37 +425,187 @@ func main() {
 		os.Exit(2)
 	}
 
+	// Nothing is written outside of the declared outputs in hermetic mode, and
+	// neither a past revision, merged shards nor a snippet are a run of the project
+	projectRun := command != "merge" && command != "check-snippet"
+
+	if !config.Hermetic && config.At == "" && projectRun {
+		if err := saveRunState(config, results, time.Now()); err != nil && config.OutputFormat == "human" {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save the run state: %v\n", err)
+		}
+	}
+
+	if config.Stats && !config.Hermetic && projectRun {
+		path, err := statsFile()
+
+		if err == nil {
+			err = appendRunStats(path, newRunStats(results, startedAt, time.Since(startedAt)))
+		}
+
+		if err != nil && config.OutputFormat == "human" {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save the usage stats: %v\n", err)
+		}
+	}
+
+	if config.BadgeFile != "" {
+		if err := writeBadge(config.BadgeFile, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
 	// Output results
-	if config.OutputFormat == "json" {
+	switch config.OutputFormat {
+	case "json":
+		var output interface{} = results
+
+		if config.Query != "" {
+			query, _ := CompileQuery(config.Query) // already validated by parseFlags
+
+			if output, err = query.Apply(results); err != nil {
+				fmt.Fprintf(os.Stderr, "Error applying query: %v\n", err)
+				os.Exit(2)
+			}
+		}
+
 		encoder := json.NewEncoder(os.Stdout)
 		encoder.SetIndent("", "  ")
 
-		if err := encoder.Encode(results); err != nil {
+		if err := encoder.Encode(output); err != nil {
 			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
 			os.Exit(2)
 		}
-	} else {
+
+	case "jsonl":
+		// The snippets are already streamed, as they are checked
+		writeEvent(os.Stdout, SummaryEvent{
+			Type:     "summary",
+			Summary:  results.Summary,
+			Warnings: results.Warnings,
+			Modes:    results.Modes,
+			Verdict:  results.Verdict,
+		})
+
+	case "sarif":
+		if err := writeSARIF(os.Stdout, results, config.ProjectRoot); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding SARIF: %v\n", err)
+			os.Exit(2)
+		}
+
+	case "github":
+		writeGitHubAnnotations(os.Stdout, results, config.ProjectRoot)
+
+	case "markdown":
+		writeMarkdownSummary(os.Stdout, results, config.ProjectRoot)
+
+	case "porcelain":
+		writePorcelain(os.Stdout, results)
+
+	default:
 		printHumanResults(results, config.Verbose, config.ShowSuggestions)
 	}
 
 	// Exit with appropriate code
-	if results.Summary.FailedSnippets > 0 {
+	if results.Verdict == verdictFailed {
 		os.Exit(1)
 	}
 }
 
-func parseFlags() (*Config, error) {
+// showStatus prints the summary of the latest run for the project,
+// and returns the exit code (as the one of the run, or 3 if there is none)
+func showStatus(config *Config) int {
+	state, err := loadRunState(config.ProjectRoot)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	if state == nil {
+		fmt.Fprintf(os.Stderr, "No previous run for %s\n", config.ProjectRoot)
+		return 3
+	}
+
+	if config.OutputFormat == "json" {
+		var output interface{} = state
+
+		if config.Query != "" {
+			query, _ := CompileQuery(config.Query)
+
+			if output, err = query.Apply(state); err != nil {
+				fmt.Fprintf(os.Stderr, "Error applying query: %v\n", err)
+				return 2
+			}
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(output)
+	} else {
+		printRunState(os.Stdout, state, time.Now())
+	}
+
+	if state.Summary.FailedSnippets > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// runBisect finds the commit which broke a snippet, and returns the exit code
+func runBisect(config *Config) int {
+	progress := io.Discard
+
+	if config.OutputFormat == "human" {
+		progress = os.Stderr
+	}
+
+	result, err := bisectSnippet(context.Background(), config, progress)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	if config.OutputFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+	} else {
+		printBisectResult(os.Stdout, result)
+	}
+
+	return 0
+}
+
+func parseFlags(args []string) (*Config, error) {
 	config := &Config{
 		OutputFormat: "human",
 		Verbose:      true,
+		SnippetNames: "path",
+		ExtractJobs:  1,
+		Jobs:         1,
+		MaxAgeDays:   30,
+		RunTimeout:   10,
+		ClippyLevel:  clippyWarn,
 	}
 
 	var filesStr string
+	var apiFilter string
+	var snippetFilter string
+	var rustdocJSON string
+	var shard string
+	var selectCodes, ignoreCodes string
+	var toolchains, featuresMatrix string
+	var porcelain bool
+	var lang string
 
 	flag.StringVar(&filesStr, "f", "", "Comma-separated list of files to check")
 	flag.StringVar(&filesStr, "files", "", "Comma-separated list of files to check")
-	flag.StringVar(&config.OutputFormat, "o", "human", "Output format: human or json")
-	flag.StringVar(&config.OutputFormat, "output", "human", "Output format: human or json")
+	flag.StringVar(&config.OutputFormat, "o", "human", "Output format: human, json, jsonl, sarif, github, markdown or porcelain")
+	flag.StringVar(&config.OutputFormat, "output", "human", "Output format: human, json, jsonl, sarif, github, markdown or porcelain")
+	flag.StringVar(&lang, "lang", "en", "Language of the reports: en, fr, or a TOML file of messages")
+	flag.BoolVar(&porcelain, "porcelain", false, "Print a single line with the counts (same as -o porcelain)")
 	flag.BoolVar(&config.Quiet, "q", false, "Quiet mode")
 	flag.BoolVar(&config.Quiet, "quiet", false, "Quiet mode")
 	flag.BoolVar(&config.Verbose, "v", true, "Verbose mode")
@@ -130,12 +615,85 @@ func parseFlags() (*Config, error) {
 	flag.BoolVar(&config.ForceColor, "color", false, "Force colored output")
 	flag.BoolVar(&config.NoColor, "no-color", false, "Disable colored output")
 	flag.BoolVar(&config.ShowVersion, "version", false, "Show version")
+	flag.BoolVar(&config.CheckUpdate, "check-update", false, "Check whether a newer release of doc-checker is available (GitHub API)")
 	flag.BoolVar(&config.ShowHelp, "h", false, "Show help")
 	flag.BoolVar(&config.ShowHelp, "help", false, "Show help")
 	flag.BoolVar(&config.KeepTempDir, "keep-temp", false, "Keep temporary directory after execution")
 	flag.BoolVar(&config.ShowSuggestions, "suggestions", false, "Show suggestions for fixing common documentation errors")
+	flag.BoolVar(&config.WarningsAsErrors, "warnings-as-errors", false, "Fail when there are warnings")
+	flag.IntVar(&config.MaxLineWidth, "max-line-width", 0, "Warn about the code lines of the snippets wider than this number of characters (0 for no check)")
+	flag.BoolVar(&config.Stats, "stats", false, "Append the usage stats of the run to the local stats file")
+	flag.BoolVar(&config.Parity, "parity", false, "Report public items with examples only in markdown or only in rustdoc")
+	flag.BoolVar(&config.Coverage, "coverage", false, "Count the compiled snippets using each public type, and report the gaps of the [coverage] policy")
+	flag.StringVar(&rustdocJSON, "rustdoc-json", "", "Comma-separated rustdoc JSON files of the documented crates, for --coverage (generated with nightly if not given)")
+	flag.StringVar(&config.BadgeFile, "badge-file", "", "Write a shields.io endpoint badge (valid/total snippets) to this file")
+	flag.StringVar(&config.ReportDir, "report-dir", "", "Write one result file per markdown file (with the failing snippet sources) to this directory")
+	flag.IntVar(&config.MaxErrorBytes, "max-error-bytes", 500, "Truncate the reported error messages to this number of bytes (0 for no truncation)")
+	flag.StringVar(&config.ErrorLogDir, "error-log-dir", "", "Write the full compiler output of each failing snippet to this directory")
+	flag.StringVar(&config.ArtifactsDir, "artifacts-dir", "", "Write the stdout, stderr and exit code of each snippet run (--run, --check-output) to this directory")
+	flag.BoolVar(&config.CheckOutput, "check-output", false, "Run the snippets followed by a text or console block, and compare their output with it")
+	flag.BoolVar(&config.Run, "run", false, "Run the snippets which compiled, and fail the ones panicking or exceeding their timeout")
+	flag.IntVar(&config.RunTimeout, "run-timeout", 10, "Seconds a snippet can run with --run, unless it has a timeout= attribute")
+	flag.StringVar(&toolchains, "toolchains", "", "Comma-separated rustup toolchains to also compile the snippets with (e.g. stable,beta,nightly)")
+	flag.StringVar(&featuresMatrix, "features-matrix", "", "Feature sets of the default crate to also compile the snippets with, separated by semicolons (e.g. \"default;chrono;uuid,chrono\")")
+	flag.BoolVar(&config.Clippy, "clippy", false, "Lint the snippets which compiled with clippy")
+	flag.StringVar(&config.ClippyLevel, "clippy-level", clippyWarn, "Level of the clippy lints: warn (reported as warnings) or deny (as failures)")
+	flag.BoolVar(&config.CheckCargoCommands, "check-cargo-commands", false, "Check the subcommand and flags of the cargo commands of the shell blocks with their --help")
+	flag.StringVar(&config.LinkBase, "link-base", "", "URL of the rendered markdown summary (-o markdown), to link each failure to its section")
+	flag.StringVar(&config.BisectBad, "bad", "HEAD", "Revision where the snippet fails to compile (bisect)")
+	flag.BoolVar(&config.InitForce, "force", false, "Overwrite the files generated by init")
+	flag.StringVar(&config.CIWorkflow, "ci-workflow", "", "File where init writes the CI workflow (printed otherwise)")
+	flag.StringVar(&config.GraphFormat, "format", "dot", "Format of the graph of the snippets: dot or mermaid")
+	flag.StringVar(&config.SnippetCode, "code", "", "Code of the snippet to check (check-snippet), read from stdin if not given")
+	flag.StringVar(&config.SnippetPrelude, "prelude", "", "Comma-separated items of the default crate imported by the snippet, instead of its prelude (check-snippet)")
+	flag.StringVar(&config.BisectGood, "good", "", "Revision where the snippet compiles (bisect)")
+	flag.StringVar(&config.BisectSnippet, "snippet", "", "Snippet to bisect, as FILE:LINE or FILE:ID (bisect)")
+	flag.StringVar(&config.At, "at", "", "Check the files against the crates as they existed at this git revision")
+	flag.BoolVar(&config.ExplainDiscovery, "explain-discovery", false, "Explain why each markdown file is checked or not, without checking")
+	flag.BoolVar(&config.VerifyDeterministic, "verify-deterministic", false, "Check that two runs extract and check the snippets the same way")
+	flag.BoolVar(&config.Community, "community", false, "Also check community files: CONTRIBUTING.md, issue/PR templates in .github/")
+	flag.BoolVar(&config.Rustdoc, "rustdoc", false, "Also check the examples of the doc comments (/// and //!) of the crate sources (src/**/*.rs)")
+	flag.StringVar(&config.SnippetNames, "snippet-names", "path", "Naming scheme of the generated snippet files: path or hash")
+	flag.BoolVar(&config.ProgressJSON, "progress-json", false, "Report the progress as JSON lines on stderr (e.g. for IDE plugins)")
+	flag.StringVar(&shard, "shard", "", "Only check the snippets of a shard, as K/N (e.g. 2/4 for the 2nd of 4 shards)")
+	flag.StringVar(&apiFilter, "api-filter", "", "Only check the snippets referencing these comma-separated crate paths (e.g. updates::set,filters::eq)")
+	flag.StringVar(&snippetFilter, "filter", "", "Only check the snippets with these comma-separated identifiers, as ID or FILE:ID globs (e.g. find_by_name,docs/guide.md:setup_*)")
+	flag.StringVar(&config.Baseline, "baseline", "", "JSON file of the known failures, reported as excluded rather than failed")
+	flag.BoolVar(&config.UpdateBaseline, "update-baseline", false, "Replace the known failures of the --baseline file with the ones of the run")
+	flag.StringVar(&selectCodes, "select", "", "Only report the failures with one of these comma-separated rustc error codes (e.g. E0609,E0433)")
+	flag.StringVar(&ignoreCodes, "ignore-codes", "", "Don't report the failures with only these comma-separated rustc error codes (e.g. E0601)")
+	flag.BoolVar(&config.AgainstPublished, "against-published", false, "Compile the snippets against the published versions of the crates (except the preview ones)")
+	flag.BoolVar(&config.IndentedBlocks, "indented-blocks", false, "Also check the indented code blocks preceded by a language hint (e.g. <!-- lang: rust -->)")
+	flag.IntVar(&config.ExtractJobs, "extract-jobs", 1, "Number of markdown files read and parsed at the same time")
+	flag.IntVar(&config.CargoJobs, "cargo-jobs", 0, "Number of parallel jobs of cargo (0 for the cargo default, the number of CPUs)")
+	flag.IntVar(&config.Jobs, "j", 1, "Number of snippets checked at the same time when compiled one by one")
+	flag.IntVar(&config.Jobs, "jobs", 1, "Number of snippets checked at the same time when compiled one by one")
+	flag.IntVar(&config.WriteBatch, "write-batch", 0, "Write the generated snippet files by batches of this size (0 to write each file at once)")
+	flag.StringVar(&config.Query, "query", "", "JMESPath expression to extract fields from the JSON results (implies -o json)")
+	flag.StringVar(&config.WorkKey, "work-key", "", "Reuse the generated project (and target dir) keyed by this name across runs")
+	flag.StringVar(&config.TargetDir, "target-dir", "", "Cargo target dir shared by the runs (default: the one of the project in the user cache directory)")
+	flag.IntVar(&config.MaxAgeDays, "max-age", 30, "Remove the shared target dirs and result caches unused for more than this number of days (gc)")
+	flag.BoolVar(&config.DiffProject, "diff-project", false, "Print the diff of the generated project since the previous run (with --work-key or --hermetic)")
+	flag.BoolVar(&config.NoCache, "no-cache", false, "Don't use the cache of the outcomes of the unchanged snippets")
+	flag.BoolVar(&config.NoSyntaxPrecheck, "no-syntax-precheck", false, "Compile the snippets with blatant syntax errors too, instead of reporting them before compiling")
+	flag.StringVar(&config.ConfigFile, "config", "", "Configuration file (default: .doc-checker.toml at the project root)")
+	flag.BoolVar(&config.PrintConfig, "print-config", false, "Print the effective configuration, with the source of each value (TOML, or JSON with -o json)")
+	flag.BoolVar(&config.Hermetic, "hermetic", false, "Hermetic mode: only use the declared paths, without network access")
+	flag.StringVar(&config.CargoHome, "cargo-home", "", "Cargo home directory (hermetic mode)")
+	flag.StringVar(&config.RegistryDir, "registry", "", "Directory of the vendored dependencies (hermetic mode)")
+	flag.StringVar(&config.ToolchainDir, "toolchain", "", "Rust toolchain directory, with bin/cargo and bin/rustc (hermetic mode)")
+	flag.StringVar(&config.OutDir, "out-dir", "", "Output directory for the generated project and target dir (hermetic mode)")
 
-	flag.Parse()
+	// The flags take precedence over the environment
+	envOptions, err := applyEnv(flag.CommandLine, os.Environ(), os.Stderr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config.EnvOptions = envOptions
+
+	flag.CommandLine.Parse(args)
 
 	if config.Quiet {
 		config.Verbose = false
@@ -149,8 +707,173 @@ func parseFlags() (*Config, error) {
 		os.Setenv("NO_COLOR", "1")
 	}
 
-	if config.OutputFormat != "human" && config.OutputFormat != "json" {
-		return nil, fmt.Errorf("invalid output format '%s'. Must be 'human' or 'json'", config.OutputFormat)
+	if err := setLanguage(lang); err != nil {
+		return nil, err
+	}
+
+	if porcelain {
+		if config.OutputFormat != "human" && config.OutputFormat != "porcelain" {
+			return nil, fmt.Errorf("--porcelain cannot be used with the '%s' output format", config.OutputFormat)
+		}
+
+		config.OutputFormat = "porcelain"
+	}
+
+	if !isValidOutputFormat(config.OutputFormat) {
+		return nil, fmt.Errorf("invalid output format '%s'. Must be one of: %s",
+			config.OutputFormat, strings.Join(outputFormats, ", "))
+	}
+
+	if config.Query != "" {
+		if _, err := CompileQuery(config.Query); err != nil {
+			return nil, err
+		}
+
+		// The query is applied to the JSON results
+		if config.OutputFormat == "human" {
+			config.OutputFormat = "json"
+		} else if config.OutputFormat != "json" {
+			return nil, fmt.Errorf("--query cannot be used with the '%s' output format", config.OutputFormat)
+		}
+	}
+
+	if config.ExplainDiscovery && config.OutputFormat != "human" &&
+		config.OutputFormat != "json" && config.OutputFormat != "jsonl" {
+		return nil, fmt.Errorf("--explain-discovery cannot be used with the '%s' output format", config.OutputFormat)
+	}
+
+	if config.VerifyDeterministic && config.OutputFormat != "human" && config.OutputFormat != "json" {
+		return nil, fmt.Errorf("--verify-deterministic cannot be used with the '%s' output format", config.OutputFormat)
+	}
+
+	if strings.Contains(config.LinkBase, "#") {
+		return nil, fmt.Errorf("invalid --link-base %s. Must be the URL of the report, without anchor", config.LinkBase)
+	}
+
+	if config.MaxLineWidth < 0 {
+		return nil, fmt.Errorf("invalid --max-line-width %d. Must be positive (or 0 for no check)", config.MaxLineWidth)
+	}
+
+	if config.MaxErrorBytes < 0 {
+		return nil, fmt.Errorf("invalid --max-error-bytes %d. Must be positive (or 0 for no truncation)", config.MaxErrorBytes)
+	}
+
+	if config.ExtractJobs < 1 {
+		return nil, fmt.Errorf("invalid --extract-jobs %d. Must be at least 1", config.ExtractJobs)
+	}
+
+	if config.CargoJobs < 0 {
+		return nil, fmt.Errorf("invalid --cargo-jobs %d. Must be positive (or 0 for the cargo default)", config.CargoJobs)
+	}
+
+	if config.Jobs < 1 {
+		return nil, fmt.Errorf("invalid --jobs %d. Must be at least 1", config.Jobs)
+	}
+
+	if config.WriteBatch < 0 {
+		return nil, fmt.Errorf("invalid --write-batch %d. Must be positive (or 0 to write each file at once)", config.WriteBatch)
+	}
+
+	if config.SnippetNames != "path" && config.SnippetNames != "hash" {
+		return nil, fmt.Errorf("invalid snippet naming scheme '%s'. Must be 'path' or 'hash'", config.SnippetNames)
+	}
+
+	if config.WorkKey != "" && !isValidWorkKey(config.WorkKey) {
+		return nil, fmt.Errorf("invalid work key '%s'. Must only contain letters, digits, '.', '_' or '-'", config.WorkKey)
+	}
+
+	if config.TargetDir != "" {
+		if config.TargetDir, err = filepath.Abs(config.TargetDir); err != nil {
+			return nil, fmt.Errorf("invalid --target-dir: %w", err)
+		}
+	}
+
+	if config.RunTimeout < 1 {
+		return nil, fmt.Errorf("invalid --run-timeout %d. Must be at least 1 second", config.RunTimeout)
+	}
+
+	if config.ClippyLevel != clippyWarn && config.ClippyLevel != clippyDeny {
+		return nil, fmt.Errorf("invalid --clippy-level %s. Must be warn or deny", config.ClippyLevel)
+	}
+
+	if config.MaxAgeDays < 0 {
+		return nil, fmt.Errorf("invalid --max-age %d. Must be positive (or 0 to remove all the shared target dirs)", config.MaxAgeDays)
+	}
+
+	if config.DiffProject && config.WorkKey == "" && !config.Hermetic {
+		return nil, fmt.Errorf("--diff-project requires a persistent work directory (--work-key or --hermetic)")
+	}
+
+	if shard != "" {
+		if config.Shard, err = parseShard(shard); err != nil {
+			return nil, err
+		}
+	}
+
+	if apiFilter != "" {
+		paths, err := parseAPIFilter(apiFilter)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.APIFilter = paths
+	}
+
+	if snippetFilter != "" {
+		if config.Filter, err = parseSnippetFilters(snippetFilter); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.UpdateBaseline && config.Baseline == "" {
+		return nil, fmt.Errorf("--update-baseline requires the --baseline file")
+	}
+
+	if config.Baseline != "" {
+		if config.KnownFailures, err = loadBaseline(config.Baseline, config.UpdateBaseline); err != nil {
+			return nil, err
+		}
+	}
+
+	if toolchains != "" {
+		if config.Toolchains, err = parseToolchains(toolchains); err != nil {
+			return nil, err
+		}
+	}
+
+	if featuresMatrix != "" {
+		if config.FeaturesMatrix, err = parseFeaturesMatrix(featuresMatrix); err != nil {
+			return nil, err
+		}
+	}
+
+	if selectCodes != "" {
+		codes, err := parseErrorCodes("select", selectCodes)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.SelectCodes = codes
+	}
+
+	if ignoreCodes != "" {
+		codes, err := parseErrorCodes("ignore-codes", ignoreCodes)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.IgnoreCodes = codes
+	}
+
+	if rustdocJSON != "" {
+		config.Coverage = true
+
+		for _, file := range strings.Split(rustdocJSON, ",") {
+			config.RustdocJSON = append(config.RustdocJSON, strings.TrimSpace(file))
+		}
 	}
 
 	// Parse files
@@ -165,6 +888,24 @@ func parseFlags() (*Config, error) {
 	// Add remaining arguments as files
 	config.Files = append(config.Files, flag.Args()...)
 
+	if config.Hermetic {
+		if err := validateHermetic(config); err != nil {
+			return nil, err
+		}
+
+		if config.At != "" {
+			return nil, fmt.Errorf("--at cannot be used with --hermetic")
+		}
+	}
+
+	if config.At != "" && config.ExplainDiscovery {
+		return nil, fmt.Errorf("--at cannot be used with --explain-discovery")
+	}
+
+	if config.At != "" && config.VerifyDeterministic {
+		return nil, fmt.Errorf("--at cannot be used with --verify-deterministic")
+	}
+
 	// Get project root - look for Cargo.toml in parent directories
 	wd, err := os.Getwd()
 	if err != nil {
@@ -179,9 +920,43 @@ func parseFlags() (*Config, error) {
 
 	config.ProjectRoot = projectRoot
 
+	if err := loadConfigFile(config); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
 
+// Supported values of the --output option
+var outputFormats = []string{"human", "json", "jsonl", "sarif", "github", "markdown", "porcelain"}
+
+func isValidOutputFormat(format string) bool {
+	for _, f := range outputFormats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isValidWorkKey checks the work key can safely be used as a directory name
+func isValidWorkKey(key string) bool {
+	if key == "." || key == ".." {
+		return false
+	}
+
+	for _, r := range key {
+		isAlnum := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+
+		if !isAlnum && r != '.' && r != '_' && r != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
 func findProjectRoot(startDir string) string {
 	dir := startDir
 	for {
@@ -207,134 +982,538 @@ Extract and validate Rust code snippets from Markdown files.
 
 USAGE:
 	doc-checker [OPTIONS] [FILES...]
+	doc-checker rpc [OPTIONS]
+	doc-checker status [-o json]
+	doc-checker schema
+	doc-checker bisect --good REV [--bad REV] --snippet FILE:LINE
+	doc-checker init [--ci-workflow FILE] [--force]
+	doc-checker stats [-o json]
+	doc-checker graph [--format dot|mermaid] [FILES...]
+	doc-checker merge [OPTIONS] SHARD_RESULTS...
+	doc-checker aggregate [-o json] [NAME=]RESULTS...
+	doc-checker check-snippet [--code CODE] [--prelude ITEMS] [OPTIONS]
+	doc-checker gc [--max-age DAYS]
+
+COMMANDS:
+	rpc                     Serve JSON-RPC requests over stdio (check_file, check_snippet, cancel)
+	status                  Print the summary of the latest run for the project (with its age)
+	schema                  Print the JSON Schema of the JSON results
+	bisect                  Find the commit which broke a snippet, with git bisect
+	warmup                  Compile the dependencies of the snippets, without any snippet,
+	                        in the --work-key directory (e.g. in a cached CI stage)
+	init                    Generate a starter .doc-checker.toml from the crates and the
+	                        snippets of the project, and a CI workflow
+	stats                   Summarize the usage stats recorded with --stats (durations,
+	                        cache hit rate)
+	graph                   Print the graph of the snippets building on each other
+	                        (continues= and requires=), per file
+	merge                   Combine the JSON results of the shards of a run (--shard)
+	                        into the results of the whole run
+	aggregate               Combine the JSON results of several repositories into a
+	                        cross-repository report (totals, per repository, shared
+	                        failing categories)
+	check-snippet           Check a snippet given with --code (or on stdin), before
+	                        pasting it into the documentation
+	gc                      Remove the shared target dirs and result caches unused for
+	                        more than --max-age days (e.g. of the projects not checked
+	                        anymore)
 
 OPTIONS:
 	-f, --files FILES       Comma-separated list of files to check
-	-o, --output FORMAT     Output format: 'human' (default) or 'json'
+	-o, --output FORMAT     Output format: 'human' (default), 'json', 'jsonl', 'sarif',
+	                        'github', 'markdown' or 'porcelain'
+	--porcelain             Print a single line with the counts (same as '-o porcelain')
+	--lang LANG             Language of the reports: 'en' (default), 'fr', or a TOML file
+	                        of messages (e.g. de.toml)
 	-q, --quiet             Quiet mode: minimal output
 	-v, --verbose           Verbose mode (default)
 	--quick                 Quick mode: exit on first compilation error
 	--exit-on-error         Exit immediately on first error
 	--color                 Force colored output
 	--no-color              Disable colored output
-	--version               Show version
+	--keep-temp             Keep temporary directory after execution
+	--suggestions           Show suggestions for fixing common errors
+	--config FILE           Configuration file (default: .doc-checker.toml at the project root)
+	--print-config          Print the effective configuration, with the source of each value
+	                        (TOML, or JSON with '-o json'), without checking
+	--no-cache              Check all the snippets, even the ones which are unchanged
+	                        since they were checked (successfully or not)
+	--no-syntax-precheck    Compile the snippets with blatant syntax errors (e.g. an unclosed
+	                        delimiter) too, instead of reporting them before compiling
+	--work-key NAME         Reuse the generated project and target dir across runs (the
+	                        default target dir being NAME-HASH-KEY, one per key)
+	--target-dir DIR        Cargo target dir shared by the runs, so the dependencies are
+	                        compiled incrementally (default: the one of the project in
+	                        the user cache dir, e.g. ~/.cache/doc-checker/target/NAME-HASH)
+	--max-age DAYS          Remove the shared target dirs and result caches unused for
+	                        more than DAYS days (gc, default: 30)
+	--diff-project          Print the diff of the generated project (Cargo.toml, Cargo.lock
+	                        and snippets) since the previous run, with --work-key or --hermetic
+	--hermetic              Only use the declared paths below, without network access
+	                        (e.g. as a Bazel/Buck build action)
+	--cargo-home DIR        Cargo home directory (hermetic mode)
+	--registry DIR          Vendored dependencies, from 'cargo vendor' (hermetic mode)
+	--toolchain DIR         Rust toolchain, with bin/cargo and bin/rustc (hermetic mode)
+	--out-dir DIR           Generated project and target dir (hermetic mode)
+	--snippet-names SCHEME  Naming of generated snippet files: 'path' (default) or 'hash'
+	--community             Also check CONTRIBUTING.md and the .github/ templates
+	--rustdoc               Also check the examples of the doc comments (/// and //!)
+	                        of the crate sources (src/**/*.rs)
+	--warnings-as-errors    Fail when there are warnings (e.g. untagged Rust code blocks)
+	--max-line-width N      Warn about the code lines of the snippets wider than N characters
+	                        (e.g. 100, as they render poorly on crates.io and docs.rs)
+	--stats                 Append the usage stats of the run (duration, counts, cache hits)
+	                        to a local file, for 'doc-checker stats' (never sent anywhere)
+	--parity                Report items with examples only in markdown or only in rustdoc
+	--coverage              Count the compiled snippets using each public type (from the
+	                        rustdoc JSON), failing on the gaps of the [coverage] policy
+	--rustdoc-json FILES    Comma-separated rustdoc JSON of the documented crates, for
+	                        --coverage (implied), instead of generating it with nightly
+	--badge-file FILE       Write a shields.io endpoint badge (valid/total snippets) to FILE
+	--report-dir DIR        Write one result file per markdown file, with the sources
+	                        of its failing snippets, to DIR (e.g. for CI artifacts)
+	--max-error-bytes N     Truncate the reported error messages to N bytes (default: 500,
+	                        0 for no truncation)
+	--error-log-dir DIR     Write the full compiler output of each failing snippet to DIR
+	--artifacts-dir DIR     Write the stdout, stderr and exit code of each snippet run
+	                        (--run, --check-output) to DIR, as SNIPPET.stdout, .stderr
+	                        and .exit files referenced by the results
+	--link-base URL         URL of the rendered markdown summary (-o markdown), so each
+	                        failure has a 'report_link' to its section (URL#failure-ID)
+	--check-output          Run the snippets followed by a text or console block, and fail
+	                        if their output differs from it (shown as a diff)
+	--run                   Run the snippets which compiled (but no_run, no_main and
+	                        compile_fail ones), and fail the ones panicking, or running
+	                        longer than their timeout (their output is in the results)
+	--run-timeout SECONDS   Time a snippet can run with --run, unless it has a timeout=
+	                        attribute (default: 10)
+	--toolchains LIST       Also compile the snippets with these rustup toolchains (e.g.
+	                        stable,beta,nightly), reported as a matrix in the summary
+	--features-matrix SETS  Also compile the snippets with these feature sets of the default
+	                        crate, separated by semicolons (e.g. "default;chrono;uuid,chrono",
+	                        without the default features unless "default" is given)
+	--clippy                Lint the snippets which compiled with clippy (the clippy::all
+	                        lints, with the clippy.toml of the project, if any)
+	--clippy-level LEVEL    Level of the clippy lints: warn (reported as warnings, default)
+	                        or deny (the snippets fail as CLIPPY_LINT)
+	--check-cargo-commands  Run 'cargo SUBCOMMAND --help' for the cargo commands of the shell
+	                        blocks, to report the unknown subcommands and flags (e.g. typos)
+	--at REV                Check the files as they existed at a git revision, against
+	                        the crates at this same revision (in a temporary worktree)
+	--explain-discovery     Explain why each markdown file is checked or not (git-tracked,
+	                        under target/, ignored by .gitignore, ...), without checking
+	--verify-deterministic  Extract the snippets twice, then check them twice without the
+	                        result cache, and report any difference between the two runs
+	--progress-json         Report the progress as JSON lines on stderr (phase, percent,
+	                        current file or snippet), e.g. for the IDE plugins
+	--against-published     Compile the snippets against the published versions of the
+	                        crates (from their Cargo.toml), except the preview ones
+	--indented-blocks       Also check the indented code blocks preceded by a language
+	                        hint comment (e.g. '<!-- lang: rust -->'), for legacy docs
+	--extract-jobs N        Number of markdown files read and parsed at the same time
+	                        (default: 1)
+	--cargo-jobs N          Number of parallel jobs of cargo (default: 0, the cargo
+	                        default, i.e. the number of CPUs)
+	-j, --jobs N            Number of snippets checked at the same time when compiled
+	                        one by one, each in its own target dir (default: 1)
+	--write-batch N         Write the generated snippet files by batches of N (default: 0,
+	                        each file written at once)
+	--select CODES          Only report the failures with one of these comma-separated
+	                        rustc error codes (e.g. 'E0609,E0433')
+	--ignore-codes CODES    Don't report the failures with only these comma-separated
+	                        rustc error codes (e.g. 'E0601')
+	--api-filter PATHS      Only check the snippets referencing these comma-separated
+	                        crate paths (e.g. 'updates::set,filters::eq')
+	--filter IDS            Only check the snippets with these comma-separated identifiers,
+	                        as ID or FILE:ID globs (e.g. 'find_by_name,docs/guide.md:setup_*')
+	--baseline FILE         JSON file of the known failures (by file and snippet identifier),
+	                        reported as excluded rather than failed
+	--update-baseline       Replace the known failures of the --baseline file with the
+	                        failures of the run
+	--shard K/N             Only check the snippets of the K-th of N shards (e.g. '2/4'),
+	                        on parallel CI jobs whose results are combined by 'merge'
+	--query EXPR            Print only the result of a JMESPath expression applied to
+	                        the JSON results (implies '-o json')
+	--version               Show version, with the build commit and date (for bug reports)
+	--check-update          Print a notice on stderr if a newer release is available, in the
+	                        same channel (stable, or pre-release when running one)
 	-h, --help              Show this help message
 
+ENVIRONMENT:
+	DOC_CHECKER_<OPTION>    Each option can be set by an environment variable, named after
+	                        its long name (e.g. DOC_CHECKER_OUTPUT=json, DOC_CHECKER_WORK_KEY=ci,
+	                        DOC_CHECKER_QUICK=true); the flags take precedence
+
+BISECT OPTIONS:
+	--good REV              Revision where the snippet compiles
+	--bad REV               Revision where the snippet fails to compile (default: HEAD)
+	--snippet FILE:LINE     Snippet to bisect, by a line within its fences or by its
+	                        id=NAME attribute (e.g. README.md:120, README.md:find_by_name)
+
+INIT OPTIONS:
+	--ci-workflow FILE      Write the CI workflow to this file (printed otherwise), e.g.
+	                        .github/workflows/doc-checker.yml
+	--force                 Overwrite the existing configuration (or workflow) file
+
+GRAPH OPTIONS:
+	--format FORMAT         Format of the graph: 'dot' (default, for Graphviz) or 'mermaid'
+
+CHECK-SNIPPET OPTIONS:
+	--code CODE             Code of the snippet (read from stdin if not given, or '-')
+	--prelude ITEMS         Comma-separated items of the default crate imported by the
+	                        snippet, instead of the prelude of the crate (e.g. updates)
+
 EXAMPLES:
 	doc-checker                              # Check all .md files under git control
 	doc-checker -f README.md                 # Check only README.md
+	doc-checker --community docs/            # Check docs/, CONTRIBUTING.md and templates
+	doc-checker --parity                     # Compare markdown and rustdoc examples
+	doc-checker --coverage -o json           # Examples of each public type, and the gaps
+	doc-checker --at v0.2.0 README.md        # Check README.md as released in v0.2.0
+	doc-checker bisect --good v0.3.0 --snippet README.md:120
+	doc-checker init --ci-workflow .github/workflows/doc-checker.yml
+	doc-checker warmup --work-key ci         # Compile the dependencies, to be cached
+	doc-checker graph docs/ | dot -Tsvg > snippets.svg
+	doc-checker check-snippet --prelude updates --code 'let u = updates::empty::<User>();'
+	doc-checker --explain-discovery -o json  # Why each markdown file is checked or not
 	doc-checker -o json -q                   # JSON output, quiet mode
 	doc-checker --quick README.md docs/*.md  # Quick check of specific docs
 	doc-checker -o json --exit-on-error      # JSON output, fail fast
+	doc-checker --query summary.failed_snippets
+	doc-checker -o jsonl | tee run.jsonl     # Stream the outcome of each snippet
+	doc-checker -o sarif > doc-checker.sarif # SARIF report for code scanning
+	doc-checker -o github                    # GitHub Actions annotations
+	doc-checker -o markdown >> "$GITHUB_STEP_SUMMARY"
+	doc-checker --api-filter updates::set    # Only the snippets using updates::set
+	doc-checker --shard 2/4 -o json > shard-2.json
+	doc-checker merge -o markdown shard-*.json
+	doc-checker --ignore-codes E0601         # Not failing on a missing main function
+	doc-checker --porcelain                  # total=12 valid=10 failed=2 files=3 ...
+	doc-checker --work-key editor README.md  # Incremental re-check (e.g. from an editor)
 
 EXIT CODES:
 	0   All snippets compiled successfully
-	1   Some snippets failed to compile
+	1   Some snippets failed to compile (or warnings, with --warnings-as-errors)
 	2   Script configuration/setup error
 	3   File not found or access error
 
 `, version)
 }
 
+// categoryDescription describes an error category
+func categoryDescription(category string) string {
+	switch category {
+	case "MISSING_FIELD_WITNESS", "UNKNOWN_FIELD", "SYNTAX_ERROR", "MISSING_TRAIT", "COMPILE_FAIL",
+		categoryOutputMismatch, categoryRunFailed, categoryRunTimeout, categoryMalformedMarkdown, categoryClippyLint:
+		return msg("category." + category)
+	default:
+		return msg("category.COMPILATION_ERROR")
+	}
+}
+
 func printHumanResults(results *Results, verbose bool, showSuggestions bool) {
+	// At the top, so it's seen first in a long CI log
+	if first := results.Summary.FirstFailure; first != nil {
+		logError(msg("summary.first_failure", first.File, first.Line, first.SnippetID, first.Category))
+	}
+
 	if verbose {
 		fmt.Println()
-		logInfo("=== SUMMARY ===")
-		logInfo(fmt.Sprintf("Total Rust snippets found: %d", results.Summary.TotalSnippets))
-		logSuccess(fmt.Sprintf("Valid snippets: %d", results.Summary.ValidSnippets))
+		logInfo(msg("summary.header"))
+		logInfo(msg("summary.total", results.Summary.TotalSnippets))
+		logSuccess(msg("summary.valid", results.Summary.ValidSnippets))
+
+		if results.Summary.WarnedSnippets > 0 {
+			logWarning(msg("summary.warned", results.Summary.WarnedSnippets))
+		}
+
+		if results.Summary.SkippedSnippets > 0 {
+			logInfo(msg("summary.skipped", results.Summary.SkippedSnippets))
+		}
+
+		if results.Summary.IgnoredSnippets > 0 {
+			logInfo(msg("summary.ignored", results.Summary.IgnoredSnippets))
+
+			for _, reason := range sortedCodes(results.Summary.IgnoreReasons) {
+				logInfo(msg("summary.ignore_reason", reason, results.Summary.IgnoreReasons[reason]))
+			}
+		}
+
+		if results.Summary.FilteredSnippets > 0 {
+			logInfo(msg("summary.filtered", results.Summary.FilteredSnippets))
+		}
+
+		if results.Summary.ShardedSnippets > 0 {
+			logInfo(msg("summary.sharded", results.Summary.ShardedSnippets, results.Shard))
+		}
+
+		if results.Summary.ExcludedFailures > 0 {
+			logInfo(msg("summary.excluded", results.Summary.ExcludedFailures))
+		}
+
+		if results.Summary.CacheHits+results.Summary.CacheMisses > 0 {
+			logInfo(msg("summary.cache", results.Summary.CacheHits, results.Summary.CacheMisses))
+		}
+
+		if len(results.Summary.Toolchains) > 0 {
+			logInfo(msg("summary.toolchains"))
+
+			for _, result := range results.Summary.Toolchains {
+				switch {
+				case result.Error != "":
+					logError(msg("summary.matrix_error", result.Toolchain, result.Error))
+				case result.Failed > 0:
+					logError(msg("summary.toolchain", result.Toolchain, result.Passed, result.Checked, result.Rustc))
+				default:
+					logSuccess(msg("summary.toolchain", result.Toolchain, result.Passed, result.Checked, result.Rustc))
+				}
+			}
+		}
+
+		if len(results.Summary.FeatureSets) > 0 {
+			logInfo(msg("summary.feature_sets"))
+
+			for _, result := range results.Summary.FeatureSets {
+				switch {
+				case result.Error != "":
+					logError(msg("summary.matrix_error", result.Features, result.Error))
+				case result.Failed > 0:
+					logError(msg("summary.feature_set", result.Features, result.Passed, result.Checked))
+				default:
+					logSuccess(msg("summary.feature_set", result.Features, result.Passed, result.Checked))
+				}
+			}
+		}
+
+		for _, name := range modeNames {
+			mode, ran := results.Modes[name]
+
+			if !ran {
+				continue
+			}
+
+			key := "summary.mode_passed"
+
+			if !mode.Passed {
+				key = "summary.mode_failed"
+			}
+
+			logInfo(msg(key, name, mode.Summary.Checked, mode.Summary.Findings, mode.Summary.Failed))
+		}
+
+		for file, result := range results.Files {
+			for _, retry := range result.Retries {
+				if retry.Attempts < 2 {
+					continue
+				}
+
+				key := "summary.retry_failed"
+
+				if retry.Passed {
+					key = "summary.retry_passed"
+				}
+
+				logWarning(msg(key, retry.SnippetID, file, retry.Line, retry.Attempts))
+			}
+		}
 	}
 
 	if results.Summary.FailedSnippets > 0 {
-		logError(fmt.Sprintf("Failed snippets: %d", results.Summary.FailedSnippets))
+		logError(msg("summary.failed", results.Summary.FailedSnippets))
 
 		// Show error categories if we have them
 		if len(results.Summary.ErrorsByCategory) > 0 {
 			fmt.Println()
-			logWarning("Error breakdown by category:")
+			logWarning(msg("summary.categories"))
 			for category, count := range results.Summary.ErrorsByCategory {
-				var categoryDesc string
-				switch category {
-				case "MISSING_FIELD_WITNESS":
-					categoryDesc = "Missing field witness modules (need struct definitions with FieldWitnesses derive)"
-				case "UNKNOWN_FIELD":
-					categoryDesc = "References to non-existent fields"
-				case "SYNTAX_ERROR":
-					categoryDesc = "Syntax errors (unclosed delimiters, malformed expressions)"
-				case "MISSING_TRAIT":
-					categoryDesc = "Missing trait implementations (e.g., Deserialize, Serialize)"
-				default:
-					categoryDesc = "General compilation errors"
+				fmt.Printf("  • %s: %d (%s)\n", category, count, categoryDescription(category))
+			}
+
+			if len(results.Summary.ErrorsByCode) > 0 {
+				fmt.Println()
+				logWarning(msg("summary.codes"))
+
+				for _, code := range sortedCodes(results.Summary.ErrorsByCode) {
+					fmt.Printf("  • %s: %d\n", code, results.Summary.ErrorsByCode[code])
 				}
-				fmt.Printf("  • %s: %d (%s)\n", category, count, categoryDesc)
 			}
 
 			// Show suggestions if requested
 			if showSuggestions {
 				fmt.Println()
-				logInfo("💡 Suggestions to fix these errors:")
+				logInfo(msg("summary.suggestions"))
 
-				if results.Summary.ErrorsByCategory["MISSING_FIELD_WITNESS"] > 0 {
-					fmt.Println("  🔧 MISSING_FIELD_WITNESS: Each code snippet should either:")
-					fmt.Println("     • Include the full struct definition with #[derive(FieldWitnesses)] in the same snippet")
-					fmt.Println("     • Or be split into separate documentation sections showing struct definition first")
-					fmt.Println("     • Example: Move struct definitions to the beginning of each code example")
-					fmt.Println()
-				}
+				for _, category := range []string{"MISSING_FIELD_WITNESS", "UNKNOWN_FIELD", "SYNTAX_ERROR", "MISSING_TRAIT"} {
+					if results.Summary.ErrorsByCategory[category] == 0 {
+						continue
+					}
 
-				if results.Summary.ErrorsByCategory["UNKNOWN_FIELD"] > 0 {
-					fmt.Println("  🔧 UNKNOWN_FIELD: Field name mismatches detected:")
-					fmt.Println("     • Check if the field names in the examples match the struct definitions")
-					fmt.Println("     • Ensure consistency between struct fields and update operations")
-					fmt.Println("     • Run 'cargo expand' to see what field modules are generated")
-					fmt.Println()
-				}
+					// A title, then the advices
+					lines := strings.Split(msg("suggestion."+category), "\n")
+					fmt.Printf("  🔧 %s\n", lines[0])
 
-				if results.Summary.ErrorsByCategory["SYNTAX_ERROR"] > 0 {
-					fmt.Println("  🔧 SYNTAX_ERROR: Code formatting issues:")
-					fmt.Println("     • Check for unclosed braces, parentheses, or brackets")
-					fmt.Println("     • Ensure proper indentation and line endings")
-					fmt.Println("     • Test code snippets in a Rust playground first")
-					fmt.Println()
-				}
+					for _, line := range lines[1:] {
+						fmt.Printf("     %s\n", line)
+					}
 
-				if results.Summary.ErrorsByCategory["MISSING_TRAIT"] > 0 {
-					fmt.Println("  🔧 MISSING_TRAIT: Add required derive macros:")
-					fmt.Println("     • Add #[derive(Deserialize, Serialize)] to structs used with MongoDB")
-					fmt.Println("     • Include #[derive(Debug, Clone)] for better usability")
-					fmt.Println("     • Consider adding #[derive(Default)] for struct initialization")
 					fmt.Println()
 				}
 			}
 		}
 
 		fmt.Println()
-		logError("Some documentation snippets failed to compile!")
-		logError("Please update the failing snippets to match the current API.")
+		logError(msg("summary.some_failed"))
+		logError(msg("summary.update"))
 
-		fmt.Println("\nDetailed results:")
+		fmt.Println("\n" + msg("summary.details"))
 
 		for file, result := range results.Files {
 			if result.SnippetsFailed > 0 {
-				fmt.Printf("  %s: %d failed out of %d snippets\n",
-					file, result.SnippetsFailed, result.SnippetsFound)
+				fmt.Printf("  %s\n", msg("summary.file_failed", file, result.SnippetsFailed, result.SnippetsFound))
 				for _, err := range result.Errors {
 					// Print first few lines of each error
 					lines := strings.Split(err, "\n")
 					maxLines := 5
 					if len(lines) > maxLines {
 						lines = lines[:maxLines]
-						lines = append(lines, "    ... (error truncated)")
+						lines = append(lines, "    "+msg("summary.truncated"))
 					}
 					for _, line := range lines {
+						if strings.Contains(lines[0], "("+categoryOutputMismatch+")") {
+							line = colorDiff(line)
+						}
+
 						fmt.Printf("    %s\n", line)
 					}
 					fmt.Println()
 				}
+
+				for _, failure := range result.Failures {
+					fmt.Printf("    %s\n", msg("summary.fingerprint", failure.Fingerprint, failure.Snippet, failure.Category))
+
+					if failure.Link != "" {
+						fmt.Printf("      %s\n", msg("summary.link", failure.Link))
+					}
+
+					if failure.ReportLink != "" {
+						fmt.Printf("      %s\n", msg("summary.report_link", failure.ReportLink))
+					}
+
+					for _, suggestion := range failure.Suggestions {
+						fmt.Printf("      %s\n", msg("summary.fix",
+							suggestion.Message, suggestion.Replacement, suggestion.Line, suggestion.Column))
+					}
+				}
+
+				if len(result.Failures) > 0 {
+					fmt.Println()
+				}
 			}
 		}
 	} else {
 		if verbose {
-			logSuccess("All documentation snippets are valid! 🎉")
+			logSuccess(msg("summary.all_valid"))
+		}
+	}
+
+	if len(results.Warnings) > 0 {
+		printWarnings(results.Warnings, results.Summary.WarningsByCode)
+	}
+
+	if results.Parity != nil {
+		printParityReport(results.Parity)
+	}
+
+	if results.Coverage != nil {
+		printCoverageReport(results.Coverage)
+	}
+
+	if previews := previewExamples(results); len(previews) > 0 {
+		printPreviewExamples(previews)
+	}
+}
+
+func printWarnings(warnings []Warning, byCode map[string]int) {
+	fmt.Println()
+	logInfo(msg("warnings.header"))
+
+	codes := make([]string, 0, len(byCode))
+
+	for code := range byCode {
+		codes = append(codes, code)
+	}
+
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		fmt.Printf("  • %s: %d (%s)\n", code, byCode[code], warningDescription(code))
+	}
+
+	fmt.Println()
+
+	for _, warning := range warnings {
+		location := msg("warnings.project")
+
+		if warning.File != "" {
+			location = fmt.Sprintf("%s:%d", warning.File, warning.Line)
 		}
+
+		fmt.Printf("  %s: %s (%s)\n", location, warning.Message, warning.Code)
+	}
+
+	if errorWarnings(warnings) > 0 {
+		fmt.Println()
+		logError(msg("warnings.as_errors"))
+	}
+}
+
+func printParityReport(report *ParityReport) {
+	fmt.Println()
+	logInfo(msg("parity.header"))
+
+	if len(report.RustdocOnly) == 0 && len(report.MarkdownOnly) == 0 {
+		logSuccess(msg("parity.same"))
+		return
+	}
+
+	if len(report.RustdocOnly) > 0 {
+		logWarning(msg("parity.rustdoc_only", len(report.RustdocOnly)))
+
+		for _, item := range report.RustdocOnly {
+			fmt.Printf("  • %s (%s, %s:%d)\n", item.Path, item.Kind, item.File, item.Line)
+		}
+	}
+
+	if len(report.MarkdownOnly) > 0 {
+		logWarning(msg("parity.markdown_only", len(report.MarkdownOnly)))
+
+		for _, item := range report.MarkdownOnly {
+			fmt.Printf("  • %s (%s, %s:%d)\n", item.Path, item.Kind, item.File, item.Line)
+		}
+	}
+}
+
+func printCoverageReport(report *CoverageReport) {
+	fmt.Println()
+	logInfo(msg("coverage.header"))
+
+	covered := 0
+
+	for _, typ := range report.Types {
+		if typ.Examples > 0 {
+			covered++
+		}
+	}
+
+	logInfo(msg("coverage.summary", covered, len(report.Types)))
+
+	if len(report.Gaps) == 0 {
+		return
+	}
+
+	logWarning(msg("coverage.gaps", len(report.Gaps)))
+
+	for _, typ := range report.Gaps {
+		fmt.Printf("  • %s (%s, %d/%d, %s:%d)\n", typ.Path, typ.Kind, typ.Examples, typ.Required, typ.File, typ.Line)
 	}
 }
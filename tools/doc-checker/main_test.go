@@ -1,10 +1,27 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestExtractRustSnippets(t *testing.T) {
@@ -71,7 +88,7 @@ func TestExtractRustSnippets(t *testing.T) {
 			}
 			tmpfile.Close()
 
-			snippets, err := checker.extractRustSnippetsWithIDs(tc.content)
+			snippets, err := checker.extractRustSnippetsWithIDs("README.md", tc.content)
 			if err != nil {
 				t.Fatalf("extractRustSnippetsWithIDs failed: %v", err)
 			}
@@ -96,7 +113,7 @@ This should be compiled:
 }
 ` + "```"
 
-	snippets, err := checker.extractRustSnippetsWithIDs(content)
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
 	if err != nil {
 		t.Fatalf("extractRustSnippetsWithIDs failed: %v", err)
 	}
@@ -125,6 +142,34 @@ This should be compiled:
 	}
 }
 
+func TestSkipRegions(t *testing.T) {
+	checker := NewDocChecker(&Config{})
+
+	content := "```rust\nfn checked() {}\n```\n" +
+		"<!-- doc-checker:off -->\n" +
+		"```rust\nfn archived() {}\n```\n" +
+		"```rust\nfn appendix() {}\n```\n" +
+		"<!-- doc-checker:on -->\n" +
+		"```rust\nfn checked_again() {}\n```\n"
+
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+	if err != nil {
+		t.Fatalf("extractRustSnippetsWithIDs failed: %v", err)
+	}
+
+	if len(snippets) != 4 {
+		t.Fatalf("expected 4 snippets, got %d", len(snippets))
+	}
+
+	expected := []bool{false, true, true, false}
+
+	for i, snippet := range snippets {
+		if snippet.Skipped != expected[i] {
+			t.Errorf("snippet %d: expected skipped=%v, got %v", i+1, expected[i], snippet.Skipped)
+		}
+	}
+}
+
 func TestDiscoverFiles(t *testing.T) {
 	// Create a temporary directory structure
 	tmpDir, err := ioutil.TempDir("", "test-discover")
@@ -170,16 +215,5857 @@ func TestDiscoverFiles(t *testing.T) {
 	}
 }
 
-func containsString(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr ||
-		(len(s) > len(substr) && contains(s, substr)))
+func TestFailureFingerprint(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-fingerprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snippetFile := filepath.Join(tmpDir, "README-10.rs")
+	if err := ioutil.WriteFile(snippetFile, []byte("fn main() {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewDocChecker(&Config{ProjectRoot: tmpDir})
+	mdFile := filepath.Join(tmpDir, "README.md")
+
+	fp := checker.failureFingerprint(mdFile, snippetFile, "SYNTAX_ERROR", nil)
+
+	if len(fp) != 16 {
+		t.Errorf("expected 16 chars fingerprint, got '%s'", fp)
+	}
+
+	if again := checker.failureFingerprint(mdFile, snippetFile, "SYNTAX_ERROR", nil); again != fp {
+		t.Errorf("fingerprint is not stable: '%s' != '%s'", fp, again)
+	}
+
+	if other := checker.failureFingerprint(mdFile, snippetFile, "UNKNOWN_FIELD", nil); other == fp {
+		t.Error("fingerprint should depend on the error category, without error codes")
+	}
+
+	// The error codes of the compiler, rather than the category
+	mismatched := checker.failureFingerprint(mdFile, snippetFile, "COMPILATION_ERROR", []string{"E0308"})
+
+	if unresolved := checker.failureFingerprint(mdFile, snippetFile, "COMPILATION_ERROR", []string{"E0425"}); unresolved == mismatched {
+		t.Error("fingerprint should depend on the error codes")
+	}
+
+	if recategorized := checker.failureFingerprint(mdFile, snippetFile, "UNKNOWN_FIELD", []string{"E0308"}); recategorized != mismatched {
+		t.Errorf("fingerprint should not depend on the category with error codes: '%s' != '%s'", recategorized, mismatched)
+	}
+
+	both := checker.failureFingerprint(mdFile, snippetFile, "COMPILATION_ERROR", []string{"E0425", "E0308"})
+
+	if reordered := checker.failureFingerprint(mdFile, snippetFile, "COMPILATION_ERROR", []string{"E0308", "E0425"}); reordered != both || both == mismatched {
+		t.Errorf("fingerprint should depend on the sorted error codes: '%s', '%s'", both, reordered)
+	}
 }
 
-func contains(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
+func TestSnippetProvenance(t *testing.T) {
+	checker := NewDocChecker(&Config{})
+
+	content := "# Guide\n\n" + "```rust\n" + `let a = 1;
+let b = 2;
+` + "```\n"
+
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+	if err != nil {
+		t.Fatalf("extractRustSnippetsWithIDs failed: %v", err)
+	}
+
+	if len(snippets) != 1 {
+		t.Fatalf("expected 1 snippet, got %d", len(snippets))
+	}
+
+	header := provenanceHeader("docs/guide.md", snippets[0])
+	expected := "// source: docs/guide.md:3-6, id=auto_1\n"
+
+	if header != expected {
+		t.Errorf("expected header '%s', got '%s'", expected, header)
+	}
+
+	h, code := splitProvenance(header + snippets[0].Content)
+
+	if h != header || code != snippets[0].Content {
+		t.Errorf("failed to split provenance: '%s' / '%s'", h, code)
+	}
+}
+
+func TestParseCargoDiagnostics(t *testing.T) {
+	output := `{"reason":"compiler-artifact","target":{"name":"serde"}}
+{"reason":"compiler-message","target":{"name":"README-12"},"message":{"level":"error","message":"cannot find value` + "`usr`" + `","rendered":"error[E0425]: cannot find value usr\n","spans":[],"children":[{"level":"help","message":"a local variable with a similar name exists","spans":[{"file_name":"src/bin/README-12.rs","line_start":8,"line_end":8,"column_start":13,"column_end":16,"is_primary":true,"suggested_replacement":"user","suggestion_applicability":"MachineApplicable"}],"children":[]}]}}
+error: could not compile ` + "`doc_snippet_test`" + ` due to 1 previous error
+`
+
+	diagnostics := parseCargoDiagnostics([]byte(output))
+
+	if len(diagnostics.Diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d", len(diagnostics.Diagnostics))
+	}
+
+	if rendered := diagnostics.Rendered(); rendered != "error[E0425]: cannot find value usr\n" {
+		t.Errorf("unexpected rendered errors: '%s'", rendered)
+	}
+
+	suggestions := diagnostics.Suggestions()
+
+	if len(suggestions) != 1 {
+		t.Fatalf("expected 1 suggestion, got %d", len(suggestions))
+	}
+
+	if suggestions[0].Replacement != "user" || suggestions[0].Line != 8 || suggestions[0].Column != 13 {
+		t.Errorf("unexpected suggestion: %+v", suggestions[0])
+	}
+
+	diagnostics.Failed = true
+
+	if diagnostics.failedBeforeCompiling("README-12") {
+		t.Error("Expected an error of the compiler for the snippet")
+	}
+
+	// e.g. a dependency which could not be resolved
+	unresolved := parseCargoDiagnostics([]byte("error: no matching package named `bson` found\n"))
+	unresolved.Failed = true
+
+	if !unresolved.failedBeforeCompiling("README-12") || unresolved.failedInSnippet("README-12") {
+		t.Error("Expected a failure of cargo, before compiling the snippet")
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	output := `{"reason":"compiler-message","target":{"name":"README-12"},"message":{"level":"error","code":{"code":"E0425"},"message":"cannot find value","rendered":"","spans":[],"children":[]}}
+{"reason":"compiler-message","target":{"name":"README-12"},"message":{"level":"warning","code":{"code":"unused_imports"},"message":"unused import","rendered":"","spans":[],"children":[]}}
+{"reason":"compiler-message","target":{"name":"README-12"},"message":{"level":"error","code":{"code":"E0433"},"message":"failed to resolve","rendered":"","spans":[],"children":[]}}
+{"reason":"compiler-message","target":{"name":"README-12"},"message":{"level":"error","code":{"code":"E0425"},"message":"cannot find value","rendered":"","spans":[],"children":[]}}
+{"reason":"compiler-message","target":{"name":"README-12"},"message":{"level":"error","code":null,"message":"aborting","rendered":"","spans":[],"children":[]}}
+`
+
+	if codes := parseCargoDiagnostics([]byte(output)).ErrorCodes(); strings.Join(codes, ",") != "E0425,E0433" {
+		t.Errorf("Unexpected error codes: %v", codes)
+	}
+
+	if _, err := parseErrorCodes("select", "E0609, not a code"); err == nil {
+		t.Error("Expected an invalid error code to be rejected")
+	}
+
+	selectCodes, _ := parseErrorCodes("select", "E0609, E0433")
+	ignoreCodes, _ := parseErrorCodes("ignore-codes", "E0601")
+
+	for _, test := range []struct {
+		selectCodes, ignoreCodes []string
+		codes                    []string
+		excluded                 bool
+	}{
+		{nil, nil, []string{"E0601"}, false},
+		{selectCodes, nil, []string{"E0425", "E0433"}, false},
+		{selectCodes, nil, []string{"E0425"}, true},
+		{selectCodes, nil, nil, true},
+		{nil, ignoreCodes, []string{"E0601"}, true},
+		{nil, ignoreCodes, []string{"E0601", "E0425"}, false},
+		{nil, ignoreCodes, nil, false},
+	} {
+		checker := NewDocChecker(&Config{SelectCodes: test.selectCodes, IgnoreCodes: test.ignoreCodes})
+
+		if excluded := checker.excludedByCodes(test.codes, nil); excluded != test.excluded {
+			t.Errorf("Codes %v with --select %v and --ignore-codes %v: expected excluded=%v", test.codes, test.selectCodes, test.ignoreCodes, test.excluded)
 		}
 	}
-	return false
+
+	if codes := sortedCodes(map[string]int{"E0609": 1, "E0433": 3, "E0425": 1}); strings.Join(codes, ",") != "E0433,E0425,E0609" {
+		t.Errorf("Unexpected order of the codes: %v", codes)
+	}
+}
+
+func TestSnippetBaseName(t *testing.T) {
+	root := filepath.Join(os.TempDir(), "project")
+
+	for _, scheme := range []string{"path", "hash"} {
+		checker := NewDocChecker(&Config{ProjectRoot: root, SnippetNames: scheme})
+
+		a := checker.snippetBaseName(filepath.Join(root, "docs", "a", "intro.md"))
+		b := checker.snippetBaseName(filepath.Join(root, "docs", "b", "intro.md"))
+
+		if a == b {
+			t.Errorf("%s scheme: names collide for files with the same base name: %s", scheme, a)
+		}
+
+		if checker.snippetBaseName(filepath.Join(root, "docs", "a", "intro.md")) != a {
+			t.Errorf("%s scheme: name is not stable", scheme)
+		}
+	}
+
+	checker := NewDocChecker(&Config{ProjectRoot: root, SnippetNames: "path"})
+
+	if name := checker.snippetBaseName(filepath.Join(root, "docs", "user", "intro.md")); name != "docs_user_intro" {
+		t.Errorf("unexpected name: %s", name)
+	}
+
+	// Suffixed with a hash of the path when characters are replaced (or the extension removed)
+	if name := checker.snippetBaseName(filepath.Join(root, "docs", "user-guide", "01-intro.md")); !strings.HasPrefix(name, "docs_user_guide_01_intro_") || len(name) != len("docs_user_guide_01_intro_")+8 {
+		t.Errorf("unexpected name: %s", name)
+	}
+
+	names := make(map[string]string)
+
+	for _, path := range []string{"docs/a-b.md", "docs/a_b.md", "docs/a/b.md", "docs/a.b.md", "docs/a b.md", "docs/ab.md", "docs/ab.markdown", "docs/AB.md"} {
+		name := checker.snippetBaseName(filepath.Join(root, filepath.FromSlash(path)))
+
+		if other, exists := names[name]; exists {
+			t.Errorf("names collide for %s and %s: %s", other, path, name)
+		}
+
+		names[name] = path
+	}
+}
+
+func TestWriteGitHubAnnotations(t *testing.T) {
+	root := filepath.Join(os.TempDir(), "project")
+	results := &Results{
+		Files: map[string]FileResult{
+			filepath.Join(root, "docs", "guide.md"): {
+				Failures: []Failure{{
+					Snippet:  "docs_guide-12",
+					Line:     12,
+					EndLine:  15,
+					Category: "SYNTAX_ERROR",
+					Message:  "error: unclosed delimiter\n100% broken",
+				}, {
+					Snippet:     "docs_guide-30",
+					Line:        30,
+					Category:    "COMPILATION_ERROR",
+					Message:     "error[E0308]: mismatched types",
+					Fingerprint: "3f2a9c1d0e4b5a6f",
+				}},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+
+	writeGitHubAnnotations(&out, results, root)
+
+	expected := "::error file=docs/guide.md,line=12,endLine=15," +
+		"title=Documentation snippet docs_guide-12 (SYNTAX_ERROR)" +
+		"::error: unclosed delimiter%0A100%25 broken\n" +
+		"::error file=docs/guide.md,line=30," +
+		"title=Documentation snippet docs_guide-30 (COMPILATION_ERROR%2C fingerprint 3f2a9c1d0e4b5a6f)" +
+		"::error[E0308]: mismatched types\n"
+
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	root := filepath.Join(os.TempDir(), "project")
+	results := &Results{
+		Files: map[string]FileResult{
+			filepath.Join(root, "docs", "guide.md"): {
+				Failures: []Failure{
+					{Line: 12, EndLine: 15, Category: "SYNTAX_ERROR", Message: "unclosed delimiter", Fingerprint: "abc"},
+					{Line: 0, Category: "COMPILATION_ERROR", Message: "not located"},
+				},
+			},
+			filepath.Join(root, "README.md"): {
+				Failures: []Failure{{Line: 3, EndLine: 5, Category: "SYNTAX_ERROR", Message: "expected expression"}},
+			},
+		},
+		Warnings: []Warning{
+			{Code: warnUntaggedRust, Level: "warning", File: filepath.Join(root, "README.md"), Line: 20, Message: "untagged"},
+			{Code: warnStaleIgnore, Level: "error", File: filepath.Join(root, "README.md"), Message: "stale"}, // --warnings-as-errors
+			{Code: warnToolchainSkew, Level: "warning", Message: "skew"},
+		},
+	}
+
+	var out bytes.Buffer
+
+	if err := writeSARIF(&out, results, root); err != nil {
+		t.Fatal(err)
+	}
+
+	var log struct {
+		Schema  string `json:"$schema"`
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				RuleIndex int    `json:"ruleIndex"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine int `json:"startLine"`
+							EndLine   int `json:"endLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("Invalid SARIF: %v\n%s", err, out.String())
+	}
+
+	if log.Version != "2.1.0" || log.Schema != "https://json.schemastore.org/sarif-2.1.0.json" || len(log.Runs) != 1 {
+		t.Fatalf("Unexpected SARIF log: %s", out.String())
+	}
+
+	run := log.Runs[0]
+
+	// A rule per category (or warning code), in order of appearance
+	var rules []string
+
+	for _, rule := range run.Tool.Driver.Rules {
+		rules = append(rules, rule.ID)
+	}
+
+	if run.Tool.Driver.Name != "doc-checker" || !reflect.DeepEqual(rules, []string{"SYNTAX_ERROR", "COMPILATION_ERROR", warnUntaggedRust, warnStaleIgnore, warnToolchainSkew}) {
+		t.Errorf("Unexpected rules: %v", rules)
+	}
+
+	// The files in order, then the warnings
+	expected := []struct {
+		ruleID, level, uri string
+		startLine, endLine int
+	}{
+		{"SYNTAX_ERROR", "error", "README.md", 3, 5},
+		{"SYNTAX_ERROR", "error", "docs/guide.md", 12, 15},
+		{"COMPILATION_ERROR", "error", "docs/guide.md", 1, 0},
+		{warnUntaggedRust, "warning", "README.md", 20, 0},
+		{warnStaleIgnore, "error", "README.md", 1, 0},
+		{warnToolchainSkew, "warning", "", 0, 0},
+	}
+
+	if len(run.Results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d:\n%s", len(expected), len(run.Results), out.String())
+	}
+
+	for i, result := range run.Results {
+		if result.RuleID != expected[i].ruleID || result.Level != expected[i].level || rules[result.RuleIndex] != result.RuleID {
+			t.Errorf("Unexpected result %d: %+v", i, result)
+		}
+
+		if expected[i].uri == "" {
+			if len(result.Locations) != 0 {
+				t.Errorf("Expected no location for result %d, got %+v", i, result.Locations)
+			}
+
+			continue
+		}
+
+		if len(result.Locations) != 1 {
+			t.Errorf("Expected a location for result %d, got %+v", i, result.Locations)
+			continue
+		}
+
+		location := result.Locations[0].PhysicalLocation
+
+		if location.ArtifactLocation.URI != expected[i].uri || location.Region.StartLine != expected[i].startLine || location.Region.EndLine != expected[i].endLine {
+			t.Errorf("Unexpected location of result %d: %+v", i, location)
+		}
+	}
+}
+
+func TestDiscoverCommunityFiles(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-community")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, file := range []string{
+		"CONTRIBUTING.md",
+		".github/pull_request_template.md",
+		".github/ISSUE_TEMPLATE/bug_report.md",
+		".github/workflows/ci.yml",
+	} {
+		fullPath := filepath.Join(tmpDir, file)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fullPath, []byte("test content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checker := NewDocChecker(&Config{
+		ProjectRoot: tmpDir,
+		Files:       []string{filepath.Join(tmpDir, "CONTRIBUTING.md")},
+		Community:   true,
+	})
+
+	files, err := checker.discoverFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CONTRIBUTING.md is specified, so must not be included twice
+	if len(files) != 3 {
+		t.Errorf("expected 3 files, got %d: %v", len(files), files)
+	}
+}
+
+func TestParityItemReference(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected string
+	}{
+		{"impl<T> FilterBuilder<T> {", "FilterBuilder"},
+		{"impl<T: Default> Default for UpdateBuilder<T> {", "UpdateBuilder"},
+		{"impl From<PushEachSort> for bson::Bson {", "Bson"},
+	}
+
+	for _, tc := range testCases {
+		if name := implTypeName(tc.line); name != tc.expected {
+			t.Errorf("expected impl type '%s' for '%s', got '%s'", tc.expected, tc.line, name)
+		}
+	}
+
+	method := ParityItem{Kind: "fn", name: "eq", owner: "FilterBuilder"}
+
+	if !method.referencedIn("filter.eq::<user_fields::Name, _>(name)") {
+		t.Error("method call should be detected")
+	}
+
+	if method.referencedIn("let equal = 1;") {
+		t.Error("unrelated code should not be detected")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	results := &Results{
+		Summary: Summary{TotalSnippets: 3, FailedSnippets: 1},
+		Files: map[string]FileResult{
+			"README.md": {SnippetsFound: 2, SnippetsFailed: 1, Failures: []Failure{
+				{Snippet: "README-10", Line: 10, Fingerprint: "aaaa"},
+			}},
+			"docs/guide.md": {SnippetsFound: 1},
+		},
+	}
+
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"summary.failed_snippets", "1"},
+		{`files."README.md".failures[0].line`, "10"},
+		{"files.*.failures[].fingerprint", `["aaaa"]`},
+		{"keys(files)", `["README.md","docs/guide.md"]`},
+		{"values(files)[?snippets_failed > `0`].snippets_found", "[2]"},
+		{"length(values(files) | [?snippets_failed == `0`])", "1"},
+		{"files.*.snippets_found | [-1]", "1"},
+		{"summary.unknown", "null"},
+	}
+
+	for _, test := range tests {
+		query, err := CompileQuery(test.expression)
+
+		if err != nil {
+			t.Errorf("Failed to compile '%s': %v", test.expression, err)
+			continue
+		}
+
+		result, err := query.Apply(results)
+
+		if err != nil {
+			t.Errorf("Failed to apply '%s': %v", test.expression, err)
+			continue
+		}
+
+		actual, _ := json.Marshal(result)
+
+		if string(actual) != test.expected {
+			t.Errorf("Query '%s': expected %s, got %s", test.expression, test.expected, actual)
+		}
+	}
+
+	for _, invalid := range []string{"summary.", "files[", "unknown(files)", "[?a ~ b]"} {
+		if _, err := CompileQuery(invalid); err == nil {
+			t.Errorf("Expected '%s' to be rejected", invalid)
+		}
+	}
+}
+
+func TestLintMarkdown(t *testing.T) {
+	content := `# Title
+
+` + "```" + `
+let x = 1;
+` + "```" + `
+
+` + "```" + `
+$ cargo build
+` + "```" + `
+
+<!-- doc-checker:off -->
+Nothing to skip
+<!-- doc-checker:on -->
+
+<!-- doc-checker:off -->
+` + "```rust" + `
+fn main() {}
+` + "```" + `
+<!-- doc-checker:on -->
+`
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", WarningsAsErrors: true})
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil {
+		t.Fatalf("Failed to extract snippets: %v", err)
+	}
+
+	checker.lintMarkdown("test.md", content, snippets)
+
+	expected := []Warning{
+		{Code: warnUntaggedRust, Level: "error", File: "test.md", Line: 3},
+		{Code: warnStaleIgnore, Level: "error", File: "test.md", Line: 11},
+	}
+
+	if len(checker.results.Warnings) != len(expected) {
+		t.Fatalf("Expected %d warnings, got %v", len(expected), checker.results.Warnings)
+	}
+
+	for i, warning := range checker.results.Warnings {
+		warning.Message = ""
+
+		if warning != expected[i] {
+			t.Errorf("Expected warning %v, got %v", expected[i], warning)
+		}
+	}
+
+	if checker.results.Summary.Warnings != 2 || checker.results.Summary.WarningsByCode[warnStaleIgnore] != 1 {
+		t.Errorf("Unexpected warning counts: %+v", checker.results.Summary)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	if err := NewDocChecker(&Config{ProjectRoot: t.TempDir()}).Warmup(context.Background()); err == nil {
+		t.Error("Expected warmup to require a work key")
+	}
+
+	// A fake cargo, recording its arguments
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho \"$@\" > cargo-args\n"
+
+	if err := ioutil.WriteFile(filepath.Join(bin, "cargo"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", bin)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	root := t.TempDir()
+
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"demo\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root, WorkKey: "warmup"})
+
+	if err := checker.Warmup(context.Background()); err != nil {
+		t.Fatalf("Failed to warm up: %v", err)
+	}
+
+	projectDir := checker.projectDir(0, checker.crates()[0])
+	args, err := ioutil.ReadFile(filepath.Join(projectDir, "cargo-args"))
+
+	if err != nil || strings.TrimSpace(string(args)) != "check --workspace" {
+		t.Errorf("Expected cargo check --workspace, got '%s' (%v)", args, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(projectDir, "src", "bin", warmupSnippet+".rs")); err != nil {
+		t.Errorf("Expected the warmup snippet: %v", err)
+	}
+
+	// Removed by the next run, which reuses the project
+	if err := cleanWorkDir(checker.tempDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(projectDir, "src", "bin", warmupSnippet+".rs")); !os.IsNotExist(err) {
+		t.Errorf("Expected the warmup snippet to be cleaned, got %v", err)
+	}
+}
+
+func TestProjectDiff(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	after := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+
+	expected := `--- a/test_project/Cargo.toml
++++ b/test_project/Cargo.toml
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -11,3 +11,4 @@
+ k
+ l
+ m
++n
+`
+
+	if diff := unifiedDiff("test_project/Cargo.toml", before, after); diff != expected {
+		t.Errorf("Unexpected diff:\n%s", diff)
+	}
+
+	if diff := unifiedDiff("test_project/src/bin/README-1.rs", "", "fn main() {}\n"); diff != "--- /dev/null\n+++ b/test_project/src/bin/README-1.rs\n@@ -0,0 +1,1 @@\n+fn main() {}\n" {
+		t.Errorf("Unexpected diff of an added file:\n%s", diff)
+	}
+
+	if diff := unifiedDiff("test_project/Cargo.toml", before, before); diff != "" {
+		t.Errorf("Expected no diff, got:\n%s", diff)
+	}
+
+	// The previous project is kept before the work directory is cleaned
+	workDir := t.TempDir()
+	binDir := filepath.Join(workDir, "test_project", "src", "bin")
+
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(binDir, "README-1.rs"), []byte("fn main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", DiffProject: true})
+	checker.tempDir = workDir
+
+	if err := checker.reuseWorkDir(workDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if checker.previousProject["test_project/src/bin/README-1.rs"] != "fn main() {}\n" {
+		t.Errorf("Expected the previous snippet, got %v", checker.previousProject)
+	}
+
+	diff, err := checker.projectDiff()
+
+	if err != nil || !strings.Contains(diff, "+++ /dev/null") || !strings.Contains(diff, "-fn main() {}") {
+		t.Errorf("Expected the removed snippet in the diff, got:\n%s (%v)", diff, err)
+	}
+}
+
+func TestCompileFail(t *testing.T) {
+	fence := parseFenceInfo("rust,compile_fail,E0308")
+
+	if !fence.CompileFail || strings.Join(fence.ErrorCodes, ",") != "E0308" {
+		t.Errorf("Unexpected fence: %+v", fence)
+	}
+
+	// A fake cargo, failing (with E0425) for the snippets using FAIL
+	bin := t.TempDir()
+	script := `#!/bin/sh
+bins=""
+while [ $# -gt 0 ]; do
+  [ "$1" = "--bin" ] && bins="$bins src/bin/$2.rs"
+  shift
+done
+[ -z "$bins" ] && bins=$(ls src/bin/*.rs)
+if grep -l FAIL $bins > /dev/null; then
+  printf '%s\n' '{"reason":"compiler-message","message":{"level":"error","code":{"code":"E0425"},"message":"cannot find value","rendered":"error[E0425]: cannot find value\n","spans":[],"children":[]}}'
+  exit 101
+fi
+`
+
+	if err := ioutil.WriteFile(filepath.Join(bin, "cargo"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := "```rust\nfn main() {}\n```\n\n" +
+		"```rust,compile_fail\nlet x = FAIL;\n```\n\n" +
+		"```rust,compile_fail\nlet x = 1;\n```\n\n" +
+		"```rust,compile_fail,E0425\nlet x = FAIL;\n```\n\n" +
+		"```rust,compile_fail,E0308\nlet x = FAIL;\n```\n"
+
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"tnuctipun\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root, NoCache: true})
+	checker.ctx = context.Background()
+	checker.tempDir = t.TempDir()
+
+	if err := checker.processFile(file); err != nil {
+		t.Fatalf("Failed to process: %v", err)
+	}
+
+	if err := checker.compileSnippets(); err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+
+	var statuses []string
+
+	for _, snippet := range checker.results.Files[file].Snippets {
+		statuses = append(statuses, snippet.Status)
+	}
+
+	if strings.Join(statuses, ",") != "valid,valid,failed,valid,failed" {
+		t.Errorf("Unexpected statuses: %v", statuses)
+	}
+
+	snippets := checker.results.Files[file].Snippets
+
+	if failure := snippets[2].Failure; failure == nil || failure.Category != "COMPILE_FAIL" || !strings.Contains(failure.Message, "compiled") {
+		t.Errorf("Expected the compile_fail snippet which compiled to fail, got %+v", failure)
+	}
+
+	if failure := snippets[4].Failure; failure == nil || !strings.Contains(failure.Message, "Expected error E0308 (compile_fail), got E0425") {
+		t.Errorf("Expected the compile_fail snippet with another error to fail, got %+v", failure)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	// A fake cargo, failing for the snippets using FAIL, and recording the target dir of each check
+	bin := t.TempDir()
+	script := `#!/bin/sh
+bins=""
+while [ $# -gt 0 ]; do
+  [ "$1" = "--bin" ] && bins="$bins src/bin/$2.rs" && echo "$2 ${CARGO_TARGET_DIR:-default}" >> checks
+  shift
+done
+[ -z "$bins" ] && bins=$(ls src/bin/*.rs)
+sleep 0.1
+if grep -l FAIL $bins > /dev/null; then
+  exit 101
+fi
+`
+
+	if err := ioutil.WriteFile(filepath.Join(bin, "cargo"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := ""
+
+	for i := 0; i < 6; i++ {
+		code := "let x = 1;"
+
+		if i%3 == 1 {
+			code = "let x = FAIL;"
+		}
+
+		content += fmt.Sprintf("```rust\n%s\n```\n\n", code)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"tnuctipun\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root, NoCache: true, NoSyntaxPrecheck: true, Jobs: 3})
+	checker.ctx = context.Background()
+	checker.tempDir = t.TempDir()
+
+	if err := checker.processFile(file); err != nil {
+		t.Fatalf("Failed to process: %v", err)
+	}
+
+	if err := checker.compileSnippets(); err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+
+	var statuses []string
+
+	for _, snippet := range checker.results.Files[file].Snippets {
+		statuses = append(statuses, snippet.Status)
+	}
+
+	// Reported in order
+	if strings.Join(statuses, ",") != "valid,failed,valid,valid,failed,valid" {
+		t.Errorf("Unexpected statuses: %v", statuses)
+	}
+
+	projectDir := checker.projectDir(0, checker.crates()[0])
+	checks, err := ioutil.ReadFile(filepath.Join(projectDir, "checks"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	targets := make(map[string]bool)
+
+	for _, line := range strings.Split(strings.TrimSpace(string(checks)), "\n") {
+		targets[strings.TrimPrefix(line[strings.Index(line, " ")+1:], projectDir+string(filepath.Separator))] = true
+	}
+
+	// Each worker in its own target dir
+	if len(strings.Split(strings.TrimSpace(string(checks)), "\n")) != 6 ||
+		!reflect.DeepEqual(targets, map[string]bool{"default": true, filepath.Join("target", "jobs", "1"): true, filepath.Join("target", "jobs", "2"): true}) {
+		t.Errorf("Unexpected checks: %s", checks)
+	}
+}
+
+func TestCheckUpdate(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		less bool
+	}{
+		{"1.0.0", "1.0.1", true},
+		{"1.2.0", "1.10.0", true},
+		{"1.1.0-rc.1", "1.1.0", true},
+		{"1.1.0-rc.1", "1.1.0-rc.2", true},
+		{"1.1.0", "1.1.0-rc.1", false},
+		{"2.0.0", "1.9.9", false},
+		{"1.0.0", "1.0.0+build", false},
+	} {
+		a, okA := parseSemver(tc.a)
+		b, okB := parseSemver(tc.b)
+
+		if !okA || !okB {
+			t.Fatalf("Failed to parse %s or %s", tc.a, tc.b)
+		}
+
+		if got := a.less(b); got != tc.less {
+			t.Errorf("Expected %s < %s to be %v", tc.a, tc.b, tc.less)
+		}
+	}
+
+	for _, invalid := range []string{"1.0", "v1.0.0", "1.x.0", ""} {
+		if _, ok := parseSemver(invalid); ok {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+
+	tags := []string{
+		"v0.2.0", // Tag of the crates, not of doc-checker
+		"tools/doc-checker/v1.0.0",
+		"tools/doc-checker/v1.1.0",
+		"tools/doc-checker/v1.2.0-rc.1",
+		"tools/doc-checker/vnext",
+	}
+
+	stable, _ := parseSemver("1.0.0")
+	prerelease, _ := parseSemver("1.1.0-rc.1")
+
+	if latest, ok := latestRelease(tags, stable); !ok || latest != "1.1.0" {
+		t.Errorf("Expected the latest stable release 1.1.0, got %q", latest)
+	}
+
+	if latest, ok := latestRelease(tags, prerelease); !ok || latest != "1.2.0-rc.1" {
+		t.Errorf("Expected the latest pre-release 1.2.0-rc.1, got %q", latest)
+	}
+
+	if _, ok := latestRelease([]string{"v0.2.0"}, stable); ok {
+		t.Error("Expected no release of doc-checker")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message":"API rate limit exceeded"}`)
+			return
+		}
+
+		fmt.Fprint(w, `[{"name":"tools/doc-checker/v1.0.0"},{"name":"tools/doc-checker/v`+version+`"},{"name":"tools/doc-checker/v99.0.0"}]`)
+	}))
+	defer server.Close()
+
+	defer func(url string) { tagsURL = url }(tagsURL)
+	tagsURL = server.URL
+
+	t.Setenv("GITHUB_TOKEN", "")
+
+	if _, _, err := checkUpdate(context.Background(), server.Client()); err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Errorf("Expected the API error, got %v", err)
+	}
+
+	t.Setenv("GITHUB_TOKEN", "secret")
+
+	latest, newer, err := checkUpdate(context.Background(), server.Client())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if latest != "99.0.0" || !newer {
+		t.Errorf("Expected the newer release 99.0.0, got %q (newer: %v)", latest, newer)
+	}
+
+	if v := versionString(); !strings.HasPrefix(v, version+" (") || !strings.Contains(v, runtime.GOOS+"/"+runtime.GOARCH) {
+		t.Errorf("Unexpected version string: %s", v)
+	}
+}
+
+func TestResultsByMode(t *testing.T) {
+	results := newResults()
+	results.Summary.ValidSnippets = 3
+	results.Summary.FailedSnippets = 0
+	results.Summary.ExcludedFailures = 1
+	results.Summary.FilesProcessed = 2
+	results.Summary.Warnings = 1
+	results.Summary.WarningsByCode["DEP_DRIFT"] = 1
+
+	results.summarizeModes(&Config{})
+
+	if results.Verdict != verdictPassed || len(results.Modes) != 2 {
+		t.Fatalf("Expected the check and lint modes to pass, got %s: %+v", results.Verdict, results.Modes)
+	}
+
+	check := results.Modes[modeCheck].Summary
+
+	if check.Checked != 3 || check.Failed != 0 || check.Findings != 1 {
+		t.Errorf("Unexpected check summary: %+v", check)
+	}
+
+	if lint := results.Modes[modeLint]; !lint.Passed || lint.Summary.Findings != 1 || lint.Summary.Checked != 2 {
+		t.Errorf("Unexpected lint result: %+v", lint)
+	}
+
+	// The warnings only fail the lint mode
+	results.summarizeModes(&Config{WarningsAsErrors: true})
+
+	if results.Verdict != verdictFailed || !results.Modes[modeCheck].Passed || results.Modes[modeLint].Passed {
+		t.Errorf("Expected only the lint mode to fail, got %s: %+v", results.Verdict, results.Modes)
+	}
+
+	// The parity is only informative
+	results.Summary.Warnings = 0
+	results.Parity = &ParityReport{RustdocOnly: []ParityItem{{}}}
+
+	results.summarizeModes(&Config{WarningsAsErrors: true})
+
+	if parity, ran := results.Modes[modeParity]; !ran || !parity.Passed || parity.Summary.Findings != 1 || results.Verdict != verdictPassed {
+		t.Errorf("Unexpected parity result: %+v (%s)", parity, results.Verdict)
+	}
+
+	results.Summary.FailedSnippets = 1
+	results.summarizeModes(&Config{})
+
+	if results.Verdict != verdictFailed || results.Modes[modeCheck].Passed {
+		t.Errorf("Expected the check mode to fail, got %s: %+v", results.Verdict, results.Modes)
+	}
+
+	// The failure which comes first in the documentation
+	results.Files = map[string]FileResult{
+		"docs/guide.md": {Failures: []Failure{{SnippetID: "auto_1", Line: 12, Category: "SYNTAX_ERROR"}}},
+		"README.md": {Failures: []Failure{
+			{SnippetID: "auto_4", Line: 80, Category: "UNKNOWN_FIELD"},
+			{SnippetID: "auto_2", Line: 30, Category: "COMPILATION_ERROR"},
+		}},
+	}
+
+	results.summarizeModes(&Config{})
+
+	expected := FailurePointer{File: "README.md", Line: 30, SnippetID: "auto_2", Category: "COMPILATION_ERROR"}
+
+	if first := results.Summary.FirstFailure; first == nil || *first != expected {
+		t.Errorf("Unexpected first failure: %+v", first)
+	}
+
+	var markdown bytes.Buffer
+
+	writeMarkdownSummary(&markdown, results, "")
+
+	if !strings.Contains(markdown.String(), "First failure: `README.md:30` (snippet `auto_2`, `COMPILATION_ERROR`)") {
+		t.Errorf("Missing first failure:\n%s", markdown.String())
+	}
+}
+
+func TestFailureAnchors(t *testing.T) {
+	results := newResults()
+	results.Summary.FailedSnippets = 2
+	results.Files["README.md"] = FileResult{Failures: []Failure{
+		{Snippet: "README-10", SnippetID: "auto_1", Line: 10, Category: "SYNTAX_ERROR", Fingerprint: "3f2a9c1d0e4b5a6f"},
+		{Snippet: "README-30", SnippetID: "auto_2", Line: 30, Category: "SYNTAX_ERROR"},
+	}}
+
+	var markdown bytes.Buffer
+
+	writeMarkdownSummary(&markdown, results, "")
+
+	for _, anchor := range []string{`<a id="failure-3f2a9c1d0e4b5a6f"></a>`, `<a id="failure-README-30"></a>`} {
+		if !strings.Contains(markdown.String(), anchor+"\n<details>") {
+			t.Errorf("Missing anchor %s:\n%s", anchor, markdown.String())
+		}
+	}
+}
+
+func TestWriteMarkdownSummary(t *testing.T) {
+	root := filepath.Join(os.TempDir(), "project")
+
+	valid := newResults()
+	valid.Summary = Summary{FilesProcessed: 2, TotalSnippets: 5, ValidSnippets: 4, SkippedSnippets: 1}
+	valid.Files[filepath.Join(root, "README.md")] = FileResult{SnippetsFound: 5, SnippetsValid: 4}
+
+	failed := newResults()
+	failed.Summary = Summary{
+		FilesProcessed: 2, TotalSnippets: 6, ValidSnippets: 3, FailedSnippets: 3,
+		ErrorsByCategory: map[string]int{"UNKNOWN_FIELD": 1, "SYNTAX_ERROR": 2},
+		ErrorsByCode:     map[string]int{"E0609": 1},
+		FirstFailure:     &FailurePointer{File: filepath.Join(root, "README.md"), Line: 12, SnippetID: "auto_1", Category: "SYNTAX_ERROR"},
+	}
+	failed.Files[filepath.Join(root, "docs", "guide.md")] = FileResult{SnippetsFound: 2, SnippetsFailed: 1, Failures: []Failure{
+		{Snippet: "docs_guide-40", Line: 40, Category: "UNKNOWN_FIELD", Message: "error[E0609]: no field `nme`\n", Fingerprint: "0a1b2c3d4e5f6a7b"},
+	}}
+	failed.Files[filepath.Join(root, "README.md")] = FileResult{SnippetsFound: 4, SnippetsFailed: 2, Failures: []Failure{
+		{Snippet: "README-12", Line: 12, Category: "SYNTAX_ERROR", Message: "error: expected expression", Fingerprint: "3f2a9c1d0e4b5a6f"},
+		{Snippet: "README-30", Line: 30, Category: "SYNTAX_ERROR", Message: "error: unclosed delimiter\n```rust\nlet x = (\n```"},
+	}}
+	failed.Files[filepath.Join(root, "docs", "valid.md")] = FileResult{SnippetsFound: 0}
+
+	asErrors := newResults()
+	asErrors.Summary = Summary{FilesProcessed: 1, TotalSnippets: 1, ValidSnippets: 1, Warnings: 2}
+	asErrors.Warnings = []Warning{
+		{Code: warnUntaggedRust, Level: "error", File: filepath.Join(root, "README.md"), Line: 7, Message: "code block looking like Rust"},
+		{Code: warnToolchainSkew, Level: "error", Message: "rustc 1.70 is older than the MSRV"},
+	}
+
+	// Merged from shards, with an error-level warning which isn't the first one
+	mixed := newResults()
+	mixed.Summary = Summary{FilesProcessed: 1, TotalSnippets: 1, ValidSnippets: 1, Warnings: 3}
+	mixed.Warnings = []Warning{
+		{Code: warnStaleIgnore, Level: "warning", File: filepath.Join(root, "docs", "guide.md"), Line: 3, Message: "ignored snippet compiles"},
+		{Code: warnUntaggedRust, Level: "error", File: filepath.Join(root, "README.md"), Line: 7, Message: "code block looking like Rust"},
+		{Code: warnToolchainSkew, Level: "error", Message: "rustc 1.70 is older than the MSRV"},
+	}
+
+	warned := newResults()
+	warned.Summary = Summary{FilesProcessed: 1, TotalSnippets: 1, ValidSnippets: 1, Warnings: 1}
+	warned.Warnings = []Warning{{Code: warnStaleIgnore, Level: "warning", File: filepath.Join(root, "docs", "guide.md"), Line: 3, Message: "ignored snippet compiles"}}
+
+	for _, test := range []struct {
+		name     string
+		results  *Results
+		expected []string // In this order
+		absent   []string
+	}{
+		{
+			name:    "valid",
+			results: valid,
+			expected: []string{
+				"## Documentation snippets\n\n✅ All documentation snippets are valid\n\n",
+				"| Files | Snippets | Valid | Failed | Skipped | Warnings |\n|------:|---------:|------:|-------:|--------:|---------:|\n| 2 | 5 | 4 | 0 | 1 | 0 |\n\n",
+			},
+			absent: []string{"First failure", "| Error category", "| Error code", "###", "<details>"},
+		},
+		{
+			name:    "failed",
+			results: failed,
+			expected: []string{
+				"❌ 3 documentation snippet(s) failed to compile\n\nFirst failure: `README.md:12` (snippet `auto_1`, `SYNTAX_ERROR`)\n\n",
+				"| 2 | 6 | 3 | 3 | 0 | 0 |\n\n",
+				// Top categories first
+				"| `SYNTAX_ERROR` | 2 | " + categoryDescription("SYNTAX_ERROR") + " |\n| `UNKNOWN_FIELD` | 1 | ",
+				"| Error code | Count |\n|------------|------:|\n| `E0609` | 1 |\n\n",
+				// The files with failures, in order, with paths relative to the project root
+				"### `README.md`: 2 failed out of 4 snippets\n\n",
+				"<a id=\"failure-3f2a9c1d0e4b5a6f\"></a>\n<details>\n<summary><code>README.md:12</code> README-12 (SYNTAX_ERROR)</summary>\n\n```text\nerror: expected expression\n```\n\n</details>\n\n",
+				// A longer fence than the backticks of the message
+				"<summary><code>README.md:30</code> README-30 (SYNTAX_ERROR)</summary>\n\n````text\nerror: unclosed delimiter\n```rust\nlet x = (\n```\n````\n\n</details>\n\n",
+				"### `docs/guide.md`: 1 failed out of 2 snippets\n\n",
+				"```text\nerror[E0609]: no field `nme`\n```\n",
+			},
+			absent: []string{"valid.md", "All documentation snippets are valid", "warning(s)"},
+		},
+		{
+			name:    "warnings as errors",
+			results: asErrors,
+			expected: []string{
+				"❌ 2 warning(s), treated as errors\n\n",
+				"### ⚠️ 2 warning(s)\n\n- <code>README.md:7</code> `UNTAGGED_RUST_BLOCK`: code block looking like Rust\n- `TOOLCHAIN_SKEW`: rustc 1.70 is older than the MSRV\n\n",
+			},
+			absent: []string{"All documentation snippets are valid", "failed to compile"},
+		},
+		{
+			name:    "mixed warning levels",
+			results: mixed,
+			expected: []string{
+				"❌ 2 warning(s), treated as errors\n\n",
+				"### ⚠️ 3 warning(s)\n\n",
+			},
+			absent: []string{"All documentation snippets are valid", "failed to compile"},
+		},
+		{
+			name:    "warnings",
+			results: warned,
+			expected: []string{
+				"✅ All documentation snippets are valid\n\n",
+				"### ⚠️ 1 warning(s)\n\n- <code>docs/guide.md:3</code> `STALE_IGNORE`: ignored snippet compiles\n",
+			},
+			absent: []string{"treated as errors"},
+		},
+	} {
+		var markdown bytes.Buffer
+
+		writeMarkdownSummary(&markdown, test.results, root)
+		output := markdown.String()
+		rest := output
+
+		for _, part := range test.expected {
+			idx := strings.Index(rest, part)
+
+			if idx < 0 {
+				t.Errorf("%s: expected (in order) %q, in:\n%s", test.name, part, output)
+				break
+			}
+
+			rest = rest[idx+len(part):]
+		}
+
+		for _, part := range test.absent {
+			if strings.Contains(output, part) {
+				t.Errorf("%s: unexpected %q, in:\n%s", test.name, part, output)
+			}
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	if name, path := aggregateInput("billing=ci/results.json"); name != "billing" || path != "ci/results.json" {
+		t.Errorf("Unexpected input %s=%s", name, path)
+	}
+
+	if name, path := aggregateInput("ci/accounts.json"); name != "accounts" || path != "ci/accounts.json" {
+		t.Errorf("Unexpected input %s=%s", name, path)
+	}
+
+	repository := func(verdict string, valid int, byCategory map[string]int) *Results {
+		results := newResults()
+		results.Verdict = verdict
+		results.Summary.FilesProcessed, results.Summary.ValidSnippets = 2, valid
+		results.Summary.ErrorsByCategory = byCategory
+
+		for _, count := range byCategory {
+			results.Summary.FailedSnippets += count
+		}
+
+		results.Summary.TotalSnippets = valid + results.Summary.FailedSnippets
+
+		return results
+	}
+
+	report, err := aggregateResults(
+		[]string{"tnuctipun", "billing", "accounts"},
+		[]string{"tnuctipun.json", "billing.json", "accounts.json"},
+		[]*Results{
+			repository(verdictPassed, 10, nil),
+			repository(verdictFailed, 5, map[string]int{"UNKNOWN_FIELD": 2, "SYNTAX_ERROR": 1}),
+			repository(verdictFailed, 3, map[string]int{"UNKNOWN_FIELD": 1, "MISSING_TRAIT": 1}),
+		})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := AggregateCounts{Files: 6, Snippets: 23, Valid: 18, Failed: 5}
+
+	if report.Totals != expected || report.Verdict != verdictFailed || len(report.Repositories) != 3 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	if len(report.Shared) != 1 || report.Shared[0].Category != "UNKNOWN_FIELD" || report.Shared[0].Failures != 3 ||
+		fmt.Sprint(report.Shared[0].Repositories) != "[billing accounts]" {
+		t.Errorf("Unexpected shared categories: %+v", report.Shared)
+	}
+
+	var output bytes.Buffer
+
+	writeAggregateReport(&output, report)
+
+	if !strings.Contains(output.String(), "\nTotal            6        23      18       5         0  failed\n") {
+		t.Errorf("Unexpected report:\n%s", output.String())
+	}
+
+	if _, err := aggregateResults([]string{"a", "a"}, []string{"a.json", "ci/a.json"}, []*Results{newResults(), newResults()}); err == nil {
+		t.Error("Expected an error for the same repository given twice")
+	}
+}
+
+func TestInit(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"Cargo.toml":                "[package]\nname = \"widgets\"\nversion = \"1.0.0\"\nedition = \"2018\"\n",
+		"widgets-derive/Cargo.toml": "[package]\nname = \"widgets-derive\"\nedition = \"2021\"\n",
+		"README.md":                 "```rust\nuse widgets::{Widget, Color};\nuse serde::Serialize;\nlet w = Widget::new();\n```\n",
+		"docs/guide.md":             "```rust,retries=2\nuse widgets::{Widget, Color};\nuse widgets::Widget;\nuse serde::Serialize;\n```\n\n```rust,ignore\nuse widgets::{Widget, Color};\n```\n",
+		"docs/derive.md":            "```rust,crate=widgets-derive\nuse widgets_derive::Widget;\n```\n",
+		"widgets-derive/src/lib.rs": "",
+		"docs/nested/unchecked.txt": "",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Not in a git repository, so given as a directory
+	config := &Config{ProjectRoot: root, Files: []string{root}, OutputFormat: "human"}
+	var output bytes.Buffer
+
+	if code := runInit(config, &output); code != 0 {
+		t.Fatalf("Unexpected exit code %d: %s", code, output.String())
+	}
+
+	if !strings.Contains(output.String(), "3 Markdown file(s): root (1), docs/ (2)") || !strings.Contains(output.String(), "doc-checker@latest") {
+		t.Errorf("Unexpected output:\n%s", output.String())
+	}
+
+	generated, err := ioutil.ReadFile(filepath.Join(root, configFileName))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The most frequent imports, without the one importing Widget again
+	for _, expected := range []string{
+		"default_crate = \"widgets\"",
+		"[crates.widgets]\npath = \".\"\n# Edition 2018",
+		"prelude = [\n  \"use serde::Serialize;\",\n  \"use widgets::{Widget, Color};\",\n]",
+		"[crates.widgets-derive]\npath = \"widgets-derive\"\n# Imports added",
+		"# prelude = [\"use widgets_derive::*;\"]",
+		"# Fence attributes: crate (1), ignore (1), retries (1)",
+	} {
+		if !strings.Contains(string(generated), expected) {
+			t.Errorf("Expected %q in:\n%s", expected, generated)
+		}
+	}
+
+	// The generated configuration is valid
+	if err := loadConfigFile(config); err != nil || len(config.Crates) != 2 || len(config.Crates[0].Prelude) != 2 {
+		t.Errorf("Unexpected configuration: %+v (%v)", config.Crates, err)
+	}
+
+	// Not overwritten without --force
+	if code := runInit(config, &output); code != 2 {
+		t.Errorf("Expected the existing configuration to be kept, got exit code %d", code)
+	}
+
+	config.InitForce = true
+	config.CIWorkflow = filepath.Join(".github", "workflows", "doc-checker.yml")
+
+	if code := runInit(config, &output); code != 0 {
+		t.Fatalf("Unexpected exit code %d: %s", code, output.String())
+	}
+
+	if workflow, err := ioutil.ReadFile(filepath.Join(root, config.CIWorkflow)); err != nil || string(workflow) != ciWorkflow() {
+		t.Errorf("Expected the CI workflow to be written (%v)", err)
+	}
+}
+
+func TestImportedNames(t *testing.T) {
+	for line, expected := range map[string]string{
+		"use bson::{doc, Document};":       "doc,Document",
+		"use mongodb::Collection;":         "Collection",
+		"use std::io::{self, Write as W};": "io,W",
+		"use tnuctipun::*;":                "",
+		"use a::{b::{c, d}, e};":           "unsupported",
+	} {
+		names, ok := importedNames(line)
+		got := strings.Join(names, ",")
+
+		if !ok {
+			got = "unsupported"
+		}
+
+		if got != expected {
+			t.Errorf("%s: expected %s, got %s", line, expected, got)
+		}
+	}
+}
+
+func TestRunState(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	config := &Config{ProjectRoot: "/path/to/project", Files: []string{"README.md"}}
+
+	if state, err := loadRunState(config.ProjectRoot); err != nil || state != nil {
+		t.Fatalf("Expected no state before the first run, got %v (%v)", state, err)
+	}
+
+	results := &Results{
+		Summary: Summary{TotalSnippets: 3, ValidSnippets: 2, FailedSnippets: 1},
+		Files: map[string]FileResult{
+			"/path/to/project/README.md": {SnippetsFound: 3, SnippetsFailed: 1},
+		},
+	}
+
+	finishedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := saveRunState(config, results, finishedAt); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	state, err := loadRunState(config.ProjectRoot)
+
+	if err != nil || state == nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+
+	if !state.FinishedAt.Equal(finishedAt) || state.Summary.FailedSnippets != 1 || state.FailedFiles["README.md"] != 1 {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+
+	var output bytes.Buffer
+
+	printRunState(&output, state, finishedAt.Add(90*time.Minute))
+
+	if !contains(output.String(), "Last run: 1 hour ago") || !contains(output.String(), "README.md: 1 failed") {
+		t.Errorf("Unexpected status output:\n%s", output.String())
+	}
+}
+
+func TestValidateHermetic(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for _, dir := range []string{"home", "registry", "toolchain/bin"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newConfig := func() *Config {
+		return &Config{
+			Hermetic:     true,
+			Files:        []string{"README.md"},
+			CargoHome:    filepath.Join(tmpDir, "home"),
+			RegistryDir:  filepath.Join(tmpDir, "registry"),
+			ToolchainDir: filepath.Join(tmpDir, "toolchain"),
+			OutDir:       filepath.Join(tmpDir, "out"),
+		}
+	}
+
+	if err := validateHermetic(newConfig()); err == nil || !contains(err.Error(), "cargo not found") {
+		t.Errorf("Expected missing cargo to be rejected, got %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "toolchain", "bin", "cargo"), []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validateHermetic(newConfig()); err != nil {
+		t.Errorf("Expected valid hermetic config, got %v", err)
+	}
+
+	config := newConfig()
+	config.Files = nil
+
+	if err := validateHermetic(config); err == nil {
+		t.Error("Expected the files to be required in hermetic mode")
+	}
+
+	config = newConfig()
+	config.TargetDir = filepath.Join(tmpDir, "target")
+
+	if err := validateHermetic(config); err == nil || !contains(err.Error(), "--out-dir") {
+		t.Errorf("Expected --target-dir to be rejected in hermetic mode, got %v", err)
+	}
+
+	config = newConfig()
+	config.CheckUpdate = true
+
+	if err := validateHermetic(config); err == nil || !contains(err.Error(), "--check-update") {
+		t.Errorf("Expected --check-update to be rejected in hermetic mode, got %v", err)
+	}
+
+	config = newConfig()
+	config.RegistryDir = ""
+
+	if err := validateHermetic(config); err == nil || !contains(err.Error(), "--registry") {
+		t.Errorf("Expected missing --registry to be rejected, got %v", err)
+	}
+}
+
+func TestParseFenceInfo(t *testing.T) {
+	tests := []struct {
+		info    string
+		rust    bool
+		ignore  bool
+		retries int
+	}{
+		{"rust", true, false, 0},
+		{"rs:ignore", true, true, 0},
+		{"rust,ignore", true, true, 0},
+		{" rust,retries=3", true, false, 3},
+		{"rust retries=2", true, false, 2},
+		{"toml", false, false, 0},
+		{"", false, false, 0},
+	}
+
+	for _, test := range tests {
+		fence := parseFenceInfo(test.info)
+		retries, err := fence.retries()
+
+		if err != nil {
+			t.Errorf("Unexpected error for '%s': %v", test.info, err)
+		}
+
+		if fence.isRust(nil) != test.rust || fence.Ignore != test.ignore || retries != test.retries {
+			t.Errorf("Info '%s': expected rust=%v, ignore=%v, retries=%d, got %+v",
+				test.info, test.rust, test.ignore, test.retries, fence)
+		}
+	}
+
+	if _, err := parseFenceInfo("rust,retries=many").retries(); err == nil {
+		t.Error("Expected invalid retries to be rejected")
+	}
+
+	checker := &DocChecker{}
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", "```rust,retries=2\nfn main() {}\n```\n")
+
+	if err != nil || len(snippets) != 1 || snippets[0].Retries != 2 {
+		t.Errorf("Expected a snippet with 2 retries, got %+v (%v)", snippets, err)
+	}
+}
+
+func TestEnvAttribute(t *testing.T) {
+	for info, expected := range map[string]string{
+		"rust": "[]",
+		`rust,env="MONGODB_URI=mongodb://localhost"`:   "[MONGODB_URI=mongodb://localhost]",
+		`rust,env="MONGODB_URI=mongodb://a,b,DB=test"`: "[MONGODB_URI=mongodb://a,b DB=test]",
+		`rust,env="EMPTY=",no_run`:                     "[EMPTY=]",
+	} {
+		env, err := parseFenceInfo(info).env()
+
+		if err != nil || fmt.Sprint(env) != expected {
+			t.Errorf("Info '%s': expected the environment %s, got %v (%v)", info, expected, env, err)
+		}
+	}
+
+	for _, info := range []string{`rust,env=MONGODB_URI`, `rust,env="1A=b"`} {
+		if _, err := parseFenceInfo(info).env(); err == nil {
+			t.Errorf("Expected %s to be rejected", info)
+		}
+	}
+}
+
+func TestNoMainAttribute(t *testing.T) {
+	content := "```rust,no_main\nuse serde::Serialize;\n\n#[derive(Serialize)]\npub struct User { name: String }\n```\n"
+	snippets, err := (&DocChecker{}).extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil || len(snippets) != 1 || !snippets[0].NoMain {
+		t.Fatalf("Expected a no_main snippet, got %+v (%v)", snippets, err)
+	}
+
+	crate := CrateConfig{Name: "tnuctipun"}
+	checker := &DocChecker{}
+	wrapped := checker.wrapSnippet("// source: README.md:1-6, id=auto_1\n"+snippets[0].Content, crate, true)
+
+	// At the root, with only a glob import, as the snippet imports serde
+	expected := "// source: README.md:1-6, id=auto_1\n#![allow(unused)]\nuse tnuctipun::*;\n\n" + snippets[0].Content + "\n\nfn main() {}\n"
+
+	if wrapped != expected {
+		t.Errorf("Unexpected binary:\n%s", wrapped)
+	}
+
+	if wrapped := checker.wrapSnippet(snippets[0].Content, crate, false); !strings.Contains(wrapped, "async fn main()") {
+		t.Errorf("Expected the snippet to be wrapped without no_main:\n%s", wrapped)
+	}
+}
+
+func TestFeaturesAttribute(t *testing.T) {
+	for info, expected := range map[string]string{
+		"rust":                                 "[]",
+		"rust,features=mongodb,chrono":         "[chrono mongodb]",
+		`rust features="chrono, serde/derive"`: "[chrono serde/derive]",
+		"rust,features=chrono,no_run,mongodb":  "[chrono]",
+		`rust,features=""`:                     "[]",
+	} {
+		features, err := parseFenceInfo(info).features()
+
+		if err != nil || fmt.Sprint(features) != expected {
+			t.Errorf("Info '%s': expected the features %s, got %v (%v)", info, expected, features, err)
+		}
+	}
+
+	if _, err := parseFenceInfo(`rust,features="a b"`).features(); err == nil {
+		t.Error("Expected invalid features to be rejected")
+	}
+
+	// The features of a snippet replace the ones of its file
+	content := "---\ndoc_checker: { features: [mongodb] }\n---\n\n```rust,features=chrono\nlet now = chrono::Utc::now();\n```\n\n```rust\nlet x = 1;\n```\n\n```rust,features=\"\"\nlet y = 1;\n```\n"
+	snippets, err := (&DocChecker{}).extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil || len(snippets) != 3 {
+		t.Fatalf("Expected 3 snippets, got %+v (%v)", snippets, err)
+	}
+
+	if fmt.Sprint(snippets[0].Features, snippets[1].Features, snippets[2].Features) != "[chrono] [mongodb] []" {
+		t.Errorf("Unexpected features: %v, %v and %v", snippets[0].Features, snippets[1].Features, snippets[2].Features)
+	}
+}
+
+func TestCfgAttribute(t *testing.T) {
+	host := parseRustcCfg("debug_assertions\npanic=\"unwind\"\ntarget_arch=\"x86_64\"\ntarget_family=\"unix\"\ntarget_os=\"linux\"\nunix\n")
+
+	for predicate, expected := range map[string]bool{
+		"unix":                               true,
+		"windows":                            false,
+		`target_arch="wasm32"`:               false,
+		"target_arch=x86_64":                 true,
+		`all(unix, target_os = "linux")`:     true,
+		`all(unix,not(target_os="linux"))`:   false,
+		`any(windows, target_arch="x86_64")`: true,
+		"not(any())":                         true,
+	} {
+		cfg, err := parseCfg(predicate)
+
+		if err != nil {
+			t.Errorf("cfg=%s: %v", predicate, err)
+		} else if cfg.matches(host) != expected {
+			t.Errorf("cfg=%s: expected %v on the host", predicate, expected)
+		}
+	}
+
+	for _, predicate := range []string{"", "unix windows", "all(unix", "not(unix, windows)", "cfg(unix)", `target_os="linux`, "target_os="} {
+		if _, err := parseCfg(predicate); err == nil {
+			t.Errorf("Expected cfg=%s to be rejected", predicate)
+		}
+	}
+
+	fence := parseFenceInfo(`rust,cfg=all(unix,target_pointer_width="64"),no_run`)
+
+	if cfg, err := fence.cfg(); err != nil || cfg.String() != `all(unix, target_pointer_width="64")` || !fence.NoRun {
+		t.Errorf("Unexpected fence: %+v (%v, %v)", fence, cfg, err)
+	}
+
+	// Reported as skipped on the other hosts
+	checker := NewDocChecker(&Config{})
+	checker.cfg = host
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", "```rust,cfg=windows\nlet x = 1;\n```\n")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checker.processLoaded(&loadedFile{path: "README.md", snippets: snippets}); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := checker.results.Files["README.md"]; result.SnippetsSkipped != 1 || result.Snippets[0].Status != "skipped" {
+		t.Errorf("Expected a skipped snippet, got %+v", result)
+	}
+}
+
+func TestEmitSnippetEvents(t *testing.T) {
+	var stream bytes.Buffer
+
+	checker := NewDocChecker(&Config{OutputFormat: "jsonl", ProjectRoot: "/project"})
+	checker.stream = &stream
+	checker.manifest["README-10"] = ManifestEntry{File: "/project/README.md", SnippetID: "auto_1", StartLine: 10, EndLine: 15}
+
+	checker.emitSnippet("/project/README.md", Snippet{ID: "ignored_1", StartLine: 3, EndLine: 6}, "ignored")
+	checker.emitCompiled("README-10", "failed", 2, &Failure{Category: "SYNTAX_ERROR"})
+
+	lines := strings.Split(strings.TrimSpace(stream.String()), "\n")
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 JSON lines, got:\n%s", stream.String())
+	}
+
+	var event SnippetEvent
+
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatalf("Invalid JSON line: %v", err)
+	}
+
+	if event.File != "README.md" || event.SnippetID != "auto_1" || event.Status != "failed" ||
+		event.Attempts != 2 || event.Failure == nil || event.Failure.Category != "SYNTAX_ERROR" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+
+	if !contains(lines[0], `"status":"ignored"`) {
+		t.Errorf("Unexpected event: %s", lines[0])
+	}
+}
+
+func TestEmitProgress(t *testing.T) {
+	var progress bytes.Buffer
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: "/project"})
+	checker.progress = &progress
+	checker.manifest["README-10"] = ManifestEntry{File: "/project/README.md", SnippetID: "auto_1", StartLine: 10, EndLine: 15}
+	checker.manifest["README-20"] = ManifestEntry{File: "/project/README.md", SnippetID: "auto_2", StartLine: 20, EndLine: 25}
+
+	checker.emitProgress(ProgressEvent{Phase: phaseExtract, Done: 1, Total: 2, File: "/project/README.md"})
+	checker.completeSnippet("README-10", "valid", 1, 0, nil)
+
+	lines := strings.Split(strings.TrimSpace(progress.String()), "\n")
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 JSON lines, got:\n%s", progress.String())
+	}
+
+	var events [2]ProgressEvent
+
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &events[i]); err != nil {
+			t.Fatalf("Invalid JSON line: %v", err)
+		}
+	}
+
+	if events[0].Type != "progress" || events[0].Percent != 5 || events[0].File != "README.md" {
+		t.Errorf("Unexpected extract event: %+v", events[0])
+	}
+
+	if events[1].Phase != phaseCompile || events[1].Percent != 55 || events[1].Done != 1 || events[1].SnippetID != "auto_1" {
+		t.Errorf("Unexpected compile event: %+v", events[1])
+	}
+
+	if percent := progressPercent(phaseDone, 0, 0); percent != 100 {
+		t.Errorf("Expected 100%% when done, got %d", percent)
+	}
+}
+
+func TestPhaseTunables(t *testing.T) {
+	root := t.TempDir()
+	var paths []string
+
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(root, fmt.Sprintf("doc%d.md", i))
+		content := strings.Repeat("```rust\nlet a = 1;\n```\n\n", i)
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		paths = append(paths, path)
+	}
+
+	paths = append(paths, filepath.Join(root, "missing.md"))
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root, ExtractJobs: 3})
+	files := checker.loadFiles(paths)
+
+	for i, file := range files[:5] {
+		if file.path != paths[i] || file.readErr != nil || len(file.snippets) != i {
+			t.Errorf("Unexpected file %d: %s with %d snippets (%v)", i, file.path, len(file.snippets), file.readErr)
+		}
+	}
+
+	if files[5].readErr == nil {
+		t.Error("Expected an error reading the missing file")
+	}
+
+	// Written by batches of 2
+	checker = NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root, WriteBatch: 2})
+	out := t.TempDir()
+
+	for i := 0; i < 3; i++ {
+		if err := checker.writeGenerated(filepath.Join(out, fmt.Sprintf("s%d.rs", i)), []byte("fn main() {}")); err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 0 {
+			if _, err := os.Stat(filepath.Join(out, "s0.rs")); !os.IsNotExist(err) {
+				t.Errorf("Expected the first file to be queued, got %v", err)
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(out, "s1.rs")); err != nil {
+		t.Errorf("Expected the first batch to be written: %v", err)
+	}
+
+	if len(checker.pending) != 1 {
+		t.Errorf("Expected 1 queued file, got %d", len(checker.pending))
+	}
+
+	if err := checker.flushGenerated(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(out, "s2.rs")); err != nil {
+		t.Errorf("Expected the queued file to be written: %v", err)
+	}
+
+	if jobs := checker.cargoJobs(); jobs != nil {
+		t.Errorf("Expected no cargo jobs by default, got %v", jobs)
+	}
+
+	checker.config.CargoJobs = 2
+
+	if jobs := strings.Join(checker.cargoJobs(), " "); jobs != "--jobs 2" {
+		t.Errorf("Expected --jobs 2, got '%s'", jobs)
+	}
+}
+
+func TestSnippetResults(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := "```rust,ignore\nlet a = 1;\n```\n\n```rust,retries=2\nlet b = 2;\n```\n"
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root})
+	checker.tempDir = t.TempDir()
+
+	if err := checker.processFile(file); err != nil {
+		t.Fatalf("Failed to process: %v", err)
+	}
+
+	snippets := checker.results.Files[file].Snippets
+
+	if len(snippets) != 2 || snippets[0].Status != "ignored" || snippets[1].Status != "unchecked" ||
+		snippets[1].Line != 5 || snippets[1].EndLine != 7 || snippets[1].Attributes["retries"] != "2" {
+		t.Fatalf("Unexpected snippets: %+v", snippets)
+	}
+
+	binName := checker.manifest.binNames()[0]
+	checker.completeSnippet(binName, "failed", 3, 1500*time.Millisecond, &Failure{Category: "SYNTAX_ERROR"})
+
+	snippet := checker.results.Files[file].Snippets[1]
+
+	if snippet.Status != "failed" || snippet.Snippet != binName || snippet.Attempts != 3 ||
+		snippet.DurationMs != 1500 || snippet.Failure == nil || snippet.Failure.Category != "SYNTAX_ERROR" {
+		t.Errorf("Unexpected outcome: %+v", snippet)
+	}
+}
+
+func TestAPIFilter(t *testing.T) {
+	code := `use tnuctipun::{filters::empty, updates};
+
+let update = updates::empty::<User>()
+    .set::<user_fields::Name, _>("Jane".to_string())
+    .build();`
+
+	for path, expected := range map[string]bool{
+		"updates::set":            true,
+		"tnuctipun::updates::set": true,
+		"updates::empty":          true,
+		"filters::empty":          true,
+		"updates::unset":          false,
+		"filters::eq":             false,
+		"projection::set":         false,
+	} {
+		if referencesAPI(code, path) != expected {
+			t.Errorf("Expected %s referenced = %v", path, expected)
+		}
+	}
+
+	if !referencesAPI("use tnuctipun::updates::{set, unset};", "updates::unset") {
+		t.Error("Expected a grouped import to reference the path")
+	}
+
+	if paths, err := parseAPIFilter("updates::set, filters::eq"); err != nil || len(paths) != 2 || paths[1] != "filters::eq" {
+		t.Errorf("Unexpected paths: %v (%v)", paths, err)
+	}
+
+	if _, err := parseAPIFilter("updates::set,"); err == nil {
+		t.Error("Expected an empty path to be rejected")
+	}
+
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := "```rust\nlet a = updates::empty::<User>().set::<F, _>(1);\n```\n\n```rust\nlet b = filters::empty::<User>();\n```\n"
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root, APIFilter: []string{"updates::set"}})
+	checker.tempDir = t.TempDir()
+
+	if err := checker.processFile(file); err != nil {
+		t.Fatalf("Failed to process: %v", err)
+	}
+
+	snippets := checker.results.Files[file].Snippets
+
+	if len(checker.manifest) != 1 || checker.results.Summary.FilteredSnippets != 1 ||
+		len(snippets) != 2 || snippets[0].Status != "unchecked" || snippets[1].Status != "filtered" {
+		t.Errorf("Expected only the first snippet to be checked, got %+v", snippets)
+	}
+}
+
+func TestPreviewSnippets(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := "```rust preview\nlet a = next_api();\n```\n\n```rust\nlet b = 2;\n```\n"
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"demo\"\nversion = \"0.3.1\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, published := range []bool{false, true} {
+		checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root, AgainstPublished: published})
+		checker.tempDir = t.TempDir()
+
+		if err := checker.processFile(file); err != nil {
+			t.Fatalf("Failed to process: %v", err)
+		}
+
+		previews := previewExamples(checker.results)
+		expected := map[bool]string{false: "unchecked", true: "preview"}[published]
+
+		if checker.results.Summary.PreviewSnippets != 1 || len(previews) != 1 ||
+			previews[0].Line != 1 || previews[0].Status != expected {
+			t.Errorf("Expected a %s preview snippet (published=%v), got %+v", expected, published, previews)
+		}
+
+		if compiled := map[bool]int{false: 2, true: 1}[published]; len(checker.manifest) != compiled {
+			t.Errorf("Expected %d compiled snippets (published=%v), got %d", compiled, published, len(checker.manifest))
+		}
+
+		dependency, err := checker.crateDependency(CrateConfig{Name: "demo", Path: root})
+		expected = map[bool]string{false: `{ path = "` + root + `" }`, true: `"=0.3.1"`}[published]
+
+		if err != nil || dependency != expected {
+			t.Errorf("Expected dependency %s, got %s (%v)", expected, dependency, err)
+		}
+	}
+}
+
+func TestTildeFences(t *testing.T) {
+	content := "~~~rust\nlet a = 1;\n~~~\n\n" +
+		"````rust\n```text\nnot a fence end\n```\nlet b = 2;\n````\n\n" +
+		"~~~~rs,ignore\nlet c = 3;\n~~~\n~~~~~\n\n" +
+		"```rust\nlet d = 4;\n~~~\n```\n"
+
+	checker := &DocChecker{}
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil {
+		t.Fatalf("Failed to extract snippets: %v", err)
+	}
+
+	expected := []struct {
+		start, end int
+		content    string
+	}{
+		{1, 3, "let a = 1;"},
+		{5, 10, "```text\nnot a fence end\n```\nlet b = 2;"},
+		{12, 15, "let c = 3;\n~~~"},
+		{17, 20, "let d = 4;\n~~~"},
+	}
+
+	if len(snippets) != len(expected) {
+		t.Fatalf("Expected %d snippets, got %+v", len(expected), snippets)
+	}
+
+	for i, snippet := range snippets {
+		if snippet.StartLine != expected[i].start || snippet.EndLine != expected[i].end || snippet.Content != expected[i].content {
+			t.Errorf("Unexpected snippet %d: %+v", i+1, snippet)
+		}
+	}
+
+	if !snippets[2].Ignore {
+		t.Error("Expected the attributes of a tilde fence to be parsed")
+	}
+
+	if _, ok := parseCodeFence("``` `code` ```"); ok {
+		t.Error("Expected an inline code span not to be a fence")
+	}
+}
+
+func TestUnclosedFences(t *testing.T) {
+	content := "```rust\nlet a = 1;\n\n```rust\nlet b = 2;\n```\n\n" +
+		"````markdown\n```rust\n```\n````\n\n" +
+		"```rust\nlet c = 3;\n"
+
+	root := t.TempDir()
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root})
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil {
+		t.Fatalf("Failed to extract snippets: %v", err)
+	}
+
+	expected := []struct {
+		start, end int
+		content    string
+		unclosed   bool
+	}{
+		{1, 3, "let a = 1;\n", true},
+		{4, 6, "let b = 2;", false},
+		{13, 15, "let c = 3;\n", true},
+	}
+
+	if len(snippets) != len(expected) {
+		t.Fatalf("Expected %d snippets, got %+v", len(expected), snippets)
+	}
+
+	for i, snippet := range snippets {
+		if snippet.StartLine != expected[i].start || snippet.EndLine != expected[i].end || snippet.Content != expected[i].content ||
+			snippet.Unclosed != expected[i].unclosed {
+			t.Errorf("Unexpected snippet %d: %+v", i+1, snippet)
+		}
+	}
+
+	// The unclosed snippets are reported rather than compiled
+	checker.tempDir = t.TempDir()
+	var messages []string
+
+	for _, snippet := range snippets {
+		if err := checker.writeSnippetFile(filepath.Join(root, "README.md"), snippet); err != nil {
+			t.Fatal(err)
+		}
+
+		if failure := checker.unclosedFence(fmt.Sprintf("README-%d", snippet.StartLine)); failure != nil {
+			if failure.Category != categoryMalformedMarkdown || failure.Line != snippet.StartLine {
+				t.Errorf("Unexpected failure: %+v", failure)
+			}
+
+			messages = append(messages, failure.Message)
+		}
+	}
+
+	if len(messages) != 2 || messages[1] != "README.md:13: code block not closed, so its content (up to line 15) is not compiled" {
+		t.Errorf("Expected the unclosed blocks of lines 1 and 13 to fail, got %q", messages)
+	}
+
+	checker.lintMarkdown("README.md", content, snippets)
+
+	var lines []int
+
+	for _, warning := range checker.results.Warnings {
+		if warning.Code == warnStructure {
+			lines = append(lines, warning.Line)
+		}
+	}
+
+	if fmt.Sprint(lines) != "[1 13]" {
+		t.Errorf("Expected the unclosed blocks of lines 1 and 13, got %v (%+v)", lines, checker.results.Warnings)
+	}
+}
+
+func TestHiddenLines(t *testing.T) {
+	content := "```rust\n# use tnuctipun::updates;\n#\n    # let x = 1;\n#[derive(Debug)]\n#![allow(unused)]\n##[doc = \"#\"]\nlet y = x;\n```\n"
+
+	checker := &DocChecker{}
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil || len(snippets) != 1 {
+		t.Fatalf("Expected 1 snippet, got %+v (%v)", snippets, err)
+	}
+
+	expected := "use tnuctipun::updates;\n\nlet x = 1;\n#[derive(Debug)]\n#![allow(unused)]\n#[doc = \"#\"]\nlet y = x;"
+
+	if snippets[0].Content != expected {
+		t.Errorf("Unexpected content:\n%s", snippets[0].Content)
+	}
+
+	// One line per markdown line, between the fences
+	if lines := strings.Count(snippets[0].Content, "\n") + 1; lines != snippets[0].EndLine-snippets[0].StartLine-1 {
+		t.Errorf("Expected the lines to be kept, got %d lines for %d-%d", lines, snippets[0].StartLine, snippets[0].EndLine)
+	}
+}
+
+func TestNoRun(t *testing.T) {
+	if fence := parseFenceInfo("rust,no_run"); !fence.NoRun || fence.Ignore || fence.CompileFail {
+		t.Errorf("Unexpected fence: %+v", fence)
+	}
+
+	content := "```rust,no_run\nlet client = connect();\n```\n\n```rust\nlet a = 1;\n```\n"
+
+	checker := &DocChecker{}
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil || len(snippets) != 2 {
+		t.Fatalf("Expected 2 snippets, got %+v (%v)", snippets, err)
+	}
+
+	// Still compiled
+	if !snippets[0].NoRun || snippets[0].Ignore || snippets[1].NoRun {
+		t.Errorf("Unexpected snippets: %+v", snippets)
+	}
+}
+
+func TestShouldPanic(t *testing.T) {
+	if fence := parseFenceInfo("rust,should_panic"); !fence.ShouldPanic || fence.NoRun || fence.CompileFail {
+		t.Errorf("Unexpected fence: %+v", fence)
+	}
+
+	content := "```rust,should_panic\nlet id = ObjectId::parse_str(\"invalid\").unwrap();\n```\n"
+
+	checker := &DocChecker{}
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil || len(snippets) != 1 || !snippets[0].ShouldPanic || snippets[0].Ignore {
+		t.Fatalf("Expected a should_panic snippet, got %+v (%v)", snippets, err)
+	}
+}
+
+func TestEditionAttribute(t *testing.T) {
+	if fence := parseFenceInfo("rust,edition2018"); fence.Edition != "2018" {
+		t.Errorf("Unexpected fence: %+v", fence)
+	}
+
+	checker := &DocChecker{}
+
+	if _, err := checker.extractRustSnippetsWithIDs("README.md", "```rust,edition2019\nlet a = 1;\n```\n"); err == nil || !strings.Contains(err.Error(), "line 1: invalid edition2019") {
+		t.Errorf("Expected an invalid edition error, got %v", err)
+	}
+
+	// Not a Rust block, so not validated
+	if _, err := checker.extractRustSnippetsWithIDs("README.md", "```toml,edition2019\na = 1\n```\n"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := "```rust,edition2018\nlet a = 1;\n```\n\n```rust\nlet b = 2;\n```\n"
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"tnuctipun\"\nversion = \"0.2.0\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker = NewDocChecker(&Config{ProjectRoot: root, Files: []string{file}, OutputFormat: "json"})
+	checker.tempDir = t.TempDir()
+
+	if err := checker.processFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checker.flushGenerated(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := checker.manifest.binNames()
+
+	if len(names) != 2 || checker.manifest[names[0]].Edition != "2018" || checker.manifest[names[1]].Edition != "" {
+		t.Fatalf("Unexpected manifest: %+v", checker.manifest)
+	}
+
+	// The same code, with another edition, is another cache entry
+	crate := checker.crates()[0]
+	code := checker.generatedCode(names[0], crate)
+	entry := checker.manifest[names[0]]
+	entry.Edition = "2021"
+	checker.manifest[names[0]] = entry
+
+	if checker.generatedCode(names[0], crate) == code {
+		t.Error("Expected the edition to change the cached code")
+	}
+
+	entry.Edition = "2018"
+	checker.manifest[names[0]] = entry
+	projectDir := filepath.Join(checker.tempDir, "test_project")
+
+	if err := checker.createCargoProject(projectDir, crate, checker.snippetFiles(names)); err != nil {
+		t.Fatal(err)
+	}
+
+	cargoToml, err := ioutil.ReadFile(filepath.Join(projectDir, "Cargo.toml"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf("name = \"%s\"\npath = \"src/bin/%s.rs\"\nedition = \"2018\"\n", names[0], names[0])
+
+	if !strings.Contains(string(cargoToml), expected) || strings.Count(string(cargoToml), "edition = ") != 2 {
+		t.Errorf("Expected the edition of the first binary only:\n%s", cargoToml)
+	}
+}
+
+func TestIgnoreReason(t *testing.T) {
+	for info, expected := range map[string]FenceInfo{
+		"rust:ignore":                               {Lang: "rust", Ignore: true},
+		`rust:ignore(reason="pseudo-code")`:         {Lang: "rust", Ignore: true, IgnoreReason: "pseudo-code"},
+		`rust,ignore(reason="needs a replica set")`: {Lang: "rust", Ignore: true, IgnoreReason: "needs a replica set"},
+		`rust ignore(reason="a, b"),retries=2`:      {Lang: "rust", Ignore: true, IgnoreReason: "a, b"},
+		`rust:other`:                                {Lang: "rust:other"},
+	} {
+		fence := parseFenceInfo(info)
+
+		if fence.Lang != expected.Lang || fence.Ignore != expected.Ignore || fence.IgnoreReason != expected.IgnoreReason {
+			t.Errorf("%s: unexpected fence %+v", info, fence)
+		}
+
+		if _, exists := fence.Attrs["ignore(reason"]; exists {
+			t.Errorf("%s: the reason parsed as an attribute", info)
+		}
+	}
+
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := "```rust:ignore(reason=\"pseudo-code\")\nlet a = ...;\n```\n\n" +
+		"```rust,ignore(reason=\"pseudo-code\")\nlet b = ...;\n```\n\n" +
+		"```rust,ignore\nlet c = ...;\n```\n"
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewDocChecker(&Config{ProjectRoot: root, Files: []string{file}, OutputFormat: "json"})
+	checker.tempDir = t.TempDir()
+
+	if err := checker.processFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := checker.results.Summary
+
+	if summary.IgnoredSnippets != 3 || len(summary.IgnoreReasons) != 1 || summary.IgnoreReasons["pseudo-code"] != 2 {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+
+	snippets := checker.results.Files[file].Snippets
+
+	if len(snippets) != 3 || snippets[0].IgnoreReason != "pseudo-code" || snippets[2].IgnoreReason != "" || snippets[2].Status != "ignored" {
+		t.Errorf("Unexpected snippets: %+v", snippets)
+	}
+}
+
+func TestSnippetRefs(t *testing.T) {
+	content := "```rust,id=user\n#[derive(FieldWitnesses)]\nstruct User { name: String }\n```\n\n" +
+		"```rust,ignore,id=setup\nlet client = connect();\n```\n\n" +
+		"```rust,id=filter,requires=user\nlet f = filters::<User>();\n```\n\n" +
+		"```rust,continues=filter,requires=\"setup,user\"\nclient.find(f);\n```\n"
+
+	checker := &DocChecker{}
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil || len(snippets) != 4 {
+		t.Fatalf("Expected 4 snippets, got %+v (%v)", snippets, err)
+	}
+
+	if snippets[0].ID != "user" || snippets[1].ID != "setup" || snippets[3].ID != "auto_4" || snippets[0].Preamble != "" {
+		t.Errorf("Unexpected snippets: %+v", snippets)
+	}
+
+	if expected := "// user (line 1)\n#[derive(FieldWitnesses)]\nstruct User { name: String }\n\n"; snippets[2].Preamble != expected {
+		t.Errorf("Unexpected preamble:\n%s", snippets[2].Preamble)
+	}
+
+	// Transitively, each one once, in the order of the file
+	expected := "// user (line 1)\n#[derive(FieldWitnesses)]\nstruct User { name: String }\n\n" +
+		"// setup (line 6)\nlet client = connect();\n\n" +
+		"// filter (line 10)\nlet f = filters::<User>();\n\n"
+
+	if snippets[3].Preamble != expected {
+		t.Errorf("Unexpected preamble:\n%s", snippets[3].Preamble)
+	}
+
+	for input, message := range map[string]string{
+		"```rust,continues=later\nlet a = 1;\n```\n\n```rust,id=later\nlet b = 2;\n```\n": "line 1: no snippet with id=later before this one",
+		"```rust,id=a\nlet a = 1;\n```\n\n```rust,id=a\nlet b = 2;\n```\n":                "line 5: duplicate id a (already the one of the snippet at line 1)",
+		"```rust,id=\"a b\"\nlet a = 1;\n```\n":                                           "line 1: invalid id=a b",
+		"```rust,id=a\nlet a = 1;\n```\n\n```rust,continues=\"a,a\"\nlet b = 2;\n```\n":   "line 5: invalid continues=a,a",
+	} {
+		if _, err := checker.extractRustSnippetsWithIDs("README.md", input); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q, got %v", message, err)
+		}
+	}
+
+	// Written before the code of the snippet, after the prelude
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker = NewDocChecker(&Config{ProjectRoot: root, Files: []string{file}, OutputFormat: "json"})
+	checker.tempDir = t.TempDir()
+
+	if err := checker.processFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checker.flushGenerated(); err != nil {
+		t.Fatal(err)
+	}
+
+	var binName string
+
+	for name, source := range checker.manifest {
+		if source.SnippetID == "auto_4" { // After the ones of lines 1 and 10
+			binName = name
+		}
+	}
+
+	generated, err := ioutil.ReadFile(filepath.Join(checker.tempDir, binName+".rs"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(generated), "use serde::{Deserialize, Serialize};\n\n// user (line 1)\n") ||
+		!strings.HasSuffix(string(generated), "// filter (line 10)\nlet f = filters::<User>();\n\nclient.find(f);") {
+		t.Errorf("Unexpected generated snippet:\n%s", generated)
+	}
+}
+
+func TestSetupSnippets(t *testing.T) {
+	content := "```rust\nlet before = 0;\n```\n\n" +
+		"```rust,setup\nuse tnuctipun::FieldWitnesses;\n```\n\n" +
+		"```rust,setup,ignore,id=user\n#[derive(FieldWitnesses)]\nstruct User { name: String }\n```\n\n" +
+		"```rust,id=filter\nlet f = filters::<User>();\n```\n\n" +
+		"```rust,continues=filter,requires=user\nclient.find(f);\n```\n"
+
+	checker := &DocChecker{}
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil || len(snippets) != 5 {
+		t.Fatalf("Expected 5 snippets, got %+v (%v)", snippets, err)
+	}
+
+	if snippets[0].Preamble != "" || !snippets[1].Setup || snippets[1].Preamble != "" {
+		t.Errorf("Unexpected snippets: %+v", snippets)
+	}
+
+	setup := "// auto_2 (line 5)\nuse tnuctipun::FieldWitnesses;\n\n" +
+		"// user (line 9)\n#[derive(FieldWitnesses)]\nstruct User { name: String }\n\n"
+
+	if snippets[3].Preamble != setup {
+		t.Errorf("Unexpected preamble:\n%s", snippets[3].Preamble)
+	}
+
+	// Each one once, with the snippets it continues
+	if expected := setup + "// filter (line 14)\nlet f = filters::<User>();\n\n"; snippets[4].Preamble != expected {
+		t.Errorf("Unexpected preamble:\n%s", snippets[4].Preamble)
+	}
+}
+
+func TestSnippetParts(t *testing.T) {
+	content := "```rust,part=1/2,id=find\nlet client = connect();\n```\n\nThen:\n\n" +
+		"```rust\nlet other = 1;\n```\n\n" +
+		"```rust,part=2/2\nlet user = client.find(\n```\n\n" +
+		"```rust\nlet last = 2;\n```\n"
+
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	checker := NewDocChecker(&Config{ProjectRoot: root})
+	snippets, err := checker.extractRustSnippetsWithIDs(file, content)
+
+	if err != nil || len(snippets) != 3 {
+		t.Fatalf("Expected 3 snippets, got %+v (%v)", snippets, err)
+	}
+
+	example := snippets[0]
+
+	if example.ID != "find" || example.Content != "let client = connect();\nlet user = client.find(" ||
+		example.StartLine != 1 || example.EndLine != 13 || snippets[2].ID != "auto_3" {
+		t.Errorf("Unexpected snippets: %+v", snippets)
+	}
+
+	// The prose between the parts is not part of the code
+	if lines := example.codeLines(len(strings.Split(content, "\n"))); !reflect.DeepEqual(lines, []int{1, 11}) {
+		t.Errorf("Unexpected code lines: %v", lines)
+	}
+
+	checker.tempDir = t.TempDir()
+
+	if err := checker.writeSnippetFile(file, example); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := checker.precheckSyntax("README-find")
+
+	if failure == nil || !strings.Contains(failure.Message, "README.md:12:23: unclosed delimiter `(`") {
+		t.Errorf("Expected the error in the second part, got %+v", failure)
+	}
+
+	for input, message := range map[string]string{
+		"```rust,part=2/2\nlet a = 1;\n```\n":                                      "line 1: part=2/2, without the part 1/2 before it",
+		"```rust,part=1/2\nlet a = 1;\n```\n":                                      "line 1: example in 2 parts, but only 1 found",
+		"```rust,part=1/3\nlet a = 1;\n```\n\n```rust,part=3/3\nlet b = 2;\n```\n": "line 5: part=3/3, while the part 2/3 of the example at line 1 is expected",
+		"```rust,part=1/1\nlet a = 1;\n```\n":                                      "line 1: invalid part=1/1",
+		"```rust,part=first\nlet a = 1;\n```\n":                                    "line 1: invalid part=first",
+	} {
+		if _, err := checker.extractRustSnippetsWithIDs(file, input); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q, got %v", message, err)
+		}
+	}
+}
+
+func TestNestedFences(t *testing.T) {
+	content := "- Item:\n\n  ```rust\n  let a = 1;\n    let b = a;\n  ```\n\n" +
+		"> ```rust\n> let c = 3;\n>\n> ```\n\n" +
+		"> 1. Step:\n>    ```rust,ignore\n>    let d = 4;\n>    ```\n\n" +
+		"```markdown\n- ```rust\n```\n"
+
+	checker := &DocChecker{}
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil {
+		t.Fatalf("Failed to extract snippets: %v", err)
+	}
+
+	expected := []struct {
+		start, end int
+		content    string
+	}{
+		{3, 6, "let a = 1;\n  let b = a;"},
+		{8, 11, "let c = 3;\n"},
+		{14, 16, "let d = 4;"},
+	}
+
+	if len(snippets) != len(expected) {
+		t.Fatalf("Expected %d snippets, got %+v", len(expected), snippets)
+	}
+
+	for i, snippet := range snippets {
+		if snippet.StartLine != expected[i].start || snippet.EndLine != expected[i].end || snippet.Content != expected[i].content {
+			t.Errorf("Unexpected snippet %d: %+v", i+1, snippet)
+		}
+	}
+
+	if !snippets[2].Ignore {
+		t.Error("Expected the attributes of a nested fence to be parsed")
+	}
+
+	if fence, ok := parseCodeFence("> - ```rust"); !ok || fence.quotes != 1 || fence.indent != 2 || fence.info != "rust" {
+		t.Errorf("Unexpected nested fence: %+v", fence)
+	}
+}
+
+func TestIndentedBlocks(t *testing.T) {
+	content := "Intro\n\n<!-- lang: rust -->\n\n    let a = 1;\n\n\tlet b = a;\n\nText\n\n" +
+		"<!-- lang: rust,ignore -->\n    let c = 3;\n\n" +
+		"<!-- lang: rust -->\nNot a code block\n\n    let d = 4;\n\n" +
+		"<!-- lang: text -->\n\n    plain text\n\n" +
+		"```rust\nlet e = 5;\n```\n\n" +
+		"<!-- lang: rs -->\n    let f = 6;"
+
+	checker := NewDocChecker(&Config{OutputFormat: "json"})
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil || len(snippets) != 1 || snippets[0].Content != "let e = 5;" {
+		t.Fatalf("Expected only the fenced snippet by default, got %+v (%v)", snippets, err)
+	}
+
+	checker.config.IndentedBlocks = true
+
+	if snippets, err = checker.extractRustSnippetsWithIDs("README.md", content); err != nil {
+		t.Fatalf("Failed to extract snippets: %v", err)
+	}
+
+	expected := []struct {
+		start, end int
+		content    string
+		ignore     bool
+	}{
+		{3, 7, "let a = 1;\n\nlet b = a;", false},
+		{11, 12, "let c = 3;", true},
+		{23, 25, "let e = 5;", false},
+		{27, 28, "let f = 6;", false},
+	}
+
+	if len(snippets) != len(expected) {
+		t.Fatalf("Expected %d snippets, got %+v", len(expected), snippets)
+	}
+
+	for i, snippet := range snippets {
+		if snippet.StartLine != expected[i].start || snippet.EndLine != expected[i].end ||
+			snippet.Content != expected[i].content || snippet.Ignore != expected[i].ignore {
+			t.Errorf("Unexpected snippet %d: %+v", i+1, snippet)
+		}
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	doc, err := parseTOML(`# Comment
+default_crate = "tnuctipun" # trailing comment
+
+[crates.tnuctipun-derive]
+path = 'tnuctipun-derive'
+prelude = [
+  "use tnuctipun_derive::*; # kept",
+  "use serde::Serialize;",
+]
+retries = 3
+enabled = true
+`)
+
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"default_crate":                   "tnuctipun",
+		"crates.tnuctipun-derive.path":    "tnuctipun-derive",
+		"crates.tnuctipun-derive.retries": int64(3),
+		"crates.tnuctipun-derive.enabled": true,
+	}
+
+	for key, value := range expected {
+		if doc.Values[key].Value != value {
+			t.Errorf("Expected %s = %v, got %v", key, value, doc.Values[key].Value)
+		}
+	}
+
+	prelude, _, err := doc.stringsValue("crates.tnuctipun-derive.prelude")
+
+	if err != nil || len(prelude) != 2 || prelude[0] != "use tnuctipun_derive::*; # kept" {
+		t.Errorf("Unexpected prelude: %v (%v)", prelude, err)
+	}
+
+	if line := doc.Values["crates.tnuctipun-derive.retries"].Line; line != 10 {
+		t.Errorf("Expected retries at line 10, got %d", line)
+	}
+
+	doc, err = parseTOML("[[bin]]\nname = \"a\"\n[[bin]]\nname = \"b\"\n[dependencies]\nbson = { version = \"3.1\", features = [\"serde\"] }\n")
+
+	if err != nil || doc.Values["bin.1.name"].Value != "b" {
+		t.Errorf("Unexpected arrays of tables: %v (%v)", doc, err)
+	} else if bson, _ := doc.Values["dependencies.bson"].Value.(map[string]interface{}); bson["version"] != "3.1" {
+		t.Errorf("Unexpected inline table: %v", doc.Values["dependencies.bson"])
+	}
+
+	// The whole TOML syntax, e.g. in the [package.metadata] of a manifest
+	doc, err = parseTOML(`ratio = 0.5
+max = inf
+min = -inf
+undefined = nan
+released = 1979-05-27T07:32:00Z
+description = """
+A type-safe
+query builder"""
+pattern = '''
+\d+'''
+
+[[bin]]
+name = "a"
+
+[[bin.required]]
+feature = "chrono"
+`)
+
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	if doc.Values["ratio"].Value != 0.5 || !math.IsInf(doc.Values["max"].Value.(float64), 1) ||
+		!math.IsInf(doc.Values["min"].Value.(float64), -1) || !math.IsNaN(doc.Values["undefined"].Value.(float64)) {
+		t.Errorf("Unexpected floats: %v", doc.Values)
+	}
+
+	if released, _ := doc.Values["released"].Value.(time.Time); released.Year() != 1979 {
+		t.Errorf("Unexpected date: %v", doc.Values["released"])
+	}
+
+	if doc.Values["description"].Value != "A type-safe\nquery builder" || doc.Values["pattern"].Value != "\\d+" {
+		t.Errorf("Unexpected multi-line strings: %q, %q", doc.Values["description"].Value, doc.Values["pattern"].Value)
+	}
+
+	if value := doc.Values["bin.0.required.0.feature"]; value.Value != "chrono" || value.Line != 16 {
+		t.Errorf("Unexpected nested array of tables: %+v (%v)", value, doc.Keys)
+	}
+
+	for _, invalid := range []string{"key", "key = ", "[table", "a = \"unterminated", "a = 1\na = 2", "a = [1, 2", "a = { b = 1",
+		"[dependencies]\nserde = \"1\"\n[dependencies]\nbson = \"3\"\n", "a = 1.", "a = \"\"\"unterminated"} {
+		if _, err := parseTOML(invalid); err == nil {
+			t.Errorf("Expected '%s' to be rejected", invalid)
+		}
+	}
+
+	if _, err := parseTOML("[dependencies]\nserde = \"1\"\n\n[dependencies]\n"); err == nil || !strings.HasPrefix(err.Error(), "line 4: ") {
+		t.Errorf("Expected the duplicate table to be rejected at line 4, got %v", err)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	root := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(root, "derive"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{".", "derive"} {
+		if err := ioutil.WriteFile(filepath.Join(root, dir, "Cargo.toml"), []byte("[package]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without configuration file
+	config := &Config{ProjectRoot: root}
+
+	if err := loadConfigFile(config); err != nil || len(config.Crates) != 1 || config.Crates[0].Name != "tnuctipun" {
+		t.Fatalf("Expected the default crate, got %v (%v)", config.Crates, err)
+	}
+
+	content := `default_crate = "main"
+
+[crates.derive-macros]
+path = "derive"
+
+[crates.main]
+path = "."
+prelude = ["use main::*;"]
+
+[renames]
+"main::update" = "main::updates"
+`
+
+	if err := ioutil.WriteFile(filepath.Join(root, configFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loadConfigFile(config); err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	if len(config.Crates) != 2 || config.Crates[0].Name != "main" || config.Crates[1].Path != filepath.Join(root, "derive") {
+		t.Fatalf("Unexpected crates: %+v", config.Crates)
+	}
+
+	if len(config.Renames) != 1 || config.Renames[0] != (PathRename{Old: "main::update", New: "main::updates"}) {
+		t.Errorf("Unexpected renames: %+v", config.Renames)
+	}
+
+	checker := NewDocChecker(config)
+
+	if crate, err := checker.crate("derive-macros"); err != nil || crate.ident() != "derive_macros" {
+		t.Errorf("Unexpected crate: %+v (%v)", crate, err)
+	}
+
+	if _, err := checker.crate("unknown"); err == nil {
+		t.Error("Expected an unknown crate to be rejected")
+	}
+}
+
+func TestRustAliases(t *testing.T) {
+	root := t.TempDir()
+	content := "[languages]\nrust = [\"tnuctipun\", \"rust-example\"]\n"
+
+	if err := ioutil.WriteFile(filepath.Join(root, configFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{ProjectRoot: root}
+
+	if err := loadConfigFile(config); err != nil || len(config.RustAliases) != 2 {
+		t.Fatalf("Unexpected aliases: %v (%v)", config.RustAliases, err)
+	}
+
+	markdown := "```tnuctipun\nlet a = 1;\n```\n\n```rust-example:ignore\nlet b = 2;\n```\n\n```text\nlet c = 3;\n```\n\n```rs\nlet d = 4;\n```\n"
+	snippets, err := NewDocChecker(config).extractRustSnippetsWithIDs("README.md", markdown)
+
+	if err != nil || len(snippets) != 3 {
+		t.Fatalf("Expected 3 snippets, got %+v (%v)", snippets, err)
+	}
+
+	if snippets[0].StartLine != 1 || snippets[1].StartLine != 5 || !snippets[1].Ignore || snippets[2].StartLine != 13 {
+		t.Errorf("Unexpected snippets: %+v", snippets)
+	}
+
+	// Without configuration, only rust and rs
+	if snippets, _ := (&DocChecker{}).extractRustSnippetsWithIDs("README.md", markdown); len(snippets) != 1 {
+		t.Errorf("Expected only the rs snippet, got %+v", snippets)
+	}
+
+	content = "[languages]\nrust = [\"rust example\"]\n"
+
+	if err := ioutil.WriteFile(filepath.Join(root, configFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loadConfigFile(config); err == nil || !contains(err.Error(), "line 2: invalid language") {
+		t.Errorf("Expected an invalid language to be rejected, got %v", err)
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	doc, err := parseTOML(`includ = ["docs"]
+default_crate = 1
+
+[crates.main]
+path = "."
+prelud = ["use main::*;"]
+prelude = ["use main::*;", 2]
+
+[crate.derive]
+path = "derive"
+
+[renames]
+"main::update" = "main::updates"
+`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, warnings := validateConfig(doc, configSchema)
+	var messages []string
+
+	for _, problem := range errs {
+		messages = append(messages, problem.String())
+	}
+
+	expected := []string{
+		"line 1: unknown key includ",
+		"line 2: default_crate must be a string, not an integer",
+		"line 6: unknown key crates.main.prelud (did you mean crates.main.prelude?)",
+		"line 7: crates.main.prelude must be an array of strings, not an array",
+		"line 9: unknown table [crate.derive] (did you mean crates.derive?)",
+	}
+
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") || len(warnings) != 0 {
+		t.Errorf("Unexpected problems:\n%s\n(warnings: %v)", strings.Join(messages, "\n"), warnings)
+	}
+
+	// A deprecated key is only a warning
+	schema := append([]configKey{{Pattern: "crates.*.imports", Type: configStrings, Deprecated: "prelude"}}, configSchema...)
+	doc, _ = parseTOML("[crates.main]\npath = \".\"\nimports = [\"use main::*;\"]\n")
+	errs, warnings = validateConfig(doc, schema)
+
+	if len(errs) != 0 || len(warnings) != 1 || warnings[0].String() != "line 3: crates.main.imports is deprecated, use prelude instead" {
+		t.Errorf("Unexpected problems: %v, warnings: %v", errs, warnings)
+	}
+
+	// Reported by loadConfigFile, with the file
+	root := t.TempDir()
+	path := filepath.Join(root, configFileName)
+
+	if err := ioutil.WriteFile(path, []byte("default_crat = \"main\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = loadConfigFile(&Config{ProjectRoot: root})
+
+	if err == nil || !strings.Contains(err.Error(), path+": line 1: unknown key default_crat (did you mean default_crate?)") {
+		t.Errorf("Expected an unknown key error, got %v", err)
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	root := t.TempDir()
+	config := &Config{ProjectRoot: root, OutputFormat: "human"}
+
+	flags := flag.NewFlagSet("doc-checker", flag.ContinueOnError)
+	flags.StringVar(&config.OutputFormat, "o", "human", "")
+	flags.StringVar(&config.OutputFormat, "output", "human", "")
+	flags.StringVar(&config.WorkKey, "work-key", "", "")
+	flags.IntVar(&config.MaxErrorBytes, "max-error-bytes", 500, "")
+	flags.BoolVar(&config.Verbose, "verbose", true, "")
+
+	if err := flags.Parse([]string{"-o", "markdown", "--work-key", "ci", "README.md"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Verbose = false // e.g. by --quiet
+
+	var output bytes.Buffer
+
+	if err := printConfig(&output, flags, config); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `max-error-bytes = 500 # default
+output = "markdown" # flag
+verbose = false # implied
+work-key = "ci" # flag
+arguments = ["README.md"] # arguments
+project_root = "` + root + `" # implied
+default_crate = "tnuctipun" # default
+crates.tnuctipun.path = "." # default
+crates.tnuctipun.prelude = ["use tnuctipun::{FieldWitnesses, MongoComparable, updates};", "use serde::{Deserialize, Serialize};"] # default
+`
+
+	if output.String() != expected {
+		t.Errorf("Unexpected configuration:\n%s", output.String())
+	}
+
+	content := "default_crate = \"main\"\n\n[crates.main]\npath = \".\"\n\n[renames]\n\"main::update\" = \"main::updates\"\n"
+
+	if err := ioutil.WriteFile(filepath.Join(root, configFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config.OutputFormat = "json"
+	output.Reset()
+
+	if err := printConfig(&output, flags, config); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []configEntry
+
+	if err := json.Unmarshal(output.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+
+	last := entries[len(entries)-1]
+
+	if last.Key != "renames.main::update" || last.Value != "main::updates" || last.Source != configFileName+":7" {
+		t.Errorf("Unexpected entry: %+v", last)
+	}
+
+	if tomlKey(last.Key) != `renames."main::update"` {
+		t.Errorf("Unexpected TOML key: %s", tomlKey(last.Key))
+	}
+}
+
+func TestEnvOptions(t *testing.T) {
+	config := &Config{ProjectRoot: t.TempDir(), OutputFormat: "human"}
+
+	flags := flag.NewFlagSet("doc-checker", flag.ContinueOnError)
+	flags.StringVar(&config.OutputFormat, "o", "human", "")
+	flags.StringVar(&config.OutputFormat, "output", "human", "")
+	flags.StringVar(&config.WorkKey, "work-key", "", "")
+	flags.BoolVar(&config.QuickMode, "quick", false, "")
+
+	var warnings bytes.Buffer
+
+	envOptions, err := applyEnv(flags, []string{
+		"HOME=/root",
+		"DOC_CHECKER_OUTPUT=json",
+		"DOC_CHECKER_WORK_KEY=ci",
+		"DOC_CHECKER_QUIK=true",
+		"DOC_CHECKER_O=sarif",
+	}, &warnings)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedWarnings := `Warning: unknown environment variable DOC_CHECKER_O
+Warning: unknown environment variable DOC_CHECKER_QUIK (did you mean DOC_CHECKER_QUICK?)
+`
+
+	if warnings.String() != expectedWarnings {
+		t.Errorf("Unexpected warnings:\n%s", warnings.String())
+	}
+
+	// The flags take precedence
+	if err := flags.Parse([]string{"--work-key", "local"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config.EnvOptions = envOptions
+
+	if config.OutputFormat != "json" || config.WorkKey != "local" || config.QuickMode {
+		t.Errorf("Unexpected options: %+v", config)
+	}
+
+	entries, err := effectiveConfig(flags, config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := make(map[string]string)
+
+	for _, entry := range entries {
+		sources[entry.Key] = entry.Source
+	}
+
+	if sources["output"] != "env DOC_CHECKER_OUTPUT" || sources["work-key"] != sourceFlag || sources["quick"] != sourceDefault {
+		t.Errorf("Unexpected sources: %v", sources)
+	}
+
+	if _, err := applyEnv(flags, []string{"DOC_CHECKER_QUICK=maybe"}, &warnings); err == nil ||
+		!strings.HasPrefix(err.Error(), "invalid DOC_CHECKER_QUICK 'maybe'") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"examples/model.rs":  "# use serde::Deserialize;\n#[derive(Deserialize)]\nstruct User {\n    {{#include fields.rs}}\n}\n",
+		"examples/fields.rs": "name: String,\n",
+		"book/chapter.md":    "# Chapter\n\n```rust\n{{#include ../examples/model.rs}}\n\nfn main() {\n    println!(\"\\{{#include model.rs}}\");\n}\n```\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checker := NewDocChecker(&Config{ProjectRoot: root})
+	chapter := filepath.Join(root, "book", "chapter.md")
+	snippets, err := checker.extractRustSnippetsWithIDs(chapter, files["book/chapter.md"])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `use serde::Deserialize;
+#[derive(Deserialize)]
+struct User {
+    name: String,
+}
+
+fn main() {
+    println!("{{#include model.rs}}");
+}`
+
+	if len(snippets) != 1 || snippets[0].Content != expected {
+		t.Fatalf("Unexpected snippets: %+v", snippets)
+	}
+
+	content := "```rust\nfn main() {}\n{{#include missing.rs}}\n```\n"
+
+	if _, err := checker.extractRustSnippetsWithIDs(chapter, content); err == nil ||
+		!strings.HasPrefix(err.Error(), "line 3: {{#include missing.rs}}: ") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Not resolved in the ignored snippets
+	if _, err := checker.extractRustSnippetsWithIDs(chapter, "```rust,ignore\n{{#include missing.rs}}\n```\n"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestIncludeSelectors(t *testing.T) {
+	content := "use bson::doc;\n// ANCHOR: model\nstruct User {\n    name: String,\n}\n// ANCHOR_END: model\n\nfn main() {}\n"
+
+	for _, tc := range []struct {
+		selector string
+		rustdoc  bool
+		lines    []int
+	}{
+		{"", false, []int{1, 2, 3, 4, 5, 6, 7, 8}},
+		{"model", false, []int{3, 4, 5}},
+		{"model", true, []int{1, 3, 4, 5, 7, 8}},
+		{"3:5", false, []int{3, 4, 5}},
+		{"7:", false, []int{7, 8}},
+		{":2", false, []int{1, 2}},
+		{"4", false, []int{4}},
+		{"7:20", false, []int{7, 8}},
+		{"3:5", true, []int{1, 2, 3, 4, 5, 6, 7, 8}},
+	} {
+		_, numbers, err := selectLines(content, tc.selector, tc.rustdoc)
+
+		if err != nil {
+			t.Errorf("%s: %v", tc.selector, err)
+		} else if !reflect.DeepEqual(numbers, tc.lines) {
+			t.Errorf("%s: unexpected lines %v", tc.selector, numbers)
+		}
+	}
+
+	for _, selector := range []string{"other", "5:3", "0"} {
+		if _, _, err := selectLines(content, selector, false); err == nil {
+			t.Errorf("%s: expected an error", selector)
+		}
+	}
+
+	root := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(root, "examples"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "examples", "model.rs"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewDocChecker(&Config{ProjectRoot: root})
+	chapter := filepath.Join(root, "chapter.md")
+	snippets, err := checker.extractRustSnippetsWithIDs(chapter,
+		"```rust\n{{#include examples/model.rs:model}}\nlet user = User { name: 1 };\n{{#include examples/model.rs:1}}\n```\n")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedIncludes := []IncludedLines{
+		{File: "examples/model.rs", Line: 3, At: 1, Count: 3},
+		{File: "examples/model.rs", Line: 1, At: 5, Count: 1},
+	}
+
+	if len(snippets) != 1 || !reflect.DeepEqual(snippets[0].Includes, expectedIncludes) {
+		t.Fatalf("Unexpected snippets: %+v", snippets)
+	}
+
+	// The errors in the included lines are located in the file
+	snippetFile := filepath.Join(root, "chapter-1.rs")
+	code := provenanceHeader("chapter.md", snippets[0]) + snippets[0].Content
+
+	if err := os.WriteFile(snippetFile, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source := ManifestEntry{Includes: snippets[0].Includes, CodeLine: 2}
+	diagnostics := cargoDiagnostics{Diagnostics: []rustcDiagnostic{
+		{Message: "cannot find type `String`", Level: "error", Spans: []diagnosticSpan{
+			// Header, then the 7 lines of the wrapping main function
+			{FileName: "src/bin/chapter-1.rs", LineStart: 10, ColumnStart: 11, IsPrimary: true},
+		}},
+		{Message: "mismatched types", Level: "error", Spans: []diagnosticSpan{
+			{FileName: "src/bin/chapter-1.rs", LineStart: 12, ColumnStart: 30, IsPrimary: true},
+		}},
+	}}
+
+	located := checker.includedErrors(source, "chapter-1", snippetFile, diagnostics)
+
+	if !reflect.DeepEqual(located, []string{"examples/model.rs:4:11: cannot find type `String`"}) {
+		t.Errorf("Unexpected errors: %v", located)
+	}
+}
+
+func TestRustdocExamples(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"Cargo.toml":        "[package]\nname = \"tnuctipun\"\n",
+		"derive/Cargo.toml": "[package]\nname = \"tnuctipun-derive\"\n",
+		"src/lib.rs": `//! Crate docs
+//!
+//! ` + "```" + `
+//! # use tnuctipun::Path;
+//! let path = Path::new("a");
+//! ` + "```" + `
+
+/// A filter, e.g.
+///
+/// ` + "```no_run" + `
+/// let filter = doc! {};
+/// ` + "```" + `
+///
+/// ` + "```text" + `
+/// { "name": "Alice" }
+/// ` + "```" + `
+//// ` + "```" + `
+pub fn filter() {}
+`,
+		"derive/src/lib.rs": "/// ```rust,ignore\n/// #[derive(FieldWitnesses)]\n/// ```\npub fn derive() {}\n",
+		"derive/README.md":  "# Derive\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	crates := []CrateConfig{{Name: "tnuctipun", Path: root}, {Name: "tnuctipun-derive", Path: filepath.Join(root, "derive")}}
+	checker := NewDocChecker(&Config{ProjectRoot: root, Rustdoc: true, Crates: crates})
+
+	discovered, err := checker.findRustdocFiles()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFiles := []string{filepath.Join(root, "src", "lib.rs"), filepath.Join(root, "derive", "src", "lib.rs")}
+
+	sort.Strings(discovered)
+	sort.Strings(expectedFiles)
+
+	if !reflect.DeepEqual(discovered, expectedFiles) {
+		t.Fatalf("Unexpected files: %v", discovered)
+	}
+
+	markdown := rustdocMarkdown(files["src/lib.rs"])
+
+	if strings.Count(markdown, "\n") != strings.Count(files["src/lib.rs"], "\n") {
+		t.Errorf("The lines are not preserved:\n%s", markdown)
+	}
+
+	file := checker.loadFile(filepath.Join(root, "src", "lib.rs"))
+
+	if file.extractErr != nil {
+		t.Fatal(file.extractErr)
+	}
+
+	if len(file.snippets) != 2 {
+		t.Fatalf("Unexpected snippets: %+v", file.snippets)
+	}
+
+	if s := file.snippets[0]; s.StartLine != 3 || s.Content != "use tnuctipun::Path;\nlet path = Path::new(\"a\");" || s.Crate != "" {
+		t.Errorf("Unexpected snippet: %+v", s)
+	}
+
+	if s := file.snippets[1]; s.StartLine != 10 || !s.NoRun || s.Content != "let filter = doc! {};" {
+		t.Errorf("Unexpected snippet: %+v", s)
+	}
+
+	// Compiled against the crate of the source file
+	if file := checker.loadFile(filepath.Join(root, "derive", "src", "lib.rs")); len(file.snippets) != 1 ||
+		file.snippets[0].Crate != "tnuctipun-derive" || !file.snippets[0].Ignore {
+		t.Errorf("Unexpected snippets: %+v", file.snippets)
+	}
+
+	for info, expected := range map[string]string{
+		"":                   "rust",
+		"rust":               "rust",
+		"no_run":             "rust,no_run",
+		"compile_fail,E0308": "rust,compile_fail,E0308",
+		"edition2018":        "rust,edition2018",
+		"text":               "text",
+		"ignore,text":        "ignore,text",
+	} {
+		if actual := rustdocFenceInfo(info); actual != expected {
+			t.Errorf("%q: expected %q, got %q", info, expected, actual)
+		}
+	}
+}
+
+func TestAsciiDoc(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"examples/model.rs": "use serde::Deserialize;\n\n// tag::model[]\n#[derive(Deserialize)]\nstruct User {\n    name: String,\n}\n// end::model[]\n",
+		"docs/guide.adoc": `= Guide
+:source-language: rust
+
+[source,rust]
+----
+let filter = doc! { "name": "Alice" }; <1>
+----
+<1> A filter
+
+.The model
+[source,rust,no_run]
+----
+include::../examples/model.rs[tag=model]
+----
+
+[source]
+let a = 1;
+let b = 2;
+
+[source,toml]
+----
+a = 1
+----
+
+////
+[source,rust]
+----
+let commented = true;
+----
+////
+
+// doc-checker:off
+[source,rust]
+....
+let skipped = true;
+....
+// doc-checker:on
+
+----
+fn main() {}
+----
+`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	guide := filepath.Join(root, "docs", "guide.adoc")
+
+	if !isAsciiDoc(guide) || isAsciiDoc(filepath.Join(root, "README.md")) {
+		t.Fatal("Unexpected AsciiDoc detection")
+	}
+
+	checker := NewDocChecker(&Config{ProjectRoot: root})
+	file := checker.loadFile(guide)
+
+	if file.extractErr != nil {
+		t.Fatal(file.extractErr)
+	}
+
+	if strings.Count(file.content, "\n") != strings.Count(files["docs/guide.adoc"], "\n") {
+		t.Errorf("The lines are not preserved:\n%s", file.content)
+	}
+
+	type extracted struct {
+		line    int
+		content string
+		noRun   bool
+		skipped bool
+	}
+
+	var actual []extracted
+
+	for _, snippet := range file.snippets {
+		actual = append(actual, extracted{snippet.StartLine, snippet.Content, snippet.NoRun, snippet.Skipped})
+	}
+
+	expected := []extracted{
+		{5, `let filter = doc! { "name": "Alice" };`, false, false},
+		{12, "#[derive(Deserialize)]\nstruct User {\n    name: String,\n}", true, false},
+		{16, "let a = 1;\nlet b = 2;", false, false},
+		{34, "let skipped = true;", false, true},
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected snippets: %+v", actual)
+	}
+
+	for attrs, expected := range map[string]string{
+		"":                  "{{#include model.rs}}",
+		"tag=model":         "{{#include model.rs:model}}",
+		"lines=10..25":      "{{#include model.rs:10:25}}",
+		"lines=10..-1":      "{{#include model.rs:10:}}",
+		`lines="1..2;4..5"`: "{{#include model.rs:1..2;4..5}}",
+		"indent=0,lines=3":  "{{#include model.rs:3}}",
+	} {
+		if actual := asciidocInclude("model.rs", attrs); actual != expected {
+			t.Errorf("%s: expected %s, got %s", attrs, expected, actual)
+		}
+	}
+
+	// Several ranges are not supported
+	if _, _, err := selectLines("a\nb\n", "1..2;4..5", false); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestNotebook(t *testing.T) {
+	content := `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": [
+    "# Filters"
+   ]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": 1,
+   "metadata": {},
+   "outputs": [],
+   "source": [
+    ":dep tnuctipun = { path = \"..\" }\n",
+    "let filter = doc! { \"name\": \"Alice\" };"
+   ]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": null,
+   "metadata": {
+    "ignore": true
+   },
+   "outputs": [],
+   "source": [
+    "let pseudo = ...;"
+   ]
+  }
+ ],
+ "metadata": {
+  "kernelspec": {
+   "display_name": "Rust",
+   "language": "rust",
+   "name": "rust"
+  }
+ },
+ "nbformat": 4,
+ "nbformat_minor": 4
+}
+`
+	path := filepath.Join(t.TempDir(), "filters.ipynb")
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !isNotebook(path) || !isDocFile(path) {
+		t.Fatal("Unexpected notebook detection")
+	}
+
+	file := NewDocChecker(&Config{ProjectRoot: filepath.Dir(path)}).loadFile(path)
+
+	if file.extractErr != nil {
+		t.Fatal(file.extractErr)
+	}
+
+	if strings.Count(file.content, "\n") != strings.Count(content, "\n") {
+		t.Errorf("The lines are not preserved:\n%s", file.content)
+	}
+
+	// The lines of the code are the ones of the notebook
+	if len(file.snippets) != 2 || file.snippets[0].StartLine != 15 || file.snippets[0].Ignore ||
+		file.snippets[0].Content != "// :dep tnuctipun = { path = \"..\" }\nlet filter = doc! { \"name\": \"Alice\" };" ||
+		file.snippets[1].StartLine != 27 || !file.snippets[1].Ignore {
+		t.Errorf("Unexpected snippets: %+v", file.snippets)
+	}
+
+	// Without a Rust kernel, nothing is checked
+	python, err := notebookMarkdown(strings.ReplaceAll(content, `"rust"`, `"python"`))
+
+	if err != nil || strings.TrimSpace(python) != "" {
+		t.Errorf("Unexpected markdown: %q (%v)", python, err)
+	}
+
+	if _, err := notebookMarkdown("{"); err == nil {
+		t.Error("Expected an invalid notebook to be rejected")
+	}
+}
+
+func TestSnippetGraph(t *testing.T) {
+	checker := NewDocChecker(&Config{})
+	snippets, err := checker.extractRustSnippetsWithIDs("tutorial.md", "```rust,id=model\nstruct User;\n```\n\n"+
+		"```rust\nlet a = 1;\n```\n\n"+
+		"```rust,id=setup,requires=model\nlet user = User;\n```\n\n"+
+		"```rust,continues=setup,requires=\"model\"\nlet b = user;\n```\n")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edges := snippetGraphEdges(snippets)
+	expected := []graphEdge{{0, 2, "requires"}, {2, 3, "continues"}, {0, 3, "requires"}}
+
+	if !reflect.DeepEqual(edges, expected) {
+		t.Fatalf("Unexpected edges: %+v", edges)
+	}
+
+	files := []graphFile{{Path: "docs/tutorial.md", Snippets: snippets, Edges: edges}}
+
+	var dot bytes.Buffer
+	writeGraphDOT(&dot, files)
+
+	expectedDOT := `digraph snippets {
+  rankdir=LR;
+  node [shape=box];
+
+  subgraph cluster_0 {
+    label="docs/tutorial.md";
+    "docs/tutorial.md#model" [label="model (line 1)"];
+    "docs/tutorial.md#setup" [label="setup (line 9)"];
+    "docs/tutorial.md#auto_4" [label="auto_4 (line 13)"];
+    "docs/tutorial.md#model" -> "docs/tutorial.md#setup" [label=requires, style=dashed];
+    "docs/tutorial.md#setup" -> "docs/tutorial.md#auto_4" [label=continues];
+    "docs/tutorial.md#model" -> "docs/tutorial.md#auto_4" [label=requires, style=dashed];
+  }
+}
+`
+
+	if dot.String() != expectedDOT {
+		t.Errorf("Unexpected DOT:\n%s", dot.String())
+	}
+
+	var mermaid bytes.Buffer
+	writeGraphMermaid(&mermaid, files)
+
+	expectedMermaid := `flowchart LR
+  subgraph f0["docs/tutorial.md"]
+    f0_0["model (line 1)"]
+    f0_2["setup (line 9)"]
+    f0_3["auto_4 (line 13)"]
+    f0_0 -.->|requires| f0_2
+    f0_2 -->|continues| f0_3
+    f0_0 -.->|requires| f0_3
+  end
+`
+
+	if mermaid.String() != expectedMermaid {
+		t.Errorf("Unexpected Mermaid:\n%s", mermaid.String())
+	}
+}
+
+func TestDeterminismSnapshots(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "guide.md")
+
+	if err := os.WriteFile(path, []byte("# Guide\n\n```rust\nlet a = 1;\n```\n\n```rust,ignore\nlet b = ...;\n```\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewDocChecker(&Config{ProjectRoot: root, ExtractJobs: 2})
+	first := checker.extractionSnapshot(checker.loadFiles([]string{path, path}))
+
+	if len(first) != 4 || !strings.HasPrefix(first[0], "guide.md: auto_1 at lines 3-5, includes [], ignored false") {
+		t.Fatalf("Unexpected snapshot: %v", first)
+	}
+
+	if differences := diffSnapshots("extraction", first, checker.extractionSnapshot(checker.loadFiles([]string{path, path}))); differences != nil {
+		t.Errorf("Expected the same extraction, got %v", differences)
+	}
+
+	results := newResults()
+	results.Files[path] = FileResult{Snippets: []SnippetResult{
+		{ID: "auto_1", Status: "failed", Failure: &Failure{Category: "COMPILATION_ERROR", Codes: []string{"E0425"}}},
+		{ID: "ignored_2", Status: "ignored"},
+	}}
+
+	compiled := compilationSnapshot(results, root)
+
+	if !reflect.DeepEqual(compiled, []string{"guide.md: auto_1 failed (COMPILATION_ERROR [E0425])", "guide.md: ignored_2 ignored"}) {
+		t.Fatalf("Unexpected snapshot: %v", compiled)
+	}
+
+	flaky := []string{"guide.md: auto_1 valid", "guide.md: ignored_2 ignored"}
+	expected := []string{
+		"compilation: only in the first run: guide.md: auto_1 failed (COMPILATION_ERROR [E0425])",
+		"compilation: only in the second run: guide.md: auto_1 valid",
+	}
+
+	if differences := diffSnapshots("compilation", compiled, flaky); !reflect.DeepEqual(differences, expected) {
+		t.Errorf("Unexpected differences: %v", differences)
+	}
+
+	if differences := diffSnapshots("extraction", []string{"a", "b"}, []string{"b", "a"}); !reflect.DeepEqual(differences, []string{"extraction: the same snippets, in another order"}) {
+		t.Errorf("Unexpected differences: %v", differences)
+	}
+}
+
+func TestFrontmatter(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		content  string
+		expected FileSettings
+	}{
+		{"none", "# Title\n", FileSettings{}},
+		{"other keys", "---\ntitle: Dates\n---\n", FileSettings{}},
+		{
+			"flow",
+			"---\ntitle: Dates\ndoc_checker: { features: [\"chrono\", serde/derive], prelude: \"use tnuctipun::*;\" } # Dates\n---\n",
+			FileSettings{Features: []string{"chrono", "serde/derive"}, Prelude: []string{"use tnuctipun::*;"}},
+		},
+		{
+			"block",
+			"---\ndoc_checker:\n  features:\n    - chrono\n  prelude: []\n  ignore: 'Needs MongoDB'\n  ignore_codes: [E0433]\ntitle: Dates\n---\n",
+			FileSettings{Features: []string{"chrono"}, Prelude: []string{}, Ignore: true, IgnoreReason: "Needs MongoDB", IgnoreCodes: []string{"E0433"}},
+		},
+		{
+			"multi-line flow",
+			"---\ndoc_checker: {\n  features: [\n    chrono, # Dates\n    uuid,\n  ],\n  \"ignore_codes\": [E0433]\n}\n---\n",
+			FileSettings{Features: []string{"chrono", "uuid"}, IgnoreCodes: []string{"E0433"}},
+		},
+		{
+			"block scalar",
+			"---\n'doc_checker':\n  prelude: |\n    use tnuctipun::*;\n    use bson::doc;\n  ignore: >\n    Needs a\n    running MongoDB\n---\n",
+			FileSettings{Prelude: []string{"use tnuctipun::*;\nuse bson::doc;\n"}, Ignore: true, IgnoreReason: "Needs a running MongoDB"},
+		},
+		{"empty", "---\ndoc_checker:\n---\n", FileSettings{}},
+		{"invalid without settings", "---\ntitle: [Dates\n---\n", FileSettings{}},
+	} {
+		settings, err := parseFrontmatter(tc.content)
+
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		if !reflect.DeepEqual(settings, tc.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.expected, settings)
+		}
+	}
+
+	for content, expected := range map[string]string{
+		"---\ndoc_checker: { feature: [chrono] }\n---\n":           "unknown key doc_checker.feature (did you mean doc_checker.features?)",
+		"---\ndoc_checker: { features: [\"a b\"] }\n---\n":         "invalid doc_checker.features 'a b'",
+		"---\ndoc_checker: { ignore: [yes] }\n---\n":               "doc_checker.ignore must be true, false or a reason",
+		"---\ndoc_checker: { features: [chrono }\n---\n":           "expected ',' or ']'",
+		"---\ndoc_checker: true\n---\n":                            "doc_checker must be a mapping",
+		"---\ntitle: [Dates\ndoc_checker: { ignore: true }\n---\n": "frontmatter: invalid doc_checker",
+		"---\ndoc_checker: { ignore: true, ignore: false }\n---\n": "already defined",
+	} {
+		if _, err := parseFrontmatter(content); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected an error with %q, got %v", content, expected, err)
+		}
+	}
+
+	checker := NewDocChecker(&Config{})
+	content := "---\ndoc_checker:\n  features: [chrono]\n  ignore: Needs MongoDB\n  ignore_codes: [E0433]\n---\n\n```rust\nlet now = chrono::Utc::now();\n```\n"
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snippets) != 1 || snippets[0].ID != "ignored_1" || snippets[0].IgnoreReason != "Needs MongoDB" ||
+		!reflect.DeepEqual(snippets[0].Features, []string{"chrono"}) || !reflect.DeepEqual(snippets[0].IgnoreCodes, []string{"E0433"}) {
+		t.Errorf("Expected an ignored snippet with the settings of the file, got %+v", snippets)
+	}
+
+	if !checker.excludedByCodes([]string{"E0433"}, snippets[0].IgnoreCodes) || checker.excludedByCodes([]string{"E0433"}, nil) {
+		t.Error("Expected the failures with E0433 to be excluded only for the file")
+	}
+
+	manifest := Manifest{
+		"a": {Features: []string{"chrono"}},
+		"b": {},
+		"c": {Features: []string{"chrono"}},
+	}
+
+	if groups := manifest.byFeatures([]string{"a", "b", "c"}); !reflect.DeepEqual(groups, [][]string{{"b"}, {"a", "c"}}) {
+		t.Errorf("Expected the snippets grouped by features, got %v", groups)
+	}
+
+	crate := CrateConfig{Name: "tnuctipun", Path: "/project", Features: []string{"chrono", "serde/derive"}}
+
+	if dependency, _ := checker.crateDependency(crate); dependency != `{ path = "/project", features = ["chrono", "serde/derive"] }` {
+		t.Errorf("Unexpected dependency: %s", dependency)
+	}
+
+	if dir := checker.projectDir(0, crate); filepath.Base(dir) != "test_project_features_chrono_serde_derive" {
+		t.Errorf("Unexpected project directory: %s", dir)
+	}
+}
+
+func TestLineWidth(t *testing.T) {
+	wide := "let filter = User::filter().eq(user_fields::Name, \"Alice\");"
+	content := "```rust\n" + wide + "\n\tlet é = 1;\n```\n\n<!-- doc-checker:off -->\n```rust\n" + wide + "\n```\n<!-- doc-checker:on -->\n"
+
+	for _, tc := range []struct {
+		maxWidth int
+		expected string
+	}{
+		{0, "[]"},
+		{len(wide), "[]"},
+		{len(wide) - 1, "[2]"},
+		{12, "[2 3]"},
+	} {
+		checker := NewDocChecker(&Config{MaxLineWidth: tc.maxWidth})
+		snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checker.lintMarkdown("README.md", content, snippets)
+
+		lines := []int{}
+
+		for _, warning := range checker.results.Warnings {
+			if warning.Code == warnStyle {
+				lines = append(lines, warning.Line)
+			}
+		}
+
+		if fmt.Sprint(lines) != tc.expected {
+			t.Errorf("Width %d: expected the lines %s, got %v (%+v)", tc.maxWidth, tc.expected, lines, checker.results.Warnings)
+		}
+	}
+
+	if width := lineWidth("\tlet é = 1;  "); width != 14 {
+		t.Errorf("Expected a width of 14, got %d", width)
+	}
+}
+
+func TestShards(t *testing.T) {
+	for value, expected := range map[string]string{"2/4": "2/4", " 1 / 1 ": "1/1", "0/4": "", "5/4": "", "2": "", "a/b": ""} {
+		shard, err := parseShard(value)
+
+		if expected == "" && err == nil || expected != "" && (err != nil || shard.String() != expected) {
+			t.Errorf("--shard %q: expected %q, got %v (%v)", value, expected, shard, err)
+		}
+	}
+
+	counts := make(map[int]int)
+
+	for i := 1; i <= 100; i++ {
+		shard := snippetShard("docs/guide.md", fmt.Sprintf("auto_%d", i), 4)
+
+		if shard != snippetShard("docs/guide.md", fmt.Sprintf("auto_%d", i), 4) {
+			t.Fatal("Expected the shard of a snippet to be stable")
+		}
+
+		counts[shard]++
+	}
+
+	if len(counts) != 4 {
+		t.Errorf("Expected the snippets in the 4 shards, got %v", counts)
+	}
+
+	// Each shard checks one of the two snippets of the file
+	shardResults := func(index int, status [2]string, warning Warning) *Results {
+		results := newResults()
+		results.Shard = &ShardInfo{Index: index, Count: 2}
+		results.Summary.TotalSnippets, results.Summary.FilesProcessed = 2, 1
+		results.Warnings = []Warning{warning}
+		file := FileResult{SnippetsFound: 2, Errors: []string{}, Failures: []Failure{}}
+
+		for i, status := range status {
+			file.Snippets = append(file.Snippets, SnippetResult{ID: fmt.Sprintf("auto_%d", i+1), Line: 10 * (i + 1), Status: status})
+		}
+
+		if status[0] == "valid" {
+			results.Summary.ValidSnippets++
+			file.SnippetsValid++
+		} else {
+			results.Summary.FailedSnippets++
+			results.Summary.ErrorsByCode["E0425"]++
+			file.SnippetsFailed++
+			file.Failures = append(file.Failures, Failure{SnippetID: "auto_2", Line: 20, Category: "UNKNOWN_FIELD"})
+		}
+
+		results.Files["docs/guide.md"] = file
+
+		return results
+	}
+
+	lint := Warning{Code: warnDepDrift, Level: "warning", File: "docs/guide.md", Line: 3, Message: "bson"}
+	first := shardResults(1, [2]string{"valid", statusOtherShard}, lint)
+	second := shardResults(2, [2]string{statusOtherShard, "failed"}, lint)
+	second.Warnings = append(second.Warnings, Warning{Code: warnCompiler, Level: "warning", File: "docs/guide.md", Line: 10})
+	merged, err := mergeShardResults([]*Results{second, first})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := merged.Files["docs/guide.md"]
+	summary := merged.Summary
+
+	if summary.TotalSnippets != 2 || summary.ValidSnippets != 1 || summary.FailedSnippets != 1 || summary.FilesProcessed != 1 ||
+		summary.ErrorsByCode["E0425"] != 1 || summary.Warnings != 2 || merged.Verdict != verdictFailed || merged.Shard != nil {
+		t.Errorf("Unexpected merged results: %+v", merged)
+	}
+
+	if file.Snippets[0].Status != "valid" || file.Snippets[1].Status != "failed" || len(file.Failures) != 1 ||
+		file.SnippetsValid != 1 || file.SnippetsFailed != 1 || merged.Summary.FirstFailure == nil {
+		t.Errorf("Unexpected merged file: %+v", file)
+	}
+
+	for _, shards := range [][]*Results{{first}, {first, first, second}, {first, newResults()}} {
+		if _, err := mergeShardResults(shards); err == nil {
+			t.Errorf("Expected an error merging %d results", len(shards))
+		}
+	}
+}
+
+func TestExpectedOutput(t *testing.T) {
+	content := "```rust\nfn main() { println!(\"3\"); }\n```\n\n```text\n3\n```\n\n```rust\nlet x = 1;\n```\nNot right after.\n\n```text\nx\n```\n\n```rust\nfn main() {}\n```\n```console\n$ cargo run\nHello  \n\nWorld\n```\n"
+	snippets, err := (&DocChecker{}).extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil || len(snippets) != 3 {
+		t.Fatalf("Expected 3 snippets, got %+v (%v)", snippets, err)
+	}
+
+	for i, expected := range []struct {
+		output string
+		line   int
+	}{{"3", 5}, {"", 0}, {"Hello  \n\nWorld", 21}} {
+		if snippets[i].Expected != expected.output || snippets[i].ExpectedLine != expected.line {
+			t.Errorf("Snippet %d: expected the output %q (line %d), got %q (line %d)",
+				i+1, expected.output, expected.line, snippets[i].Expected, snippets[i].ExpectedLine)
+		}
+	}
+
+	// Only the trailing spaces and the surrounding blank lines are ignored
+	if diff := outputDiff("Hello  \n\nWorld", "\nHello\n\nWorld\n"); diff != "" {
+		t.Errorf("Expected the same output, got the diff:\n%s", diff)
+	}
+
+	diff := outputDiff("Hello\nWorld", "Hello\nthere\n")
+
+	if !strings.Contains(diff, "\n-World\n+there\n") || strings.Contains(diff, "+++") {
+		t.Errorf("Unexpected diff of the output:\n%s", diff)
+	}
+
+	// Without --check-output, the snippets are not run
+	checker := &DocChecker{config: &Config{}, manifest: Manifest{"README-1": {ExpectedOutput: "3", ExpectedLine: 5}}}
+
+	if failure, attempts := checker.checkRun(t.TempDir(), "README-1"); failure != nil || attempts != 0 {
+		t.Errorf("Expected no output check, got %+v (%d runs)", failure, attempts)
+	}
+
+	if categoryDescription(categoryOutputMismatch) == categoryDescription("COMPILATION_ERROR") {
+		t.Error("Expected OUTPUT_MISMATCH to be described")
+	}
+}
+
+func TestRun(t *testing.T) {
+	// A fake cargo, building a script printing the greeting of the snippet,
+	// or panicking or sleeping for the snippets using PANIC or SLEEP, or failing
+	// the first time it's run for the snippets using FLAKY
+	bin := t.TempDir()
+	script := `#!/bin/sh
+[ "$1" = "build" ] || exit 0
+while [ $# -gt 0 ]; do
+  [ "$1" = "--bin" ] && name=$2
+  shift
+done
+mkdir -p target
+exe="$PWD/target/$name"
+if grep -q PANIC src/bin/$name.rs; then
+  printf '#!/bin/sh\necho "thread main panicked at src/main.rs" >&2\nexit 101\n' > $exe
+elif grep -q SLEEP src/bin/$name.rs; then
+  printf '#!/bin/sh\necho started\nexec sleep 5\n' > $exe
+elif grep -q FLAKY src/bin/$name.rs; then
+  printf '#!/bin/sh\n[ -f flaky ] && exit 0\ntouch flaky\necho "connection reset" >&2\nexit 1\n' > $exe
+else
+  printf '#!/bin/sh\necho "Hello $GREETING"\n' > $exe
+fi
+chmod +x $exe
+echo "{\"reason\":\"compiler-artifact\",\"target\":{\"name\":\"$name\"},\"executable\":\"$exe\"}"
+`
+
+	if err := ioutil.WriteFile(filepath.Join(bin, "cargo"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := "```rust,env=\"GREETING=world\"\nlet x = 1;\n```\n\n" +
+		"```rust\nlet x = PANIC;\n```\n\n" +
+		"```rust,timeout=1\nlet x = SLEEP;\n```\n\n" +
+		"```rust,should_panic\nlet x = PANIC;\n```\n\n" +
+		"```rust,should_panic\nlet x = 1;\n```\n\n" +
+		"```rust,no_run\nlet x = SLEEP;\n```\n\n" +
+		"```rust,retries=2\nlet x = FLAKY;\n```\n"
+
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"tnuctipun\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	artifacts := filepath.Join(t.TempDir(), "artifacts")
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root, NoCache: true, NoSyntaxPrecheck: true, Run: true, RunTimeout: 30, ArtifactsDir: artifacts})
+	checker.ctx = context.Background()
+	checker.tempDir = t.TempDir()
+
+	if err := checker.processFile(file); err != nil {
+		t.Fatalf("Failed to process: %v", err)
+	}
+
+	start := time.Now()
+
+	if err := checker.compileSnippets(); err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+
+	// Killed after the timeout of the snippet, rather than --run-timeout
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("Expected the sleeping snippet to be killed after 1s, took %v", elapsed)
+	}
+
+	var outcomes []string
+
+	for _, snippet := range checker.results.Files[file].Snippets {
+		outcome := snippet.Status
+
+		if snippet.Failure != nil {
+			outcome += ":" + snippet.Failure.Category
+		}
+
+		outcomes = append(outcomes, outcome)
+	}
+
+	expected := "valid,failed:RUN_FAILED,failed:RUN_TIMEOUT,valid,failed:RUN_FAILED,valid,valid"
+
+	if strings.Join(outcomes, ",") != expected {
+		t.Errorf("Expected %s, got %v", expected, outcomes)
+	}
+
+	snippets := checker.results.Files[file].Snippets
+
+	// The output of each run snippet is reported, with the environment of the snippet
+	if run := snippets[0].Run; run == nil || run.ExitCode != 0 || run.Stdout != "Hello world\n" {
+		t.Errorf("Unexpected run of the valid snippet: %+v", run)
+	}
+
+	if run := snippets[1].Run; run == nil || run.ExitCode != 101 || !strings.Contains(run.Stderr, "panicked") {
+		t.Errorf("Unexpected run of the panicking snippet: %+v", run)
+	}
+
+	if !strings.Contains(snippets[1].Failure.Message, "panicked") {
+		t.Errorf("Expected the panic in the failure, got %q", snippets[1].Failure.Message)
+	}
+
+	if run := snippets[2].Run; run == nil || !run.TimedOut || run.Stdout != "started\n" {
+		t.Errorf("Unexpected run of the sleeping snippet: %+v", run)
+	}
+
+	if snippets[5].Run != nil {
+		t.Errorf("Expected the no_run snippet not to be run, got %+v", snippets[5].Run)
+	}
+
+	// Run from the work dir of the run, not from the (shared) target dir
+	if _, err := os.Stat(filepath.Join(checker.tempDir, "run", snippets[0].Snippet)); err != nil {
+		t.Errorf("Expected the executable in the work dir of the run: %v", err)
+	}
+
+	// The flaky snippet is run again (retries=2)
+	retries := checker.results.Files[file].Retries
+
+	if snippets[6].Attempts != 2 || len(retries) != 1 || retries[0].Attempts != 2 || !retries[0].Passed {
+		t.Errorf("Expected the flaky snippet to pass on its second run, got %d attempts (%+v)", snippets[6].Attempts, retries)
+	}
+
+	// The output and exit code of each run are written in the --artifacts-dir
+	run := snippets[1].Run
+	base := filepath.Join(artifacts, snippets[1].Snippet)
+
+	if run.StdoutFile != base+".stdout" || run.StderrFile != base+".stderr" || run.ExitFile != base+".exit" {
+		t.Errorf("Unexpected artifacts of the panicking snippet: %+v", run)
+	}
+
+	if data, err := ioutil.ReadFile(run.StderrFile); err != nil || !strings.Contains(string(data), "panicked") {
+		t.Errorf("Expected the panic in %s, got %q (%v)", run.StderrFile, data, err)
+	}
+
+	if data, err := ioutil.ReadFile(run.ExitFile); err != nil || string(data) != "101\n" {
+		t.Errorf("Expected the exit code in %s, got %q (%v)", run.ExitFile, data, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(artifacts, snippets[5].Snippet+".stdout")); err == nil {
+		t.Error("Expected no artifacts for the no_run snippet")
+	}
+
+	if _, err := parseFlags([]string{"--run", "--run-timeout", "0"}); err == nil {
+		t.Error("Expected an invalid --run-timeout to be rejected")
+	}
+
+	if _, err := parseFenceInfo("rust,timeout=0").timeout(); err == nil {
+		t.Error("Expected an invalid timeout= attribute to be rejected")
+	}
+}
+
+func TestClippy(t *testing.T) {
+	// A fake cargo, whose clippy reports the snippets using LINT, at the level it's given
+	bin := t.TempDir()
+	script := `#!/bin/sh
+[ "$1" = "clippy" ] || exit 0
+echo clippy >> clippy-runs
+level=warning
+case "$*" in *"-D clippy::all"*) level=error ;; esac
+for f in src/bin/*.rs; do
+  name=$(basename $f .rs)
+  grep -q LINT $f || continue
+  echo "{\"reason\":\"compiler-message\",\"target\":{\"name\":\"$name\"},\"message\":{\"level\":\"$level\",\"code\":{\"code\":\"clippy::needless_borrow\"},\"message\":\"this expression creates a reference which is immediately dereferenced by the compiler\",\"rendered\":\"$level: this expression creates a reference which is immediately dereferenced by the compiler\",\"spans\":[],\"children\":[]}}"
+  echo "{\"reason\":\"compiler-message\",\"target\":{\"name\":\"$name\"},\"message\":{\"level\":\"warning\",\"code\":{\"code\":\"unused_mut\"},\"message\":\"variable does not need to be mutable\",\"rendered\":\"warning: variable does not need to be mutable\",\"spans\":[],\"children\":[]}}"
+done
+[ $level = error ] && grep -q LINT src/bin/*.rs && exit 101
+exit 0
+`
+
+	if err := ioutil.WriteFile(filepath.Join(bin, "cargo"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := "```rust\nlet x = 1;\n```\n\n```rust\nlet x = foo(&LINT);\n```\n"
+
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"tnuctipun\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, level := range []string{clippyWarn, clippyDeny} {
+		checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root, NoCache: true, NoSyntaxPrecheck: true, Clippy: true, ClippyLevel: level})
+		checker.ctx = context.Background()
+		checker.tempDir = t.TempDir()
+
+		if err := checker.processFile(file); err != nil {
+			t.Fatalf("Failed to process: %v", err)
+		}
+
+		if err := checker.compileSnippets(); err != nil {
+			t.Fatalf("Failed to compile: %v", err)
+		}
+
+		snippets := checker.results.Files[file].Snippets
+
+		if snippets[0].Status != "valid" || snippets[0].ClippyLints != nil {
+			t.Errorf("Expected the first snippet to pass clippy at the %s level, got %+v", level, snippets[0])
+		}
+
+		// Only the lints of clippy, not the other warnings
+		lint := "this expression creates a reference which is immediately dereferenced by the compiler"
+
+		if level == clippyWarn {
+			if snippets[1].Status != "warnings" || len(snippets[1].ClippyLints) != 1 || !strings.Contains(snippets[1].ClippyLints[0], lint) {
+				t.Errorf("Expected the clippy lint as a warning, got %+v", snippets[1])
+			}
+
+			if len(checker.results.Warnings) != 1 || checker.results.Warnings[0].Code != warnClippy || checker.results.Warnings[0].Line != 5 {
+				t.Errorf("Unexpected warnings: %+v", checker.results.Warnings)
+			}
+		} else if snippets[1].Failure == nil || snippets[1].Failure.Category != categoryClippyLint || !strings.Contains(snippets[1].Failure.Message, lint) {
+			t.Errorf("Expected the snippet denied by clippy, got %+v", snippets[1])
+		}
+
+		// Once for the project
+		runs, err := ioutil.ReadFile(filepath.Join(checker.projectDir(0, checker.crates()[0]), "clippy-runs"))
+
+		if err != nil || strings.Count(string(runs), "clippy") != 1 {
+			t.Errorf("Expected clippy to run once, got %q (%v)", runs, err)
+		}
+	}
+}
+
+func TestToolchains(t *testing.T) {
+	// A fake rustup setup, without the beta toolchain, and whose stable
+	// toolchain doesn't compile the snippets using NIGHTLY
+	bin := t.TempDir()
+	rustc := `#!/bin/sh
+case "$1" in
+  +beta) echo "error: toolchain 'beta' is not installed" >&2; exit 1 ;;
+  +*) echo "rustc 1.80.0-${1#+}" ;;
+  *) echo "rustc 1.80.0" ;;
+esac
+`
+	cargo := `#!/bin/sh
+[ "$1" = "+stable" ] || exit 0
+echo "$CARGO_TARGET_DIR" > stable-target
+for f in src/bin/*.rs; do
+  name=$(basename $f .rs)
+  grep -q NIGHTLY $f && echo "{\"reason\":\"compiler-message\",\"target\":{\"name\":\"$name\"},\"message\":{\"level\":\"error\",\"code\":{\"code\":\"E0658\"},\"message\":\"use of unstable library feature\",\"rendered\":\"error[E0658]: use of unstable library feature\",\"spans\":[],\"children\":[]}}"
+done
+grep -q NIGHTLY src/bin/*.rs && exit 101
+exit 0
+`
+
+	for name, script := range map[string]string{"rustc": rustc, "cargo": cargo} {
+		if err := ioutil.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := "```rust\nlet x = 1;\n```\n\n```rust\nlet x = NIGHTLY;\n```\n\n```rust,compile_fail\nlet x: u8 = NIGHTLY;\n```\n"
+
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"tnuctipun\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	toolchains, err := parseToolchains("stable, beta,nightly,stable")
+
+	if err != nil || !reflect.DeepEqual(toolchains, []string{"stable", "beta", "nightly"}) {
+		t.Fatalf("Unexpected toolchains: %v (%v)", toolchains, err)
+	}
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root, NoCache: true, NoSyntaxPrecheck: true, Toolchains: toolchains})
+	checker.ctx = context.Background()
+	checker.tempDir = t.TempDir()
+
+	if err := checker.processFile(file); err != nil {
+		t.Fatalf("Failed to process: %v", err)
+	}
+
+	if err := checker.compileSnippets(); err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+
+	checker.checkToolchains()
+	checker.results.summarizeModes(checker.config)
+
+	matrix := checker.results.Summary.Toolchains
+
+	if len(matrix) != 3 {
+		t.Fatalf("Expected a result per toolchain, got %+v", matrix)
+	}
+
+	// The compile_fail snippet is not part of the matrix
+	stable := matrix[0]
+
+	if stable.Rustc != "rustc 1.80.0-stable" || stable.Checked != 2 || stable.Passed != 1 || stable.Failed != 1 ||
+		!reflect.DeepEqual(stable.FailedSnippets, []string{"README.md:5 (auto_2)"}) {
+		t.Errorf("Unexpected result for stable: %+v", stable)
+	}
+
+	if matrix[1].Toolchain != "beta" || matrix[1].Error == "" || matrix[1].Checked != 0 {
+		t.Errorf("Expected beta not to be available, got %+v", matrix[1])
+	}
+
+	if nightly := matrix[2]; nightly.Checked != 2 || nightly.Failed != 0 {
+		t.Errorf("Unexpected result for nightly: %+v", nightly)
+	}
+
+	projectDir := checker.projectDir(0, checker.crates()[0])
+
+	if target, _ := ioutil.ReadFile(filepath.Join(projectDir, "stable-target")); strings.TrimSpace(string(target)) != filepath.Join(projectDir, "target", "toolchains", "stable") {
+		t.Errorf("Unexpected target dir for stable: %s", target)
+	}
+
+	mode := checker.results.Modes[modeToolchains]
+
+	if mode.Passed || mode.Summary.Checked != 4 || mode.Summary.Failed != 2 || mode.Summary.ByCode["stable"] != 1 || checker.results.Verdict != verdictFailed {
+		t.Errorf("Unexpected toolchains mode: %+v (%s)", mode, checker.results.Verdict)
+	}
+}
+
+func TestFeaturesMatrix(t *testing.T) {
+	// A fake cargo, failing for the snippets using CHRONO without the chrono feature
+	bin := t.TempDir()
+	script := `#!/bin/sh
+grep -q '"chrono"' Cargo.toml && exit 0
+for f in src/bin/*.rs; do
+  name=$(basename $f .rs)
+  grep -q CHRONO $f && echo "{\"reason\":\"compiler-message\",\"target\":{\"name\":\"$name\"},\"message\":{\"level\":\"error\",\"code\":{\"code\":\"E0425\"},\"message\":\"cannot find value CHRONO in this scope\",\"rendered\":\"error[E0425]: cannot find value CHRONO in this scope\",\"spans\":[],\"children\":[]}}"
+done
+grep -q CHRONO src/bin/*.rs && exit 101
+exit 0
+`
+
+	if err := ioutil.WriteFile(filepath.Join(bin, "cargo"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := "```rust\nlet x = 1;\n```\n\n```rust\nlet d = CHRONO;\n```\n\n```rust,features=chrono\nlet d = CHRONO;\n```\n"
+
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"tnuctipun\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	matrix, err := parseFeaturesMatrix("default;chrono; uuid, chrono;chrono")
+
+	if err != nil || !reflect.DeepEqual(matrix, [][]string{{"default"}, {"chrono"}, {"uuid", "chrono"}}) {
+		t.Fatalf("Unexpected features matrix: %v (%v)", matrix, err)
+	}
+
+	if _, err := parseFeaturesMatrix("default;;chrono"); err == nil {
+		t.Error("Expected an empty feature set to be rejected")
+	}
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root, NoCache: true, NoSyntaxPrecheck: true, FeaturesMatrix: matrix})
+	checker.ctx = context.Background()
+	checker.tempDir = t.TempDir()
+
+	if err := checker.processFile(file); err != nil {
+		t.Fatalf("Failed to process: %v", err)
+	}
+
+	checker.checkFeaturesMatrix()
+	checker.results.summarizeModes(checker.config)
+
+	sets := checker.results.Summary.FeatureSets
+
+	if len(sets) != 3 {
+		t.Fatalf("Expected a result per feature set, got %+v", sets)
+	}
+
+	// The snippet with its own features is not part of the matrix
+	if sets[0].Features != "default" || sets[0].Checked != 2 || sets[0].Failed != 1 ||
+		!reflect.DeepEqual(sets[0].FailedSnippets, []string{"README.md:5 (auto_2)"}) {
+		t.Errorf("Unexpected result for the default features: %+v", sets[0])
+	}
+
+	for _, set := range sets[1:] {
+		if set.Checked != 2 || set.Passed != 2 || set.Error != "" {
+			t.Errorf("Unexpected result for the features %s: %+v", set.Features, set)
+		}
+	}
+
+	// Without the default features, unless the set has them
+	manifest, err := ioutil.ReadFile(filepath.Join(checker.tempDir, "features_matrix", "uuid_chrono", "Cargo.toml"))
+
+	if err != nil || !strings.Contains(string(manifest), `default-features = false, features = ["uuid", "chrono"] }`) {
+		t.Errorf("Unexpected manifest for uuid,chrono: %s (%v)", manifest, err)
+	}
+
+	mode := checker.results.Modes[modeFeatures]
+
+	if mode.Passed || mode.Summary.Checked != 6 || mode.Summary.ByCode["default"] != 1 {
+		t.Errorf("Unexpected features mode: %+v", mode)
+	}
+}
+
+func TestMarkdownSuggestions(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := "# Guide\n\n1. Count the users:\n\n   ```rust\n   # let users = vec![1];\n   let n = users.lenght();\n   ```\n\n" +
+		"```rust,no_main\nstruct User;\nimpl User { fn nme(&self) {} }\n```\n"
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root})
+	checker.tempDir = t.TempDir()
+
+	if err := checker.processFile(file); err != nil {
+		t.Fatalf("Failed to process: %v", err)
+	}
+
+	markdownLines := strings.Split(content, "\n")
+
+	for _, binName := range checker.manifest.binNames() {
+		source := checker.manifest[binName]
+		snippetFile := filepath.Join(checker.tempDir, binName+".rs")
+		generated, err := ioutil.ReadFile(snippetFile)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Located by the compiler in the binary, with its wrapping code
+		typo := map[int]string{5: "lenght", 10: "nme"}[source.StartLine]
+		wrapped := strings.Split(checker.wrapSnippet(string(generated), checker.crates()[0], source.NoMain), "\n")
+		binFile := "src/bin/" + binName + ".rs"
+		var suggestions []Suggestion
+
+		for line, text := range wrapped {
+			if column := strings.Index(text, typo); column >= 0 {
+				suggestions = append(suggestions, Suggestion{Replacement: "len", Line: line + 1, Column: column + 1, file: binFile})
+			}
+		}
+
+		// Neither in the wrapping code, nor in another file
+		suggestions = append(suggestions, Suggestion{Line: 2, Column: 1, file: binFile}, Suggestion{Line: 1, Column: 1, file: "src/lib.rs"})
+
+		located := checker.markdownSuggestions(source, binName, snippetFile, suggestions)
+		line := map[string]int{"lenght": 7, "nme": 12}[typo]
+
+		if len(located) != 1 || located[0].Line != line || located[0].Column != strings.Index(markdownLines[line-1], typo)+1 {
+			t.Errorf("Expected %s at line %d, column %d of the markdown file, got %+v",
+				typo, line, strings.Index(markdownLines[line-1], typo)+1, located)
+		}
+	}
+}
+
+func TestCompilerWarnings(t *testing.T) {
+	output := `{"reason":"compiler-message","target":{"name":"README-12"},"message":{"level":"warning","code":{"code":"unused_mut"},"message":"variable does not need to be mutable","rendered":"warning: variable does not need to be mutable\n --> src/bin/README-12.rs:9:5\n","spans":[{"file_name":"src/bin/README-12.rs","line_start":9,"line_end":9,"column_start":5,"column_end":10,"is_primary":true}],"children":[]}}
+{"reason":"compiler-message","target":{"name":"README-12"},"message":{"level":"warning","code":null,"message":"1 warning emitted","rendered":"warning: 1 warning emitted\n","spans":[],"children":[]}}
+{"reason":"compiler-message","target":{"name":"README-13"},"message":{"level":"warning","code":{"code":"dead_code"},"message":"unused","rendered":"warning: unused\n","spans":[{"file_name":"src/bin/README-13.rs","line_start":2,"line_end":2,"column_start":1,"column_end":4,"is_primary":true}],"children":[]}}
+`
+	diagnostics := parseCargoDiagnostics([]byte(output))
+	warnings := diagnostics.Warnings("README-12")
+
+	if !reflect.DeepEqual(warnings, []string{"warning: variable does not need to be mutable\n --> src/bin/README-12.rs:9:5"}) {
+		t.Fatalf("Unexpected warnings: %q", warnings)
+	}
+
+	checker := NewDocChecker(&Config{OutputFormat: "json"})
+	checker.manifest["README-12"] = ManifestEntry{File: "README.md", SnippetID: "R12", StartLine: 12}
+	checker.manifest["README-14"] = ManifestEntry{File: "README.md", SnippetID: "R14", StartLine: 30}
+	checker.results.Files["README.md"] = FileResult{Snippets: []SnippetResult{{ID: "R12"}, {ID: "R14"}}}
+
+	var cached []string
+	onValid := func(binName string) { cached = append(cached, binName) }
+
+	checker.completeValid("README-12", 1, 0, warnings, onValid)
+	checker.completeValid("README-14", 1, 0, diagnostics.Warnings("README-14"), onValid)
+
+	// Both valid, but only the one without warnings is cached
+	summary := checker.results.Summary
+
+	if summary.ValidSnippets != 2 || summary.WarnedSnippets != 1 || summary.Warnings != 1 || !reflect.DeepEqual(cached, []string{"README-14"}) {
+		t.Errorf("Unexpected summary: %+v (cached %v)", summary, cached)
+	}
+
+	snippets := checker.results.Files["README.md"].Snippets
+
+	if snippets[0].Status != "warnings" || !reflect.DeepEqual(snippets[0].CompilerWarnings, warnings) || snippets[1].Status != "valid" {
+		t.Errorf("Unexpected snippets: %+v", snippets)
+	}
+
+	warning := checker.results.Warnings[0]
+
+	if warning.Code != warnCompiler || warning.Line != 12 || warning.Message != "Snippet R12 compiled with a warning: variable does not need to be mutable" {
+		t.Errorf("Unexpected warning: %+v", warning)
+	}
+}
+
+func TestRunStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+
+	if runs, err := loadRunStats(path); err != nil || runs != nil {
+		t.Fatalf("Expected no stats, got %v (%v)", runs, err)
+	}
+
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	for i, durationMs := range []int64{8000, 2000, 4000, 60000} {
+		results := newResults()
+		results.Summary.TotalSnippets = 100 + i
+		results.Summary.CacheHits, results.Summary.CacheMisses = 3, 1
+		results.Verdict = verdictPassed
+
+		if i == 3 {
+			results.Verdict = verdictFailed
+		}
+
+		stats := newRunStats(results, start.Add(time.Duration(i)*time.Hour), time.Duration(durationMs)*time.Millisecond)
+
+		if err := appendRunStats(path, stats); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A partial line (e.g. interrupted write) is skipped
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(`{"started_at":`)
+	file.Close()
+
+	runs, err := loadRunStats(path)
+
+	if err != nil || len(runs) != 4 {
+		t.Fatalf("Expected 4 runs, got %d (%v)", len(runs), err)
+	}
+
+	summary := summarizeRunStats(path, runs)
+
+	if summary.Runs != 4 || summary.FailedRuns != 1 || !summary.Since.Equal(start) ||
+		summary.MedianDurationMs != 8000 || summary.P90DurationMs != 60000 || summary.MaxDurationMs != 60000 ||
+		summary.MedianSnippets != 102 || summary.CacheHitRate != 0.75 || !reflect.DeepEqual(summary.Versions, []string{version}) {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	root := t.TempDir()
+	srcFile := filepath.Join(root, "src", "lib.rs")
+
+	if err := os.MkdirAll(filepath.Dir(srcFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	treeHash := func() string {
+		hash := sha256.New()
+
+		if err := hashTree(hash, root, filepath.Join(root, "src")); err != nil {
+			t.Fatal(err)
+		}
+
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+
+	ioutil.WriteFile(srcFile, []byte("pub fn a() {}"), 0644)
+	before := treeHash()
+
+	if treeHash() != before {
+		t.Error("Expected a stable hash of the sources")
+	}
+
+	ioutil.WriteFile(srcFile, []byte("pub fn b() {}"), 0644)
+
+	if treeHash() == before {
+		t.Error("Expected the hash to change with the sources")
+	}
+
+	cache := &resultCache{dir: filepath.Join(root, "cache")}
+
+	if cache.passed("fn main() {}") {
+		t.Error("Expected a miss before the snippet is stored")
+	}
+
+	cache.store("fn main() {}")
+
+	if !cache.passed("fn main() {}") || cache.passed("fn main() { changed(); }") {
+		t.Error("Expected a hit only for the stored snippet")
+	}
+
+	compileErr := compileError{Category: "UNKNOWN_FIELD", Log: "error[E0609]", Message: "error[E0609]", Codes: []string{"E0609"}}
+	cache.storeFailure("README-3 README.md:3", "fn main() { x.y; }", compileErr)
+
+	if cached, failed := cache.failed("README-3 README.md:3", "fn main() { x.y; }"); !failed || !reflect.DeepEqual(cached, compileErr) {
+		t.Errorf("Expected the stored failure, got %+v", cached)
+	}
+
+	if _, failed := cache.failed("README-7 README.md:7", "fn main() { x.y; }"); failed {
+		t.Error("Expected a miss for the same code at another location")
+	}
+
+	var disabled *resultCache
+
+	disabled.store("fn main() {}")
+	disabled.storeFailure("README-3 README.md:3", "fn main() { x.y; }", compileErr)
+
+	if _, failed := disabled.failed("README-3 README.md:3", "fn main() { x.y; }"); disabled.passed("fn main() {}") || failed {
+		t.Error("Expected no hit with the cache disabled")
+	}
+}
+
+func TestWorkDir(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+
+	root := filepath.Join(t.TempDir(), "tnuctipun")
+
+	for key, valid := range map[string]bool{
+		"ci": true, "editor-1.2_x": true, "a..b": true,
+		".": false, "..": false, "../ci": false, "a/b": false, "/tmp": false, `a\b`: false, "a b": false,
+	} {
+		if isValidWorkKey(key) != valid {
+			t.Errorf("Expected the work key '%s' valid = %v", key, valid)
+		}
+
+		if valid {
+			continue
+		}
+
+		if workDir, err := NewDocChecker(&Config{ProjectRoot: root, WorkKey: key}).prepareWorkDir(); err == nil {
+			t.Errorf("Expected the work key '%s' to be rejected, got %s", key, workDir)
+		}
+	}
+
+	if entries, _ := os.ReadDir(filepath.Join(cacheDir, "doc-checker")); len(entries) != 0 {
+		t.Errorf("Expected nothing created for the invalid keys, got %v", entries)
+	}
+
+	// Reused across the runs with the same key, without the snippets of the previous run
+	first := NewDocChecker(&Config{ProjectRoot: root, WorkKey: "ci"})
+	workDir, err := first.prepareWorkDir()
+
+	if name, _ := projectDirName(root); err != nil || workDir != filepath.Join(cacheDir, "doc-checker", "work", name+"-ci") {
+		t.Fatalf("Unexpected work dir %s (%v)", workDir, err)
+	}
+
+	for _, file := range []string{"README-12.rs", filepath.Join("test_project", "src", "bin", "README-12.rs"), filepath.Join("test_project", "Cargo.lock")} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(workDir, file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(workDir, file), []byte("fn main() {}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Locked until the end of the run
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	waiting := NewDocChecker(&Config{ProjectRoot: root, WorkKey: "ci"})
+	waiting.ctx = ctx
+
+	if _, err := waiting.prepareWorkDir(); err == nil || ctx.Err() == nil {
+		t.Errorf("Expected to wait for the lock of the work dir, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(workDir, "README-12.rs")); err != nil {
+		t.Errorf("Expected the snippets of the running run to be kept: %v", err)
+	}
+
+	first.releaseWorkDir()
+
+	again := NewDocChecker(&Config{ProjectRoot: root, WorkKey: "ci"})
+
+	if dir, err := again.prepareWorkDir(); err != nil || dir != workDir {
+		t.Fatalf("Expected the same work dir, got %s (%v)", dir, err)
+	}
+
+	again.releaseWorkDir()
+
+	for file, kept := range map[string]bool{"README-12.rs": false, filepath.Join("test_project", "src", "bin", "README-12.rs"): false, filepath.Join("test_project", "Cargo.lock"): true, workDirLock: false} {
+		if _, err := os.Stat(filepath.Join(workDir, file)); (err == nil) != kept {
+			t.Errorf("Expected %s kept = %v (%v)", file, kept, err)
+		}
+	}
+
+	// The lock of a killed run is stale once it isn't refreshed anymore
+	if err := ioutil.WriteFile(filepath.Join(workDir, workDirLock), []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	staleTime := time.Now().Add(-2 * workLockStale)
+
+	if err := os.Chtimes(filepath.Join(workDir, workDirLock), staleTime, staleTime); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := NewDocChecker(&Config{ProjectRoot: root, WorkKey: "ci"})
+
+	if _, err := stale.prepareWorkDir(); err != nil {
+		t.Errorf("Expected the stale lock to be taken over: %v", err)
+	}
+
+	stale.releaseWorkDir()
+
+	// Isolated from the ones of the other keys, and of the other projects with the same key
+	other := NewDocChecker(&Config{ProjectRoot: root, WorkKey: "editor"})
+
+	if dir, err := other.prepareWorkDir(); err != nil || dir == workDir || filepath.Dir(dir) != filepath.Dir(workDir) {
+		t.Errorf("Expected another work dir for another key, got %s (%v)", dir, err)
+	}
+
+	other.releaseWorkDir()
+
+	otherRoot := filepath.Join(t.TempDir(), "tnuctipun")
+	otherProject := NewDocChecker(&Config{ProjectRoot: otherRoot, WorkKey: "ci"})
+
+	if dir, err := otherProject.prepareWorkDir(); err != nil || dir == workDir || filepath.Dir(dir) != filepath.Dir(workDir) {
+		t.Errorf("Expected another work dir for another project with the same key, got %s (%v)", dir, err)
+	}
+
+	otherProject.releaseWorkDir()
+
+	if _, err := os.Stat(filepath.Join(workDir, "test_project", "Cargo.lock")); err != nil {
+		t.Errorf("Expected the work dir of the key untouched by the other key: %v", err)
+	}
+}
+
+func TestSharedTargetDir(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+
+	root := filepath.Join(t.TempDir(), "tnuctipun")
+	checker := NewDocChecker(&Config{ProjectRoot: root})
+	checker.ctx = context.Background()
+
+	targetDir, err := checker.prepareTargetDir()
+
+	if err != nil || filepath.Dir(targetDir) != filepath.Join(cacheDir, "doc-checker", "target") ||
+		!strings.HasPrefix(filepath.Base(targetDir), "tnuctipun-") {
+		t.Fatalf("Unexpected target dir %s (%v)", targetDir, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(targetDir, targetDirStamp)); err != nil {
+		t.Errorf("Expected the stamp of the target dir: %v", err)
+	}
+
+	checker.targetDir = targetDir
+	env := checker.projectCargoCommand(t.TempDir(), "check").Env
+
+	if len(env) == 0 || env[len(env)-1] != "CARGO_TARGET_DIR="+targetDir {
+		t.Errorf("Expected the shared target dir, got %v", env)
+	}
+
+	// The same one for the same project, another one with --target-dir
+	if again, _ := NewDocChecker(&Config{ProjectRoot: root}).prepareTargetDir(); again != targetDir {
+		t.Errorf("Expected the same target dir, got %s", again)
+	}
+
+	custom := filepath.Join(t.TempDir(), "target")
+
+	if dir, _ := NewDocChecker(&Config{ProjectRoot: root, TargetDir: custom}).prepareTargetDir(); dir != custom {
+		t.Errorf("Expected the --target-dir, got %s", dir)
+	}
+
+	// One per work key, next to the one of the project (so collected the same way)
+	editor, err := NewDocChecker(&Config{ProjectRoot: root, WorkKey: "editor"}).prepareTargetDir()
+
+	if err != nil || editor != targetDir+"-editor" {
+		t.Errorf("Expected the target dir of the work key, got %s (%v)", editor, err)
+	}
+
+	if ci, _ := NewDocChecker(&Config{ProjectRoot: root, WorkKey: "ci"}).prepareTargetDir(); ci == editor || filepath.Dir(ci) != filepath.Dir(targetDir) {
+		t.Errorf("Expected another target dir for another work key, got %s", ci)
+	}
+
+	if _, err := os.Stat(filepath.Join(editor, targetDirStamp)); err != nil {
+		t.Errorf("Expected the stamp of the target dir of the work key: %v", err)
+	}
+
+	// Only the ones unused for long are collected
+	old := filepath.Join(filepath.Dir(targetDir), "old-1234abcd")
+
+	if err := os.MkdirAll(filepath.Join(old, "debug"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(old, "debug", "lib.rlib"), make([]byte, 1500), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lastUsed := time.Now().AddDate(0, 0, -40)
+
+	if err := os.Chtimes(old, lastUsed, lastUsed); err != nil {
+		t.Fatal(err)
+	}
+
+	collected, err := collectUnusedDirs(filepath.Dir(targetDir), time.Now().AddDate(0, 0, -30))
+
+	if err != nil || len(collected) != 1 || collected[0].Path != old || collected[0].Size != 1500 {
+		t.Fatalf("Expected the old target dir to be collected, got %+v (%v)", collected, err)
+	}
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("Expected the old target dir to be removed, got %v", err)
+	}
+
+	if _, err := os.Stat(targetDir); err != nil {
+		t.Errorf("Expected the target dir in use to be kept: %v", err)
+	}
+
+	// The result caches of the previous inputs are collected the same way
+	resultsRoot, err := resultCachesRoot()
+
+	if err != nil || resultsRoot != filepath.Join(cacheDir, "doc-checker", "results") {
+		t.Fatalf("Unexpected result caches root %s (%v)", resultsRoot, err)
+	}
+
+	staleCache := &resultCache{dir: filepath.Join(resultsRoot, "0123456789abcdef")}
+	staleCache.store("fn main() {}")
+
+	if err := os.Chtimes(staleCache.dir, lastUsed, lastUsed); err != nil {
+		t.Fatal(err)
+	}
+
+	usedCache := &resultCache{dir: filepath.Join(resultsRoot, "fedcba9876543210")}
+	usedCache.store("fn main() {}")
+
+	if err := ioutil.WriteFile(filepath.Join(usedCache.dir, targetDirStamp), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(usedCache.dir, lastUsed, lastUsed); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+
+	if code := runGC(&Config{MaxAgeDays: 30}, &output); code != 0 || !strings.Contains(output.String(), "Removed "+staleCache.dir+" (") || !strings.HasSuffix(output.String(), "in 0 target dir(s) and 1 result cache(s) unused for more than 30 days\n") {
+		t.Errorf("Expected the stale result cache to be collected, got %d:\n%s", code, output.String())
+	}
+
+	if _, err := os.Stat(staleCache.dir); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale result cache to be removed, got %v", err)
+	}
+
+	if !usedCache.passed("fn main() {}") {
+		t.Error("Expected the result cache in use (as per its stamp) to be kept")
+	}
+
+	if formatSize(1500) != "1.5 KB" || formatSize(999) != "999 B" || formatSize(2100000000) != "2.1 GB" {
+		t.Errorf("Unexpected sizes: %s, %s, %s", formatSize(1500), formatSize(999), formatSize(2100000000))
+	}
+}
+
+func TestCachedFailures(t *testing.T) {
+	// A fake cargo, failing (with E0425) for the snippets using FAIL, or to resolve
+	// the dependencies with BROKEN_DEPS, and counting the checks
+	bin := t.TempDir()
+	script := `#!/bin/sh
+[ "$1" = "-vV" ] && echo "rustc 1.80.0" && exit 0
+bins=""
+while [ $# -gt 0 ]; do
+  [ "$1" = "--bin" ] && bins="$bins src/bin/$2.rs" && echo "$2" >> checks
+  shift
+done
+[ -z "$bins" ] && bins=$(ls src/bin/*.rs)
+if [ -n "$BROKEN_DEPS" ]; then
+  echo "error: no matching package named 'bson' found"
+  exit 101
+fi
+status=0
+for f in $bins; do
+  grep -q FAIL $f || continue
+  printf '{"reason":"compiler-message","target":{"name":"%s"},"message":{"level":"error","code":{"code":"E0425"},"message":"cannot find value","rendered":"error[E0425]: cannot find value\\n","spans":[{"file_name":"%s","line_start":3,"line_end":3,"column_start":9,"column_end":13,"is_primary":true}],"children":[]}}\n' $(basename $f .rs) $f
+  status=101
+done
+exit $status
+`
+
+	for _, tool := range []string{"cargo", "rustc"} {
+		if err := ioutil.WriteFile(filepath.Join(bin, tool), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	content := "```rust\nlet x = 1;\n```\n\n```rust\nlet y = FAIL;\n```\n"
+
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"tnuctipun\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func() (*DocChecker, []string) {
+		checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root})
+		checker.ctx = context.Background()
+		checker.tempDir = t.TempDir()
+
+		if err := checker.processFile(file); err != nil {
+			t.Fatalf("Failed to process: %v", err)
+		}
+
+		if err := checker.compileSnippets(); err != nil {
+			t.Fatalf("Failed to compile: %v", err)
+		}
+
+		checks, _ := ioutil.ReadFile(filepath.Join(checker.projectDir(0, checker.crates()[0]), "checks"))
+
+		return checker, strings.Fields(string(checks))
+	}
+
+	// Not cached when the dependencies can't be resolved, e.g. the registry being unreachable
+	t.Setenv("BROKEN_DEPS", "1")
+
+	if broken, _ := run(); broken.results.Summary.FailedSnippets != 2 {
+		t.Fatalf("Expected the snippets to fail to resolve the dependencies, got %+v", broken.results.Summary)
+	}
+
+	t.Setenv("BROKEN_DEPS", "")
+
+	first, checks := run()
+
+	if first.results.Summary.FailedSnippets != 1 || first.results.Summary.CacheMisses != 2 || len(checks) != 2 {
+		t.Fatalf("Expected the snippets to be checked one by one, got %+v (%v)", first.results.Summary, checks)
+	}
+
+	// Neither the valid snippet nor the failing one are compiled again
+	second, checks := run()
+	failure := second.results.Files[file].Snippets[1].Failure
+
+	if second.results.Summary.FailedSnippets != 1 || second.results.Summary.CacheHits != 2 || len(checks) != 0 {
+		t.Errorf("Expected the outcomes from the cache, got %+v (%v)", second.results.Summary, checks)
+	}
+
+	if failure == nil || failure.Category != "COMPILATION_ERROR" || strings.Join(failure.Codes, ",") != "E0425" ||
+		!strings.Contains(failure.Message, "cannot find value") {
+		t.Errorf("Expected the cached failure, got %+v", failure)
+	}
+}
+
+func TestResultsSchema(t *testing.T) {
+	schema := resultsSchema()
+	defs := schema["$defs"].(map[string]interface{})
+
+	// Validates the required properties and the types (only what the schema uses)
+	var validate func(path string, value interface{}, s map[string]interface{})
+
+	validate = func(path string, value interface{}, s map[string]interface{}) {
+		if ref, ok := s["$ref"].(string); ok {
+			s = defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]interface{})
+		}
+
+		switch s["type"] {
+		case "object":
+			obj, ok := value.(map[string]interface{})
+
+			if !ok {
+				t.Errorf("%s: expected an object, got %v", path, value)
+				return
+			}
+
+			required, _ := s["required"].([]string)
+
+			for _, name := range required {
+				if _, exists := obj[name]; !exists {
+					t.Errorf("%s: missing required property %s", path, name)
+				}
+			}
+
+			properties, _ := s["properties"].(map[string]interface{})
+
+			for name, v := range obj {
+				if additional, ok := s["additionalProperties"].(map[string]interface{}); ok {
+					validate(path+"."+name, v, additional)
+				} else if property, ok := properties[name].(map[string]interface{}); ok {
+					validate(path+"."+name, v, property)
+				} else {
+					t.Errorf("%s: property %s not in the schema", path, name)
+				}
+			}
+
+		case "array":
+			list, ok := value.([]interface{})
+
+			if !ok {
+				t.Errorf("%s: expected an array, got %v", path, value)
+				return
+			}
+
+			for i, v := range list {
+				validate(fmt.Sprintf("%s[%d]", path, i), v, s["items"].(map[string]interface{}))
+			}
+
+		case "string", "integer", "boolean":
+			expected := map[string]string{"string": "string", "integer": "float64", "boolean": "bool"}[s["type"].(string)]
+
+			if actual := fmt.Sprintf("%T", value); actual != expected {
+				t.Errorf("%s: expected %s, got %s", path, s["type"], actual)
+			}
+		}
+	}
+
+	results := newResults()
+	results.Files["README.md"] = FileResult{
+		Errors: []string{"error"},
+		Failures: []Failure{{
+			Snippet: "README-1", Category: "SYNTAX_ERROR",
+			Suggestions: []Suggestion{{Message: "help", Replacement: "x", Line: 1, Column: 2}},
+		}},
+		Snippets: []SnippetResult{{
+			ID: "auto_1", Line: 1, EndLine: 3, Attributes: map[string]string{"retries": "1"},
+			Status: "failed", Snippet: "README-1", Attempts: 2, DurationMs: 120,
+			Failure: &Failure{Snippet: "README-1", Category: "SYNTAX_ERROR"},
+		}},
+		Retries: []SnippetAttempts{{SnippetID: "auto_1", Attempts: 2, Passed: true}},
+	}
+	results.Warnings = append(results.Warnings, Warning{Code: warnStaleIgnore, Level: "warning", Message: "stale"})
+	results.Parity = &ParityReport{RustdocOnly: []ParityItem{{Path: "a::b", Kind: "fn"}}, MarkdownOnly: []ParityItem{}}
+
+	content, err := json.Marshal(results)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var value interface{}
+
+	if err := json.Unmarshal(content, &value); err != nil {
+		t.Fatal(err)
+	}
+
+	validate("$", value, schema)
+
+	if value.(map[string]interface{})["schema_version"] != float64(schemaVersion) {
+		t.Errorf("Expected schema_version %d in the results", schemaVersion)
+	}
+}
+
+func TestExplainDiscovery(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-explain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, file := range []string{
+		"CONTRIBUTING.md",
+		"docs/guide.md",
+		"docs/target/generated.md",
+		"docs/notes.txt",
+	} {
+		fullPath := filepath.Join(tmpDir, file)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fullPath, []byte("test content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checker := NewDocChecker(&Config{
+		ProjectRoot: tmpDir,
+		Files:       []string{filepath.Join(tmpDir, "CONTRIBUTING.md"), filepath.Join(tmpDir, "docs")},
+		Community:   true,
+	})
+
+	entries, err := checker.ExplainDiscovery()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []DiscoveryEntry{
+		{File: "CONTRIBUTING.md", Included: true, Reason: discoveryExplicit},
+		{File: "CONTRIBUTING.md", Included: false, Reason: discoveryDuplicate},
+		{File: "docs/guide.md", Included: true, Reason: discoveryDirectory},
+		{File: "docs/target/generated.md", Included: false, Reason: discoveryTargetDir},
+	}
+
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d: %+v", len(expected), len(entries), entries)
+	}
+
+	for i, entry := range entries {
+		if entry.File != expected[i].File || entry.Included != expected[i].Included || entry.Reason != expected[i].Reason {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, expected[i], entry)
+		}
+	}
+
+	var output bytes.Buffer
+
+	if err := writeDiscovery(&output, entries, "human"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output.String(), "2 file(s) included, 2 excluded") {
+		t.Errorf("Expected the counts in the output, got:\n%s", output.String())
+	}
+}
+
+func TestBadge(t *testing.T) {
+	results := newResults()
+	results.Summary.TotalSnippets = 5
+	results.Summary.ValidSnippets = 4
+	results.Summary.FailedSnippets = 1
+
+	if badge := newBadge(results); badge.Message != "4/5 valid" || badge.Color != "red" {
+		t.Errorf("Unexpected badge for failures: %+v", badge)
+	}
+
+	results.Summary.ValidSnippets = 5
+	results.Summary.FailedSnippets = 0
+
+	if badge := newBadge(results); badge.Message != "5/5 valid" || badge.Color != "brightgreen" {
+		t.Errorf("Unexpected badge for valid snippets: %+v", badge)
+	}
+
+	path := filepath.Join(t.TempDir(), "docs-status.json")
+
+	if err := writeBadge(path, newResults()); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var badge map[string]interface{}
+
+	if err := json.Unmarshal(content, &badge); err != nil {
+		t.Fatal(err)
+	}
+
+	if badge["schemaVersion"] != float64(1) || badge["color"] != "lightgrey" {
+		t.Errorf("Unexpected badge without snippets: %s", content)
+	}
+}
+
+func TestLintOutdatedPaths(t *testing.T) {
+	content := "Intro\n\n```rust\n" + `use tnuctipun::{filters, update};
+use tnuctipun::updates::UpdateBuilder;
+# use tnuctipun::update::Hidden;
+let u = tnuctipun::update::UpdateBuilder::new();
+let v = my_tnuctipun::update::X;
+` + "```\n"
+
+	checker := NewDocChecker(&Config{
+		OutputFormat: "json",
+		Renames:      []PathRename{{Old: "tnuctipun::update", New: "tnuctipun::updates"}},
+	})
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil {
+		t.Fatalf("Failed to extract snippets: %v", err)
+	}
+
+	checker.lintMarkdown("test.md", content, snippets)
+
+	var lines []int
+
+	for _, warning := range checker.results.Warnings {
+		if warning.Code == warnOutdatedPath {
+			lines = append(lines, warning.Line)
+		}
+	}
+
+	if len(lines) != 3 || lines[0] != 4 || lines[1] != 6 || lines[2] != 7 {
+		t.Errorf("Expected outdated paths at lines 4, 6 and 7, got %v", checker.results.Warnings)
+	}
+}
+
+func TestTOMLBlocks(t *testing.T) {
+	root := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"tnuctipun\"\nversion = \"0.2.1\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "```toml\n[dependencies]\ntnuctipun = \"0.2\"\n```\n\n" +
+		"```toml\n[dependencies]\ntnuctipun = { version = \"0.3.0\" }\n```\n\n" +
+		"```toml\n[dependencies]\nserde = \"1.0\nbson = \"3\"\n```\n\n" +
+		"```toml,ignore\n[dependencies]\ntnuctipun = ...\n```\n\n" +
+		"```toml\n[package]\ndescription = \"\"\"\nA crate\"\"\"\nrust-version = \"1.70\"\n\n[package.metadata]\nratio = 0.5\n```\n"
+
+	checker := NewDocChecker(&Config{
+		OutputFormat: "json",
+		ProjectRoot:  root,
+		Crates:       []CrateConfig{{Name: "tnuctipun", Path: root}},
+	})
+
+	checker.lintMarkdown("test.md", content, nil)
+
+	var found []string
+
+	for _, warning := range checker.results.Warnings {
+		found = append(found, fmt.Sprintf("%s:%d", warning.Code, warning.Line))
+	}
+
+	// 0.2 matches 0.2.1, but not 0.3.0 (ahead), and the unterminated string is invalid
+	if fmt.Sprint(found) != "[CRATE_VERSION:8 INVALID_TOML:13]" {
+		t.Errorf("Unexpected warnings: %v", checker.results.Warnings)
+	}
+
+	for _, test := range []struct {
+		req, version string
+		same         bool
+	}{
+		{"0.2", "0.2.1", true},
+		{"=0.2.0", "0.2.1", true},
+		{"0.1.1", "0.2.0", false},
+		{"1", "1.4.0", true},
+		{"2", "1.4.0", false},
+		{">=0.1, <0.3", "0.2.0", true},
+	} {
+		if same := sameCompatibility(test.req, test.version); same != test.same {
+			t.Errorf("Expected sameCompatibility(%s, %s) = %v", test.req, test.version, test.same)
+		}
+	}
+}
+
+func TestFeatureNames(t *testing.T) {
+	root := t.TempDir()
+	manifest := "[package]\nname = \"tnuctipun\"\nversion = \"0.2.0\"\n\n" +
+		"[dependencies]\nchrono = { version = \"0.4\", optional = true }\nmongodb = { version = \"3\", optional = true }\n\n" +
+		"[features]\ndefault = []\nchrono = [\"dep:chrono\"]\ndriver = [\"dep:mongodb\"]\n"
+
+	if err := os.WriteFile(filepath.Join(root, "Cargo.toml"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	features, err := crateFeatures(CrateConfig{Name: "tnuctipun", Path: root})
+
+	if err != nil || fmt.Sprint(features) != "[chrono default driver]" {
+		t.Fatalf("Unexpected features of the crate: %v (%v)", features, err)
+	}
+
+	content := "Enable it with `features = [\"chrno\"]` (or `features = [\"...\"]`), or `serde = { version = \"1\", features = [\"derive\"] }`.\n\n" +
+		"```toml\n[dependencies]\ntnuctipun = { version = \"0.2\", features = [\"chrono\", \"mongodb\"] }\n" +
+		"\n[dependencies.tnuctipun-derive]\nversion = \"0.2\"\nfeatures = [\"extra\"]\n```\n\n" +
+		"```rust\nlet features = [\"nope\"];\n```\n"
+
+	checker := NewDocChecker(&Config{
+		OutputFormat: "json",
+		ProjectRoot:  root,
+		Crates:       []CrateConfig{{Name: "tnuctipun", Path: root}},
+	})
+
+	checker.lintMarkdown("test.md", content, nil)
+
+	var found []string
+
+	for _, warning := range checker.results.Warnings {
+		found = append(found, fmt.Sprintf("%d: %s", warning.Line, warning.Message))
+	}
+
+	// Not the features of serde, nor of tnuctipun-derive (not a documented crate here), nor in the Rust code
+	expected := []string{
+		"1: Feature chrno of tnuctipun doesn't exist (did you mean chrono?)",
+		"5: Feature mongodb of tnuctipun doesn't exist",
+	}
+
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected the unknown features %q, got %q", expected, found)
+	}
+}
+
+func TestContentRules(t *testing.T) {
+	doc, err := parseTOML("[content]\ntodo = \"\"\ninternal_host = 'mongo\\.corp\\.example\\.com'\n")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := loadContentRules(doc, defaultContentRules())
+
+	if err != nil || len(rules) != 3 || rules[0].Name != "home_path" || rules[2].Name != "internal_host" {
+		t.Fatalf("Unexpected content rules: %+v (%v)", rules, err)
+	}
+
+	doc, _ = parseTOML("[content]\nlocal_mongodb = \"(\"\n")
+
+	if _, err := loadContentRules(doc, defaultContentRules()); err == nil || !strings.Contains(err.Error(), "line 2: invalid pattern of the content rule local_mongodb") {
+		t.Errorf("Expected an invalid pattern, got %v", err)
+	}
+
+	content := "Connect to localhost:27017 (prose).\n\n" +
+		"```rust\nlet uri = \"mongodb://localhost:27017\"; // TODO\nlet path = \"/home/alice/data.json\";\n```\n\n" +
+		"```text\nmongo.corp.example.com\n```\n\n" +
+		"<!-- doc-checker:off -->\n```rust\nlet path = \"/Users/bob\";\n```\n<!-- doc-checker:on -->\n"
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", ContentRules: rules})
+	checker.lintMarkdown("test.md", content, nil)
+
+	var found []string
+
+	for _, warning := range checker.results.Warnings {
+		if warning.Code == warnContent {
+			found = append(found, fmt.Sprintf("%d: %s", warning.Line, warning.Message))
+		}
+	}
+
+	// Not in the prose, nor in the skipped region, and not the disabled TODO
+	expected := []string{
+		"4: Code block contains localhost:27017 (local_mongodb)",
+		"5: Code block contains /home/alice (home_path)",
+		"9: Code block contains mongo.corp.example.com (internal_host)",
+	}
+
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected the content warnings %q, got %q", expected, found)
+	}
+}
+
+func TestJSONBlocks(t *testing.T) {
+	for content, expected := range map[string]string{
+		`{"name": "Alice", "age": {"$gt": 18}}`: "",
+		"{\"a\": 1}\n{\"a\": 2}":                "",
+		`{"_id": {"$oid": "507f1f77bcf86cd799439011"}, "n": {"$numberLong": "42"}}`:         "",
+		`{"at": {"$date": "2024-01-02T03:04:05Z"}, "old": {"$date": {"$numberLong": "0"}}}`: "",
+		`{"data": {"$binary": {"base64": "AQID", "subType": "00"}}}`:                        "",
+		"{\n  \"a\": 1,\n}":                    "3:1 invalid character '}' looking for beginning of object key string",
+		"{\n  name: \"Alice\"\n}":              "2:3 invalid character 'n' looking for beginning of object key string",
+		"{\"a\": [1, 2}":                       "1:12 invalid character '}' after array element",
+		"{\"a\": 1":                            "1:8 unexpected end of JSON input",
+		"{\n  \"_id\": {\"$oid\": \"123\"}\n}": "2:17 invalid $oid: expected 24 hexadecimal digits",
+		`{"n": {"$numberLong": 42}}`:           "1:21 invalid $numberLong: expected a 64-bit integer as a string",
+		`{"at": {"$date": "yesterday"}}`:       "1:16 invalid $date: expected an ISO-8601 date (e.g. 2024-01-02T03:04:05Z)",
+		`{"n": {"$numberInt": "1", "x": 2}}`:   "1:20 $numberInt must be the only key of its object",
+	} {
+		err := checkEJSON(content)
+		found := ""
+
+		if err != nil {
+			before := content[:min(int(err.Offset), len(content))]
+			found = fmt.Sprintf("%d:%d %v", strings.Count(before, "\n")+1, len(before)-strings.LastIndex(before, "\n"), err)
+		}
+
+		if found != expected {
+			t.Errorf("JSON %q: expected %q, got %q", content, expected, found)
+		}
+	}
+
+	content := "Some documents:\n\n```json\n{\"a\": 1}\n{\"b\": 2,}\n```\n\n```json,ignore\n{ ... }\n```\n\n```js\n{ a: 1 }\n```\n"
+	checker := NewDocChecker(&Config{OutputFormat: "json"})
+	checker.lintMarkdown("test.md", content, nil)
+
+	if len(checker.results.Warnings) != 1 || checker.results.Warnings[0].Line != 5 ||
+		checker.results.Warnings[0].Message != "Invalid JSON block (column 9): invalid character '}' looking for beginning of object key string" {
+		t.Errorf("Expected an invalid JSON block at line 5, got %v", checker.results.Warnings)
+	}
+}
+
+func TestShellBlocks(t *testing.T) {
+	words := splitShellWords(`RUST_LOG=debug cargo run -- "a b" 2>&1 | tee out.log # run`)
+	var texts []string
+
+	for _, word := range words {
+		texts = append(texts, word.Text)
+	}
+
+	if !reflect.DeepEqual(texts, []string{"RUST_LOG=debug", "cargo", "run", "--", "a b", ">&1", "|", "tee", "out.log"}) {
+		t.Errorf("Unexpected words: %q", texts)
+	}
+
+	commands := shellCommands("sudo -E make install > /dev/null && ./configure", 1)
+
+	if len(commands) != 2 || commands[0].Words[commands[0].name()].Text != "make" ||
+		len(commands[0].Words) != 4 || commands[1].Words[commands[1].name()].Text != "./configure" {
+		t.Errorf("Unexpected commands: %v", commands)
+	}
+
+	root := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(root, "tools", "scripts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "tools", "scripts", "setup.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	content := strings.Join([]string{
+		"```sh",
+		"# Setup",
+		"cd tools && ./scripts/setup.sh",
+		"mongosh --eval 'db.stats()' && doc-checker-missing-tool \\",
+		"  --verbose",
+		"cat <<EOF > notes.txt",
+		"not-a-command here",
+		"EOF",
+		"echo done —quiet",
+		"./scripts/missing.sh",
+		"```",
+		"",
+		"```console",
+		"$ echo ok",
+		"Output which is-not checked",
+		"```",
+		"",
+		"```bash,ignore",
+		"doc-checker-missing-tool",
+		"```",
+	}, "\n")
+
+	checker := NewDocChecker(&Config{OutputFormat: "json", ProjectRoot: root, ShellCommands: []string{"mongosh"}})
+	checker.lintShellBlocks(filepath.Join(root, "README.md"), strings.Split(content, "\n"))
+
+	var found []string
+
+	for _, warning := range checker.results.Warnings {
+		found = append(found, fmt.Sprintf("%d %s %s", warning.Line, warning.Code, warning.Message))
+	}
+
+	expected := []string{
+		"4 UNKNOWN_COMMAND Command doc-checker-missing-tool not found (neither a builtin, in the PATH, nor in the [shell] commands of the configuration)",
+		"9 BROKEN_FLAG Flag —quiet of echo starts with a typographic dash (U+2014), instead of -",
+		"10 UNKNOWN_COMMAND Script ./scripts/missing.sh doesn't exist",
+	}
+
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected %q, got %q", expected, found)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	doc, err := parseTOML("[coverage]\n\"tnuctipun::filters\" = 1\n\"tnuctipun\" = 2\n")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policies, err := loadCoveragePolicies(doc)
+
+	if err != nil || len(policies) != 2 {
+		t.Fatalf("Unexpected policies: %v (%v)", policies, err)
+	}
+
+	if bad, _ := parseTOML("[coverage]\n\"tnuctipun\" = \"all\"\n"); bad != nil {
+		if _, err := loadCoveragePolicies(bad); err == nil {
+			t.Error("Expected an error for a policy which isn't an integer")
+		}
+	}
+
+	rustdoc := `{
+  "format_version": 39,
+  "index": {
+    "1": {"visibility": "public", "span": {"filename": "src/filters.rs", "begin": [19, 1]}},
+    "2": {"visibility": "public", "span": {"filename": "src/updates.rs", "begin": [9, 1]}},
+    "3": {"visibility": "public", "span": {"filename": "src/updates.rs", "begin": [1653, 1]}},
+    "4": {"visibility": "crate", "span": null},
+    "5": {"visibility": "public", "span": null}
+  },
+  "paths": {
+    "1": {"crate_id": 0, "path": ["tnuctipun", "filters", "FilterBuilder"], "kind": "struct"},
+    "2": {"crate_id": 0, "path": ["tnuctipun", "updates", "UpdateBuilder"], "kind": "struct"},
+    "3": {"crate_id": 0, "path": ["tnuctipun", "updates", "PushEachSlice"], "kind": "enum"},
+    "4": {"crate_id": 0, "path": ["tnuctipun", "Hidden"], "kind": "struct"},
+    "5": {"crate_id": 0, "path": ["tnuctipun", "updates", "set"], "kind": "function"},
+    "6": {"crate_id": 1, "path": ["bson", "Document"], "kind": "struct"}
+  }
+}`
+	file := filepath.Join(t.TempDir(), "tnuctipun.json")
+
+	if err := os.WriteFile(file, []byte(rustdoc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{RustdocJSON: []string{file}, CoveragePolicies: policies}
+	checker := NewDocChecker(config)
+	checker.codes = map[string]string{
+		"a": "let f: FilterBuilder<User> = filters::empty();",
+		"b": "let u: UpdateBuilder<User> = updates::empty();\nlet v: UpdateBuilder<User> = updates::empty();",
+		"c": "let u: UpdateBuilder<User> = 1;",
+	}
+	checker.validSnippets = []string{"a", "b", "c"}
+	checker.manifest = Manifest{"c": ManifestEntry{CompileFail: true}}
+
+	report, err := checker.checkCoverage()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []string
+
+	for _, typ := range report.Types {
+		found = append(found, fmt.Sprintf("%s %s %d/%d %s:%d", typ.Path, typ.Kind, typ.Examples, typ.Required, typ.File, typ.Line))
+	}
+
+	expected := []string{
+		"tnuctipun::filters::FilterBuilder struct 1/1 src/filters.rs:19",
+		"tnuctipun::updates::PushEachSlice enum 0/2 src/updates.rs:1653",
+		"tnuctipun::updates::UpdateBuilder struct 1/2 src/updates.rs:9",
+	}
+
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected %q, got %q", expected, found)
+	}
+
+	if len(report.Gaps) != 2 || report.Gaps[0].Path != "tnuctipun::updates::PushEachSlice" {
+		t.Errorf("Unexpected gaps: %v", report.Gaps)
+	}
+
+	results := newResults()
+	results.Coverage = report
+	results.summarizeModes(config)
+
+	if coverage := results.Modes[modeCoverage]; coverage.Passed || coverage.Summary.Failed != 2 || results.Verdict != verdictFailed {
+		t.Errorf("Expected the coverage mode to fail, got %+v (%s)", coverage, results.Verdict)
+	}
+}
+
+func TestSyntaxPrecheck(t *testing.T) {
+	valid := `fn longest<'a>(x: &'a str, y: &'a str) -> &'a str { if x.len() > y.len() { x } else { y } }
+
+/* A /* nested */ comment with an unbalanced ( */
+let chars = ['{', '\'', '\x1f', '\u{1F602}', b'(' as char];
+let raw = r#"A "raw" string with a ) "#;
+let r#type = "type";
+'outer: loop { break 'outer; }
+let s = "escaped \" quote ]";`
+
+	if err := checkRustSyntax(valid); err != nil {
+		t.Errorf("Unexpected syntax error: %+v", *err)
+	}
+
+	for code, expected := range map[string]string{
+		"fn main() {\n    let x = (1, 2;\n}":     "3:1 mismatched closing delimiter `}`",
+		"fn main() {\n    let x = vec![1, 2];\n": "1:11 unclosed delimiter `{`",
+		"let x = 1);":                            "1:10 unexpected closing delimiter `)`",
+		"let s = \"unterminated;\n}":             "1:9 unterminated string literal",
+		"let c = 'ab';":                          "1:9 character literal may only contain one codepoint",
+		"let x = 1; /* not closed":               "1:12 unterminated block comment",
+		"let v = vec![1, 2);":                    "1:18 mismatched closing delimiter `)`",
+	} {
+		found := ""
+
+		if err := checkRustSyntax(code); err != nil {
+			found = fmt.Sprintf("%d:%d %s", err.Line, err.Column, err.Message)
+		}
+
+		if found != expected {
+			t.Errorf("Code %q: expected %q, got %q", code, expected, found)
+		}
+	}
+
+	checker := NewDocChecker(&Config{})
+	checker.codes["guide-10"] = "fn main() {\n    let x = (1, 2;\n}"
+	checker.manifest["guide-10"] = ManifestEntry{File: "docs/guide.md", SnippetID: "auto_1", StartLine: 10, EndLine: 14}
+
+	failure := checker.precheckSyntax("guide-10")
+
+	if failure == nil || failure.Category != "SYNTAX_ERROR" || failure.Line != 10 ||
+		failure.Message != "docs/guide.md:13:1: mismatched closing delimiter `}`, for `(` at docs/guide.md:12:13 (found before compiling)" {
+		t.Errorf("Unexpected failure: %+v", failure)
+	}
+
+	checker.config.NoSyntaxPrecheck = true
+
+	if failure := checker.precheckSyntax("guide-10"); failure != nil {
+		t.Errorf("Expected no precheck with --no-syntax-precheck, got %+v", failure)
+	}
+}
+
+func TestSnippetIdentifiers(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "docs", "guide.md")
+	checker := NewDocChecker(&Config{ProjectRoot: root, SnippetNames: "path"})
+
+	named := Snippet{ID: "find_by_name", StartLine: 12, Attrs: map[string]string{"id": "find_by_name"}}
+
+	for snippet, expected := range map[*Snippet]string{
+		&named:                        "docs_guide-find_by_name",
+		{ID: "auto_2", StartLine: 30}: "docs_guide-30",
+		{ID: "42", StartLine: 50, Attrs: map[string]string{"id": "42"}}: "docs_guide-50",
+	} {
+		if name := checker.snippetBinName(file, *snippet); name != expected {
+			t.Errorf("Expected binary %s, got %s", expected, name)
+		}
+	}
+
+	// A binary already in the manifest, for another snippet, is not overwritten
+	checker.tempDir = t.TempDir()
+	checker.manifest["docs_guide-find_by_name"] = ManifestEntry{File: filepath.Join(root, "docs", "other.md"), SnippetID: "find_by_name", StartLine: 4}
+
+	if err := checker.writeSnippetFile(file, named); err == nil || err.Error() != "snippet at line 12: binary docs_guide-find_by_name is already the one of the snippet at docs/other.md:4 (see --snippet-names)" {
+		t.Errorf("Expected the collision of the binaries to be an error, got %v", err)
+	}
+
+	if entry := checker.manifest["docs_guide-find_by_name"]; entry.File != filepath.Join(root, "docs", "other.md") || len(checker.manifest) != 1 {
+		t.Errorf("Unexpected manifest: %+v", checker.manifest)
+	}
+
+	delete(checker.manifest, "docs_guide-find_by_name")
+
+	filters, err := parseSnippetFilters("find_*, docs/guide.md:auto_2")
+
+	if err != nil || len(filters) != 2 || filters[1].File != "docs/guide.md" {
+		t.Fatalf("Unexpected filters: %v (%v)", filters, err)
+	}
+
+	checker.config.Filter = filters
+
+	for id, expected := range map[string]bool{"find_by_name": true, "auto_2": true, "auto_3": false} {
+		if checker.selectedByFilter(file, Snippet{ID: id}) != expected {
+			t.Errorf("Expected %s selected = %v", id, expected)
+		}
+	}
+
+	if checker.selectedByFilter(filepath.Join(root, "README.md"), Snippet{ID: "auto_2"}) {
+		t.Error("Expected the snippet of another file not to be selected")
+	}
+
+	for _, invalid := range []string{":auto_1", "README.md:", "[a"} {
+		if _, err := parseSnippetFilters(invalid); err == nil {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+
+	// The failures of the run replace the ones of the checked snippets
+	baseline := filepath.Join(root, "baseline.json")
+
+	if known, err := loadBaseline(baseline, true); err != nil || known != nil {
+		t.Fatalf("Expected an empty baseline to update, got %v (%v)", known, err)
+	}
+
+	if _, err := loadBaseline(baseline, false); err == nil {
+		t.Error("Expected the missing baseline to be an error")
+	}
+
+	checker.manifest["docs_guide-find_by_name"] = ManifestEntry{File: file, SnippetID: "find_by_name"}
+	checker.config.KnownFailures = []BaselineEntry{
+		{File: "docs/guide.md", SnippetID: "find_by_name", Category: "COMPILATION_ERROR"},
+		{File: "README.md", SnippetID: "auto_1", Category: "COMPILATION_ERROR"},
+	}
+
+	failure := Failure{Snippet: "docs_guide-find_by_name", SnippetID: "find_by_name", Category: "COMPILATION_ERROR"}
+
+	if !checker.inBaseline(failure) {
+		t.Error("Expected the failure to be known")
+	}
+
+	failure.Category = "SYNTAX_ERROR"
+
+	if checker.inBaseline(failure) {
+		t.Error("Expected a failure of another category not to be known")
+	}
+
+	checker.failures = []BaselineEntry{checker.baselineEntry(failure)}
+
+	if err := checker.writeBaseline(baseline); err != nil {
+		t.Fatal(err)
+	}
+
+	known, err := loadBaseline(baseline, false)
+	expected := []BaselineEntry{
+		{File: "README.md", SnippetID: "auto_1", Category: "COMPILATION_ERROR"},
+		{File: "docs/guide.md", SnippetID: "find_by_name", Category: "SYNTAX_ERROR"},
+	}
+
+	if err != nil || !reflect.DeepEqual(known, expected) {
+		t.Errorf("Unexpected baseline: %v (%v)", known, err)
+	}
+}
+
+func TestCheckSnippetInput(t *testing.T) {
+	code, err := snippetCode(&Config{SnippetCode: "let x = 1;"}, strings.NewReader("ignored"))
+
+	if err != nil || code != "let x = 1;" {
+		t.Errorf("Expected the code of --code, got %q (%v)", code, err)
+	}
+
+	code, err = snippetCode(&Config{SnippetCode: "-"}, strings.NewReader("let y = 2;\n"))
+
+	if err != nil || code != "let y = 2;\n" {
+		t.Errorf("Expected the code from stdin, got %q (%v)", code, err)
+	}
+
+	if _, err := snippetCode(&Config{}, strings.NewReader(" \n")); err == nil {
+		t.Error("Expected an error without code")
+	}
+
+	crate := CrateConfig{Name: "tnuctipun"}
+
+	prelude, err := snippetPrelude(crate, "updates, filters::empty")
+
+	if err != nil || !reflect.DeepEqual(prelude, []string{"use tnuctipun::{updates, filters::empty};"}) {
+		t.Errorf("Unexpected prelude: %v (%v)", prelude, err)
+	}
+
+	if prelude, err := snippetPrelude(crate, ""); err != nil || prelude != nil {
+		t.Errorf("Expected the prelude of the crate without --prelude, got %v (%v)", prelude, err)
+	}
+
+	if _, err := snippetPrelude(crate, "updates,"); err == nil {
+		t.Error("Expected an error for an empty item")
+	}
+}
+
+func TestDependencyDrift(t *testing.T) {
+	root := t.TempDir()
+	manifest := `[package]
+name = "tnuctipun"
+version = "0.2.0"
+
+[dependencies]
+chrono = "0.4"
+bson = { version = "3.1.0", features = ["serde"] }
+
+[[bin]]
+name = "tool"
+`
+
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "```toml\n[dependencies]\ntnuctipun = \"0.1\"\nbson = { version = \"2\" }\nchrono = \"0.4.30\"\n" +
+		"\n[dev-dependencies.bson]\nversion = \"2.15\"\n```\n\n" +
+		"```rust deps=\"bson=2.0,rand=0.8\"\nfn main() {}\n```\n"
+
+	checker := NewDocChecker(&Config{
+		OutputFormat: "json",
+		ProjectRoot:  root,
+		Crates:       []CrateConfig{{Name: "tnuctipun", Path: root}},
+	})
+	snippets, err := checker.extractRustSnippetsWithIDs("README.md", content)
+
+	if err != nil || len(snippets) != 1 || len(snippets[0].Deps) != 2 || snippets[0].Deps[1].Req != "0.8" {
+		t.Fatalf("Unexpected snippets: %+v (%v)", snippets, err)
+	}
+
+	checker.lintMarkdown("test.md", content, snippets)
+
+	var lines []int
+
+	for _, warning := range checker.results.Warnings {
+		if warning.Code == warnDepDrift {
+			lines = append(lines, warning.Line)
+		}
+	}
+
+	// bson and [dev-dependencies.bson] (tnuctipun being a documented crate)
+	if len(lines) != 2 || lines[0] != 4 || lines[1] != 8 {
+		t.Errorf("Expected dependency drifts at lines 4 and 8, got %v", checker.results.Warnings)
+	}
+
+	// The deps= of the snippet on bson, provided by the generated project in another version
+	if warnings := checker.results.Warnings; len(warnings) == 0 || warnings[0].Code != warnProvidedDep || warnings[0].Line != 11 ||
+		warnings[0].Message != "Snippet auto_1 requires bson 2.0, but it's provided by the generated project in version 3.1.0, which can't be changed" {
+		t.Errorf("Expected the provided dependency to be reported, got %v", warnings)
+	}
+
+	// Unless compatible, then only the other ones are dependencies of the generated project (nor part of the cached code)
+	compatible := "```rust deps=\"bson=3,tnuctipun=0.2,tokio=1,rand=0.8\"\nfn main() {}\n```\n"
+
+	if snippets, err = checker.extractRustSnippetsWithIDs("README.md", compatible); err != nil || len(snippets) != 1 {
+		t.Fatalf("Unexpected snippets: %+v (%v)", snippets, err)
+	}
+
+	reported := len(checker.results.Warnings)
+	checker.lintMarkdown("test.md", compatible, snippets)
+
+	if warnings := checker.results.Warnings[reported:]; len(warnings) != 0 {
+		t.Errorf("Expected no warning for the compatible requirements, got %v", warnings)
+	}
+
+	checker.tempDir = t.TempDir()
+
+	if err := checker.writeSnippetFile(filepath.Join(root, "README.md"), snippets[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if deps := checker.manifest[checker.manifest.binNames()[0]].Deps; !reflect.DeepEqual(deps, []Dependency{{Name: "rand", Req: "0.8"}}) {
+		t.Errorf("Expected only the dependency not provided, got %+v", deps)
+	}
+
+	if checker.results.Summary.WarningsByCode[warnCrateVersion] != 1 {
+		t.Errorf("Expected tnuctipun = \"0.1\" not to match the current version, got %v", checker.results.Warnings)
+	}
+
+	for _, test := range []struct {
+		req, used string
+		behind    bool
+	}{
+		{"2", "3.1.0", true},
+		{"0.3", "0.4.4", true},
+		{"0.4", "0.4.4", false},
+		{"^1.0", "1.0.228", false},
+		{"4", "3.1.0", false},
+		{"0.0.1", "0.0.2", true},
+		{">=1, <2", "3.0", false},
+	} {
+		if behind := isBehind(test.req, test.used); behind != test.behind {
+			t.Errorf("Expected %s behind %s to be %v", test.req, test.used, test.behind)
+		}
+	}
+
+	if _, err := parseFenceInfo("rust,deps=rand").deps(); err == nil {
+		t.Error("Expected invalid deps to be rejected")
+	}
+
+	if _, err := parseFenceInfo("rust,deps=\"rand\\n=0.8\"").deps(); err == nil {
+		t.Error("Expected an invalid crate name to be rejected")
+	}
+}
+
+func TestSnippetDependencies(t *testing.T) {
+	checker := NewDocChecker(&Config{})
+	checker.manifest["README-1"] = ManifestEntry{Deps: []Dependency{{Name: "rand", Req: "0.7"}, {Name: "serde", Req: "1"}}}
+	checker.manifest["README-9"] = ManifestEntry{Deps: []Dependency{{Name: "rand", Req: "0.8"}, {Name: "futures", Req: "0.3"}}}
+	checker.manifest["README-20"] = ManifestEntry{Deps: []Dependency{{Name: "itertools", Req: "0.13"}}}
+
+	// Only the ones of the snippets of the project, but the dependencies it already has
+	dependencies := checker.snippetDependencies(CrateConfig{Name: "tnuctipun"}, []string{"/tmp/README-1.rs", "/tmp/README-9.rs"})
+
+	if expected := "futures = \"0.3\"\nrand = \"0.8\"\n"; dependencies != expected {
+		t.Errorf("Unexpected dependencies:\n%s", dependencies)
+	}
+
+	crate := CrateConfig{Name: "tnuctipun"}
+	checker.tempDir = t.TempDir()
+
+	for _, binName := range []string{"README-1", "README-9"} {
+		if err := ioutil.WriteFile(filepath.Join(checker.tempDir, binName+".rs"), []byte("let r = rand::random::<u8>();"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if checker.generatedCode("README-1", crate) == checker.generatedCode("README-9", crate) {
+		t.Error("Expected the dependencies to be part of the cached code")
+	}
+}
+
+func TestBlobLinks(t *testing.T) {
+	for remote, expected := range map[string]string{
+		"https://github.com/cchantep/tnuctipun.git":     "cchantep/tnuctipun",
+		"https://github.com/cchantep/tnuctipun":         "cchantep/tnuctipun",
+		"git@github.com:cchantep/tnuctipun.git":         "cchantep/tnuctipun",
+		"ssh://git@github.com/cchantep/tnuctipun.git\n": "cchantep/tnuctipun",
+		"https://gitlab.com/cchantep/tnuctipun.git":     "",
+		"https://github.com.example.org/a/b.git":        "",
+	} {
+		if repository, _ := githubRepository(remote); repository != expected {
+			t.Errorf("Expected '%s' for %s, got '%s'", expected, remote, repository)
+		}
+	}
+
+	root, err := filepath.EvalSymlinks(t.TempDir())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links := &blobLinks{baseURL: "https://github.com/cchantep/tnuctipun/blob/abc123", topLevel: root}
+
+	if link := links.link(filepath.Join(root, "docs", "guide.md"), 42); link != "https://github.com/cchantep/tnuctipun/blob/abc123/docs/guide.md#L42" {
+		t.Errorf("Unexpected link: %s", link)
+	}
+
+	if link := links.link(filepath.Join(filepath.Dir(root), "other.md"), 1); link != "" {
+		t.Errorf("Expected no link outside of the repository, got %s", link)
+	}
+
+	if link := (*blobLinks)(nil).link("README.md", 1); link != "" {
+		t.Errorf("Expected no link without repository, got %s", link)
+	}
+}
+
+func TestWriteReports(t *testing.T) {
+	root := t.TempDir()
+	workDir := t.TempDir()
+	reportDir := filepath.Join(t.TempDir(), "reports")
+
+	checker := NewDocChecker(&Config{ProjectRoot: root})
+	checker.tempDir = workDir
+	checker.manifest["docs_guide-3"] = ManifestEntry{File: filepath.Join(root, "docs", "guide.md"), SnippetID: "auto_1"}
+
+	if err := ioutil.WriteFile(filepath.Join(workDir, "docs_guide-3.rs"), []byte("let x = 1;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker.results.Files[filepath.Join(root, "README.md")] = FileResult{SnippetsFound: 1, SnippetsValid: 1, Failures: []Failure{}}
+	checker.results.Files[filepath.Join(root, "docs", "guide.md")] = FileResult{
+		SnippetsFound:  1,
+		SnippetsFailed: 1,
+		Failures:       []Failure{{Snippet: "docs_guide-3", SnippetID: "auto_1", Category: "TYPE_ERROR"}},
+	}
+	checker.results.Warnings = append(checker.results.Warnings,
+		Warning{Code: warnOversizedSnippet, File: filepath.Join(root, "docs", "guide.md"), Line: 3})
+
+	if err := checker.writeReports(reportDir); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(reportDir, "docs", "guide.md.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report FileReport
+
+	if err := json.Unmarshal(content, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.File != "docs/guide.md" || report.SnippetsFailed != 1 || len(report.Warnings) != 1 || report.SchemaVersion != schemaVersion {
+		t.Errorf("Unexpected report: %s", content)
+	}
+
+	source, err := os.ReadFile(filepath.Join(reportDir, "docs", "guide.md.failures", "docs_guide-3.rs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(source), "let x = 1;") || !strings.Contains(string(source), "fn main") {
+		t.Errorf("Expected the snippet as compiled, got:\n%s", source)
+	}
+
+	if _, err := os.Stat(filepath.Join(reportDir, "README.md.failures")); !os.IsNotExist(err) {
+		t.Errorf("Expected no failures directory for a valid file")
+	}
+}
+
+func TestRemapResults(t *testing.T) {
+	from := filepath.Join(os.TempDir(), "doc-checker-at-1", "project")
+	to := filepath.Join(os.TempDir(), "project")
+
+	if path, err := movePath(filepath.Join(to, "docs", "guide.md"), to, from); err != nil || path != filepath.Join(from, "docs", "guide.md") {
+		t.Errorf("Unexpected moved path: %s (%v)", path, err)
+	}
+
+	if _, err := movePath(filepath.Join(os.TempDir(), "other.md"), to, from); err == nil {
+		t.Error("Expected a path outside of the project to be rejected")
+	}
+
+	results := newResults()
+	results.Files[filepath.Join(from, "README.md")] = FileResult{SnippetsFound: 1}
+	results.Warnings = append(results.Warnings, Warning{Code: warnStaleIgnore, File: filepath.Join(from, "README.md")})
+	results.Warnings = append(results.Warnings, Warning{Code: warnToolchainSkew})
+	results.Summary.FirstFailure = &FailurePointer{File: filepath.Join(from, "README.md"), Line: 3}
+
+	remapResults(results, from, to)
+
+	if _, exists := results.Files[filepath.Join(to, "README.md")]; !exists || len(results.Files) != 1 {
+		t.Errorf("Unexpected remapped files: %v", results.Files)
+	}
+
+	if results.Warnings[0].File != filepath.Join(to, "README.md") || results.Warnings[1].File != "" {
+		t.Errorf("Unexpected remapped warnings: %v", results.Warnings)
+	}
+
+	if first := results.Summary.FirstFailure; first.File != filepath.Join(to, "README.md") || first.Line != 3 {
+		t.Errorf("Unexpected remapped first failure: %+v", first)
+	}
+}
+
+func TestTruncateError(t *testing.T) {
+	if message := truncateError("short", 500, ""); message != "short" {
+		t.Errorf("Unexpected truncation: %s", message)
+	}
+
+	if message := truncateError("long message", 0, ""); message != "long message" {
+		t.Errorf("Expected no truncation with 0, got: %s", message)
+	}
+
+	// Not within the 2 bytes of 'é'
+	if message := truncateError("café au lait", 4, ""); message != "caf... (truncated)" {
+		t.Errorf("Unexpected truncation: %s", message)
+	}
+
+	logDir := t.TempDir()
+	checker := NewDocChecker(&Config{ErrorLogDir: logDir})
+	logFile, err := checker.writeErrorLog("readme-12", "error[E0425]: cannot find value")
+
+	if err != nil || logFile != filepath.Join(logDir, "readme-12.log") {
+		t.Fatalf("Unexpected log file: %s (%v)", logFile, err)
+	}
+
+	if message := truncateError("error[E0425]: cannot find value", 5, logFile); message != "error... (truncated, full output in "+logFile+")" {
+		t.Errorf("Expected the log file in the message, got: %s", message)
+	}
+}
+
+func TestSnippetSelector(t *testing.T) {
+	snippets := []Snippet{
+		{ID: "auto_1", StartLine: 3, EndLine: 6},
+		{ID: "auto_2", StartLine: 10, EndLine: 12, Attrs: map[string]string{"id": "find_by_name"}},
+	}
+
+	for value, expected := range map[string]string{
+		"README.md:4":               "auto_1",
+		"README.md:12":              "auto_2",
+		"README.md:find_by_name":    "auto_2",
+		"docs/a.md:8":               "",
+		"docs/a.md:missing":         "",
+		"C:/docs/a.md:find_by_name": "auto_2",
+		"README.md:auto_x":          "",
+	} {
+		selector, err := parseSnippetSelector(value)
+
+		if err != nil {
+			t.Errorf("Failed to parse %s: %v", value, err)
+			continue
+		}
+
+		if snippet, found := selector.find(snippets); snippet.ID != expected || found != (expected != "") {
+			t.Errorf("Expected %s to select '%s', got '%s'", value, expected, snippet.ID)
+		}
+	}
+
+	// Positional identifiers, which designate other snippets at other revisions
+	for _, value := range []string{"README.md", "README.md:", ":12", "README.md:0", "README.md:auto_2", "README.md:ignored_1"} {
+		if _, err := parseSnippetSelector(value); err == nil {
+			t.Errorf("Expected %s to be rejected", value)
+		}
+	}
+}
+
+func TestWritePorcelain(t *testing.T) {
+	var output bytes.Buffer
+
+	results := newResults()
+	results.Summary = Summary{TotalSnippets: 12, ValidSnippets: 10, FailedSnippets: 2, FilesProcessed: 3, Warnings: 1, WarnedSnippets: 1}
+
+	writePorcelain(&output, results)
+
+	if expected := "total=12 valid=10 failed=2 files=3 skipped=0 warnings=1 warned=1 fingerprints=\n"; output.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, output.String())
+	}
+
+	// The fingerprints of the failures, in the order of the files
+	results.Files["docs/guide.md"] = FileResult{Failures: []Failure{{Fingerprint: "0a1b2c3d4e5f6a7b"}}}
+	results.Files["README.md"] = FileResult{Failures: []Failure{{Fingerprint: "3f9a0c1d52e8b7a4"}, {Fingerprint: "5e6f7a8b9c0d1e2f"}}}
+	output.Reset()
+
+	writePorcelain(&output, results)
+
+	if expected := "total=12 valid=10 failed=2 files=3 skipped=0 warnings=1 warned=1 fingerprints=3f9a0c1d52e8b7a4,5e6f7a8b9c0d1e2f,0a1b2c3d4e5f6a7b\n"; output.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, output.String())
+	}
+}
+
+func TestMessageCatalogs(t *testing.T) {
+	defer setLanguage("en")
+
+	// Every built-in catalog has the same messages, with the same verbs
+	verbs := func(text string) string {
+		var found []string
+
+		for _, part := range strings.Split(text, "%")[1:] {
+			if part != "" {
+				found = append(found, part[:1])
+			}
+		}
+
+		return strings.Join(found, "")
+	}
+
+	for lang, messages := range catalogs {
+		if len(messages) != len(catalogs["en"]) {
+			t.Errorf("Catalog %s has %d messages, instead of %d", lang, len(messages), len(catalogs["en"]))
+		}
+
+		for key, text := range messages {
+			if english, exists := catalogs["en"][key]; !exists || verbs(english) != verbs(text) {
+				t.Errorf("Message %s of catalog %s doesn't match the English one: %q", key, lang, text)
+			}
+		}
+	}
+
+	if err := setLanguage("fr"); err != nil || msg("summary.failed", 2) != "Extraits en échec : 2" {
+		t.Errorf("Unexpected French message: %s (%v)", msg("summary.failed", 2), err)
+	}
+
+	path := filepath.Join(t.TempDir(), "de.toml")
+	content := `[summary]
+failed = "Fehlgeschlagene Snippets: %d"
+
+[category]
+UNKNOWN_FIELD = "Verweise auf nicht existierende Felder"
+`
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setLanguage(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg("summary.failed", 2) != "Fehlgeschlagene Snippets: 2" || categoryDescription("UNKNOWN_FIELD") != "Verweise auf nicht existierende Felder" {
+		t.Errorf("Unexpected custom messages: %s, %s", msg("summary.failed", 2), categoryDescription("UNKNOWN_FIELD"))
+	}
+
+	// Not translated
+	if msg("summary.valid", 3) != "Valid snippets: 3" {
+		t.Errorf("Expected the English message as fallback, got: %s", msg("summary.valid", 3))
+	}
+
+	if err := ioutil.WriteFile(path, []byte("[summary]\nunknown = \"x\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setLanguage(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an unknown message to be rejected, got: %v", err)
+	}
+
+	if err := setLanguage("xx"); err == nil {
+		t.Error("Expected an unknown language to be rejected")
+	}
+}
+
+func containsString(s, substr string) bool {
+	return len(s) >= len(substr) && (s == substr ||
+		(len(s) > len(substr) && contains(s, substr)))
+}
+
+func contains(s, substr string) bool {
+	for i := 0; i <= len(s)-len(substr); i++ {
+		if s[i:i+len(substr)] == substr {
+			return true
+		}
+	}
+	return false
+}
+
+func TestServeRPC(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	// A fake cargo, compiling the snippets at once, but those using SLOW
+	bin := t.TempDir()
+	script := "#!/bin/sh\ngrep -q SLOW src/bin/*.rs 2>/dev/null && exec sleep 30\nexit 0\n"
+
+	for _, tool := range []string{"cargo", "rustc"} {
+		if err := ioutil.WriteFile(filepath.Join(bin, tool), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	root := t.TempDir()
+
+	if err := ioutil.WriteFile(filepath.Join(root, "Cargo.toml"), []byte("[package]\nname = \"tnuctipun\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	in, requests := io.Pipe()
+	replies, out := io.Pipe()
+	served := make(chan error, 1)
+
+	go func() {
+		served <- serveRPC(&Config{ProjectRoot: root, NoCache: true, NoSyntaxPrecheck: true}, in, out)
+		out.Close()
+	}()
+
+	var responses []map[string]interface{}
+	read := make(chan struct{})
+
+	go func() {
+		defer close(read)
+
+		scanner := bufio.NewScanner(replies)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+		for scanner.Scan() {
+			var response map[string]interface{}
+
+			if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+				t.Errorf("Invalid response %s: %v", scanner.Text(), err)
+			}
+
+			responses = append(responses, response)
+		}
+	}()
+
+	send := func(request string) {
+		if _, err := io.WriteString(requests, request+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Notifications, never answered
+	send(`{"jsonrpc":"2.0","method":"check_snippet","params":{"code":"let x = 1;"}}`)
+	send(`{"jsonrpc":"2.0","method":"ping"}`)
+
+	send(`{"jsonrpc":"2.0","id":"ok","method":"check_snippet","params":{"code":"let x = 1;"}}`)
+	send(`{"jsonrpc":"2.0","id":1,"method":"check_snippet","params":{"code":"let x = SLOW;"}}`)
+	send(`{"jsonrpc":"2.0","id":1,"method":"check_snippet","params":{"code":"let y = 2;"}}`)
+
+	// More checks than the reader used to buffer, still reading the cancel requests
+	for id := 2; id <= 300; id++ {
+		send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"check_snippet","params":{"code":"let x = 1;"}}`, id))
+	}
+
+	for id := 300; id >= 1; id-- {
+		send(fmt.Sprintf(`{"jsonrpc":"2.0","id":"cancel-%d","method":"cancel","params":{"id":%d}}`, id, id))
+	}
+
+	requests.Close()
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("Failed to serve: %v", err)
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatal("Expected the checks to be cancelled")
+	}
+
+	<-read
+
+	errorCodes := make(map[string][]float64) // of the responses to the checks, by request ID
+	var cancelled int
+
+	for _, response := range responses {
+		id := fmt.Sprint(response["id"])
+
+		if result, ok := response["result"].(map[string]interface{}); ok && strings.HasPrefix(id, "cancel-") {
+			if result["cancelled"] == true {
+				cancelled++
+			}
+		} else if rpcErr, ok := response["error"].(map[string]interface{}); ok {
+			errorCodes[id] = append(errorCodes[id], rpcErr["code"].(float64))
+		} else if summary := response["result"].(map[string]interface{})["summary"].(map[string]interface{}); id != "ok" || summary["valid_snippets"] != float64(1) {
+			t.Errorf("Unexpected result of %s: %v", id, summary)
+		}
+	}
+
+	// The check, the duplicate one, each of the 300 checks and its cancel
+	if len(responses) != 602 || cancelled != 300 {
+		t.Errorf("Expected 602 responses, with 300 cancelled checks, got %d (%d cancelled)", len(responses), cancelled)
+	}
+
+	if fmt.Sprint(errorCodes["1"]) != fmt.Sprint([]float64{rpcInvalidRequest, rpcRequestCancelled}) {
+		t.Errorf("Expected the duplicate request id to be rejected, got %v", errorCodes["1"])
+	}
+
+	for id := 2; id <= 300; id++ {
+		if codes := errorCodes[fmt.Sprint(id)]; len(codes) != 1 || codes[0] != rpcRequestCancelled {
+			t.Errorf("Expected the check %d to be cancelled, got %v", id, codes)
+		}
+	}
+
+	if _, answered := errorCodes["<nil>"]; answered {
+		t.Error("Expected the notifications not to be answered")
+	}
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const manifestFileName = "manifest.json"
+
+// ManifestEntry maps a generated snippet binary to its documentation source
+type ManifestEntry struct {
+	File        string          `json:"file"` // Markdown file, as processed
+	SnippetID   string          `json:"snippet_id"`
+	StartLine   int             `json:"start_line"`
+	EndLine     int             `json:"end_line"`
+	Retries     int             `json:"retries,omitempty"`
+	Timeout     int             `json:"timeout,omitempty"`      // Seconds it can run with --run (timeout= attribute)
+	CompileFail bool            `json:"compile_fail,omitempty"` // The compilation is expected to fail
+	ErrorCodes  []string        `json:"error_codes,omitempty"`  // Errors expected with compile_fail
+	NoRun       bool            `json:"no_run,omitempty"`       // Compiled but never run
+	NoMain      bool            `json:"no_main,omitempty"`      // Compiled as is, before an empty main function
+	ShouldPanic bool            `json:"should_panic,omitempty"` // Expected to panic when run
+	Edition     string          `json:"edition,omitempty"`      // Rust edition, if not the default one
+	Crate       string          `json:"crate"`                  // Documented crate the snippet is compiled against
+	Includes    []IncludedLines `json:"includes,omitempty"`     // Lines included from files (mdBook includes), or of the parts
+	Parts       int             `json:"parts,omitempty"`        // Number of fences of an example in parts (part=N/M)
+	CodeLine    int             `json:"code_line,omitempty"`    // Line of the snippet code in its file, with includes
+	Features    []string        `json:"features,omitempty"`     // Features of the crate enabled for the snippet
+	Deps        []Dependency    `json:"deps,omitempty"`         // Dependencies required by the snippet (deps= attribute)
+	Env         []string        `json:"env,omitempty"`          // Environment variables when run, as NAME=VALUE (env= attribute)
+	IgnoreCodes []string        `json:"ignore_codes,omitempty"` // Error codes of the failures excluded for the snippet
+	Unclosed    bool            `json:"unclosed,omitempty"`     // The closing fence is missing (MALFORMED_MARKDOWN)
+
+	ExpectedOutput string `json:"expected_output,omitempty"` // Output expected when run (--check-output)
+	ExpectedLine   int    `json:"expected_line,omitempty"`   // Line of the block of the expected output
+}
+
+// Manifest of the generated snippets, keyed by binary name
+// (written as manifest.json in the temporary directory)
+type Manifest map[string]ManifestEntry
+
+// binNames returns the names of the snippet binaries, sorted
+func (m Manifest) binNames() []string {
+	names := make([]string, 0, len(m))
+
+	for name := range m {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// byCrate groups the names of the snippet binaries by crate, sorted
+func (m Manifest) byCrate() map[string][]string {
+	groups := make(map[string][]string)
+
+	for _, name := range m.binNames() {
+		crate := m[name].Crate
+		groups[crate] = append(groups[crate], name)
+	}
+
+	return groups
+}
+
+// byFeatures groups the given snippet binaries by the features of their crate,
+// without features first, then in the order of the features
+func (m Manifest) byFeatures(binNames []string) [][]string {
+	var keys []string
+	groups := make(map[string][]string)
+
+	for _, name := range binNames {
+		key := strings.Join(m[name].Features, ",")
+
+		if _, exists := groups[key]; !exists {
+			keys = append(keys, key)
+		}
+
+		groups[key] = append(groups[key], name)
+	}
+
+	sort.Strings(keys)
+
+	result := make([][]string, len(keys))
+
+	for i, key := range keys {
+		result[i] = groups[key]
+	}
+
+	return result
+}
+
+// save writes the manifest as JSON in the given directory
+func (m Manifest) save(dir string) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, manifestFileName), content, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
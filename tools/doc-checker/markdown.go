@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// failureAnchor returns the anchor of the section of a failure in the markdown
+// summary (e.g. failure-3f2a9c1d0e4b5a6f), stable as its fingerprint
+func failureAnchor(failure Failure) string {
+	if failure.Fingerprint == "" {
+		return "failure-" + failure.Snippet
+	}
+
+	return "failure-" + failure.Fingerprint
+}
+
+// writeMarkdownSummary writes a compact summary of the results as markdown,
+// suitable to be appended to $GITHUB_STEP_SUMMARY
+func writeMarkdownSummary(w io.Writer, results *Results, projectRoot string) {
+	summary := results.Summary
+
+	status := msg("markdown.all_valid")
+
+	if summary.FailedSnippets > 0 {
+		status = msg("markdown.failed", summary.FailedSnippets)
+
+		if first := summary.FirstFailure; first != nil {
+			status += "\n\n" + msg("markdown.first_failure", relativeTo(projectRoot, first.File), first.Line, first.SnippetID, first.Category)
+		}
+	} else if errors := errorWarnings(results.Warnings); errors > 0 {
+		status = msg("markdown.as_errors", errors)
+	}
+
+	fmt.Fprintf(w, "## %s\n\n%s\n\n", msg("markdown.title"), status)
+
+	fmt.Fprintln(w, msg("markdown.counts"))
+	fmt.Fprintln(w, "|------:|---------:|------:|-------:|--------:|---------:|")
+	fmt.Fprintf(w, "| %d | %d | %d | %d | %d | %d |\n\n",
+		summary.FilesProcessed, summary.TotalSnippets, summary.ValidSnippets,
+		summary.FailedSnippets, summary.SkippedSnippets, summary.Warnings)
+
+	if len(summary.ErrorsByCategory) > 0 {
+		categories := make([]string, 0, len(summary.ErrorsByCategory))
+
+		for category := range summary.ErrorsByCategory {
+			categories = append(categories, category)
+		}
+
+		// Top categories first
+		sort.Slice(categories, func(i, j int) bool {
+			ci, cj := summary.ErrorsByCategory[categories[i]], summary.ErrorsByCategory[categories[j]]
+
+			if ci != cj {
+				return ci > cj
+			}
+
+			return categories[i] < categories[j]
+		})
+
+		fmt.Fprintln(w, msg("markdown.categories"))
+		fmt.Fprintln(w, "|----------------|------:|-------------|")
+
+		for _, category := range categories {
+			fmt.Fprintf(w, "| `%s` | %d | %s |\n",
+				category, summary.ErrorsByCategory[category], categoryDescription(category))
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	if len(summary.ErrorsByCode) > 0 {
+		fmt.Fprintln(w, msg("markdown.codes"))
+		fmt.Fprintln(w, "|------------|------:|")
+
+		for _, code := range sortedCodes(summary.ErrorsByCode) {
+			fmt.Fprintf(w, "| `%s` | %d |\n", code, summary.ErrorsByCode[code])
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	files := make([]string, 0, len(results.Files))
+
+	for file, result := range results.Files {
+		if len(result.Failures) > 0 {
+			files = append(files, file)
+		}
+	}
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		result := results.Files[file]
+		relPath := relativeTo(projectRoot, file)
+
+		fmt.Fprintf(w, "### %s\n\n", msg("markdown.file_failed", relPath, result.SnippetsFailed, result.SnippetsFound))
+
+		for _, failure := range result.Failures {
+			fmt.Fprintf(w, "<a id=\"%s\"></a>\n", failureAnchor(failure))
+			fmt.Fprintf(w, "<details>\n<summary><code>%s:%d</code> %s (%s)</summary>\n\n",
+				relPath, failure.Line, failure.Snippet, failure.Category)
+
+			// Use a fence longer than any backtick run in the log
+			fence := "```"
+
+			for strings.Contains(failure.Message, fence) {
+				fence += "`"
+			}
+
+			fmt.Fprintf(w, "%stext\n%s\n%s\n\n</details>\n\n",
+				fence, strings.TrimRight(failure.Message, "\n"), fence)
+		}
+	}
+
+	if len(results.Warnings) > 0 {
+		fmt.Fprintf(w, "### %s\n\n", msg("markdown.warnings", len(results.Warnings)))
+
+		for _, warning := range results.Warnings {
+			location := ""
+
+			if warning.File != "" {
+				location = fmt.Sprintf("<code>%s:%d</code> ", relativeTo(projectRoot, warning.File), warning.Line)
+			}
+
+			fmt.Fprintf(w, "- %s`%s`: %s\n", location, warning.Code, warning.Message)
+		}
+
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+// Modes of a run, each with its own summary in the results
+const (
+	modeCheck  = "check"  // Compilation of the snippets
+	modeLint   = "lint"   // Warnings about the markdown files (e.g. DEP_DRIFT)
+	modeParity = "parity" // Examples parity with the rustdoc ones (--parity)
+
+	modeCoverage   = "coverage"   // Examples of the public types, against the policy (--coverage)
+	modeToolchains = "toolchains" // Compilation of the snippets with other toolchains (--toolchains)
+	modeFeatures   = "features"   // Compilation of the snippets with other feature sets (--features-matrix)
+)
+
+// Modes in the order they run
+var modeNames = []string{modeCheck, modeToolchains, modeFeatures, modeLint, modeParity, modeCoverage}
+
+// Combined verdicts of the modes
+const (
+	verdictPassed = "passed"
+	verdictFailed = "failed"
+)
+
+// ModeResult is the outcome of a mode of the run
+type ModeResult struct {
+	Passed  bool        `json:"passed"`
+	Summary ModeSummary `json:"summary"`
+}
+
+// ModeSummary counts what a mode checked and found
+type ModeSummary struct {
+	Checked  int            `json:"checked"`  // Snippets (or files, for lint) checked by the mode
+	Failed   int            `json:"failed"`   // Findings failing the mode
+	Findings int            `json:"findings"` // Every finding, failing the mode or not
+	ByCode   map[string]int `json:"by_code,omitempty"`
+}
+
+// summarizeModes sets the results of each mode which ran, from the flat
+// summary, and the combined verdict: failed as soon as a mode failed
+func (r *Results) summarizeModes(config *Config) {
+	r.Summary.FirstFailure = r.firstFailure()
+	s := r.Summary
+
+	r.Modes = map[string]ModeResult{
+		modeCheck: {
+			Passed: s.FailedSnippets == 0,
+			Summary: ModeSummary{
+				Checked:  s.ValidSnippets + s.FailedSnippets,
+				Failed:   s.FailedSnippets,
+				Findings: s.FailedSnippets + s.ExcludedFailures,
+				ByCode:   s.ErrorsByCode,
+			},
+		},
+	}
+
+	lint := ModeSummary{
+		Checked:  s.FilesProcessed,
+		Findings: s.Warnings,
+		ByCode:   s.WarningsByCode,
+	}
+
+	if config.WarningsAsErrors {
+		lint.Failed = s.Warnings
+	}
+
+	r.Modes[modeLint] = ModeResult{Passed: lint.Failed == 0, Summary: lint}
+
+	// Only informative, so never failing
+	if r.Parity != nil {
+		r.Modes[modeParity] = ModeResult{
+			Passed: true,
+			Summary: ModeSummary{
+				Checked:  s.ValidSnippets + s.FailedSnippets,
+				Findings: len(r.Parity.RustdocOnly) + len(r.Parity.MarkdownOnly),
+			},
+		}
+	}
+
+	// Failing below the [coverage] policy, if any
+	if r.Coverage != nil {
+		r.Modes[modeCoverage] = ModeResult{
+			Passed: len(r.Coverage.Gaps) == 0,
+			Summary: ModeSummary{
+				Checked:  len(r.Coverage.Types),
+				Failed:   len(r.Coverage.Gaps),
+				Findings: len(r.Coverage.Gaps),
+			},
+		}
+	}
+
+	// Failing as soon as a snippet doesn't compile with a toolchain, or it's not available
+	if len(s.Toolchains) > 0 {
+		toolchains := matrixSummary{}
+
+		for _, result := range s.Toolchains {
+			toolchains.add(result.Toolchain, result.MatrixResult)
+		}
+
+		r.Modes[modeToolchains] = toolchains.result()
+	}
+
+	// Or with a feature set
+	if len(s.FeatureSets) > 0 {
+		features := matrixSummary{}
+
+		for _, result := range s.FeatureSets {
+			features.add(result.Features, result.MatrixResult)
+		}
+
+		r.Modes[modeFeatures] = features.result()
+	}
+
+	r.Verdict = verdictPassed
+
+	for _, mode := range r.Modes {
+		if !mode.Passed {
+			r.Verdict = verdictFailed
+		}
+	}
+}
+
+// matrixSummary sums up the configurations of a matrix (--toolchains,
+// --features-matrix), with their failures by configuration
+type matrixSummary ModeSummary
+
+// add counts a configuration, failing if its snippets could not be compiled
+func (m *matrixSummary) add(name string, result MatrixResult) {
+	if m.ByCode == nil {
+		m.ByCode = make(map[string]int)
+	}
+
+	m.Checked += result.Checked
+	m.Failed += result.Failed
+	m.ByCode[name] = result.Failed
+
+	if result.Error != "" {
+		m.Failed++
+	}
+}
+
+// result returns the mode of the matrix, failing as soon as a configuration failed
+func (m matrixSummary) result() ModeResult {
+	m.Findings = m.Failed
+
+	return ModeResult{Passed: m.Failed == 0, Summary: ModeSummary(m)}
+}
+
+// firstFailure returns the failure which comes first in the documentation
+// (by file, then line), if any
+func (r *Results) firstFailure() *FailurePointer {
+	var first *FailurePointer
+
+	for file, result := range r.Files {
+		for _, failure := range result.Failures {
+			if first == nil || file < first.File || file == first.File && failure.Line < first.Line {
+				first = &FailurePointer{
+					File:      file,
+					Line:      failure.Line,
+					SnippetID: failure.SnippetID,
+					Category:  failure.Category,
+				}
+			}
+		}
+	}
+
+	return first
+}
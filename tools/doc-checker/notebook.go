@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Directory of the copies of the notebooks saved by Jupyter, not checked
+const notebookCheckpoints = ".ipynb_checkpoints"
+
+// Key of the source of a cell, on its own line in a notebook saved by Jupyter
+var notebookSourceRegex = regexp.MustCompile(`^\s*"source"\s*:`)
+
+// notebook is the part of a Jupyter notebook (nbformat 4) read to check its Rust cells
+type notebook struct {
+	Metadata struct {
+		Kernelspec struct {
+			Name     string `json:"name"`
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+	Cells []notebookCell `json:"cells"`
+}
+
+type notebookCell struct {
+	CellType string          `json:"cell_type"`
+	Metadata map[string]any  `json:"metadata"`
+	Source   json.RawMessage `json:"source"` // Array of lines, or a string
+}
+
+// isNotebook checks whether a discovered file is a Jupyter notebook
+func isNotebook(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".ipynb")
+}
+
+// rustKernel checks whether the cells of a notebook are in Rust (e.g. with the evcxr kernel)
+func (n notebook) rustKernel() bool {
+	for _, name := range []string{n.Metadata.Kernelspec.Language, n.Metadata.Kernelspec.Name, n.Metadata.LanguageInfo.Name} {
+		if strings.EqualFold(name, "rust") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// source returns the code of a cell
+func (c notebookCell) source() string {
+	var lines []string
+
+	if err := json.Unmarshal(c.Source, &lines); err == nil {
+		return strings.Join(lines, "")
+	}
+
+	var source string
+	_ = json.Unmarshal(c.Source, &source)
+
+	return source
+}
+
+// notebookMarkdown returns the code cells of a notebook with a Rust kernel as
+// markdown code blocks (with the ignore attribute if the metadata of the cell
+// has "ignore": true), each other line being blank. As Jupyter saves each line
+// of a source on its own, the lines of the snippets are the ones of the notebook.
+// The evcxr commands (e.g. ":dep serde") are commented out, the dependencies
+// being the ones of the crates.
+func notebookMarkdown(source string) (string, error) {
+	var nb notebook
+
+	if err := json.Unmarshal([]byte(source), &nb); err != nil {
+		return "", fmt.Errorf("invalid notebook: %w", err)
+	}
+
+	lines := strings.Split(source, "\n")
+
+	// Line of the source of each cell, if they can be located (0-based)
+	var sourceLines []int
+
+	for i, line := range lines {
+		if notebookSourceRegex.MatchString(line) {
+			sourceLines = append(sourceLines, i)
+		}
+	}
+
+	if len(sourceLines) != len(nb.Cells) {
+		sourceLines = make([]int, len(nb.Cells))
+	}
+
+	for i := range lines {
+		lines[i] = ""
+	}
+
+	if !nb.rustKernel() {
+		return strings.Join(lines, "\n"), nil
+	}
+
+	next := 0 // First line free for a code block
+
+	for i, cell := range nb.Cells {
+		if cell.CellType != "code" {
+			continue
+		}
+
+		code := strings.Split(strings.TrimSuffix(cell.source(), "\n"), "\n")
+
+		for j, line := range code {
+			if strings.HasPrefix(line, ":") {
+				code[j] = "// " + line
+			}
+		}
+
+		info := "rust"
+
+		if ignore, _ := cell.Metadata["ignore"].(bool); ignore {
+			info += ",ignore"
+		}
+
+		// After the previous block if the cell can't be located
+		// (e.g. a source on a single line), so the lines are off
+		at := max(sourceLines[i], next)
+
+		block := append(append([]string{"```" + info}, code...), "```")
+
+		for len(lines) < at+len(block) {
+			lines = append(lines, "")
+		}
+
+		copy(lines[at:], block)
+		next = at + len(block)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
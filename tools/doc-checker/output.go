@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Error categories of the snippets run with --run or --check-output
+const (
+	categoryOutputMismatch = "OUTPUT_MISMATCH"
+	categoryRunFailed      = "RUN_FAILED"
+	categoryRunTimeout     = "RUN_TIMEOUT"
+)
+
+// expectedOutput returns the output expected from a snippet ending at the given
+// line (1-based, its closing fence): the content of the text or console block
+// right after it (only blank lines between them), and the line of its fence,
+// or 0 if the snippet is not followed by such a block
+func expectedOutput(lines []string, endLine int) (string, int) {
+	start := endLine
+
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+
+	if start >= len(lines) {
+		return "", 0
+	}
+
+	opening, isFence := parseCodeFence(lines[start])
+
+	if !isFence {
+		return "", 0
+	}
+
+	lang := parseFenceInfo(opening.info).Lang
+
+	if lang != "text" && lang != "console" {
+		return "", 0
+	}
+
+	var output []string
+
+	for _, line := range lines[start+1:] {
+		if opening.closedBy(line) {
+			break
+		}
+
+		content := opening.content(line)
+
+		// The commands of a console block (e.g. "$ cargo run") are not part of the output
+		if lang == "console" && (strings.HasPrefix(content, "$ ") || content == "$") {
+			continue
+		}
+
+		output = append(output, content)
+	}
+
+	return strings.Join(output, "\n"), start + 1
+}
+
+// normalizeOutput ignores the trailing spaces of the lines of an output,
+// and its leading and trailing blank lines
+func normalizeOutput(output string) string {
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// outputDiff returns the diff of the actual output of a snippet with the
+// expected one (- expected, + actual), or "" if they are the same
+func outputDiff(expected, actual string) string {
+	diff := unifiedDiff("output", normalizeOutput(expected)+"\n", normalizeOutput(actual)+"\n")
+
+	// Without the ---/+++ header, as both are the output
+	if _, hunks, found := strings.Cut(diff, "\n+++ b/output\n"); found {
+		return hunks
+	}
+
+	return diff
+}
+
+// runsSnippet tells whether a snippet which compiled is run: any of them with
+// --run, and the ones followed by an expected output with --check-output; never
+// the no_run, no_main and compile_fail ones
+func (dc *DocChecker) runsSnippet(binName string) bool {
+	source := dc.manifest[binName]
+
+	if source.NoRun || source.NoMain || source.CompileFail {
+		return false
+	}
+
+	if dc.config.Run {
+		return true
+	}
+
+	return dc.config.CheckOutput && source.ExpectedLine > 0 && !source.ShouldPanic
+}
+
+// snippetTimeout returns the time a snippet can run: its timeout= attribute,
+// or --run-timeout
+func (dc *DocChecker) snippetTimeout(binName string) time.Duration {
+	seconds := dc.manifest[binName].Timeout
+
+	if seconds == 0 {
+		seconds = dc.config.RunTimeout
+	}
+
+	if seconds < 1 {
+		seconds = 10
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// buildSnippet builds a snippet binary, and returns the path of its executable
+func (dc *DocChecker) buildSnippet(projectDir, binName string) (string, error) {
+	cmd := dc.projectCargoCommand(projectDir, "build", "--quiet", "--message-format=json", "--bin", binName)
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		return "", fmt.Errorf("build failed (%v):\n%s", err, strings.TrimRight(parseCargoDiagnostics(output).Rendered(), "\n"))
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var artifact struct {
+			Reason string `json:"reason"`
+			Target struct {
+				Name string `json:"name"`
+			} `json:"target"`
+			Executable string `json:"executable"`
+		}
+
+		if json.Unmarshal(scanner.Bytes(), &artifact) == nil && artifact.Reason == "compiler-artifact" &&
+			artifact.Target.Name == binName && artifact.Executable != "" {
+			return artifact.Executable, nil
+		}
+	}
+
+	return "", fmt.Errorf("no executable built for %s", binName)
+}
+
+// runExecutable copies the executable of a snippet built in the shared target
+// dir to the work dir of the run (run/BINARY), so it's not replaced while run
+// by the build of the same binary in a concurrent run
+func (dc *DocChecker) runExecutable(binName, built string) (string, error) {
+	content, err := os.ReadFile(built)
+
+	if err != nil {
+		return "", err
+	}
+
+	runDir := filepath.Join(dc.tempDir, "run")
+
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return "", err
+	}
+
+	executable := filepath.Join(runDir, binName+filepath.Ext(built))
+
+	// Not overwritten, in case the one of a previous run is still running
+	_ = os.Remove(executable)
+
+	if err := os.WriteFile(executable, content, 0755); err != nil {
+		return "", err
+	}
+
+	return executable, nil
+}
+
+// runSnippet runs a snippet binary (built first, so its timeout doesn't count
+// the build), killed if it runs longer than its timeout
+func (dc *DocChecker) runSnippet(projectDir, binName string) (SnippetRun, error) {
+	built, err := dc.buildSnippet(projectDir, binName)
+
+	if err != nil {
+		return SnippetRun{}, err
+	}
+
+	executable, err := dc.runExecutable(binName, built)
+
+	if err != nil {
+		return SnippetRun{}, fmt.Errorf("failed to copy the executable %s: %w", built, err)
+	}
+
+	ctx, cancel := context.WithTimeout(dc.ctx, dc.snippetTimeout(binName))
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, executable)
+	cmd.Dir = projectDir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// Not waiting for the processes it started, still holding its output, once killed
+	cmd.WaitDelay = time.Second
+
+	// The environment documented by the snippet, over the one of doc-checker
+	cmd.Env = append(os.Environ(), dc.manifest[binName].Env...)
+
+	start := time.Now()
+	err = cmd.Run()
+
+	if cmd.ProcessState == nil {
+		return SnippetRun{}, fmt.Errorf("failed to run %s: %w", executable, err)
+	}
+
+	return SnippetRun{
+		ExitCode:   cmd.ProcessState.ExitCode(),
+		DurationMs: time.Since(start).Milliseconds(),
+		TimedOut:   ctx.Err() == context.DeadlineExceeded && dc.ctx.Err() == nil,
+		Stdout:     stdout.String(),
+		Stderr:     stderr.String(),
+	}, nil
+}
+
+// writeRunArtifacts writes the full output and the exit code of a snippet run
+// in the --artifacts-dir directory, if any (e.g. README-12.stdout, README-12.stderr
+// and README-12.exit), and references these files from the run
+func (dc *DocChecker) writeRunArtifacts(binName string, run *SnippetRun) error {
+	if dc.config.ArtifactsDir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(dc.config.ArtifactsDir, 0755); err != nil {
+		return err
+	}
+
+	base := filepath.Join(dc.config.ArtifactsDir, binName)
+
+	for _, artifact := range []struct {
+		file    *string
+		path    string
+		content string
+	}{
+		{&run.StdoutFile, base + ".stdout", run.Stdout},
+		{&run.StderrFile, base + ".stderr", run.Stderr},
+		{&run.ExitFile, base + ".exit", fmt.Sprintf("%d\n", run.ExitCode)},
+	} {
+		if err := os.WriteFile(artifact.path, []byte(artifact.content), 0644); err != nil {
+			return err
+		}
+
+		*artifact.file = artifact.path
+	}
+
+	return nil
+}
+
+// checkRun runs a snippet which compiled, if it's run (see runsSnippet), up to N
+// more times with retries=N (e.g. for a timing-sensitive example talking to
+// MongoDB), and returns the failure of the last run, if any, with the number of runs
+func (dc *DocChecker) checkRun(projectDir, binName string) (*Failure, int) {
+	if !dc.runsSnippet(binName) {
+		return nil, 0
+	}
+
+	retries := dc.manifest[binName].Retries
+	attempts := 0
+
+	for {
+		attempts++
+		failure := dc.runOnce(projectDir, binName)
+
+		if failure == nil || attempts > retries || dc.ctx.Err() != nil {
+			return failure, attempts
+		}
+
+		dc.logWarning(fmt.Sprintf("Retrying the run of %s (attempt %d of %d): %s", binName, attempts+1, retries+1, failure.Category))
+	}
+}
+
+// runOnce runs a snippet, and returns the failure if it panics (or doesn't, with
+// should_panic), runs longer than its timeout, or doesn't print its expected
+// output (--check-output); nil otherwise
+func (dc *DocChecker) runOnce(projectDir, binName string) *Failure {
+	source := dc.manifest[binName]
+	run, err := dc.runSnippet(projectDir, binName)
+
+	if err != nil {
+		failure := dc.snippetFailure(binName, categoryRunFailed, fmt.Sprintf("Run failed: %v", err))
+		return &failure
+	}
+
+	if err := dc.writeRunArtifacts(binName, &run); err != nil {
+		dc.logWarning(fmt.Sprintf("Failed to write the run artifacts of %s: %v", binName, err))
+	}
+
+	stdout := run.Stdout
+	stderr := strings.TrimRight(run.Stderr, "\n")
+
+	run.Stdout = truncateError(run.Stdout, dc.config.MaxErrorBytes, "")
+	run.Stderr = truncateError(run.Stderr, dc.config.MaxErrorBytes, "")
+	dc.snippetRuns[binName] = run
+
+	var failure Failure
+
+	switch {
+	case run.TimedOut:
+		failure = dc.snippetFailure(binName, categoryRunTimeout,
+			fmt.Sprintf("Still running after %s, so killed:\n%s", dc.snippetTimeout(binName), stderr))
+
+	case source.ShouldPanic && run.ExitCode == 0:
+		failure = dc.snippetFailure(binName, categoryRunFailed, "Exited successfully, but expected to panic (should_panic)")
+
+	case source.ShouldPanic:
+		return nil
+
+	case run.ExitCode != 0:
+		failure = dc.snippetFailure(binName, categoryRunFailed,
+			fmt.Sprintf("Run failed (exit status %d):\n%s", run.ExitCode, stderr))
+
+	case !dc.config.CheckOutput || source.ExpectedLine == 0:
+		return nil
+
+	default:
+		diff := outputDiff(source.ExpectedOutput, stdout)
+
+		if diff == "" {
+			return nil
+		}
+
+		failure = dc.snippetFailure(binName, categoryOutputMismatch,
+			fmt.Sprintf("Output differs from the expected one at line %d (- expected, + actual):\n%s", source.ExpectedLine, strings.TrimRight(diff, "\n")))
+	}
+
+	return &failure
+}
+
+// completeCompiled completes a snippet which compiled successfully, as failed
+// if it's run (--run or --check-output) and fails, or doesn't print the expected
+// output, or if it's denied by clippy (--clippy); its attempts are its runs, if
+// it's run, or its compilation
+func (dc *DocChecker) completeCompiled(projectDir, binName string, duration time.Duration, warnings []string, onValid func(binName string)) {
+	failure, attempts := dc.checkRun(projectDir, binName)
+
+	if attempts == 0 {
+		attempts = 1
+	}
+
+	if failure == nil {
+		failure = dc.checkClippy(projectDir, binName)
+	}
+
+	dc.recordAttempts(binName, attempts, failure == nil)
+
+	if failure == nil {
+		dc.completeValid(binName, attempts, duration, warnings, onValid)
+		return
+	}
+
+	dc.recordFailure(*failure, attempts, duration)
+
+	dc.logError(fmt.Sprintf("Check failed after compiling %s (%s): %s", binName, failure.Category, colorDiff(failure.Message)))
+}
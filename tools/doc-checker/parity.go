@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ParityReport compares the examples of the markdown files
+// with the ones embedded in the rustdoc comments of the public items
+type ParityReport struct {
+	// Items with a rustdoc example, but not used in any markdown snippet
+	RustdocOnly []ParityItem `json:"rustdoc_only"`
+
+	// Items used in markdown snippets, but without rustdoc example
+	MarkdownOnly []ParityItem `json:"markdown_only"`
+}
+
+// ParityItem is a public item of the documented crates
+type ParityItem struct {
+	Path string `json:"path"` // e.g. tnuctipun::filters::FilterBuilder::eq
+	Kind string `json:"kind"` // fn, struct, enum, trait, type, const, static, macro or derive
+	File string `json:"file"`
+	Line int    `json:"line"`
+
+	name       string // Unqualified name (possibly raw, e.g. "r#in")
+	owner      string // Type of the impl block, for the methods
+	hasExample bool   // Whether its rustdoc has a code block
+}
+
+var (
+	publicItemRegex   = regexp.MustCompile(`^\s*pub\s+(?:(?:async|const|unsafe)\s+)*(fn|struct|enum|trait|type|const|static)\s+((?:r#)?[A-Za-z_][A-Za-z0-9_]*)`)
+	macroRulesRegex   = regexp.MustCompile(`^\s*macro_rules!\s*([A-Za-z_][A-Za-z0-9_]*)`)
+	deriveMacroRegex  = regexp.MustCompile(`^\s*#\[proc_macro_derive\(\s*([A-Za-z_][A-Za-z0-9_]*)`)
+	implBlockRegex    = regexp.MustCompile(`^impl\b`)
+	implTypeNameRegex = regexp.MustCompile(`^(?:[A-Za-z_][A-Za-z0-9_]*::)*([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+// checkParity scans the public items of the crates in the project,
+// and reports the ones documented with examples in only one place
+// (rustdoc or markdown snippets)
+func (dc *DocChecker) checkParity(snippets []string) (*ParityReport, error) {
+	items, err := dc.scanPublicItems()
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ParityReport{
+		RustdocOnly:  []ParityItem{},
+		MarkdownOnly: []ParityItem{},
+	}
+
+	markdown := strings.Join(snippets, "\n")
+
+	for _, item := range items {
+		inMarkdown := item.referencedIn(markdown)
+
+		if item.hasExample && !inMarkdown {
+			report.RustdocOnly = append(report.RustdocOnly, item)
+		} else if !item.hasExample && inMarkdown {
+			report.MarkdownOnly = append(report.MarkdownOnly, item)
+		}
+	}
+
+	return report, nil
+}
+
+// crateDirs returns the directories of the project crate,
+// and of the crates in its direct subdirectories (e.g. tnuctipun-derive/)
+func (dc *DocChecker) crateDirs() ([]string, error) {
+	crateDirs := []string{dc.config.ProjectRoot}
+	entries, err := os.ReadDir(dc.config.ProjectRoot)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "target" || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		dir := filepath.Join(dc.config.ProjectRoot, entry.Name())
+
+		if _, err := os.Stat(filepath.Join(dir, "Cargo.toml")); err == nil {
+			crateDirs = append(crateDirs, dir)
+		}
+	}
+
+	return crateDirs, nil
+}
+
+// scanPublicItems finds the public items in the sources of the project crates
+func (dc *DocChecker) scanPublicItems() ([]ParityItem, error) {
+	crateDirs, err := dc.crateDirs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var items []ParityItem
+
+	for _, crateDir := range crateDirs {
+		srcDir := filepath.Join(crateDir, "src")
+
+		if _, err := os.Stat(srcDir); err != nil {
+			continue
+		}
+
+		crateName := strings.ReplaceAll(packageName(crateDir), "-", "_")
+
+		err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !strings.HasSuffix(path, ".rs") {
+				return err
+			}
+
+			fileItems, err := dc.scanRustFile(path, crateName+modulePath(srcDir, path))
+
+			items = append(items, fileItems...)
+
+			return err
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Path < items[j].Path
+	})
+
+	return items, nil
+}
+
+// packageName returns the name of the package in the Cargo.toml of the directory,
+// or the name of the directory if not found
+func packageName(crateDir string) string {
+	if name := packageField(crateDir, "name"); name != "" {
+		return name
+	}
+
+	return filepath.Base(crateDir)
+}
+
+// packageField returns a string field of the [package] table in the Cargo.toml
+// of the directory (e.g. edition), or "" if not found
+func packageField(crateDir, field string) string {
+	content, err := os.ReadFile(filepath.Join(crateDir, "Cargo.toml"))
+
+	if err != nil {
+		return ""
+	}
+
+	inPackage := false
+
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "[") {
+			inPackage = trimmed == "[package]"
+			continue
+		}
+
+		if inPackage && strings.HasPrefix(trimmed, field) {
+			parts := strings.SplitN(trimmed, "=", 2)
+
+			if len(parts) == 2 && strings.TrimSpace(parts[0]) == field {
+				return strings.Trim(strings.TrimSpace(parts[1]), `"`)
+			}
+		}
+	}
+
+	return ""
+}
+
+// modulePath returns the module path of a source file (e.g. "::filters" for src/filters.rs)
+func modulePath(srcDir, path string) string {
+	rel, err := filepath.Rel(srcDir, path)
+
+	if err != nil {
+		return ""
+	}
+
+	rel = strings.TrimSuffix(filepath.ToSlash(rel), ".rs")
+	rel = strings.TrimSuffix(rel, "/mod")
+
+	if rel == "lib" || rel == "main" || rel == "mod" {
+		return ""
+	}
+
+	return "::" + strings.ReplaceAll(rel, "/", "::")
+}
+
+// scanRustFile finds the public items declared in a source file,
+// with whether their rustdoc comment contains an example
+func (dc *DocChecker) scanRustFile(path, module string) ([]ParityItem, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var items []ParityItem
+
+	relPath := dc.relativePath(path)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	docHasExample := false
+	inDoc := false
+	macroExport := false
+	owner := ""
+
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "///") {
+			if !inDoc {
+				inDoc = true
+				docHasExample = false
+			}
+
+			if _, isFence := parseCodeFence(strings.TrimSpace(strings.TrimPrefix(trimmed, "///"))); isFence {
+				docHasExample = true
+			}
+
+			continue
+		}
+
+		// The attributes are between the doc comment and the item
+		if strings.HasPrefix(trimmed, "#[") {
+			if trimmed == "#[macro_export]" {
+				macroExport = true
+			}
+
+			if match := deriveMacroRegex.FindStringSubmatch(trimmed); match != nil {
+				items = append(items, ParityItem{
+					Path:       module + "::" + match[1],
+					Kind:       "derive",
+					File:       relPath,
+					Line:       lineNum,
+					name:       match[1],
+					hasExample: inDoc && docHasExample,
+				})
+			}
+
+			continue
+		}
+
+		if implBlockRegex.MatchString(line) {
+			owner = implTypeName(line)
+		} else if isTopLevelItem(line) {
+			owner = ""
+		}
+
+		item := ParityItem{File: relPath, Line: lineNum, hasExample: inDoc && docHasExample}
+
+		if match := publicItemRegex.FindStringSubmatch(line); match != nil {
+			item.Kind, item.name = match[1], match[2]
+
+			if item.Kind == "fn" && owner != "" && line != strings.TrimLeft(line, " \t") {
+				item.owner = owner
+				item.Path = module + "::" + owner + "::" + item.name
+			} else {
+				item.Path = module + "::" + item.name
+			}
+
+			items = append(items, item)
+		} else if match := macroRulesRegex.FindStringSubmatch(line); match != nil && macroExport {
+			item.Kind, item.name = "macro", match[1]
+			item.Path = strings.SplitN(module, "::", 2)[0] + "::" + item.name // exported at the crate root
+
+			items = append(items, item)
+		}
+
+		inDoc = false
+		macroExport = false
+	}
+
+	return items, scanner.Err()
+}
+
+// isTopLevelItem checks whether the line starts a top-level item, ending the current impl block
+func isTopLevelItem(line string) bool {
+	if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '}' || line[0] == '{' {
+		return false
+	}
+
+	return !strings.HasPrefix(line, "where") && !strings.HasPrefix(line, "//")
+}
+
+// implTypeName returns the name of the type of an impl block
+// (e.g. "FilterBuilder" for "impl<T> FilterBuilder<T> {")
+func implTypeName(line string) string {
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "impl"))
+
+	// Skip the generic parameters of the impl
+	if strings.HasPrefix(rest, "<") {
+		depth := 0
+
+		for i, r := range rest {
+			if r == '<' {
+				depth++
+			} else if r == '>' {
+				depth--
+
+				if depth == 0 {
+					rest = strings.TrimSpace(rest[i+1:])
+					break
+				}
+			}
+		}
+	}
+
+	if idx := strings.Index(rest, " for "); idx >= 0 {
+		rest = strings.TrimSpace(rest[idx+len(" for "):])
+	}
+
+	if match := implTypeNameRegex.FindStringSubmatch(rest); match != nil {
+		return match[1]
+	}
+
+	return ""
+}
+
+// referencedIn checks whether the item is used in the given code
+func (item ParityItem) referencedIn(code string) bool {
+	name := regexp.QuoteMeta(item.name)
+	var pattern string
+
+	switch {
+	case item.Kind == "fn" && item.owner != "":
+		pattern = `(\.` + name + `\s*(::<|\())|(\b` + regexp.QuoteMeta(item.owner) + `::` + name + `\b)`
+	case item.Kind == "fn":
+		pattern = `\b` + name + `\s*(::<|\()`
+	case item.Kind == "macro":
+		pattern = `\b` + name + `!`
+	default:
+		pattern = `\b` + name + `\b`
+	}
+
+	return regexp.MustCompile(pattern).MatchString(code)
+}
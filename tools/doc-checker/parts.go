@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Part of an example split across several fences (e.g. part=2/3)
+var partRegex = regexp.MustCompile(`^([0-9]+)/([0-9]+)$`)
+
+// snippetPart returns the part of an example a snippet is (the `part=N/M`
+// attribute), as its number and the number of parts, or 0, 0 if it's a whole example
+func snippetPart(snippet Snippet) (int, int, error) {
+	value, exists := snippet.Attrs["part"]
+
+	if !exists {
+		return 0, 0, nil
+	}
+
+	m := partRegex.FindStringSubmatch(value)
+
+	if m == nil {
+		return 0, 0, fmt.Errorf("invalid part=%s: expected N/M (e.g. part=2/3)", value)
+	}
+
+	n, _ := strconv.Atoi(m[1])
+	count, _ := strconv.Atoi(m[2])
+
+	if count < 2 || n < 1 || n > count {
+		return 0, 0, fmt.Errorf("invalid part=%s: must be one of 2 parts or more (from 1/M to M/M)", value)
+	}
+
+	return n, count, nil
+}
+
+// joinSnippetParts reassembles the examples split across several fences, for
+// the prose between them (part=1/3, part=2/3 then part=3/3, possibly with other
+// snippets between them): each one is a single snippet, from the first fence
+// to the last one, with the attributes of the first one. The lines of its code
+// are mapped to the ones of the fences, so the errors are located in the fence
+// they come from (as the included lines)
+func (dc *DocChecker) joinSnippetParts(filePath string, snippets []Snippet) ([]Snippet, error) {
+	var joined []Snippet
+	example := -1 // Index of the example being reassembled, if any
+	count, next := 0, 0
+
+	for _, snippet := range snippets {
+		n, m, err := snippetPart(snippet)
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", snippet.StartLine, err)
+		}
+
+		lines := IncludedLines{
+			Line:  snippet.StartLine + 1,
+			At:    1,
+			Count: strings.Count(snippet.Content, "\n") + 1,
+		}
+
+		switch {
+		case n == 0:
+			joined = append(joined, snippet)
+
+		case n == 1 && example < 0:
+			lines.File = dc.relativePath(filePath)
+			snippet.Includes = []IncludedLines{lines}
+			snippet.PartLines = snippet.Includes
+			joined = append(joined, snippet)
+			example, count, next = len(joined)-1, m, 2
+
+		case example >= 0 && n == next && m == count:
+			first := &joined[example]
+			lines.File = first.Includes[0].File
+			lines.At = strings.Count(first.Content, "\n") + 2
+
+			first.Content += "\n" + snippet.Content
+			first.Includes = append(first.Includes, lines)
+			first.PartLines = first.Includes
+			first.EndLine = snippet.EndLine
+			next++
+
+			if n == count {
+				example = -1
+			}
+
+		case example >= 0:
+			return nil, fmt.Errorf("line %d: part=%d/%d, while the part %d/%d of the example at line %d is expected",
+				snippet.StartLine, n, m, next, count, joined[example].StartLine)
+
+		default:
+			return nil, fmt.Errorf("line %d: part=%d/%d, without the part 1/%d before it", snippet.StartLine, n, m, m)
+		}
+	}
+
+	if example >= 0 {
+		return nil, fmt.Errorf("line %d: example in %d parts, but only %d found", joined[example].StartLine, count, next-1)
+	}
+
+	// Numbered as the snippets of the file, each example being one
+	if len(joined) < len(snippets) {
+		for i := range joined {
+			joined[i].ID = snippetID(i+1, joined[i].Ignore)
+		}
+	}
+
+	return joined, nil
+}
+
+// codeLines returns the indexes of the lines of the markdown file between the
+// fences of a snippet (of each of its parts, not the prose between them)
+func (s Snippet) codeLines(count int) []int {
+	parts := s.PartLines
+
+	if len(parts) == 0 {
+		parts = []IncludedLines{{Line: s.StartLine + 1, Count: s.EndLine - s.StartLine - 1}}
+	}
+
+	var indexes []int
+
+	for _, part := range parts {
+		for i := part.Line - 1; i < part.Line-1+part.Count && i < count; i++ {
+			indexes = append(indexes, i)
+		}
+	}
+
+	return indexes
+}
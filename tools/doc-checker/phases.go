@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// loadedFile is a markdown file read, with its extracted snippets
+type loadedFile struct {
+	path       string
+	content    string
+	snippets   []Snippet
+	readErr    error
+	extractErr error
+}
+
+// loadFile reads a markdown file and extracts its snippets
+// (without any side effect, so files can be loaded concurrently)
+func (dc *DocChecker) loadFile(filePath string) *loadedFile {
+	file := &loadedFile{path: filePath}
+	content, err := os.ReadFile(filePath)
+
+	if err != nil {
+		file.readErr = err
+		return file
+	}
+
+	file.content = string(content)
+
+	// The examples of the doc comments of a Rust source file (--rustdoc)
+	if isRustSource(filePath) {
+		file.content = rustdocMarkdown(file.content)
+	}
+
+	// The source blocks of an AsciiDoc document
+	if isAsciiDoc(filePath) {
+		file.content = asciidocMarkdown(file.content)
+	}
+
+	// The code cells of a Jupyter notebook with a Rust kernel
+	if isNotebook(filePath) {
+		if file.content, file.extractErr = notebookMarkdown(file.content); file.extractErr != nil {
+			return file
+		}
+	}
+
+	file.snippets, file.extractErr = dc.extractRustSnippetsWithIDs(filePath, file.content)
+
+	if isRustSource(filePath) {
+		crate := dc.sourceCrate(filePath)
+
+		for i := range file.snippets {
+			if file.snippets[i].Crate == "" {
+				file.snippets[i].Crate = crate
+			}
+		}
+	}
+
+	return file
+}
+
+// loadFiles loads the markdown files, with up to --extract-jobs files
+// read and parsed at the same time, and returns them in the given order
+func (dc *DocChecker) loadFiles(filePaths []string) []*loadedFile {
+	files := make([]*loadedFile, len(filePaths))
+	jobs := dc.config.ExtractJobs
+
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+
+	for worker := 0; worker < jobs && worker < len(filePaths); worker++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				files[i] = dc.loadFile(filePaths[i])
+			}
+		}()
+	}
+
+	for i := range filePaths {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	return files
+}
+
+// generatedFile is a file of the generated project, waiting to be written (--write-batch)
+type generatedFile struct {
+	path    string
+	content []byte
+}
+
+// writeGenerated writes a generated file, or queues it with --write-batch N,
+// the queued files being written together once there are N of them
+// (so the writes are not interleaved with the reads of the markdown files)
+func (dc *DocChecker) writeGenerated(path string, content []byte) error {
+	if dc.config.WriteBatch <= 1 {
+		return os.WriteFile(path, content, 0644)
+	}
+
+	dc.pending = append(dc.pending, generatedFile{path: path, content: content})
+
+	if len(dc.pending) >= dc.config.WriteBatch {
+		return dc.flushGenerated()
+	}
+
+	return nil
+}
+
+// flushGenerated writes the queued generated files
+func (dc *DocChecker) flushGenerated() error {
+	for _, file := range dc.pending {
+		if err := os.WriteFile(file.path, file.content, 0644); err != nil {
+			return fmt.Errorf("failed to write snippet file: %w", err)
+		}
+	}
+
+	dc.pending = nil
+
+	return nil
+}
+
+// cargoJobs returns the option limiting the parallelism of cargo (--cargo-jobs), if any
+func (dc *DocChecker) cargoJobs() []string {
+	if dc.config.CargoJobs <= 0 {
+		return nil
+	}
+
+	return []string{"--jobs", fmt.Sprint(dc.config.CargoJobs)}
+}
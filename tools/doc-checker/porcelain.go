@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// writePorcelain writes the counts of the summary as a single line of key=value
+// pairs, for shell scripts (e.g. "total=12 valid=10 failed=2 files=3 skipped=0 warnings=1 warned=1
+// fingerprints=3f9a0c1d52e8b7a4,0a1b2c3d4e5f6a7b"), with the fingerprints of the failures in
+// the order of the files. The keys and their order are stable: new ones are only appended.
+func writePorcelain(w io.Writer, results *Results) {
+	summary := results.Summary
+
+	files := make([]string, 0, len(results.Files))
+
+	for file := range results.Files {
+		files = append(files, file)
+	}
+
+	sort.Strings(files)
+
+	fingerprints := []string{}
+
+	for _, file := range files {
+		for _, failure := range results.Files[file].Failures {
+			if failure.Fingerprint != "" {
+				fingerprints = append(fingerprints, failure.Fingerprint)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "total=%d valid=%d failed=%d files=%d skipped=%d warnings=%d warned=%d fingerprints=%s\n",
+		summary.TotalSnippets, summary.ValidSnippets, summary.FailedSnippets,
+		summary.FilesProcessed, summary.SkippedSnippets, summary.Warnings, summary.WarnedSnippets,
+		strings.Join(fingerprints, ","))
+}
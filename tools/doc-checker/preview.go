@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// crateDependency returns the dependency on a documented crate, in the
+// generated project: its path, or its published version with --against-published
+// (e.g. `{ path = "/project" }` or `"=0.2.0"`), with the features of the crate if any
+func (dc *DocChecker) crateDependency(crate CrateConfig) (string, error) {
+	features := ""
+
+	if crate.NoDefaultFeatures {
+		features = ", default-features = false"
+	}
+
+	if len(crate.Features) > 0 {
+		features += fmt.Sprintf(`, features = ["%s"]`, strings.Join(crate.Features, `", "`))
+	}
+
+	if !dc.config.AgainstPublished {
+		return fmt.Sprintf(`{ path = "%s"%s }`, crate.Path, features), nil
+	}
+
+	version, err := crateVersion(crate)
+
+	if err != nil {
+		return "", err
+	}
+
+	if features != "" {
+		return fmt.Sprintf(`{ version = "=%s"%s }`, version, features), nil
+	}
+
+	return fmt.Sprintf(`"=%s"`, version), nil
+}
+
+// PreviewExample is a snippet of an unreleased or experimental API (preview fence attribute)
+type PreviewExample struct {
+	File      string
+	SnippetID string
+	Line      int
+	Status    string
+}
+
+// previewExamples returns the preview snippets of the results, by file and line
+func previewExamples(results *Results) []PreviewExample {
+	var previews []PreviewExample
+
+	for file, result := range results.Files {
+		for _, snippet := range result.Snippets {
+			if snippet.Preview {
+				previews = append(previews, PreviewExample{
+					File:      file,
+					SnippetID: snippet.ID,
+					Line:      snippet.Line,
+					Status:    snippet.Status,
+				})
+			}
+		}
+	}
+
+	sort.Slice(previews, func(i, j int) bool {
+		if previews[i].File != previews[j].File {
+			return previews[i].File < previews[j].File
+		}
+
+		return previews[i].Line < previews[j].Line
+	})
+
+	return previews
+}
+
+// printPreviewExamples prints the section of the preview snippets, with their status
+func printPreviewExamples(previews []PreviewExample) {
+	fmt.Println()
+	logInfo(msg("preview.header"))
+
+	for _, preview := range previews {
+		fmt.Printf("  • %s:%d %s (%s)\n", preview.File, preview.Line, preview.SnippetID, preview.Status)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sources of the values of the effective configuration (besides "FILE:LINE")
+const (
+	sourceDefault   = "default"
+	sourceFlag      = "flag"
+	sourceEnv       = "env"       // Followed by the variable (e.g. "env DOC_CHECKER_OUTPUT")
+	sourceImplied   = "implied"   // Set from another option (e.g. -o json by --query)
+	sourceArguments = "arguments" // Files given after the options
+)
+
+// Short names of the options, printed under their long name
+var flagAliases = map[string]string{"f": "files", "j": "jobs", "o": "output", "q": "quiet", "v": "verbose", "h": "help"}
+
+// configEntry is a value of the effective configuration, with where it comes from
+type configEntry struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// effectiveConfig returns the values of the options (from the given flag set,
+// already parsed), then the ones of the configuration file, with their source
+func effectiveConfig(flags *flag.FlagSet, config *Config) ([]configEntry, error) {
+	set := make(map[string]bool)
+
+	flags.Visit(func(f *flag.Flag) {
+		if long, isAlias := flagAliases[f.Name]; isAlias {
+			set[long] = true
+		} else {
+			set[f.Name] = true
+		}
+	})
+
+	var entries []configEntry
+
+	flags.VisitAll(func(f *flag.Flag) {
+		if _, isAlias := flagAliases[f.Name]; isAlias {
+			return
+		}
+
+		source := sourceDefault
+
+		switch {
+		case set[f.Name]:
+			source = sourceFlag
+		case config.EnvOptions[f.Name] != "":
+			source = sourceEnv + " " + config.EnvOptions[f.Name]
+		case f.Value.String() != f.DefValue:
+			source = sourceImplied
+		}
+
+		var value interface{} = f.Value.String()
+
+		if getter, ok := f.Value.(flag.Getter); ok {
+			value = getter.Get()
+		}
+
+		entries = append(entries, configEntry{Key: f.Name, Value: value, Source: source})
+	})
+
+	if len(flags.Args()) > 0 {
+		entries = append(entries, configEntry{Key: "arguments", Value: flags.Args(), Source: sourceArguments})
+	}
+
+	entries = append(entries, configEntry{Key: "project_root", Value: config.ProjectRoot, Source: sourceImplied})
+
+	fileEntries, err := configFileEntries(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(entries, fileEntries...), nil
+}
+
+// configFileEntries returns the values of the configuration file, with their line,
+// or the default crate without configuration file
+func configFileEntries(config *Config) ([]configEntry, error) {
+	path := config.ConfigFile
+
+	if path == "" {
+		path = filepath.Join(config.ProjectRoot, configFileName)
+	}
+
+	content, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) && config.ConfigFile == "" {
+		crate := defaultCrates(config.ProjectRoot)[0]
+		table := "crates." + crate.Name
+
+		return []configEntry{
+			{Key: "default_crate", Value: crate.Name, Source: sourceDefault},
+			{Key: table + ".path", Value: ".", Source: sourceDefault},
+			{Key: table + ".prelude", Value: crate.Prelude, Source: sourceDefault},
+		}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+
+	doc, err := parseTOML(string(content))
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	rel, err := filepath.Rel(config.ProjectRoot, path)
+
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = path
+	}
+
+	entries := make([]configEntry, len(doc.Keys))
+
+	for i, key := range doc.Keys {
+		value := doc.Values[key]
+		entries[i] = configEntry{Key: key, Value: value.Value, Source: fmt.Sprintf("%s:%d", rel, value.Line)}
+	}
+
+	return entries, nil
+}
+
+// tomlKey returns a dotted key as TOML, with its parts quoted when not bare
+// (e.g. renames."tnuctipun::update")
+func tomlKey(key string) string {
+	parts := strings.Split(key, ".")
+
+	for i, part := range parts {
+		if part == "" || strings.IndexFunc(part, func(r rune) bool {
+			return !(r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'))
+		}) >= 0 {
+			parts[i] = fmt.Sprintf("%q", part)
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// tomlLiteral returns a value of the configuration as TOML
+func tomlLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+
+	case []string:
+		items := make([]string, len(v))
+
+		for i, item := range v {
+			items[i] = tomlLiteral(item)
+		}
+
+		return "[" + strings.Join(items, ", ") + "]"
+
+	case []interface{}:
+		items := make([]string, len(v))
+
+		for i, item := range v {
+			items[i] = tomlLiteral(item)
+		}
+
+		return "[" + strings.Join(items, ", ") + "]"
+
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// printConfig prints the effective configuration (--print-config), as TOML
+// with the source of each value in a comment, or as JSON with `-o json`
+func printConfig(w io.Writer, flags *flag.FlagSet, config *Config) error {
+	entries, err := effectiveConfig(flags, config)
+
+	if err != nil {
+		return err
+	}
+
+	if config.OutputFormat == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(entries)
+	}
+
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s = %s # %s\n", tomlKey(entry.Key), tomlLiteral(entry.Value), entry.Source)
+	}
+
+	return nil
+}
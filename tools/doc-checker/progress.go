@@ -0,0 +1,77 @@
+package main
+
+// Phases of a run, as reported with --progress-json
+const (
+	phaseDiscover = "discover" // Finding the markdown files
+	phaseExtract  = "extract"  // Extracting the snippets of each file
+	phaseCompile  = "compile"  // Compiling the snippets
+	phaseDone     = "done"
+)
+
+// Share of the extraction in the overall progress (the compilation being most of the run)
+const extractPercent = 10
+
+// ProgressEvent is written on stderr with --progress-json, so the IDE plugins
+// can show a progress bar without parsing the human logs
+type ProgressEvent struct {
+	Type    string `json:"type"` // "progress"
+	Phase   string `json:"phase"`
+	Percent int    `json:"percent"` // Of the whole run
+	Done    int    `json:"done"`    // Files (extract) or snippets (compile) processed in the phase
+	Total   int    `json:"total"`
+
+	// Current file (extract) or snippet (compile)
+	File      string `json:"file,omitempty"`
+	SnippetID string `json:"snippet_id,omitempty"`
+	Line      int    `json:"line,omitempty"`
+}
+
+// progressPercent returns the progress of the whole run, given the one of a phase
+func progressPercent(phase string, done, total int) int {
+	ratio := 1.0
+
+	if total > 0 {
+		ratio = float64(done) / float64(total)
+	}
+
+	switch phase {
+	case phaseDiscover:
+		return 0
+	case phaseExtract:
+		return int(ratio * extractPercent)
+	case phaseCompile:
+		return extractPercent + int(ratio*(100-extractPercent))
+	default:
+		return 100
+	}
+}
+
+// emitProgress writes a progress event with --progress-json
+func (dc *DocChecker) emitProgress(event ProgressEvent) {
+	if dc.progress == nil {
+		return
+	}
+
+	event.Type = "progress"
+	event.Percent = progressPercent(event.Phase, event.Done, event.Total)
+
+	if event.File != "" {
+		event.File = dc.relativePath(event.File)
+	}
+
+	writeEvent(dc.progress, event)
+}
+
+// emitCompileProgress reports the snippet being compiled (or just compiled)
+func (dc *DocChecker) emitCompileProgress(binName string) {
+	source := dc.manifest[binName]
+
+	dc.emitProgress(ProgressEvent{
+		Phase:     phaseCompile,
+		Done:      dc.compiled,
+		Total:     len(dc.manifest),
+		File:      source.File,
+		SnippetID: source.SnippetID,
+		Line:      source.StartLine,
+	})
+}
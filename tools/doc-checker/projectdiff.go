@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Lines of context around the changes of the project diff
+const diffContext = 3
+
+// Files of the generated projects compared with --diff-project
+var projectFilePatterns = []string{
+	filepath.Join("test_project*", "Cargo.toml"),
+	filepath.Join("test_project*", "Cargo.lock"),
+	filepath.Join("test_project*", "src", "bin", "*.rs"),
+}
+
+// readProjectFiles returns the content of the generated project files
+// of a work directory, by path relative to it
+func readProjectFiles(workDir string) (map[string]string, error) {
+	files := make(map[string]string)
+
+	for _, pattern := range projectFilePatterns {
+		paths, _ := filepath.Glob(filepath.Join(workDir, pattern))
+
+		for _, path := range paths {
+			content, err := os.ReadFile(path)
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to read generated project: %w", err)
+			}
+
+			rel, _ := filepath.Rel(workDir, path)
+			files[filepath.ToSlash(rel)] = string(content)
+		}
+	}
+
+	return files, nil
+}
+
+// reuseWorkDir cleans the work directory of a previous run, after having
+// kept its generated project with --diff-project
+func (dc *DocChecker) reuseWorkDir(workDir string) error {
+	if dc.config.DiffProject {
+		previous, err := readProjectFiles(workDir)
+
+		if err != nil {
+			return err
+		}
+
+		dc.previousProject = previous
+	}
+
+	return cleanWorkDir(workDir)
+}
+
+// projectDiff returns the unified diff of the generated project since the previous run
+func (dc *DocChecker) projectDiff() (string, error) {
+	current, err := readProjectFiles(dc.tempDir)
+
+	if err != nil {
+		return "", err
+	}
+
+	names := make(map[string]bool)
+
+	for name := range dc.previousProject {
+		names[name] = true
+	}
+
+	for name := range current {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+
+	sort.Strings(sorted)
+
+	var diff strings.Builder
+
+	for _, name := range sorted {
+		diff.WriteString(unifiedDiff(name, dc.previousProject[name], current[name]))
+	}
+
+	return diff.String(), nil
+}
+
+// printProjectDiff prints the changes of the generated project since the previous run
+// (on stderr with the machine-readable output formats)
+func (dc *DocChecker) printProjectDiff() error {
+	w := io.Writer(os.Stdout)
+
+	if dc.config.OutputFormat != "human" {
+		w = os.Stderr
+	}
+
+	if len(dc.previousProject) == 0 {
+		fmt.Fprintln(w, "\033[1;32m[doc-checker]\033[0m No previous generated project to compare with")
+		return nil
+	}
+
+	diff, err := dc.projectDiff()
+
+	if err != nil {
+		return err
+	}
+
+	if diff == "" {
+		fmt.Fprintln(w, "\033[1;32m[doc-checker]\033[0m Generated project unchanged since the last run")
+		return nil
+	}
+
+	_, err = io.WriteString(w, diff)
+
+	return err
+}
+
+// diffLine is a line of a diff: ' ' (unchanged), '-' (removed) or '+' (added)
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// splitLines splits a file content in lines (none if empty)
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// diffLines returns the edit script from a to b, using their longest common subsequence
+// (once the common prefix and suffix, most of the lines of a lockfile, are left aside)
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var lines []diffLine
+
+	for _, line := range a[:prefix] {
+		lines = append(lines, diffLine{' ', line})
+	}
+
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, diffLine{' ', x[i]})
+			i++
+			j++
+
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', x[i]})
+			i++
+
+		default:
+			lines = append(lines, diffLine{'+', y[j]})
+			j++
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', line})
+	}
+
+	return lines
+}
+
+// unifiedDiff returns the unified diff of a file (e.g. test_project/Cargo.toml),
+// possibly added or removed, or "" if unchanged
+func unifiedDiff(name, before, after string) string {
+	if before == after {
+		return ""
+	}
+
+	lines := diffLines(splitLines(before), splitLines(after))
+
+	var diff strings.Builder
+
+	oldName, newName := "a/"+name, "b/"+name
+
+	if before == "" {
+		oldName = "/dev/null"
+	}
+
+	if after == "" {
+		newName = "/dev/null"
+	}
+
+	fmt.Fprintf(&diff, "--- %s\n+++ %s\n", oldName, newName)
+
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+
+		// A hunk goes from the context before a change, to the context after
+		// the last change less than 2 contexts apart
+		end := start
+
+		for next := start; next < len(lines) && next-end <= 2*diffContext; next++ {
+			if lines[next].op != ' ' {
+				end = next
+			}
+		}
+
+		first := max(start-diffContext, 0)
+		last := min(end+diffContext+1, len(lines))
+
+		oldStart, newStart := 1, 1
+
+		for _, line := range lines[:first] {
+			if line.op != '+' {
+				oldStart++
+			}
+
+			if line.op != '-' {
+				newStart++
+			}
+		}
+
+		oldCount, newCount := 0, 0
+
+		for _, line := range lines[first:last] {
+			if line.op != '+' {
+				oldCount++
+			}
+
+			if line.op != '-' {
+				newCount++
+			}
+		}
+
+		// As in diff -u, the start of an empty range is the line before it
+		if oldCount == 0 {
+			oldStart--
+		}
+
+		if newCount == 0 {
+			newStart--
+		}
+
+		fmt.Fprintf(&diff, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+
+		for _, line := range lines[first:last] {
+			fmt.Fprintf(&diff, "%c%s\n", line.op, line.text)
+		}
+
+		start = last
+	}
+
+	return diff.String()
+}
@@ -0,0 +1,677 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Query is a compiled JMESPath expression, limited to the subset useful
+// to extract fields from the results:
+//
+//   - field access: `summary.failed_snippets`, `files."README.md"`
+//   - index: `files.*.errors[0]` (negative indexes count from the end)
+//   - projections: `files.*` (object values), `[*]` (list), `[]` (flatten)
+//   - filters: `[?snippets_failed > `0`]`, with ==, !=, <, <=, > and >=
+//   - pipes: `files.* | [0]`, current node: `@`
+//   - functions: `length(x)`, `keys(x)`, `values(x)`
+//   - literals: `json value` (backticks) and 'raw string'
+type Query struct {
+	expr queryNode
+}
+
+// CompileQuery parses a JMESPath expression
+func CompileQuery(expression string) (*Query, error) {
+	p := &queryParser{input: expression}
+
+	expr, err := p.parsePipe()
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid query '%s': %w", expression, err)
+	}
+
+	p.skipSpaces()
+
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("invalid query '%s': unexpected '%s' at position %d",
+			expression, p.input[p.pos:], p.pos)
+	}
+
+	return &Query{expr: expr}, nil
+}
+
+// Apply evaluates the query against the JSON representation of the value
+func (q *Query) Apply(value interface{}) (interface{}, error) {
+	content, err := json.Marshal(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var data interface{}
+
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, err
+	}
+
+	return q.expr.eval(data), nil
+}
+
+type queryNode interface {
+	eval(value interface{}) interface{}
+}
+
+// queryPipe evaluates each expression on the result of the previous one
+// (which also stops the projections)
+type queryPipe []queryNode
+
+func (p queryPipe) eval(value interface{}) interface{} {
+	for _, node := range p {
+		value = node.eval(value)
+	}
+
+	return value
+}
+
+// queryStep is an element of a chain of accesses (e.g. `a`, `[0]`, `[*]`)
+type queryStep interface {
+	// apply returns the result of the step, and whether it's a projection
+	// (in which case the result is the list of elements to project)
+	apply(value interface{}) (result interface{}, projection bool)
+}
+
+// queryChain applies its steps in sequence; after a projection,
+// the following steps are applied to each element (and null results dropped),
+// up to a flatten which applies to the whole projected list
+type queryChain []queryStep
+
+func (c queryChain) eval(value interface{}) interface{} {
+	for i, step := range c {
+		result, projection := step.apply(value)
+
+		if !projection {
+			value = result
+			continue
+		}
+
+		elems, ok := result.([]interface{})
+
+		if !ok {
+			return nil
+		}
+
+		end := len(c)
+
+		for j := i + 1; j < len(c); j++ {
+			if _, isFlatten := c[j].(flattenStep); isFlatten {
+				end = j
+				break
+			}
+		}
+
+		projected := []interface{}{}
+
+		for _, elem := range elems {
+			if v := c[i+1 : end].eval(elem); v != nil {
+				projected = append(projected, v)
+			}
+		}
+
+		return c[end:].eval(projected)
+	}
+
+	return value
+}
+
+type fieldStep string
+
+func (f fieldStep) apply(value interface{}) (interface{}, bool) {
+	if obj, ok := value.(map[string]interface{}); ok {
+		return obj[string(f)], false
+	}
+
+	return nil, false
+}
+
+type indexStep int
+
+func (i indexStep) apply(value interface{}) (interface{}, bool) {
+	list, ok := value.([]interface{})
+
+	if !ok {
+		return nil, false
+	}
+
+	idx := int(i)
+
+	if idx < 0 {
+		idx += len(list)
+	}
+
+	if idx < 0 || idx >= len(list) {
+		return nil, false
+	}
+
+	return list[idx], false
+}
+
+// valuesStep projects the values of an object (`*`), sorted by key
+type valuesStep struct{}
+
+func (valuesStep) apply(value interface{}) (interface{}, bool) {
+	obj, ok := value.(map[string]interface{})
+
+	if !ok {
+		return nil, true
+	}
+
+	return objectValues(obj), true
+}
+
+// listStep projects the elements of a list (`[*]`)
+type listStep struct{}
+
+func (listStep) apply(value interface{}) (interface{}, bool) {
+	if list, ok := value.([]interface{}); ok {
+		return list, true
+	}
+
+	return nil, true
+}
+
+// flattenStep flattens a list of lists by one level, and projects it (`[]`)
+type flattenStep struct{}
+
+func (flattenStep) apply(value interface{}) (interface{}, bool) {
+	list, ok := value.([]interface{})
+
+	if !ok {
+		return nil, true
+	}
+
+	flattened := []interface{}{}
+
+	for _, elem := range list {
+		if sub, ok := elem.([]interface{}); ok {
+			flattened = append(flattened, sub...)
+		} else {
+			flattened = append(flattened, elem)
+		}
+	}
+
+	return flattened, true
+}
+
+// filterStep projects the elements of a list matching a comparison (`[?a > b]`)
+type filterStep struct {
+	left, right queryNode
+	op          string
+}
+
+func (f filterStep) apply(value interface{}) (interface{}, bool) {
+	list, ok := value.([]interface{})
+
+	if !ok {
+		return nil, true
+	}
+
+	matching := []interface{}{}
+
+	for _, elem := range list {
+		if compareValues(f.left.eval(elem), f.op, f.right.eval(elem)) {
+			matching = append(matching, elem)
+		}
+	}
+
+	return matching, true
+}
+
+// nodeStep evaluates a whole expression as a step (e.g. function, literal, `@`)
+type nodeStep struct {
+	node queryNode
+}
+
+func (n nodeStep) apply(value interface{}) (interface{}, bool) {
+	return n.node.eval(value), false
+}
+
+type queryCurrent struct{}
+
+func (queryCurrent) eval(value interface{}) interface{} {
+	return value
+}
+
+type queryLiteral struct {
+	value interface{}
+}
+
+func (l queryLiteral) eval(interface{}) interface{} {
+	return l.value
+}
+
+type queryFunction struct {
+	name string
+	arg  queryNode
+}
+
+func (f queryFunction) eval(value interface{}) interface{} {
+	arg := f.arg.eval(value)
+
+	switch f.name {
+	case "length":
+		switch v := arg.(type) {
+		case []interface{}:
+			return float64(len(v))
+		case map[string]interface{}:
+			return float64(len(v))
+		case string:
+			return float64(len([]rune(v)))
+		}
+
+	case "keys":
+		if obj, ok := arg.(map[string]interface{}); ok {
+			keys := []interface{}{}
+
+			for _, key := range sortedKeys(obj) {
+				keys = append(keys, key)
+			}
+
+			return keys
+		}
+
+	case "values":
+		if obj, ok := arg.(map[string]interface{}); ok {
+			return objectValues(obj)
+		}
+	}
+
+	return nil
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+
+	for key := range obj {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func objectValues(obj map[string]interface{}) []interface{} {
+	values := []interface{}{}
+
+	for _, key := range sortedKeys(obj) {
+		values = append(values, obj[key])
+	}
+
+	return values
+}
+
+func compareValues(left interface{}, op string, right interface{}) bool {
+	switch op {
+	case "==":
+		return jsonEqual(left, right)
+	case "!=":
+		return !jsonEqual(left, right)
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+
+	if !lok || !rok {
+		return false
+	}
+
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+
+	return false
+}
+
+func jsonEqual(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+
+	return string(ja) == string(jb)
+}
+
+type queryParser struct {
+	input string
+	pos   int
+}
+
+func (p *queryParser) skipSpaces() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *queryParser) peek(s string) bool {
+	p.skipSpaces()
+
+	return strings.HasPrefix(p.input[p.pos:], s)
+}
+
+func (p *queryParser) consume(s string) bool {
+	if p.peek(s) {
+		p.pos += len(s)
+		return true
+	}
+
+	return false
+}
+
+func (p *queryParser) parsePipe() (queryNode, error) {
+	var pipe queryPipe
+
+	for {
+		chain, err := p.parseChain()
+
+		if err != nil {
+			return nil, err
+		}
+
+		pipe = append(pipe, chain)
+
+		if !p.consume("|") {
+			break
+		}
+	}
+
+	if len(pipe) == 1 {
+		return pipe[0], nil
+	}
+
+	return pipe, nil
+}
+
+func (p *queryParser) parseChain() (queryChain, error) {
+	var chain queryChain
+
+	// First element, without leading dot
+	switch {
+	case p.peek("["):
+		step, err := p.parseBracket()
+
+		if err != nil {
+			return nil, err
+		}
+
+		chain = append(chain, step)
+
+	default:
+		step, err := p.parseDotted()
+
+		if err != nil {
+			return nil, err
+		}
+
+		chain = append(chain, step)
+	}
+
+	for {
+		switch {
+		case p.peek("["):
+			step, err := p.parseBracket()
+
+			if err != nil {
+				return nil, err
+			}
+
+			chain = append(chain, step)
+
+		case p.consume("."):
+			step, err := p.parseDotted()
+
+			if err != nil {
+				return nil, err
+			}
+
+			chain = append(chain, step)
+
+		default:
+			return chain, nil
+		}
+	}
+}
+
+// parseDotted parses what can follow a dot (or start an expression)
+func (p *queryParser) parseDotted() (queryStep, error) {
+	p.skipSpaces()
+
+	if p.pos >= len(p.input) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	switch c := p.input[p.pos]; {
+	case c == '*':
+		p.pos++
+		return valuesStep{}, nil
+
+	case c == '@':
+		p.pos++
+		return nodeStep{queryCurrent{}}, nil
+
+	case c == '"':
+		name, err := p.parseQuoted('"')
+
+		if err != nil {
+			return nil, err
+		}
+
+		return fieldStep(name), nil
+
+	case c == '\'':
+		raw, err := p.parseQuoted('\'')
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nodeStep{queryLiteral{raw}}, nil
+
+	case c == '`':
+		literal, err := p.parseJSONLiteral()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nodeStep{literal}, nil
+
+	case isIdentStart(c):
+		start := p.pos
+
+		for p.pos < len(p.input) && isIdentPart(p.input[p.pos]) {
+			p.pos++
+		}
+
+		name := p.input[start:p.pos]
+
+		if p.consume("(") {
+			arg, err := p.parsePipe()
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !p.consume(")") {
+				return nil, fmt.Errorf("missing ')' after the argument of %s", name)
+			}
+
+			switch name {
+			case "length", "keys", "values":
+				return nodeStep{queryFunction{name, arg}}, nil
+			default:
+				return nil, fmt.Errorf("unknown function '%s'", name)
+			}
+		}
+
+		return fieldStep(name), nil
+	}
+
+	return nil, fmt.Errorf("unexpected '%s' at position %d", p.input[p.pos:], p.pos)
+}
+
+func (p *queryParser) parseBracket() (queryStep, error) {
+	p.consume("[")
+
+	switch {
+	case p.consume("]"):
+		return flattenStep{}, nil
+
+	case p.consume("*"):
+		if !p.consume("]") {
+			return nil, fmt.Errorf("missing ']' after '[*'")
+		}
+
+		return listStep{}, nil
+
+	case p.consume("?"):
+		left, err := p.parseOperand()
+
+		if err != nil {
+			return nil, err
+		}
+
+		op := ""
+
+		for _, candidate := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+			if p.consume(candidate) {
+				op = candidate
+				break
+			}
+		}
+
+		if op == "" {
+			return nil, fmt.Errorf("expected comparison operator at position %d", p.pos)
+		}
+
+		right, err := p.parseOperand()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.consume("]") {
+			return nil, fmt.Errorf("missing ']' after filter")
+		}
+
+		return filterStep{left: left, op: op, right: right}, nil
+	}
+
+	p.skipSpaces()
+	start := p.pos
+
+	if p.pos < len(p.input) && p.input[p.pos] == '-' {
+		p.pos++
+	}
+
+	for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+		p.pos++
+	}
+
+	index, err := strconv.Atoi(p.input[start:p.pos])
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid index at position %d", start)
+	}
+
+	if !p.consume("]") {
+		return nil, fmt.Errorf("missing ']' after index")
+	}
+
+	return indexStep(index), nil
+}
+
+// parseOperand parses a side of a filter comparison
+func (p *queryParser) parseOperand() (queryNode, error) {
+	p.skipSpaces()
+
+	// Bare numbers are accepted, as a convenience
+	if p.pos < len(p.input) && (p.input[p.pos] == '-' || (p.input[p.pos] >= '0' && p.input[p.pos] <= '9')) {
+		start := p.pos
+		p.pos++
+
+		for p.pos < len(p.input) && strings.IndexByte("0123456789.", p.input[p.pos]) >= 0 {
+			p.pos++
+		}
+
+		number, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid number at position %d", start)
+		}
+
+		return queryLiteral{number}, nil
+	}
+
+	return p.parseChain()
+}
+
+func (p *queryParser) parseQuoted(quote byte) (string, error) {
+	start := p.pos
+	p.pos++
+
+	var value strings.Builder
+
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+
+		switch {
+		case c == '\\' && p.pos+1 < len(p.input):
+			value.WriteByte(p.input[p.pos+1])
+			p.pos += 2
+
+		case c == quote:
+			p.pos++
+			return value.String(), nil
+
+		default:
+			value.WriteByte(c)
+			p.pos++
+		}
+	}
+
+	return "", fmt.Errorf("unterminated string at position %d", start)
+}
+
+func (p *queryParser) parseJSONLiteral() (queryNode, error) {
+	start := p.pos
+	end := strings.IndexByte(p.input[start+1:], '`')
+
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated literal at position %d", start)
+	}
+
+	var value interface{}
+
+	if err := json.Unmarshal([]byte(p.input[start+1:start+1+end]), &value); err != nil {
+		return nil, fmt.Errorf("invalid JSON literal at position %d: %w", start, err)
+	}
+
+	p.pos = start + end + 2
+
+	return queryLiteral{value}, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
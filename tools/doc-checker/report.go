@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileReport is the result of a markdown file, as written with --report-dir
+type FileReport struct {
+	SchemaVersion int    `json:"schema_version"`
+	File          string `json:"file"` // Relative to the project root
+	FileResult
+	Warnings []Warning `json:"warnings"`
+}
+
+// writeReports writes one report per processed markdown file in the report
+// directory (e.g. docs/guide.md.json), with the sources of its failing snippets,
+// as compiled (e.g. docs/guide.md.failures/docs_guide-42.rs)
+func (dc *DocChecker) writeReports(reportDir string) error {
+	for filePath, result := range dc.results.Files {
+		relPath := dc.relativePath(filePath)
+		report := FileReport{
+			SchemaVersion: dc.results.SchemaVersion,
+			File:          relPath,
+			FileResult:    result,
+			Warnings:      []Warning{},
+		}
+
+		for _, warning := range dc.results.Warnings {
+			if warning.File == filePath {
+				report.Warnings = append(report.Warnings, warning)
+			}
+		}
+
+		reportFile := filepath.Join(reportDir, filepath.FromSlash(relPath)+".json")
+		content, err := json.MarshalIndent(report, "", "  ")
+
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(reportFile), 0755); err != nil {
+			return fmt.Errorf("failed to create report directory: %w", err)
+		}
+
+		if err := os.WriteFile(reportFile, append(content, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+
+		// The failures of a previous run are replaced
+		failuresDir := filepath.Join(reportDir, filepath.FromSlash(relPath)+".failures")
+
+		if err := os.RemoveAll(failuresDir); err != nil {
+			return fmt.Errorf("failed to clean report directory: %w", err)
+		}
+
+		for _, failure := range result.Failures {
+			if err := dc.writeFailingSource(failuresDir, failure.Snippet); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeFailingSource writes the code of a failing snippet binary, as compiled
+func (dc *DocChecker) writeFailingSource(dir, binName string) error {
+	content, err := os.ReadFile(filepath.Join(dc.tempDir, binName+".rs"))
+
+	if err != nil {
+		return nil // e.g. not generated as the processing of the file failed
+	}
+
+	crate, err := dc.crate(dc.manifest[binName].Crate)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, binName+".rs"), []byte(dc.wrapSnippet(string(content), crate, dc.manifest[binName].NoMain)), 0644); err != nil {
+		return fmt.Errorf("failed to write snippet source: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError       = -32700
+	rpcInvalidRequest   = -32600
+	rpcMethodNotFound   = -32601
+	rpcInvalidParams    = -32602
+	rpcServerError      = -32000
+	rpcRequestCancelled = -32800
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type checkFileParams struct {
+	Path string `json:"path"`
+}
+
+type checkSnippetParams struct {
+	Code string `json:"code"`
+}
+
+type cancelParams struct {
+	ID json.RawMessage `json:"id"`
+}
+
+// rpcServer serves the JSON-RPC protocol over stdio: one request per line,
+// one response per line (but for the notifications, without id, which have
+// none). The checks are executed one at a time in the same work directory,
+// so the generated project and its target dir stay warm.
+type rpcServer struct {
+	config *Config
+	out    *json.Encoder
+
+	mu      sync.Mutex                    // guards out and pending
+	pending map[string]context.CancelFunc // cancels the queued or running checks
+}
+
+func serveRPC(config *Config, in io.Reader, out io.Writer) error {
+	// Never mix logs with the protocol messages
+	config.OutputFormat = "json"
+	config.Verbose = false
+
+	if config.WorkKey == "" {
+		config.WorkKey = "rpc"
+	}
+
+	server := &rpcServer{
+		config:  config,
+		out:     json.NewEncoder(out),
+		pending: make(map[string]context.CancelFunc),
+	}
+
+	// Unbounded, so that cancel requests are still read whatever the number of queued checks
+	checks := newCheckQueue()
+	done := make(chan struct{})
+
+	go func() {
+		for check, ok := checks.pop(); ok; check, ok = checks.pop() {
+			check()
+		}
+
+		close(done)
+	}()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var req rpcRequest
+
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			server.reply(nil, nil, &rpcError{rpcParseError, err.Error()})
+			continue
+		}
+
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			server.reply(req.ID, nil, &rpcError{rpcInvalidRequest, "invalid JSON-RPC 2.0 request"})
+			continue
+		}
+
+		// A notification is never answered, not even with an error (as
+		// a check whose outcome can't be replied, it's ignored)
+		notification := len(req.ID) == 0
+
+		switch req.Method {
+		case "cancel":
+			var params cancelParams
+
+			if err := json.Unmarshal(req.Params, &params); err != nil || len(params.ID) == 0 {
+				server.respond(req, nil, &rpcError{rpcInvalidParams, "expected params: {\"id\": <request id>}"})
+				continue
+			}
+
+			server.respond(req, map[string]bool{"cancelled": server.cancel(params.ID)}, nil)
+
+		case "check_file", "check_snippet":
+			if notification {
+				continue
+			}
+
+			run, err := server.prepareCheck(req)
+
+			if err != nil {
+				server.reply(req.ID, nil, err)
+				continue
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			key := string(req.ID)
+
+			if !server.addPending(key, cancel) {
+				cancel()
+				server.reply(req.ID, nil, &rpcError{rpcInvalidRequest, fmt.Sprintf("request id %s is already in use by a pending check", key)})
+
+				continue
+			}
+
+			id := req.ID
+
+			checks.push(func() {
+				defer func() {
+					server.mu.Lock()
+					delete(server.pending, key)
+					server.mu.Unlock()
+					cancel()
+				}()
+
+				if ctx.Err() != nil {
+					server.reply(id, nil, &rpcError{rpcRequestCancelled, "request cancelled"})
+					return
+				}
+
+				results, err := run(ctx)
+
+				switch {
+				case ctx.Err() != nil:
+					server.reply(id, nil, &rpcError{rpcRequestCancelled, "request cancelled"})
+				case err != nil:
+					server.reply(id, nil, &rpcError{rpcServerError, err.Error()})
+				default:
+					server.reply(id, results, nil)
+				}
+			})
+
+		default:
+			server.respond(req, nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("unknown method '%s'", req.Method)})
+		}
+	}
+
+	checks.close()
+	<-done
+
+	return scanner.Err()
+}
+
+// prepareCheck validates the parameters of a check request,
+// and returns the function executing it
+func (s *rpcServer) prepareCheck(req rpcRequest) (func(context.Context) (*Results, error), *rpcError) {
+	config := *s.config
+
+	if req.Method == "check_file" {
+		var params checkFileParams
+
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.Path == "" {
+			return nil, &rpcError{rpcInvalidParams, "expected params: {\"path\": <markdown file>}"}
+		}
+
+		config.Files = []string{params.Path}
+
+		return func(ctx context.Context) (*Results, error) {
+			return NewDocChecker(&config).RunContext(ctx)
+		}, nil
+	}
+
+	var params checkSnippetParams
+
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.Code == "" {
+		return nil, &rpcError{rpcInvalidParams, "expected params: {\"code\": <rust code>}"}
+	}
+
+	return func(ctx context.Context) (*Results, error) {
+		return NewDocChecker(&config).CheckSnippet(ctx, params.Code, nil)
+	}, nil
+}
+
+// addPending records the cancellation of a check, unless a pending check
+// already has the same request ID
+func (s *rpcServer) addPending(key string, cancel context.CancelFunc) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.pending[key]; exists {
+		return false
+	}
+
+	s.pending[key] = cancel
+
+	return true
+}
+
+// cancel cancels the pending check with the given request ID, if any
+func (s *rpcServer) cancel(id json.RawMessage) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cancel, exists := s.pending[string(id)]
+
+	if exists {
+		cancel()
+	}
+
+	return exists
+}
+
+// respond replies to a request, unless it's a notification
+func (s *rpcServer) respond(req rpcRequest, result interface{}, err *rpcError) {
+	if len(req.ID) > 0 {
+		s.reply(req.ID, result, err)
+	}
+}
+
+func (s *rpcServer) reply(id json.RawMessage, result interface{}, err *rpcError) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.out.Encode(rpcResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  result,
+		Error:   err,
+	})
+}
+
+// checkQueue is the unbounded queue of the checks to execute, one at a time
+type checkQueue struct {
+	mu     sync.Mutex
+	ready  *sync.Cond
+	checks []func()
+	closed bool
+}
+
+func newCheckQueue() *checkQueue {
+	queue := &checkQueue{}
+	queue.ready = sync.NewCond(&queue.mu)
+
+	return queue
+}
+
+// push queues a check, without ever blocking
+func (q *checkQueue) push(check func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.checks = append(q.checks, check)
+	q.ready.Signal()
+}
+
+// close stops the queue, once the queued checks are executed
+func (q *checkQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.ready.Signal()
+}
+
+// pop waits for the next check, and returns false once the queue is closed and empty
+func (q *checkQueue) pop() (func(), bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.checks) == 0 && !q.closed {
+		q.ready.Wait()
+	}
+
+	if len(q.checks) == 0 {
+		return nil, false
+	}
+
+	check := q.checks[0]
+	q.checks = q.checks[1:]
+
+	return check, true
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Markers of the doc comments whose examples are checked with --rustdoc
+var docCommentMarkers = []string{"///", "//!"}
+
+// Attributes of the code blocks of the doc comments which are still Rust
+// code for rustdoc (any other token, e.g. "text", being another language)
+var rustdocAttributes = map[string]bool{
+	"rust": true, "ignore": true, "no_run": true, "should_panic": true,
+	"compile_fail": true, "test_harness": true, "standalone_crate": true,
+}
+
+// isRustSource checks whether a discovered file is a Rust source file (--rustdoc)
+func isRustSource(path string) bool {
+	return strings.HasSuffix(path, ".rs")
+}
+
+// findRustdocFiles finds the Rust source files of the crates of the project
+// (src/**/*.rs of the root crate and of the crates in its subdirectories)
+func (dc *DocChecker) findRustdocFiles() ([]string, error) {
+	crateDirs, err := dc.crateDirs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+
+	for _, dir := range crateDirs {
+		srcDir := filepath.Join(dir, "src")
+
+		if _, err := os.Stat(srcDir); err != nil {
+			continue
+		}
+
+		err := filepath.WalkDir(srcDir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || !isRustSource(path) {
+				return err
+			}
+
+			files = append(files, path)
+			dc.noteDiscovery(path, true, discoveryRustdoc, "crate source file, with --rustdoc")
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// rustdocFenceInfo returns the info string of a code block of a doc comment as
+// in markdown: as for rustdoc, a block without language is Rust (e.g. "```"
+// or "```no_run" being "```rust" and "```rust,no_run")
+func rustdocFenceInfo(info string) string {
+	tokens := strings.FieldsFunc(info, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+
+	if len(tokens) == 0 {
+		return "rust"
+	}
+
+	for _, token := range tokens {
+		if !rustdocAttributes[token] && !fenceEditionRegex.MatchString(token) &&
+			!fenceErrorCodeRegex.MatchString(token) && !strings.Contains(token, "=") {
+			return info // e.g. "text"
+		}
+	}
+
+	if tokens[0] == "rust" {
+		return info
+	}
+
+	return "rust," + info
+}
+
+// rustdocMarkdown returns the markdown of the doc comments (/// and //!) of a
+// Rust source file, each other line being blank, so the lines of the snippets
+// are the ones of the source file
+func rustdocMarkdown(source string) string {
+	lines := strings.Split(source, "\n")
+	var opening codeFence
+	inCodeBlock := false
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		doc, isDoc := "", false
+
+		for _, marker := range docCommentMarkers {
+			// Not the "////" comments, which are ignored by rustdoc
+			if rest, ok := strings.CutPrefix(trimmed, marker); ok && !strings.HasPrefix(rest, "/") {
+				doc, isDoc = strings.TrimPrefix(rest, " "), true
+				break
+			}
+		}
+
+		if !isDoc {
+			lines[i] = ""
+			continue
+		}
+
+		if fence, isFence := parseCodeFence(doc); isFence && (!inCodeBlock || opening.closedBy(doc)) {
+			if !inCodeBlock {
+				opening = fence
+
+				if fence.info == "" {
+					doc = strings.TrimRight(doc, " ") + rustdocFenceInfo("")
+				} else {
+					doc = strings.Replace(doc, fence.info, rustdocFenceInfo(fence.info), 1)
+				}
+			}
+
+			inCodeBlock = !inCodeBlock
+		}
+
+		lines[i] = doc
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// sourceCrate returns the configured crate of a Rust source file (the one
+// of the innermost directory), or "" for the default one
+func (dc *DocChecker) sourceCrate(path string) string {
+	absPath, err := filepath.Abs(path)
+
+	if err != nil {
+		return ""
+	}
+
+	crate, depth := "", -1
+
+	for _, candidate := range dc.crates() {
+		rel, err := filepath.Rel(candidate.Path, absPath)
+
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		if d := len(strings.Split(filepath.ToSlash(candidate.Path), "/")); d > depth {
+			crate, depth = candidate.Name, d
+		}
+	}
+
+	if crate == dc.crates()[0].Name {
+		return ""
+	}
+
+	return crate
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// SARIF 2.1.0 log, limited to what is needed to report the failures
+// (see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html)
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine,omitempty"`
+}
+
+// writeSARIF writes the failures and warnings as a SARIF log, with a rule per error category
+// (or warning code), and locations pointing to the fences in the markdown files (relative to the project root)
+func writeSARIF(w io.Writer, results *Results, projectRoot string) error {
+	run := sarifRun{
+		Tool: sarifTool{
+			Driver: sarifDriver{
+				Name:           "doc-checker",
+				Version:        version,
+				InformationURI: "https://github.com/cchantep/tnuctipun/tree/master/tools/doc-checker",
+				Rules:          []sarifRule{},
+			},
+		},
+		Results: []sarifResult{},
+	}
+
+	ruleIndexes := make(map[string]int)
+
+	ruleIndex := func(id, description string) int {
+		index, exists := ruleIndexes[id]
+
+		if !exists {
+			index = len(run.Tool.Driver.Rules)
+			ruleIndexes[id] = index
+
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+				ID:               id,
+				ShortDescription: sarifMessage{Text: description},
+			})
+		}
+
+		return index
+	}
+
+	// Sort the files, for a stable output
+	files := make([]string, 0, len(results.Files))
+
+	for file := range results.Files {
+		files = append(files, file)
+	}
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		for _, failure := range results.Files[file].Failures {
+			// Line 1 if the snippet can't be located, as the region is required
+			startLine := failure.Line
+
+			if startLine < 1 {
+				startLine = 1
+			}
+
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    failure.Category,
+				RuleIndex: ruleIndex(failure.Category, categoryDescription(failure.Category)),
+				Level:     "error",
+				Message:   sarifMessage{Text: failure.Message},
+				Locations: []sarifLocation{{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{
+							URI:       relativeTo(projectRoot, file),
+							URIBaseID: "%SRCROOT%",
+						},
+						Region: sarifRegion{
+							StartLine: startLine,
+							EndLine:   failure.EndLine,
+						},
+					},
+				}},
+				PartialFingerprints: map[string]string{
+					"docCheckerFingerprint/v1": failure.Fingerprint,
+				},
+			})
+		}
+	}
+
+	for _, warning := range results.Warnings {
+		result := sarifResult{
+			RuleID:    warning.Code,
+			RuleIndex: ruleIndex(warning.Code, warningDescription(warning.Code)),
+			Level:     warning.Level,
+			Message:   sarifMessage{Text: warning.Message},
+			Locations: []sarifLocation{},
+		}
+
+		if warning.File != "" {
+			// Line 1 for the warnings about the whole file
+			startLine := warning.Line
+
+			if startLine < 1 {
+				startLine = 1
+			}
+
+			result.Locations = append(result.Locations, sarifLocation{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{
+						URI:       relativeTo(projectRoot, warning.File),
+						URIBaseID: "%SRCROOT%",
+					},
+					Region: sarifRegion{StartLine: startLine},
+				},
+			})
+		}
+
+		run.Results = append(run.Results, result)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
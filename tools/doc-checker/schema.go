@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Version of the schema of the JSON results: it's only incremented on breaking
+// changes (e.g. renamed or removed fields), new fields can be added in the same version
+const schemaVersion = 1
+
+// resultsSchema returns the JSON Schema of the results, derived from the Go types
+// (so that it's always in sync with the output)
+func resultsSchema() map[string]interface{} {
+	defs := make(map[string]interface{})
+	root := schemaOf(reflect.TypeOf(Results{}), defs)
+
+	schema := map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "doc-checker results",
+		"description": "Results of doc-checker -o json (schema version " + strconv.Itoa(schemaVersion) + ")",
+		"$defs":       defs,
+	}
+
+	for key, value := range root {
+		schema[key] = value
+	}
+
+	return schema
+}
+
+// schemaOf returns the schema of a type, registering the structs in defs
+func schemaOf(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem(), defs)
+
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), defs)}
+
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), defs)}
+
+	case reflect.Struct:
+		if t == reflect.TypeOf(Results{}) {
+			return structSchema(t, defs)
+		}
+
+		if _, exists := defs[t.Name()]; !exists {
+			defs[t.Name()] = nil // placeholder, for the recursive types
+			defs[t.Name()] = structSchema(t, defs)
+		}
+
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	}
+
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = schemaOf(field.Type, defs)
+
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
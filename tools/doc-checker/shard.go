@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Status of the snippets checked by the other shards, with --shard
+const statusOtherShard = "other_shard"
+
+// ShardInfo is the part of the snippets checked by a run, with --shard
+type ShardInfo struct {
+	Index int `json:"index"` // From 1 to Count
+	Count int `json:"count"`
+}
+
+func (s ShardInfo) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// parseShard parses the K/N value of --shard (e.g. 2/4)
+func parseShard(value string) (*ShardInfo, error) {
+	index, count, found := strings.Cut(value, "/")
+	shard := &ShardInfo{}
+	var err1, err2 error
+
+	shard.Index, err1 = strconv.Atoi(strings.TrimSpace(index))
+	shard.Count, err2 = strconv.Atoi(strings.TrimSpace(count))
+
+	if !found || err1 != nil || err2 != nil || shard.Count < 1 || shard.Index < 1 || shard.Index > shard.Count {
+		return nil, fmt.Errorf("invalid --shard '%s' (expected K/N, with 1 <= K <= N, e.g. 2/4)", value)
+	}
+
+	return shard, nil
+}
+
+// snippetShard returns the shard (from 1 to count) of a snippet, from the hash
+// of its file (relative to the project root) and identifier: so a snippet stays
+// in the same shard whatever the machine, or the other snippets
+func snippetShard(relPath, snippetID string, count int) int {
+	hash := sha256.Sum256([]byte(relPath + "#" + snippetID))
+
+	return int(binary.BigEndian.Uint64(hash[:8])%uint64(count)) + 1
+}
+
+// inShard checks whether a snippet is checked by this run (always without --shard)
+func (dc *DocChecker) inShard(filePath string, snippet Snippet) bool {
+	shard := dc.config.Shard
+
+	return shard == nil || snippetShard(dc.relativePath(filePath), snippet.ID, shard.Count) == shard.Index
+}
+
+// mergeShardResults combines the JSON results of the shards of a run (one per
+// shard, from 1 to N) into the results of the whole run: the outcome of each
+// snippet is the one of its shard, and the findings of all the shards (e.g.
+// failures) are kept, the ones reported by every shard (e.g. lint warnings) once
+func mergeShardResults(shards []*Results) (*Results, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("no shard results to merge")
+	}
+
+	count := 0
+	seen := make(map[int]bool)
+
+	for i, shard := range shards {
+		if shard.SchemaVersion != schemaVersion {
+			return nil, fmt.Errorf("results %d: schema version %d, expected %d", i+1, shard.SchemaVersion, schemaVersion)
+		}
+
+		if shard.Shard == nil {
+			return nil, fmt.Errorf("results %d: not the results of a shard (see --shard)", i+1)
+		}
+
+		if count == 0 {
+			count = shard.Shard.Count
+		}
+
+		if shard.Shard.Count != count {
+			return nil, fmt.Errorf("results %d: shard %s of another partition than %d shards", i+1, shard.Shard, count)
+		}
+
+		if seen[shard.Shard.Index] {
+			return nil, fmt.Errorf("results %d: shard %s given twice", i+1, shard.Shard)
+		}
+
+		seen[shard.Shard.Index] = true
+	}
+
+	for index := 1; index <= count; index++ {
+		if !seen[index] {
+			return nil, fmt.Errorf("missing the results of shard %d/%d", index, count)
+		}
+	}
+
+	merged := newResults()
+	warningsAsErrors := false
+
+	for _, shard := range shards {
+		mergeSummary(&merged.Summary, shard.Summary)
+
+		for file, result := range shard.Files {
+			merged.Files[file] = mergeFileResult(merged.Files[file], result)
+		}
+
+		if merged.Parity == nil {
+			merged.Parity = shard.Parity
+		}
+
+		for _, warning := range shard.Warnings {
+			warningsAsErrors = warningsAsErrors || warning.Level == "error"
+
+			if !containsWarning(merged.Warnings, warning) {
+				merged.Warnings = append(merged.Warnings, warning)
+				merged.Summary.Warnings++
+				merged.Summary.WarningsByCode[warning.Code]++
+			}
+		}
+	}
+
+	for file, result := range merged.Files {
+		sort.SliceStable(result.Failures, func(i, j int) bool { return result.Failures[i].Line < result.Failures[j].Line })
+		sort.SliceStable(result.Retries, func(i, j int) bool { return result.Retries[i].Line < result.Retries[j].Line })
+		merged.Files[file] = result
+	}
+
+	merged.summarizeModes(&Config{WarningsAsErrors: warningsAsErrors})
+
+	return merged, nil
+}
+
+// mergeSummary adds the counts of the summary of a shard: the snippets are
+// counted by their shard only, while every shard finds the same ones (total)
+// in the same files
+func mergeSummary(merged *Summary, shard Summary) {
+	merged.TotalSnippets = max(merged.TotalSnippets, shard.TotalSnippets)
+	merged.FilesProcessed = max(merged.FilesProcessed, shard.FilesProcessed)
+	merged.ValidSnippets += shard.ValidSnippets
+	merged.WarnedSnippets += shard.WarnedSnippets
+	merged.FailedSnippets += shard.FailedSnippets
+	merged.SkippedSnippets += shard.SkippedSnippets
+	merged.IgnoredSnippets += shard.IgnoredSnippets
+	merged.FilteredSnippets += shard.FilteredSnippets
+	merged.PreviewSnippets += shard.PreviewSnippets
+	merged.ExcludedFailures += shard.ExcludedFailures
+	merged.CacheHits += shard.CacheHits
+	merged.CacheMisses += shard.CacheMisses
+	merged.Toolchains = mergeToolchains(merged.Toolchains, shard.Toolchains)
+	merged.FeatureSets = mergeFeatureSets(merged.FeatureSets, shard.FeatureSets)
+
+	for _, counts := range [][2]map[string]int{
+		{merged.IgnoreReasons, shard.IgnoreReasons},
+		{merged.ErrorsByCategory, shard.ErrorsByCategory},
+		{merged.ErrorsByCode, shard.ErrorsByCode},
+	} {
+		for key, count := range counts[1] {
+			counts[0][key] += count
+		}
+	}
+}
+
+// mergeFileResult adds the results of a file by a shard to the ones of the
+// previous shards, each snippet having the outcome given by its own shard
+func mergeFileResult(merged, shard FileResult) FileResult {
+	if merged.Snippets == nil {
+		merged = FileResult{
+			SnippetsFound: shard.SnippetsFound,
+			Errors:        []string{},
+			Failures:      []Failure{},
+			Snippets:      append([]SnippetResult{}, shard.Snippets...),
+		}
+	} else {
+		for i, snippet := range shard.Snippets {
+			if i < len(merged.Snippets) && snippet.Status != statusOtherShard {
+				merged.Snippets[i] = snippet
+			}
+		}
+	}
+
+	merged.SnippetsValid += shard.SnippetsValid
+	merged.SnippetsFailed += shard.SnippetsFailed
+	merged.SnippetsSkipped += shard.SnippetsSkipped
+	merged.Failures = append(merged.Failures, shard.Failures...)
+	merged.Retries = append(merged.Retries, shard.Retries...)
+
+	// e.g. a file which can't be read, reported by every shard
+	for _, err := range shard.Errors {
+		if !containsCode(merged.Errors, err) {
+			merged.Errors = append(merged.Errors, err)
+		}
+	}
+
+	return merged
+}
+
+// containsWarning checks whether a warning was already reported
+func containsWarning(warnings []Warning, warning Warning) bool {
+	for _, w := range warnings {
+		if reflect.DeepEqual(w, warning) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeShardFiles reads the JSON results of the shards (-o json), and merges them
+func mergeShardFiles(paths []string) (*Results, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no shard results to merge (e.g. doc-checker merge shard-*.json)")
+	}
+
+	var shards []*Results
+
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read shard results: %w", err)
+		}
+
+		var results Results
+
+		if err := json.Unmarshal(content, &results); err != nil {
+			return nil, fmt.Errorf("%s: invalid results: %w", path, err)
+		}
+
+		shards = append(shards, &results)
+	}
+
+	return mergeShardResults(shards)
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Languages of the shell blocks, whose commands are checked
+var shellLanguages = map[string]bool{"sh": true, "bash": true, "shell": true, "zsh": true, "console": true}
+
+// Builtins and keywords of the shell, which are not looked up in the PATH
+var shellBuiltins = []string{
+	".", ":", "[", "[[", "alias", "bg", "break", "builtin", "cd", "command", "continue", "declare",
+	"echo", "eval", "exec", "exit", "export", "false", "fg", "getopts", "hash", "jobs", "kill",
+	"let", "local", "popd", "printf", "pushd", "pwd", "read", "readonly", "return", "set", "shift",
+	"source", "test", "trap", "true", "type", "ulimit", "umask", "unalias", "unset", "wait",
+}
+
+// Words before the command (e.g. `sudo make install`, `if cargo test; then`)
+var shellPrefixes = map[string]bool{
+	"!": true, "{": true, "if": true, "then": true, "else": true, "elif": true, "do": true,
+	"while": true, "until": true, "time": true, "sudo": true, "nohup": true, "env": true,
+}
+
+// Words ending a compound command (e.g. `fi`), or starting one without a command (e.g. `for x in ...`)
+var shellNoCommand = map[string]bool{
+	"}": true, ")": true, "fi": true, "done": true, "esac": true, "for": true, "case": true,
+	"select": true, "function": true,
+}
+
+// Variable assignment before a command (e.g. `RUST_LOG=debug cargo run`)
+var shellAssignmentRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// Name of a command, or a path to a script (not a placeholder, e.g. <command>)
+var shellCommandRegex = regexp.MustCompile(`^[A-Za-z0-9_.~/+-]+$`)
+
+// Long flags in the help of a cargo command
+var cargoHelpFlagRegex = regexp.MustCompile(`--[A-Za-z0-9][A-Za-z0-9-]*`)
+
+// Dashes of the text editors (e.g. –release pasted from a rich text),
+// which the shell doesn't read as the start of a flag
+var typographicDashes = "‐‑‒–—―−"
+
+// shellWord is a word of a command line, or an operator (e.g. &&)
+type shellWord struct {
+	Text     string
+	Quoted   bool // At least partly quoted, so not a command nor a flag to check
+	Operator bool
+}
+
+// shellCommand is a simple command of a shell block (e.g. `cargo build --release`)
+type shellCommand struct {
+	Words []shellWord
+	Line  int // Line in the markdown file
+}
+
+// shellLines returns the command lines of a shell block, with their index in
+// the block, the continued lines (ending with \) being joined: all of them
+// but the comments and the bodies of the here-documents, or only the ones
+// after a "$ " prompt in a console block, or a block with such prompts (the
+// other ones being the output)
+func shellLines(lang string, lines []string) ([]string, []int) {
+	var commands []string
+	var indexes []int
+
+	prompted := lang == "console"
+
+	for _, line := range lines {
+		prompted = prompted || strings.HasPrefix(strings.TrimSpace(line), "$ ")
+	}
+
+	heredoc := ""
+	continued := false
+
+	for i, line := range lines {
+		if heredoc != "" {
+			if strings.TrimSpace(strings.TrimLeft(line, "\t")) == heredoc {
+				heredoc = ""
+			}
+
+			continue
+		}
+
+		if continued {
+			commands[len(commands)-1] += " " + strings.TrimSpace(line)
+		} else {
+			trimmed := strings.TrimSpace(line)
+
+			if prompted {
+				command, isCommand := strings.CutPrefix(trimmed, "$ ")
+
+				if !isCommand {
+					continue
+				}
+
+				trimmed = command
+			}
+
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+
+			commands = append(commands, trimmed)
+			indexes = append(indexes, i)
+		}
+
+		last := commands[len(commands)-1]
+		continued = strings.HasSuffix(last, "\\")
+
+		if continued {
+			commands[len(commands)-1] = strings.TrimSuffix(last, "\\")
+			continue
+		}
+
+		heredoc = heredocDelimiter(last)
+	}
+
+	return commands, indexes
+}
+
+// heredocDelimiter returns the delimiter of the here-document started by a
+// command line (e.g. EOF for `cat <<'EOF' > file`), or "" if none
+func heredocDelimiter(line string) string {
+	words := splitShellWords(line)
+
+	for i, word := range words {
+		if word.Operator && (word.Text == "<<" || word.Text == "<<-") && i+1 < len(words) {
+			return words[i+1].Text
+		}
+	}
+
+	return ""
+}
+
+// splitShellWords splits a command line into words and operators, with the
+// quotes removed, and without its comment
+func splitShellWords(line string) []shellWord {
+	var words []shellWord
+	var current strings.Builder
+
+	inWord, quoted := false, false
+
+	flush := func() {
+		if inWord {
+			words = append(words, shellWord{Text: current.String(), Quoted: quoted})
+		}
+
+		current.Reset()
+		inWord, quoted = false, false
+	}
+
+	runes := []rune(line)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == ' ' || r == '\t':
+			flush()
+
+		case r == '#' && !inWord:
+			return words
+
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inWord, quoted = true, true
+
+		case r == '\'' || r == '"':
+			end := i + 1
+
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+
+			current.WriteString(string(runes[i+1 : min(end, len(runes))]))
+			inWord, quoted = true, true
+			i = end
+
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '(':
+			// Command substitution, as a part of the word
+			depth := 0
+
+			for ; i < len(runes); i++ {
+				current.WriteRune(runes[i])
+
+				if runes[i] == '(' {
+					depth++
+				} else if runes[i] == ')' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+
+			inWord, quoted = true, true
+
+		case strings.ContainsRune("|&;()<>", r):
+			// Redirection of a file descriptor (e.g. 2>&1)
+			if isDigits(current.String()) && (r == '<' || r == '>') && !quoted {
+				inWord = false
+			}
+
+			flush()
+
+			end := i + 1
+
+			for end < len(runes) && strings.ContainsRune("|&<>-", runes[end]) && (runes[i] != ';' && runes[i] != '(' && runes[i] != ')') {
+				end++
+			}
+
+			// Duplicated file descriptor (e.g. >&2)
+			for end < len(runes) && (r == '<' || r == '>') && runes[end] >= '0' && runes[end] <= '9' {
+				end++
+			}
+
+			words = append(words, shellWord{Text: string(runes[i:end]), Operator: true})
+			i = end - 1
+
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	flush()
+
+	return words
+}
+
+// isDigits checks whether a word is a (non empty) number
+func isDigits(word string) bool {
+	return word != "" && strings.Trim(word, "0123456789") == ""
+}
+
+// shellCommands returns the simple commands of a command line (e.g. the ones
+// of a pipeline), without the redirections (e.g. `> out.txt`)
+func shellCommands(line string, lineNumber int) []shellCommand {
+	var commands []shellCommand
+	var words []shellWord
+
+	all := splitShellWords(line)
+
+	for i := 0; i < len(all); i++ {
+		word := all[i]
+
+		if !word.Operator {
+			words = append(words, word)
+			continue
+		}
+
+		// The target of a redirection (unless duplicating a file descriptor, e.g. 2>&1)
+		if strings.ContainsAny(word.Text, "<>") {
+			if !isDigits(strings.TrimLeft(word.Text, "<>&")) && i+1 < len(all) && !all[i+1].Operator {
+				i++
+			}
+
+			continue
+		}
+
+		if len(words) > 0 {
+			commands = append(commands, shellCommand{Words: words, Line: lineNumber})
+		}
+
+		words = nil
+	}
+
+	if len(words) > 0 {
+		commands = append(commands, shellCommand{Words: words, Line: lineNumber})
+	}
+
+	return commands
+}
+
+// name returns the index of the word naming the command (e.g. 1 for `sudo
+// make`), or -1 if it has none (e.g. `fi`, `for x in a b`, or `X=1`)
+func (c shellCommand) name() int {
+	for i, word := range c.Words {
+		switch {
+		case word.Quoted:
+			return -1
+		case shellNoCommand[word.Text] || strings.HasSuffix(word.Text, "()"):
+			return -1
+		case shellPrefixes[word.Text] || shellAssignmentRegex.MatchString(word.Text):
+			continue
+		case strings.HasPrefix(word.Text, "-") && i > 0:
+			continue // Option of a prefix (e.g. sudo -E)
+		default:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// lintShellBlocks flags the commands of the shell blocks (```sh, ```bash,
+// or ```console for the lines after a "$ " prompt) which are neither builtins,
+// nor found in the PATH or in the [shell] commands of the configuration
+// (e.g. a typo in an install instruction), or the scripts which don't exist;
+// and the flags which can't work (e.g. –release with a typographic dash).
+// With --check-cargo-commands, the cargo commands are also checked against
+// their help (e.g. `cargo biuld`, or `cargo build --relase`)
+func (dc *DocChecker) lintShellBlocks(filePath string, lines []string) {
+	for _, block := range codeBlocks(lines) {
+		if !shellLanguages[block.Info.Lang] || block.Info.Ignore {
+			continue
+		}
+
+		// Directory of the commands, as changed by cd (unknown if "")
+		cwd := dc.config.ProjectRoot
+		commandLines, indexes := shellLines(block.Info.Lang, block.Lines)
+
+		for i, line := range commandLines {
+			for _, command := range shellCommands(line, block.Line+indexes[i]+1) {
+				nameIndex := command.name()
+
+				if nameIndex < 0 {
+					continue
+				}
+
+				name := command.Words[nameIndex].Text
+				args := command.Words[nameIndex+1:]
+
+				if name == "cd" {
+					cwd = changeDirectory(cwd, args)
+				}
+
+				dc.lintShellCommand(filePath, filepath.Dir(filePath), cwd, command, name, args)
+			}
+		}
+	}
+}
+
+// changeDirectory returns the directory after `cd ARGS` (or "" if unknown)
+func changeDirectory(cwd string, args []shellWord) string {
+	if cwd == "" || len(args) != 1 || args[0].Quoted || strings.ContainsAny(args[0].Text[:1], "-~") ||
+		strings.Contains(args[0].Text, "$") || filepath.IsAbs(args[0].Text) {
+		return ""
+	}
+
+	return filepath.Join(cwd, args[0].Text)
+}
+
+// lintShellCommand checks a command of a shell block, and its flags
+func (dc *DocChecker) lintShellCommand(filePath, fileDir, cwd string, command shellCommand, name string, args []shellWord) {
+	warn := func(code, message string) {
+		dc.addWarning(Warning{Code: code, File: filePath, Line: command.Line, Message: message})
+	}
+
+	if shellCommandRegex.MatchString(name) && !dc.shellCommandExists(name, fileDir, cwd) {
+		if strings.Contains(name, "/") {
+			warn(warnUnknownCommand, fmt.Sprintf("Script %s doesn't exist", name))
+		} else {
+			suggestion := ""
+
+			// Not for the short names, as close to too many others (e.g. dot and cat)
+			if len(name) > 3 {
+				suggestion = suggestConfigName(name, dc.knownShellCommands())
+			}
+
+			warn(warnUnknownCommand, fmt.Sprintf("Command %s not found (neither a builtin, in the PATH, nor in the [shell] commands of the configuration)%s",
+				name, suggestion))
+		}
+	}
+
+	for _, arg := range args {
+		if arg.Quoted {
+			continue
+		}
+
+		if dash := []rune(arg.Text); len(dash) > 1 && strings.ContainsRune(typographicDashes, dash[0]) {
+			warn(warnBrokenFlag, fmt.Sprintf("Flag %s of %s starts with a typographic dash (U+%04X), instead of -", arg.Text, name, dash[0]))
+		} else if strings.HasPrefix(arg.Text, "---") {
+			warn(warnBrokenFlag, fmt.Sprintf("Flag %s of %s starts with more than two dashes", arg.Text, name))
+		}
+	}
+
+	if name == "cargo" && dc.config.CheckCargoCommands {
+		dc.lintCargoCommand(warn, args)
+	}
+}
+
+// shellCommandExists checks whether a command of a shell block is a builtin,
+// a configured command, or is found in the PATH; or, if it's a relative
+// path (e.g. ./scripts/release.sh), whether it exists from the current
+// directory of the commands, or from the directory of the markdown file
+func (dc *DocChecker) shellCommandExists(name, fileDir, cwd string) bool {
+	if strings.Contains(name, "/") {
+		if filepath.IsAbs(name) || strings.HasPrefix(name, "~") {
+			return true
+		}
+
+		for _, dir := range []string{cwd, fileDir} {
+			if _, err := os.Stat(filepath.Join(dir, name)); dir != "" && err == nil {
+				return true
+			}
+		}
+
+		return cwd == "" // Unknown directory (e.g. after `cd $HOME`)
+	}
+
+	if containsCode(shellBuiltins, name) || containsCode(dc.config.ShellCommands, name) || name == "doc-checker" {
+		return true
+	}
+
+	if dc.pathCommands == nil {
+		dc.pathCommands = make(map[string]bool)
+	}
+
+	found, looked := dc.pathCommands[name]
+
+	if !looked {
+		_, err := exec.LookPath(name)
+		found = err == nil
+		dc.pathCommands[name] = found
+	}
+
+	return found
+}
+
+// knownShellCommands returns the commands known to exist, for the suggestions:
+// the builtins, the configured commands, and the ones already found in the PATH
+func (dc *DocChecker) knownShellCommands() []string {
+	known := append(append([]string{"doc-checker"}, shellBuiltins...), dc.config.ShellCommands...)
+
+	for name, found := range dc.pathCommands {
+		if found {
+			known = append(known, name)
+		}
+	}
+
+	sort.Strings(known)
+
+	return known
+}
+
+// lintCargoCommand checks the subcommand and long flags of a cargo command
+// (--check-cargo-commands), with the help of the subcommand
+func (dc *DocChecker) lintCargoCommand(warn func(code, message string), args []shellWord) {
+	subcommand := ""
+	var flags []string
+
+	for _, arg := range args {
+		// Arguments of the program (e.g. cargo run -- --port 8080)
+		if arg.Text == "--" {
+			break
+		}
+
+		switch {
+		case arg.Quoted:
+			continue
+		case subcommand == "" && (strings.HasPrefix(arg.Text, "-") || strings.HasPrefix(arg.Text, "+")):
+			continue // Options of cargo itself (e.g. -q), or the toolchain (e.g. +nightly)
+		case subcommand == "":
+			subcommand = arg.Text
+		case strings.HasPrefix(arg.Text, "--"):
+			flag, _, _ := strings.Cut(arg.Text, "=")
+			flags = append(flags, flag)
+		}
+	}
+
+	subcommands, listed := dc.cargoSubcommands()
+
+	// Not if cargo itself can't be run (e.g. its toolchain can't be installed)
+	if subcommand == "" || !shellCommandRegex.MatchString(subcommand) || !listed {
+		return
+	}
+
+	if !containsCode(subcommands, subcommand) {
+		warn(warnUnknownCommand, fmt.Sprintf("Cargo command %s not found (neither built in, nor installed)%s",
+			subcommand, suggestConfigName(subcommand, subcommands)))
+
+		return
+	}
+
+	help := dc.cargoHelp(subcommand)
+
+	if help == "" {
+		return
+	}
+
+	known := cargoHelpFlagRegex.FindAllString(help, -1)
+
+	for _, flag := range flags {
+		if !containsCode(known, flag) {
+			warn(warnBrokenFlag, fmt.Sprintf("Flag %s of cargo %s not found in its help%s", flag, subcommand, suggestConfigName(flag, known)))
+		}
+	}
+}
+
+// cargoHelp returns the help of a cargo subcommand (loaded once per subcommand),
+// or "" if it can't be loaded
+func (dc *DocChecker) cargoHelp(subcommand string) string {
+	if dc.cargoHelps == nil {
+		dc.cargoHelps = make(map[string]string)
+	}
+
+	help, loaded := dc.cargoHelps[subcommand]
+
+	if !loaded {
+		output, _ := dc.cargoCommand(dc.config.ProjectRoot, subcommand, "--help").Output()
+		help = string(output)
+		dc.cargoHelps[subcommand] = help
+	}
+
+	return help
+}
+
+// cargoSubcommands returns the subcommands listed by `cargo --list` (loaded
+// once), i.e. the built-in ones, their aliases, and the installed plugins
+// (e.g. set-version of cargo-edit), and whether they could be listed
+func (dc *DocChecker) cargoSubcommands() ([]string, bool) {
+	if dc.cargoListLoaded {
+		return dc.cargoList, dc.cargoList != nil
+	}
+
+	dc.cargoListLoaded = true
+	output, err := dc.cargoCommand(dc.config.ProjectRoot, "--list").Output()
+
+	if err != nil {
+		return nil, false
+	}
+
+	dc.cargoList = []string{}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && strings.HasPrefix(line, " ") {
+			dc.cargoList = append(dc.cargoList, fields[0])
+		}
+	}
+
+	return dc.cargoList, true
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Names given to the snippets with the id=NAME attribute
+var snippetNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// snippetRefs returns the names of the earlier snippets a snippet builds on:
+// the one it continues (continues=NAME), then the ones it requires
+// (requires=NAME or requires="NAME,...")
+func snippetRefs(snippet Snippet) ([]string, error) {
+	var refs []string
+
+	if name, exists := snippet.Attrs["continues"]; exists {
+		if strings.Contains(name, ",") {
+			return nil, fmt.Errorf("invalid continues=%s: a snippet continues a single one (see requires=)", name)
+		}
+
+		refs = append(refs, strings.TrimSpace(name))
+	}
+
+	if names, exists := snippet.Attrs["requires"]; exists {
+		for _, name := range strings.Split(names, ",") {
+			refs = append(refs, strings.TrimSpace(name))
+		}
+	}
+
+	return refs, nil
+}
+
+// resolveSnippetRefs names the snippets with an id=NAME attribute, and gives the
+// snippets the code of the earlier snippets they build on: the setup ones, and
+// the ones of continues= or requires= (transitively, each one once, in the order of the file)
+func resolveSnippetRefs(snippets []Snippet) ([]Snippet, error) {
+	index := make(map[string]int)
+	chains := make([][]int, len(snippets)) // Earlier snippets each one builds on
+	var setups []int                       // Setup snippets so far, prepended to the next ones
+
+	for i := range snippets {
+		snippet := &snippets[i]
+
+		if name, named := snippet.Attrs["id"]; named {
+			if !snippetNameRegex.MatchString(name) {
+				return nil, fmt.Errorf("line %d: invalid id=%s: only letters, digits, '_' and '-' are allowed", snippet.StartLine, name)
+			}
+
+			snippet.ID = name
+		}
+
+		if previous, exists := index[snippet.ID]; exists {
+			return nil, fmt.Errorf("line %d: duplicate id %s (already the one of the snippet at line %d)",
+				snippet.StartLine, snippet.ID, snippets[previous].StartLine)
+		}
+
+		refs, err := snippetRefs(*snippet)
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", snippet.StartLine, err)
+		}
+
+		// Only the earlier snippets, so there is no cycle
+		var chain []int
+		included := make(map[int]bool)
+		earlier := [][]int{setups}
+
+		for _, ref := range refs {
+			j, exists := index[ref]
+
+			if !exists {
+				return nil, fmt.Errorf("line %d: no snippet with id=%s before this one", snippet.StartLine, ref)
+			}
+
+			earlier = append(earlier, append(append([]int{}, chains[j]...), j))
+		}
+
+		for _, group := range earlier {
+			for _, k := range group {
+				if !included[k] {
+					included[k] = true
+					chain = append(chain, k)
+				}
+			}
+		}
+
+		sort.Ints(chain)
+
+		var preamble strings.Builder
+
+		for _, k := range chain {
+			fmt.Fprintf(&preamble, "// %s (line %d)\n%s\n\n", snippets[k].ID, snippets[k].StartLine, snippets[k].Content)
+		}
+
+		chains[i] = chain
+		snippet.Preamble = preamble.String()
+		index[snippet.ID] = i
+
+		if snippet.Setup {
+			setups = append(setups, i)
+		}
+	}
+
+	return snippets, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RunState is the summary of the latest run for a project,
+// printed by `doc-checker status` without re-running the compilation
+type RunState struct {
+	ProjectRoot string         `json:"project_root"`
+	FinishedAt  time.Time      `json:"finished_at"`
+	Scope       []string       `json:"scope"` // Files/directories given on the command line (empty for all)
+	Summary     Summary        `json:"summary"`
+	FailedFiles map[string]int `json:"failed_files"` // Number of failed snippets per file (relative path)
+}
+
+// stateFile returns the path of the state file of the project,
+// in the user cache directory (keyed by a hash of the project root)
+func stateFile(projectRoot string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve cache directory: %w", err)
+	}
+
+	rootHash := sha256.Sum256([]byte(projectRoot))
+
+	return filepath.Join(cacheDir, "doc-checker", "state", fmt.Sprintf("%x.json", rootHash[:8])), nil
+}
+
+// saveRunState writes the summary of the run as the latest state of the project
+func saveRunState(config *Config, results *Results, finishedAt time.Time) error {
+	path, err := stateFile(config.ProjectRoot)
+
+	if err != nil {
+		return err
+	}
+
+	state := RunState{
+		ProjectRoot: config.ProjectRoot,
+		FinishedAt:  finishedAt,
+		Scope:       append([]string{}, config.Files...),
+		Summary:     results.Summary,
+		FailedFiles: make(map[string]int),
+	}
+
+	for file, result := range results.Files {
+		if result.SnippetsFailed > 0 {
+			state.FailedFiles[relativeTo(config.ProjectRoot, file)] = result.SnippetsFailed
+		}
+	}
+
+	content, err := json.MarshalIndent(state, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	// Write then rename, so a concurrent status never reads a partial file
+	tmpPath := path + ".tmp"
+
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// loadRunState reads the latest state of the project, or nil if there is none
+func loadRunState(projectRoot string) (*RunState, error) {
+	path, err := stateFile(projectRoot)
+
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var state RunState
+
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+
+	return &state, nil
+}
+
+// printRunState prints the latest state in a human readable way
+func printRunState(w io.Writer, state *RunState, now time.Time) {
+	scope := "all files"
+
+	if len(state.Scope) > 0 {
+		scope = strings.Join(state.Scope, ", ")
+	}
+
+	fmt.Fprintf(w, "Last run: %s ago (%s), on %s\n",
+		formatAge(now.Sub(state.FinishedAt)), state.FinishedAt.Local().Format(time.RFC1123), scope)
+
+	summary := state.Summary
+
+	fmt.Fprintf(w, "Snippets: %d total, %d valid, %d failed, %d skipped (%d files)\n",
+		summary.TotalSnippets, summary.ValidSnippets, summary.FailedSnippets,
+		summary.SkippedSnippets, summary.FilesProcessed)
+
+	if summary.Warnings > 0 {
+		fmt.Fprintf(w, "Warnings: %d\n", summary.Warnings)
+	}
+
+	if len(state.FailedFiles) == 0 {
+		if summary.FailedSnippets == 0 {
+			fmt.Fprintln(w, colorSuccess("Documentation snippets are valid"))
+		}
+
+		return
+	}
+
+	files := make([]string, 0, len(state.FailedFiles))
+
+	for file := range state.FailedFiles {
+		files = append(files, file)
+	}
+
+	sort.Strings(files)
+
+	fmt.Fprintln(w, colorError("Failing files:"))
+
+	for _, file := range files {
+		fmt.Fprintf(w, "  • %s: %d failed\n", file, state.FailedFiles[file])
+	}
+}
+
+// formatAge formats a duration as a rough age (e.g. "3 minutes")
+func formatAge(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+
+	switch {
+	case d < time.Minute:
+		return plural(int(d.Seconds()), "second")
+	case d < time.Hour:
+		return plural(int(d.Minutes()), "minute")
+	case d < 24*time.Hour:
+		return plural(int(d.Hours()), "hour")
+	default:
+		return plural(int(d.Hours()/24), "day")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// RunStats are the usage statistics of a run, appended to the local stats
+// file with --stats (never sent anywhere), for `doc-checker stats`
+type RunStats struct {
+	StartedAt   time.Time `json:"started_at"`
+	DurationMs  int64     `json:"duration_ms"`
+	Version     string    `json:"version"`
+	Platform    string    `json:"platform"` // e.g. linux/amd64
+	Files       int       `json:"files"`
+	Snippets    int       `json:"snippets"`
+	Failed      int       `json:"failed"`
+	CacheHits   int       `json:"cache_hits"`
+	CacheMisses int       `json:"cache_misses"`
+	Verdict     string    `json:"verdict"`
+}
+
+// StatsSummary summarizes the runs of the stats file
+type StatsSummary struct {
+	File             string    `json:"file"`
+	Runs             int       `json:"runs"`
+	FailedRuns       int       `json:"failed_runs"`
+	Since            time.Time `json:"since"`
+	Versions         []string  `json:"versions"`
+	MedianDurationMs int64     `json:"median_duration_ms"`
+	P90DurationMs    int64     `json:"p90_duration_ms"`
+	MaxDurationMs    int64     `json:"max_duration_ms"`
+	MedianSnippets   int       `json:"median_snippets"`
+	CacheHitRate     float64   `json:"cache_hit_rate"` // Over all the runs using the cache, from 0 to 1
+}
+
+// statsFile returns the path of the usage stats file, in the user cache directory
+func statsFile() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve cache directory: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "doc-checker", "stats.jsonl"), nil
+}
+
+// newRunStats returns the stats of a run
+func newRunStats(results *Results, startedAt time.Time, duration time.Duration) RunStats {
+	return RunStats{
+		StartedAt:   startedAt,
+		DurationMs:  duration.Milliseconds(),
+		Version:     version,
+		Platform:    runtime.GOOS + "/" + runtime.GOARCH,
+		Files:       results.Summary.FilesProcessed,
+		Snippets:    results.Summary.TotalSnippets,
+		Failed:      results.Summary.FailedSnippets,
+		CacheHits:   results.Summary.CacheHits,
+		CacheMisses: results.Summary.CacheMisses,
+		Verdict:     results.Verdict,
+	}
+}
+
+// appendRunStats appends the stats of a run to the stats file, as a JSON line
+func appendRunStats(path string, stats RunStats) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create stats directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return fmt.Errorf("failed to open stats file: %w", err)
+	}
+
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(stats)
+}
+
+// loadRunStats reads the runs of the stats file (skipping the invalid lines,
+// e.g. a partial one), or none if there is no stats file
+func loadRunStats(path string) ([]RunStats, error) {
+	file, err := os.Open(path)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read stats file: %w", err)
+	}
+
+	defer file.Close()
+
+	var runs []RunStats
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		var stats RunStats
+
+		if err := json.Unmarshal(scanner.Bytes(), &stats); err == nil {
+			runs = append(runs, stats)
+		}
+	}
+
+	return runs, scanner.Err()
+}
+
+// summarizeRunStats summarizes the runs of a stats file
+func summarizeRunStats(path string, runs []RunStats) StatsSummary {
+	summary := StatsSummary{File: path, Runs: len(runs), Versions: []string{}}
+
+	if len(runs) == 0 {
+		return summary
+	}
+
+	durations := make([]int64, len(runs))
+	snippets := make([]int, len(runs))
+	versions := make(map[string]bool)
+	hits, lookups := 0, 0
+	summary.Since = runs[0].StartedAt
+
+	for i, run := range runs {
+		durations[i], snippets[i] = run.DurationMs, run.Snippets
+		hits += run.CacheHits
+		lookups += run.CacheHits + run.CacheMisses
+
+		if run.Verdict == verdictFailed {
+			summary.FailedRuns++
+		}
+
+		if run.StartedAt.Before(summary.Since) {
+			summary.Since = run.StartedAt
+		}
+
+		if !versions[run.Version] {
+			versions[run.Version] = true
+			summary.Versions = append(summary.Versions, run.Version)
+		}
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	sort.Ints(snippets)
+
+	summary.MedianDurationMs = durations[len(durations)/2]
+	summary.P90DurationMs = durations[len(durations)*9/10]
+	summary.MaxDurationMs = durations[len(durations)-1]
+	summary.MedianSnippets = snippets[len(snippets)/2]
+
+	if lookups > 0 {
+		summary.CacheHitRate = float64(hits) / float64(lookups)
+	}
+
+	return summary
+}
+
+// printStatsSummary prints the summary of the runs in a human readable way
+func printStatsSummary(w io.Writer, summary StatsSummary) {
+	seconds := func(ms int64) string {
+		return fmt.Sprintf("%.1fs", float64(ms)/1000)
+	}
+
+	fmt.Fprintf(w, "Runs: %d since %s (%d failed), with doc-checker %v\n",
+		summary.Runs, summary.Since.Local().Format(time.RFC1123), summary.FailedRuns, summary.Versions)
+	fmt.Fprintf(w, "Duration: %s median, %s p90, %s max\n",
+		seconds(summary.MedianDurationMs), seconds(summary.P90DurationMs), seconds(summary.MaxDurationMs))
+	fmt.Fprintf(w, "Snippets: %d per run (median)\n", summary.MedianSnippets)
+	fmt.Fprintf(w, "Result cache: %.0f%% hit rate\n", summary.CacheHitRate*100)
+	fmt.Fprintf(w, "Stats file: %s\n", summary.File)
+}
+
+// showStats prints the summary of the stats file, and returns the exit code
+// (3 if there are no stats, e.g. --stats never given)
+func showStats(config *Config) int {
+	path, err := statsFile()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	runs, err := loadRunStats(path)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	if len(runs) == 0 {
+		fmt.Fprintf(os.Stderr, "No usage stats in %s (see --stats)\n", path)
+		return 3
+	}
+
+	summary := summarizeRunStats(path, runs)
+
+	if config.OutputFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(summary)
+	} else {
+		printStatsSummary(os.Stdout, summary)
+	}
+
+	return 0
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// SnippetEvent is the line written for each snippet with `-o jsonl`,
+// as soon as its outcome is known
+type SnippetEvent struct {
+	Type      string `json:"type"` // "snippet"
+	File      string `json:"file"`
+	SnippetID string `json:"snippet_id"`
+	Line      int    `json:"line"`
+	EndLine   int    `json:"end_line"`
+	Status    string `json:"status"` // valid, warnings, failed, excluded (--select, --ignore-codes), ignored, skipped, filtered (--api-filter), preview (--against-published) or unchecked (quick mode)
+
+	IgnoreReason string `json:"ignore_reason,omitempty"` // Why an ignored snippet is ignored
+
+	Snippet  string   `json:"snippet,omitempty"` // Name of the generated binary
+	Attempts int      `json:"attempts,omitempty"`
+	Failure  *Failure `json:"failure,omitempty"`
+
+	CompilerWarnings []string `json:"compiler_warnings,omitempty"` // With the warnings status
+	ClippyLints      []string `json:"clippy_lints,omitempty"`      // With the warnings status (--clippy)
+
+	Run *SnippetRun `json:"run,omitempty"` // With --run (or --check-output)
+}
+
+// SummaryEvent is the last line written with `-o jsonl`
+type SummaryEvent struct {
+	Type     string                `json:"type"` // "summary"
+	Summary  Summary               `json:"summary"`
+	Warnings []Warning             `json:"warnings"`
+	Modes    map[string]ModeResult `json:"modes"`
+	Verdict  string                `json:"verdict"`
+}
+
+// ErrorEvent is written with `-o jsonl` when the run fails
+type ErrorEvent struct {
+	Type    string `json:"type"` // "error"
+	Message string `json:"message"`
+}
+
+// writeEvent writes an event as a single JSON line
+func writeEvent(w io.Writer, event interface{}) error {
+	return json.NewEncoder(w).Encode(event)
+}
+
+// emitSnippet streams the outcome of a snippet, with `-o jsonl`
+func (dc *DocChecker) emitSnippet(filePath string, snippet Snippet, status string) {
+	if dc.stream == nil {
+		return
+	}
+
+	writeEvent(dc.stream, SnippetEvent{
+		Type:      "snippet",
+		File:      dc.relativePath(filePath),
+		SnippetID: snippet.ID,
+		Line:      snippet.StartLine,
+		EndLine:   snippet.EndLine,
+		Status:    status,
+
+		IgnoreReason: snippet.IgnoreReason,
+	})
+}
+
+// emitCompiled streams the outcome of the compilation of a generated snippet,
+// with `-o jsonl`
+func (dc *DocChecker) emitCompiled(binName, status string, attempts int, failure *Failure) {
+	if dc.stream == nil {
+		return
+	}
+
+	source := dc.manifest[binName]
+	event := SnippetEvent{
+		Type:      "snippet",
+		File:      dc.relativePath(source.File),
+		SnippetID: source.SnippetID,
+		Line:      source.StartLine,
+		EndLine:   source.EndLine,
+		Status:    status,
+		Snippet:   binName,
+		Attempts:  attempts,
+		Failure:   failure,
+
+		CompilerWarnings: dc.compilerWarnings[binName],
+	}
+
+	if lints, linted := dc.clippyLints[binName]; linted {
+		event.ClippyLints = lints
+	}
+
+	if run, ran := dc.snippetRuns[binName]; ran {
+		event.Run = &run
+	}
+
+	writeEvent(dc.stream, event)
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// syntaxError is a blatant syntax error of a snippet, found without compiling it,
+// at a position of its code (1-based)
+type syntaxError struct {
+	Line    int
+	Column  int
+	Message string
+	Opening *delimiter // Opening delimiter of a mismatched closing one
+}
+
+// delimiter is an opening delimiter of the code, not closed yet
+type delimiter struct {
+	Char   rune
+	Line   int
+	Column int
+}
+
+// Closing delimiters, by opening one
+var closingDelimiters = map[rune]rune{'(': ')', '[': ']', '{': '}'}
+
+// rustLexer scans the code of a snippet, for its delimiters and literals
+type rustLexer struct {
+	runes  []rune
+	pos    int
+	line   int
+	column int
+}
+
+func (l *rustLexer) peek(offset int) rune {
+	if l.pos+offset < len(l.runes) {
+		return l.runes[l.pos+offset]
+	}
+
+	return 0
+}
+
+func (l *rustLexer) next() rune {
+	r := l.runes[l.pos]
+	l.pos++
+
+	if r == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
+	return r
+}
+
+func (l *rustLexer) done() bool {
+	return l.pos >= len(l.runes)
+}
+
+func (l *rustLexer) errorAt(line, column int, format string, args ...interface{}) *syntaxError {
+	return &syntaxError{Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+// isIdentRune checks whether a character can be part of an identifier
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// checkRustSyntax looks for the blatant syntax errors of Rust code, which
+// a lexer finds without parsing it: the unbalanced or mismatched delimiters,
+// the unterminated strings and block comments, and the invalid character
+// literals; it returns the first one, or nil (which doesn't mean the code is valid)
+func checkRustSyntax(code string) *syntaxError {
+	l := &rustLexer{runes: []rune(code), line: 1, column: 1}
+	var open []delimiter
+
+	for !l.done() {
+		line, column := l.line, l.column
+		r := l.peek(0)
+		startsToken := l.pos == 0 || !isIdentRune(l.runes[l.pos-1])
+
+		switch {
+		case r == '/' && l.peek(1) == '/':
+			for !l.done() && l.peek(0) != '\n' {
+				l.next()
+			}
+
+		case r == '/' && l.peek(1) == '*':
+			if err := l.blockComment(); err != nil {
+				return err
+			}
+
+		case r == '"':
+			if err := l.quoted('"', "string literal"); err != nil {
+				return err
+			}
+
+		case startsToken && (r == 'r' || ((r == 'b' || r == 'c') && l.peek(1) == 'r')) && l.rawStringAhead():
+			if err := l.rawString(); err != nil {
+				return err
+			}
+
+		case startsToken && (r == 'b' || r == 'c') && l.peek(1) == '"':
+			l.next()
+
+			if err := l.quoted('"', "string literal"); err != nil {
+				return err
+			}
+
+		case startsToken && r == 'b' && l.peek(1) == '\'':
+			l.next()
+
+			if err := l.charLiteral(); err != nil {
+				return err
+			}
+
+		case r == '\'':
+			if err := l.charLiteral(); err != nil {
+				return err
+			}
+
+		case r == '(' || r == '[' || r == '{':
+			open = append(open, delimiter{Char: r, Line: line, Column: column})
+			l.next()
+
+		case r == ')' || r == ']' || r == '}':
+			if len(open) == 0 {
+				return l.errorAt(line, column, "unexpected closing delimiter `%c`", r)
+			}
+
+			last := open[len(open)-1]
+
+			if closingDelimiters[last.Char] != r {
+				err := l.errorAt(line, column, "mismatched closing delimiter `%c`", r)
+				err.Opening = &last
+
+				return err
+			}
+
+			open = open[:len(open)-1]
+			l.next()
+
+		case isIdentRune(r):
+			// The whole identifier (or number), so its last letter doesn't start a literal
+			for !l.done() && isIdentRune(l.peek(0)) {
+				l.next()
+			}
+
+		default:
+			l.next()
+		}
+	}
+
+	if len(open) > 0 {
+		last := open[len(open)-1]
+
+		return l.errorAt(last.Line, last.Column, "unclosed delimiter `%c`", last.Char)
+	}
+
+	return nil
+}
+
+// blockComment skips a block comment (possibly nested)
+func (l *rustLexer) blockComment() *syntaxError {
+	line, column := l.line, l.column
+	depth := 0
+
+	for !l.done() {
+		switch {
+		case l.peek(0) == '/' && l.peek(1) == '*':
+			l.next()
+			l.next()
+			depth++
+
+		case l.peek(0) == '*' && l.peek(1) == '/':
+			l.next()
+			l.next()
+
+			if depth--; depth == 0 {
+				return nil
+			}
+
+		default:
+			l.next()
+		}
+	}
+
+	return l.errorAt(line, column, "unterminated block comment")
+}
+
+// quoted skips a literal delimited by a quote, with its escapes
+func (l *rustLexer) quoted(quote rune, what string) *syntaxError {
+	line, column := l.line, l.column
+	l.next()
+
+	for !l.done() {
+		switch l.next() {
+		case '\\':
+			if !l.done() {
+				l.next()
+			}
+
+		case quote:
+			return nil
+		}
+	}
+
+	return l.errorAt(line, column, "unterminated %s", what)
+}
+
+// rawStringAhead checks whether a raw string starts at the position
+// (e.g. r"...", r#"..."#, br"..." or cr"..."), rather than a raw identifier (e.g. r#type)
+func (l *rustLexer) rawStringAhead() bool {
+	i := 1
+
+	if l.peek(0) != 'r' {
+		i++
+	}
+
+	for l.peek(i) == '#' {
+		i++
+	}
+
+	return l.peek(i) == '"'
+}
+
+// rawString skips a raw string, until its quote followed by as many # as its opening one
+func (l *rustLexer) rawString() *syntaxError {
+	line, column := l.line, l.column
+
+	for l.peek(0) != '#' && l.peek(0) != '"' {
+		l.next()
+	}
+
+	hashes := 0
+
+	for l.peek(0) == '#' {
+		l.next()
+		hashes++
+	}
+
+	l.next() // Opening quote
+
+	closing := "\"" + strings.Repeat("#", hashes)
+
+	for !l.done() {
+		if strings.HasPrefix(string(l.runes[l.pos:min(l.pos+len(closing), len(l.runes))]), closing) {
+			for range closing {
+				l.next()
+			}
+
+			return nil
+		}
+
+		l.next()
+	}
+
+	return l.errorAt(line, column, "unterminated raw string")
+}
+
+// charLiteral skips a character literal (e.g. 'a' or '\n'), or a lifetime
+// or a label (e.g. 'a or 'outer)
+func (l *rustLexer) charLiteral() *syntaxError {
+	line, column := l.line, l.column
+	l.next()
+
+	if l.done() || l.peek(0) == '\n' {
+		return l.errorAt(line, column, "unterminated character literal")
+	}
+
+	if l.peek(0) == '\\' {
+		l.next()
+
+		// Up to the closing quote of the escape (e.g. \n, \x1f or \u{1F600}), on the same line
+		for n := 0; n < len(`x1f`) && !l.done() && l.peek(0) != '\n' && (n == 0 || l.peek(0) != '\''); n++ {
+			if l.next() == 'u' && n == 0 && l.peek(0) == '{' {
+				for !l.done() && l.peek(0) != '}' && l.peek(0) != '\n' {
+					l.next()
+				}
+			}
+		}
+
+		if l.peek(0) != '\'' {
+			return l.errorAt(line, column, "unterminated character literal")
+		}
+
+		l.next()
+
+		return nil
+	}
+
+	// A single character
+	if l.peek(1) == '\'' {
+		l.next()
+		l.next()
+
+		return nil
+	}
+
+	if !isIdentRune(l.peek(0)) {
+		return l.errorAt(line, column, "unterminated character literal")
+	}
+
+	// A lifetime or a label, which isn't closed by a quote
+	for !l.done() && isIdentRune(l.peek(0)) {
+		l.next()
+	}
+
+	if l.peek(0) == '\'' {
+		return l.errorAt(line, column, "character literal may only contain one codepoint")
+	}
+
+	return nil
+}
+
+// precheckSyntax checks a snippet for the blatant syntax errors before
+// compiling it, and returns its SYNTAX_ERROR failure at the position of the
+// error in the markdown file if any, or nil (e.g. for the compile_fail
+// snippets, whose errors are expected, or with --no-syntax-precheck)
+func (dc *DocChecker) precheckSyntax(binName string) *Failure {
+	source := dc.manifest[binName]
+
+	if dc.config.NoSyntaxPrecheck || source.CompileFail {
+		return nil
+	}
+
+	code := dc.codes[binName]
+	err := checkRustSyntax(code)
+
+	if err == nil {
+		return nil
+	}
+
+	// At its line in the markdown file, if the code is the content of the block as is
+	// (e.g. not with included lines)
+	inMarkdown := len(source.Includes) == 0 && strings.Count(strings.TrimSuffix(code, "\n"), "\n")+1 == source.EndLine-source.StartLine-1
+
+	locate := func(line, column int) string {
+		if inMarkdown {
+			return fmt.Sprintf("%s:%d:%d", dc.relativePath(source.File), source.StartLine+line, column)
+		}
+
+		// In a part of the example, or in an included file
+		for _, lines := range source.Includes {
+			if l, ok := lines.locate(line); ok {
+				return fmt.Sprintf("%s:%d:%d", lines.File, l, column)
+			}
+		}
+
+		return fmt.Sprintf("line %d, column %d of the snippet", line, column)
+	}
+
+	message := fmt.Sprintf("%s: %s", locate(err.Line, err.Column), err.Message)
+
+	if err.Opening != nil {
+		message += fmt.Sprintf(", for `%c` at %s", err.Opening.Char, locate(err.Opening.Line, err.Opening.Column))
+	}
+
+	failure := dc.snippetFailure(binName, "SYNTAX_ERROR", message+" (found before compiling)")
+
+	return &failure
+}
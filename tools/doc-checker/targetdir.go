@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Stamp of the last run using a shared target dir (or result cache), for `doc-checker gc`
+const targetDirStamp = ".doc-checker-used"
+
+// targetDirsRoot returns the directory of the shared target dirs of the projects,
+// in the user cache directory
+func targetDirsRoot() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve cache directory: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "doc-checker", "target"), nil
+}
+
+// projectDirName returns the name of the directories of a project in the user
+// cache directory, after its name and a hash of its root (e.g. tnuctipun-1a2b3c4d)
+func projectDirName(projectRoot string) (string, error) {
+	projectRoot, err := filepath.Abs(projectRoot)
+
+	if err != nil {
+		return "", err
+	}
+
+	rootHash := sha256.Sum256([]byte(projectRoot))
+
+	return filepath.Base(projectRoot) + "-" + hex.EncodeToString(rootHash[:4]), nil
+}
+
+// prepareTargetDir returns the cargo target dir of the generated projects, shared
+// by the runs so the dependencies (and the crates) are compiled incrementally:
+// the --target-dir one, or the one of the project in the user cache directory
+// (e.g. ~/.cache/doc-checker/target/tnuctipun-1a2b3c4d), whose runs with a
+// --work-key have their own (e.g. tnuctipun-1a2b3c4d-editor), so the project
+// of a key isn't built in the target dir of another one; "" in hermetic mode,
+// where it's in the --out-dir
+func (dc *DocChecker) prepareTargetDir() (string, error) {
+	if dc.config.Hermetic {
+		return "", nil
+	}
+
+	targetDir := dc.config.TargetDir
+
+	if targetDir == "" {
+		root, err := targetDirsRoot()
+
+		if err != nil {
+			return "", err
+		}
+
+		name, err := projectDirName(dc.config.ProjectRoot)
+
+		if err != nil {
+			return "", err
+		}
+
+		if dc.config.WorkKey != "" {
+			name += "-" + dc.config.WorkKey
+		}
+
+		targetDir = filepath.Join(root, name)
+	}
+
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	// Last used now, so it's not collected
+	if err := os.WriteFile(filepath.Join(targetDir, targetDirStamp), []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write target directory stamp: %w", err)
+	}
+
+	return targetDir, nil
+}
+
+// projectCargoCommand returns the cargo command to run in a generated project,
+// with the shared target dir
+func (dc *DocChecker) projectCargoCommand(projectDir string, args ...string) *exec.Cmd {
+	cmd := dc.cargoCommand(projectDir, args...)
+
+	if dc.targetDir != "" {
+		cmd.Env = targetDirEnv(cmd.Env, dc.targetDir)
+	}
+
+	return cmd
+}
+
+// collectedDir is a shared target dir (or result cache) removed by `doc-checker gc`
+type collectedDir struct {
+	Path     string
+	Size     int64
+	LastUsed time.Time
+}
+
+// collectUnusedDirs removes the directories under root (e.g. the shared target
+// dirs of the projects) which were not used since the given time, and returns
+// them (by path)
+func collectUnusedDirs(root string, unusedSince time.Time) ([]collectedDir, error) {
+	entries, err := os.ReadDir(root)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var collected []collectedDir
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(root, entry.Name())
+		info, err := os.Stat(filepath.Join(path, targetDirStamp))
+
+		// Without stamp (e.g. interrupted by the first run), as old as the directory
+		if err != nil {
+			info, err = entry.Info()
+		}
+
+		if err != nil || !info.ModTime().Before(unusedSince) {
+			continue
+		}
+
+		size := directorySize(path)
+
+		if err := os.RemoveAll(path); err != nil {
+			return collected, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+
+		collected = append(collected, collectedDir{Path: path, Size: size, LastUsed: info.ModTime()})
+	}
+
+	sort.Slice(collected, func(i, j int) bool { return collected[i].Path < collected[j].Path })
+
+	return collected, nil
+}
+
+// directorySize returns the total size of the files under a directory
+func directorySize(dir string) int64 {
+	var size int64
+
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size
+}
+
+// formatSize formats a number of bytes (e.g. 1.5 GB)
+func formatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// runGC removes the shared target dirs and the result caches unused for more
+// than --max-age days (`doc-checker gc`), e.g. the ones of the projects which
+// are not checked anymore, or of the previous toolchains
+func runGC(config *Config, w io.Writer) int {
+	unusedSince := time.Now().AddDate(0, 0, -config.MaxAgeDays)
+	counts := make([]int, 2)
+
+	var freed int64
+
+	for i, rootFunc := range []func() (string, error){targetDirsRoot, resultCachesRoot} {
+		root, err := rootFunc()
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+
+		collected, err := collectUnusedDirs(root, unusedSince)
+
+		for _, dir := range collected {
+			freed += dir.Size
+			fmt.Fprintf(w, "Removed %s (%s, last used on %s)\n", dir.Path, formatSize(dir.Size), dir.LastUsed.Format("2006-01-02"))
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+
+		counts[i] = len(collected)
+	}
+
+	fmt.Fprintf(w, "Freed %s in %d target dir(s) and %d result cache(s) unused for more than %d days\n", formatSize(freed), counts[0], counts[1], config.MaxAgeDays)
+
+	return 0
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+// tomlValue is a value of a TOML document, with the line where it's defined
+type tomlValue struct {
+	Value interface{} // string, int64, float64, bool, a date/time, []interface{} or map[string]interface{}
+	Line  int
+}
+
+// tomlDocument is a parsed TOML document, flattened by dotted keys
+// (e.g. "crates.tnuctipun.path" for the key path in the [crates.tnuctipun] table)
+type tomlDocument struct {
+	Values map[string]tomlValue
+	Keys   []string // in the order of definition
+	Tables []string // table headers, in the order of definition
+
+	TableLines map[string]int // Line of each table header
+}
+
+// parseTOML parses a TOML document (the configuration files, and the Cargo
+// manifests), whose [[arrays of tables]] are named with their index (e.g.
+// "bin.0"); the document is decoded by go-toml, which rejects the invalid ones
+// (e.g. with a table defined twice), and its expressions are walked again for
+// the order and the line of its keys
+func parseTOML(content string) (*tomlDocument, error) {
+	var tree map[string]interface{}
+
+	if err := toml.Unmarshal([]byte(content), &tree); err != nil {
+		var decodeErr *toml.DecodeError
+
+		if errors.As(err, &decodeErr) {
+			line, _ := decodeErr.Position()
+			return nil, fmt.Errorf("line %d: %s", line, strings.TrimPrefix(decodeErr.Error(), "toml: "))
+		}
+
+		return nil, err
+	}
+
+	doc := &tomlDocument{Values: make(map[string]tomlValue), TableLines: make(map[string]int)}
+	arrayTables := make(map[string]int) // number of tables of each array (e.g. "bin")
+
+	var table []string
+	var parser unstable.Parser
+
+	parser.Reset([]byte(content))
+
+	for parser.NextExpression() {
+		expr := parser.Expression()
+
+		if expr.Kind != unstable.Table && expr.Kind != unstable.ArrayTable && expr.Kind != unstable.KeyValue {
+			continue
+		}
+
+		keys := expr.Key()
+		var parts []string
+		line := 0
+
+		for keys.Next() {
+			if line == 0 {
+				line = parser.Shape(keys.Node().Raw).Start.Line
+			}
+
+			parts = append(parts, string(keys.Node().Data))
+		}
+
+		if expr.Kind == unstable.KeyValue {
+			path := append(append([]string{}, table...), parts...)
+			key := strings.Join(path, ".")
+
+			doc.Values[key] = tomlValue{Value: tomlLookup(tree, path), Line: line}
+			doc.Keys = append(doc.Keys, key)
+
+			continue
+		}
+
+		// Within the last table of the arrays of tables the header is nested in
+		table = nil
+
+		for i, part := range parts {
+			table = append(table, part)
+			name := strings.Join(table, ".")
+
+			if count, isArray := arrayTables[name]; isArray && (i < len(parts)-1 || expr.Kind == unstable.Table) {
+				table = append(table, strconv.Itoa(count-1))
+			}
+		}
+
+		if expr.Kind == unstable.ArrayTable {
+			name := strings.Join(table, ".")
+			table = append(table, strconv.Itoa(arrayTables[name]))
+			arrayTables[name]++
+		}
+
+		name := strings.Join(table, ".")
+		doc.Tables = append(doc.Tables, name)
+		doc.TableLines[name] = line
+	}
+
+	if err := parser.Error(); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// tomlLookup returns the value at a path of a decoded TOML document, whose
+// parts are the keys of the tables and the indexes of the arrays of tables
+func tomlLookup(tree map[string]interface{}, path []string) interface{} {
+	var value interface{} = tree
+
+	for _, part := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[part]
+
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+
+			if err != nil || index < 0 || index >= len(v) {
+				return nil
+			}
+
+			value = v[index]
+
+		default:
+			return nil
+		}
+	}
+
+	return value
+}
+
+// stringValue returns the value of a key as a string
+func (doc *tomlDocument) stringValue(key string) (string, bool, error) {
+	v, exists := doc.Values[key]
+
+	if !exists {
+		return "", false, nil
+	}
+
+	s, ok := v.Value.(string)
+
+	if !ok {
+		return "", true, fmt.Errorf("line %d: %s must be a string", v.Line, key)
+	}
+
+	return s, true, nil
+}
+
+// stringsValue returns the value of a key as an array of strings
+func (doc *tomlDocument) stringsValue(key string) ([]string, bool, error) {
+	v, exists := doc.Values[key]
+
+	if !exists {
+		return nil, false, nil
+	}
+
+	values, ok := v.Value.([]interface{})
+	strs := make([]string, 0, len(values))
+
+	for _, value := range values {
+		s, isString := value.(string)
+
+		if !isString {
+			ok = false
+			break
+		}
+
+		strs = append(strs, s)
+	}
+
+	if !ok {
+		return nil, true, fmt.Errorf("line %d: %s must be an array of strings", v.Line, key)
+	}
+
+	return strs, true, nil
+}
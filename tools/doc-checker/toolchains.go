@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Rustup toolchain names (e.g. stable, nightly-2024-06-01, 1.75.0)
+var toolchainNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// MatrixResult counts the snippets compiled in a configuration of a matrix
+// (a toolchain of --toolchains, or a feature set of --features-matrix)
+type MatrixResult struct {
+	Checked int `json:"checked"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+
+	// Snippets which don't compile in the configuration (e.g. "docs/guide.md:42 (auto_3)")
+	FailedSnippets []string `json:"failed_snippets,omitempty"`
+
+	// Why the snippets could not be compiled (e.g. the toolchain is not installed)
+	Error string `json:"error,omitempty"`
+}
+
+// add adds the counts of the same configuration in another shard
+func (r *MatrixResult) add(other MatrixResult) {
+	r.Checked += other.Checked
+	r.Passed += other.Passed
+	r.Failed += other.Failed
+	r.FailedSnippets = append(r.FailedSnippets, other.FailedSnippets...)
+
+	if r.Error == "" {
+		r.Error = other.Error
+	}
+}
+
+// ToolchainResult is the outcome of the compilation of the snippets with a
+// toolchain of the --toolchains matrix
+type ToolchainResult struct {
+	Toolchain string `json:"toolchain"`       // e.g. nightly
+	Rustc     string `json:"rustc,omitempty"` // e.g. rustc 1.81.0-nightly (...)
+
+	MatrixResult
+}
+
+// parseToolchains parses the comma-separated toolchains of --toolchains
+// (e.g. "stable,beta,nightly")
+func parseToolchains(value string) ([]string, error) {
+	var toolchains []string
+
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+
+		if !toolchainNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid toolchain %q in --toolchains %s", name, value)
+		}
+
+		if !containsCode(toolchains, name) {
+			toolchains = append(toolchains, name)
+		}
+	}
+
+	return toolchains, nil
+}
+
+// matrixTargetDir returns the target dir of the snippets compiled in a
+// configuration of a matrix (e.g. toolchains/nightly), so their artifacts
+// don't invalidate the ones of the other configurations
+func (dc *DocChecker) matrixTargetDir(projectDir, matrix, name string) string {
+	if dc.targetDir != "" {
+		return filepath.Join(dc.targetDir, matrix, name)
+	}
+
+	return filepath.Join(projectDir, "target", matrix, name)
+}
+
+// checkToolchains compiles the snippets again with each toolchain of --toolchains
+// (`cargo +TOOLCHAIN check`), and reports the matrix in the summary, e.g. to
+// catch the nightly-only syntax of a snippet; the compile_fail and unclosed
+// snippets are not part of it
+func (dc *DocChecker) checkToolchains() {
+	groups := dc.manifest.byCrate()
+
+	for _, toolchain := range dc.config.Toolchains {
+		result := ToolchainResult{Toolchain: toolchain}
+
+		version, err := dc.rustcCommand(dc.tempDir, "+"+toolchain, "-V").Output()
+
+		if err != nil {
+			result.Error = fmt.Sprintf("toolchain not available (rustup toolchain install %s)", toolchain)
+			dc.results.Summary.Toolchains = append(dc.results.Summary.Toolchains, result)
+			dc.logError(fmt.Sprintf("Failed to compile the snippets with %s: %s", toolchain, result.Error))
+
+			continue
+		}
+
+		result.Rustc = strings.TrimSpace(string(version))
+		dc.logInfo(fmt.Sprintf("Compiling the snippets with %s (%s)...", toolchain, result.Rustc))
+
+		for i, crate := range dc.crates() {
+			for _, group := range dc.manifest.byFeatures(groups[crate.Name]) {
+				crate.Features = dc.manifest[group[0]].Features
+
+				projectDir := dc.projectDir(i, crate)
+				targetDir := dc.matrixTargetDir(projectDir, "toolchains", toolchain)
+
+				if err := dc.checkMatrixSnippets(projectDir, targetDir, toolchain, group, &result.MatrixResult, "+"+toolchain); err != nil {
+					result.Error = err.Error()
+					dc.logError(fmt.Sprintf("Failed to compile the snippets with %s: %v", toolchain, err))
+				}
+			}
+		}
+
+		dc.results.Summary.Toolchains = append(dc.results.Summary.Toolchains, result)
+	}
+}
+
+// checkMatrixSnippets compiles the snippets of a generated project in a
+// configuration of a matrix (e.g. with `cargo +nightly`), and counts them in its result
+func (dc *DocChecker) checkMatrixSnippets(projectDir, targetDir, configuration string, binNames []string, result *MatrixResult, cargoArgs ...string) error {
+	var bins []string
+
+	for _, binName := range binNames {
+		if source := dc.manifest[binName]; !source.CompileFail && !source.Unclosed {
+			bins = append(bins, binName)
+		}
+	}
+
+	if len(bins) == 0 {
+		return nil
+	}
+
+	args := append(append([]string{}, cargoArgs...), "check", "--keep-going", "--message-format=json")
+
+	for _, binName := range bins {
+		args = append(args, "--bin", binName)
+	}
+
+	cmd := dc.projectCargoCommand(projectDir, args...)
+	cmd.Env = targetDirEnv(cmd.Env, targetDir)
+
+	output, err := cmd.CombinedOutput()
+	diagnostics := parseCargoDiagnostics(output)
+	failures := make(map[string]string) // First error of each failing binary
+
+	for _, diag := range diagnostics.Diagnostics {
+		if _, exists := failures[diag.target]; diag.Level == "error" && diag.target != "" && !exists {
+			failures[diag.target] = diag.Message
+		}
+	}
+
+	// Failed before compiling the snippets, e.g. a dependency requiring a newer toolchain
+	if err != nil && len(failures) == 0 {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(diagnostics.Text))
+	}
+
+	for _, binName := range bins {
+		result.Checked++
+
+		message, failed := failures[binName]
+
+		if !failed {
+			result.Passed++
+			continue
+		}
+
+		source := dc.manifest[binName]
+		location := fmt.Sprintf("%s:%d (%s)", dc.relativePath(source.File), source.StartLine, source.SnippetID)
+
+		result.Failed++
+		result.FailedSnippets = append(result.FailedSnippets, location)
+
+		dc.logError(fmt.Sprintf("Snippet %s fails to compile with %s: %s", location, configuration, message))
+	}
+
+	return nil
+}
+
+// mergeToolchains adds the toolchain matrix of a shard to the one of the
+// previous shards, each shard compiling its own snippets
+func mergeToolchains(merged, shard []ToolchainResult) []ToolchainResult {
+	for _, result := range shard {
+		found := false
+
+		for i := range merged {
+			if merged[i].Toolchain != result.Toolchain {
+				continue
+			}
+
+			found = true
+			merged[i].add(result.MatrixResult)
+		}
+
+		if !found {
+			merged = append(merged, result)
+		}
+	}
+
+	return merged
+}
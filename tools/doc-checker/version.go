@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Build information, set at build time (see the Makefile), e.g.
+//
+//	go build -ldflags "-X main.commit=1b6e611 -X main.buildDate=2025-01-02T03:04:05Z"
+//
+// Otherwise, the VCS information embedded by the Go toolchain is used, if any
+var (
+	commit    = ""
+	buildDate = ""
+)
+
+// Tags of the doc-checker releases: as a nested Go module, tools/doc-checker/vX.Y.Z
+const releaseTagPrefix = "tools/doc-checker/v"
+
+// Tags of the repository, from the GitHub API
+var tagsURL = "https://api.github.com/repos/cchantep/tnuctipun/tags?per_page=100"
+
+// versionString returns the version of doc-checker, with its build information
+// (e.g. "1.0.0 (commit 1b6e611, built 2025-01-02T03:04:05Z, go1.21.5 linux/amd64)"),
+// to be given in the bug reports
+func versionString() string {
+	rev, date := commit, buildDate
+	modified := false
+
+	if info, ok := debug.ReadBuildInfo(); ok && rev == "" {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				rev = setting.Value
+
+			case "vcs.time":
+				if date == "" {
+					date = setting.Value
+				}
+
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+	}
+
+	details := []string{}
+
+	if rev != "" {
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+
+		if modified {
+			rev += "-dirty"
+		}
+
+		details = append(details, "commit "+rev)
+	}
+
+	if date != "" {
+		details = append(details, "built "+date)
+	}
+
+	details = append(details, fmt.Sprintf("%s %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH))
+
+	return fmt.Sprintf("%s (%s)", version, strings.Join(details, ", "))
+}
+
+// semver is a semantic version (e.g. 1.2.0-rc.1)
+type semver struct {
+	numbers    [3]int
+	prerelease string // e.g. "rc.1", "" for a stable release
+}
+
+// parseSemver parses a semantic version, without the "v" prefix
+func parseSemver(value string) (semver, bool) {
+	var v semver
+
+	value, _, _ = strings.Cut(value, "+") // Build metadata
+	value, v.prerelease, _ = strings.Cut(value, "-")
+	parts := strings.Split(value, ".")
+
+	if len(parts) != 3 {
+		return v, false
+	}
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+
+		if err != nil || n < 0 {
+			return v, false
+		}
+
+		v.numbers[i] = n
+	}
+
+	return v, true
+}
+
+// less checks whether the version precedes the other one (a pre-release
+// preceding its release, the pre-releases being compared as strings)
+func (v semver) less(other semver) bool {
+	for i := range v.numbers {
+		if v.numbers[i] != other.numbers[i] {
+			return v.numbers[i] < other.numbers[i]
+		}
+	}
+
+	switch {
+	case v.prerelease == other.prerelease:
+		return false
+	case v.prerelease == "":
+		return false
+	case other.prerelease == "":
+		return true
+	default:
+		return v.prerelease < other.prerelease
+	}
+}
+
+// latestRelease returns the latest version among the release tags, in the channel
+// of the running version: only the stable releases, unless it's a pre-release
+func latestRelease(tags []string, current semver) (string, bool) {
+	var versions []semver
+	names := make(map[semver]string)
+
+	for _, tag := range tags {
+		name, isRelease := strings.CutPrefix(tag, releaseTagPrefix)
+
+		if !isRelease {
+			continue
+		}
+
+		v, ok := parseSemver(name)
+
+		if !ok || (v.prerelease != "" && current.prerelease == "") {
+			continue
+		}
+
+		versions = append(versions, v)
+		names[v] = name
+	}
+
+	if len(versions) == 0 {
+		return "", false
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].less(versions[j]) })
+
+	return names[versions[len(versions)-1]], true
+}
+
+// checkUpdate returns the latest release of doc-checker, if newer than the running one
+func checkUpdate(ctx context.Context, client *http.Client) (string, bool, error) {
+	current, ok := parseSemver(version)
+
+	if !ok {
+		return "", false, fmt.Errorf("invalid running version %s", version)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tagsURL, nil)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	// Higher rate limit, e.g. on the CI runners sharing an IP
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", false, fmt.Errorf("GitHub API: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var tags []struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return "", false, fmt.Errorf("GitHub API: %w", err)
+	}
+
+	names := make([]string, len(tags))
+
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+
+	latest, found := latestRelease(names, current)
+
+	if !found {
+		return "", false, nil
+	}
+
+	latestVersion, _ := parseSemver(latest)
+
+	return latest, current.less(latestVersion), nil
+}
+
+// printUpdateNotice checks for a newer release (--check-update), and prints
+// a notice on stderr if any: a failure to check doesn't prevent the run
+func printUpdateNotice() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	latest, newer, err := checkUpdate(ctx, http.DefaultClient)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg("update.failed", err))
+	} else if newer {
+		fmt.Fprintln(os.Stderr, msg("update.available", latest, version))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Snippet compiled by warmup, so the generated projects have a target
+// (named like the generated snippets, so it's cleaned by the next run)
+const warmupSnippet = "warmup-0"
+
+// Warmup generates the Cargo project of each documented crate, with an empty
+// snippet, and compiles its dependencies in the persistent work directory,
+// so that the next checks (e.g. in a later CI stage) only compile the snippets
+func (dc *DocChecker) Warmup(ctx context.Context) error {
+	if dc.config.WorkKey == "" && !dc.config.Hermetic {
+		return fmt.Errorf("warmup requires --work-key (or --hermetic with --out-dir), for the checks to reuse its target dir")
+	}
+
+	dc.ctx = ctx
+
+	tempDir, err := dc.prepareWorkDir()
+	defer dc.releaseWorkDir()
+
+	if err != nil {
+		return err
+	}
+
+	dc.tempDir = tempDir
+	snippetFile := filepath.Join(tempDir, warmupSnippet+".rs")
+
+	if err := os.WriteFile(snippetFile, nil, 0644); err != nil {
+		return fmt.Errorf("failed to write warmup snippet: %w", err)
+	}
+
+	dc.checkToolchain(tempDir)
+
+	for i, crate := range dc.crates() {
+		projectDir := dc.projectDir(i, crate)
+
+		if err := dc.createCargoProject(projectDir, crate, []string{snippetFile}); err != nil {
+			return fmt.Errorf("failed to create cargo project: %w", err)
+		}
+
+		dc.logInfo(fmt.Sprintf("Compiling the dependencies for %s...", crate.Name))
+
+		if output, err := dc.projectCargoCommand(projectDir, append([]string{"check", "--workspace"}, dc.cargoJobs()...)...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to compile the dependencies for %s: %w\n%s",
+				crate.Name, err, strings.TrimSpace(string(output)))
+		}
+
+		dc.logSuccess(fmt.Sprintf("Dependencies for %s compiled in %s", crate.Name, projectDir))
+	}
+
+	return nil
+}
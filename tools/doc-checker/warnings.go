@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Codes of the warnings
+const (
+	warnStaleIgnore      = "STALE_IGNORE"
+	warnOversizedSnippet = "OVERSIZED_SNIPPET"
+	warnUntaggedRust     = "UNTAGGED_RUST_BLOCK"
+	warnToolchainSkew    = "TOOLCHAIN_SKEW"
+	warnOutdatedPath     = "OUTDATED_PATH"
+	warnDepDrift         = "DEP_DRIFT"
+	warnStructure        = "MARKDOWN_STRUCTURE"
+	warnCompiler         = "COMPILER_WARNING"
+	warnClippy           = "CLIPPY_LINT"
+	warnStyle            = "STYLE"
+	warnInvalidTOML      = "INVALID_TOML"
+	warnCrateVersion     = "CRATE_VERSION"
+	warnUnknownFeature   = "UNKNOWN_FEATURE"
+	warnContent          = "CONTENT"
+	warnInvalidJSON      = "INVALID_JSON"
+	warnUnknownCommand   = "UNKNOWN_COMMAND"
+	warnBrokenFlag       = "BROKEN_FLAG"
+	warnProvidedDep      = "PROVIDED_DEPENDENCY"
+)
+
+// Snippets longer than that are hard to follow as documentation
+const maxSnippetLines = 100
+
+// Lines which are most likely Rust code, in a code block without language
+var rustLookingLineRegex = regexp.MustCompile(
+	`^\s*((pub(\(crate\))?\s+)?(fn|struct|enum|impl|trait|mod)\s|use\s+[A-Za-z_:]+|let\s+(mut\s+)?[A-Za-z_][A-Za-z0-9_]*\s*[:=]|#\[derive\()`)
+
+// warningDescription describes a warning code
+func warningDescription(code string) string {
+	switch code {
+	case warnOversizedSnippet:
+		return msg("warning."+code, maxSnippetLines)
+	case warnStyle:
+		return msg("warning."+code, "--max-line-width")
+	case warnStaleIgnore, warnUntaggedRust, warnToolchainSkew, warnOutdatedPath, warnDepDrift, warnStructure, warnCompiler,
+		warnClippy, warnInvalidTOML, warnCrateVersion, warnUnknownFeature, warnContent, warnInvalidJSON,
+		warnUnknownCommand, warnBrokenFlag, warnProvidedDep:
+		return msg("warning." + code)
+	default:
+		return msg("warning.OTHER")
+	}
+}
+
+// addWarning records a non-fatal finding, as an error with --warnings-as-errors
+func (dc *DocChecker) addWarning(warning Warning) {
+	warning.Level = "warning"
+
+	if dc.config.WarningsAsErrors {
+		warning.Level = "error"
+	}
+
+	dc.results.Warnings = append(dc.results.Warnings, warning)
+	dc.results.Summary.Warnings++
+	dc.results.Summary.WarningsByCode[warning.Code]++
+
+	location := ""
+
+	if warning.File != "" {
+		location = fmt.Sprintf("%s:%d: ", dc.relativePath(warning.File), warning.Line)
+	}
+
+	dc.logWarning(fmt.Sprintf("%s%s (%s)", location, warning.Message, warning.Code))
+}
+
+// errorWarnings counts the warnings treated as errors, whatever their order
+// (e.g. the ones merged from shards run with and without --warnings-as-errors)
+func errorWarnings(warnings []Warning) int {
+	count := 0
+
+	for _, warning := range warnings {
+		if warning.Level == "error" {
+			count++
+		}
+	}
+
+	return count
+}
+
+// lintMarkdown finds the non-fatal issues of a markdown file,
+// given the snippets extracted from its content
+func (dc *DocChecker) lintMarkdown(filePath, content string, snippets []Snippet) {
+	for _, snippet := range snippets {
+		if lines := snippet.EndLine - snippet.StartLine - 1; !snippet.Ignore && lines > maxSnippetLines {
+			dc.addWarning(Warning{
+				Code:    warnOversizedSnippet,
+				File:    filePath,
+				Line:    snippet.StartLine,
+				Message: fmt.Sprintf("Snippet %s has %d lines (more than %d)", snippet.ID, lines, maxSnippetLines),
+			})
+		}
+	}
+
+	lines := strings.Split(content, "\n")
+
+	dc.lintOutdatedPaths(filePath, lines, snippets)
+	dc.lintLineWidth(filePath, lines, snippets)
+	dc.lintDependencyDrift(filePath, lines, snippets)
+	dc.lintFeatureNames(filePath, lines)
+	dc.lintContent(filePath, lines)
+	dc.lintJSONBlocks(filePath, lines)
+	dc.lintShellBlocks(filePath, lines)
+	inCodeBlock := false
+	untagged := false
+	rustLooking := false
+	fenceLine := 0
+	regionLine := 0 // line of the doc-checker:off marker, if in a skip region
+
+	var opening codeFence
+
+	for i, line := range lines {
+		if inCodeBlock && opening.interruptedBy(line) {
+			dc.addWarning(Warning{
+				Code:    warnStructure,
+				File:    filePath,
+				Line:    fenceLine,
+				Message: fmt.Sprintf("Code block not closed before the fence at line %d", i+1),
+			})
+
+			inCodeBlock = false
+		}
+
+		if fence, isFence := parseCodeFence(line); isFence && (!inCodeBlock || opening.closedBy(line)) {
+			if !inCodeBlock {
+				inCodeBlock = true
+				opening = fence
+				fenceLine = i + 1
+				untagged = fence.info == ""
+				rustLooking = false
+
+				continue
+			}
+
+			inCodeBlock = false
+
+			if untagged && rustLooking {
+				dc.addWarning(Warning{
+					Code:    warnUntaggedRust,
+					File:    filePath,
+					Line:    fenceLine,
+					Message: "Code block without language looks like Rust: tag it as 'rust' to check it, or as 'text'",
+				})
+			}
+
+			continue
+		}
+
+		if inCodeBlock {
+			if untagged && rustLookingLineRegex.MatchString(opening.content(line)) {
+				rustLooking = true
+			}
+
+			continue
+		}
+
+		switch strings.TrimSpace(line) {
+		case skipRegionStart:
+			regionLine = i + 1
+
+		case skipRegionEnd:
+			if regionLine == 0 {
+				dc.addWarning(Warning{
+					Code:    warnStaleIgnore,
+					File:    filePath,
+					Line:    i + 1,
+					Message: skipRegionEnd + " without a previous " + skipRegionStart,
+				})
+			} else if !skipsSnippet(snippets, regionLine, i+1) {
+				dc.addWarning(Warning{
+					Code:    warnStaleIgnore,
+					File:    filePath,
+					Line:    regionLine,
+					Message: "Skip region without any Rust snippet",
+				})
+			}
+
+			regionLine = 0
+		}
+	}
+
+	if inCodeBlock {
+		dc.addWarning(Warning{
+			Code:    warnStructure,
+			File:    filePath,
+			Line:    fenceLine,
+			Message: "Code block not closed before the end of the file",
+		})
+	}
+
+	if regionLine > 0 && !skipsSnippet(snippets, regionLine, len(lines)) {
+		dc.addWarning(Warning{
+			Code:    warnStaleIgnore,
+			File:    filePath,
+			Line:    regionLine,
+			Message: "Skip region without any Rust snippet",
+		})
+	}
+}
+
+// lintOutdatedPaths flags the snippets using the old paths of the configured renames,
+// even if they still compile (e.g. thanks to a re-export)
+func (dc *DocChecker) lintOutdatedPaths(filePath string, lines []string, snippets []Snippet) {
+	for _, rename := range dc.config.Renames {
+		patterns := outdatedPathPatterns(rename.Old)
+
+		for _, snippet := range snippets {
+			for _, i := range snippet.codeLines(len(lines)) {
+				for _, pattern := range patterns {
+					if pattern.MatchString(lines[i]) {
+						dc.addWarning(Warning{
+							Code:    warnOutdatedPath,
+							File:    filePath,
+							Line:    i + 1,
+							Message: fmt.Sprintf("Snippet %s uses %s, replaced by %s", snippet.ID, rename.Old, rename.New),
+						})
+
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// lintLineWidth flags the code lines of the snippets wider than --max-line-width,
+// as the wide examples render poorly (e.g. scrolled on crates.io and docs.rs)
+func (dc *DocChecker) lintLineWidth(filePath string, lines []string, snippets []Snippet) {
+	if dc.config.MaxLineWidth == 0 {
+		return
+	}
+
+	for _, snippet := range snippets {
+		if snippet.Skipped {
+			continue
+		}
+
+		for _, i := range snippet.codeLines(len(lines)) {
+			if width := lineWidth(lines[i]); width > dc.config.MaxLineWidth {
+				dc.addWarning(Warning{
+					Code:    warnStyle,
+					File:    filePath,
+					Line:    i + 1,
+					Message: fmt.Sprintf("Line of snippet %s is %d characters wide (more than %d)", snippet.ID, width, dc.config.MaxLineWidth),
+				})
+			}
+		}
+	}
+}
+
+// lineWidth returns the rendered width of a line: its characters,
+// a tab being 4 columns wide (as with rustfmt)
+func lineWidth(line string) int {
+	line = strings.TrimRight(line, " \r")
+
+	return utf8.RuneCountInString(line) + 3*strings.Count(line, "\t")
+}
+
+// outdatedPathPatterns returns the patterns matching a path in the code:
+// as is (e.g. "tnuctipun::update::X"), or imported in a group
+// (e.g. "use tnuctipun::{update, filters};")
+func outdatedPathPatterns(path string) []*regexp.Regexp {
+	const before, after = `(^|[^A-Za-z0-9_:])`, `($|[^A-Za-z0-9_])`
+
+	patterns := []*regexp.Regexp{regexp.MustCompile(before + regexp.QuoteMeta(path) + after)}
+
+	if sep := strings.LastIndex(path, "::"); sep > 0 {
+		parent, last := path[:sep], path[sep+2:]
+
+		patterns = append(patterns, regexp.MustCompile(
+			before+regexp.QuoteMeta(parent)+`::\{[^}]*[{,\s]`+regexp.QuoteMeta(last)+after))
+	}
+
+	return patterns
+}
+
+// skipsSnippet checks whether a snippet is between the given lines
+func skipsSnippet(snippets []Snippet, fromLine, toLine int) bool {
+	for _, snippet := range snippets {
+		if snippet.Skipped && snippet.StartLine > fromLine && snippet.StartLine < toLine {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkToolchain warns when the snippets are not compiled with the toolchain
+// pinned by the project (as the generated project is outside of it,
+// its rust-toolchain.toml doesn't apply)
+func (dc *DocChecker) checkToolchain(projectDir string) {
+	pinned := pinnedToolchain(dc.config.ProjectRoot)
+
+	// Only the versions can be compared, not the channels (e.g. stable)
+	if pinned == "" || (pinned[0] < '0' || pinned[0] > '9') {
+		return
+	}
+
+	cmd := dc.rustcCommand(projectDir, "--version")
+	output, err := cmd.Output()
+
+	if err != nil {
+		return
+	}
+
+	// e.g. "rustc 1.94.0 (4a4ef493e 2026-03-02)"
+	fields := strings.Fields(string(output))
+
+	if len(fields) < 2 {
+		return
+	}
+
+	used := fields[1]
+
+	if used != pinned && !strings.HasPrefix(used, pinned+".") {
+		dc.addWarning(Warning{
+			Code:    warnToolchainSkew,
+			Message: fmt.Sprintf("Snippets compiled with rustc %s, but the project pins %s", used, pinned),
+		})
+	}
+}
+
+// pinnedToolchain returns the channel of the rust-toolchain(.toml) file of the project, if any
+func pinnedToolchain(projectRoot string) string {
+	if content, err := os.ReadFile(filepath.Join(projectRoot, "rust-toolchain.toml")); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			parts := strings.SplitN(line, "=", 2)
+
+			if len(parts) == 2 && strings.TrimSpace(parts[0]) == "channel" {
+				return strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+			}
+		}
+
+		return ""
+	}
+
+	// Legacy file, only containing the channel
+	if content, err := os.ReadFile(filepath.Join(projectRoot, "rust-toolchain")); err == nil {
+		return strings.TrimSpace(string(content))
+	}
+
+	return ""
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Lock file of a persistent work directory, held for the lifetime of a run
+const workDirLock = ".doc-checker.lock"
+
+// The lock is refreshed while held, so that the one of a killed run is
+// only considered stale once it isn't refreshed anymore
+var (
+	workLockRefresh = 10 * time.Second
+	workLockStale   = time.Minute
+	workLockPoll    = 200 * time.Millisecond
+)
+
+// workLock is the lock of a persistent work directory, so that the concurrent
+// runs using it (e.g. with the same --work-key) don't clean the snippets of each other
+type workLock struct {
+	path string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// lockWorkDir waits for the lock of the work directory to be released
+// (or stale), then takes it, until the context is cancelled
+func lockWorkDir(ctx context.Context, workDir string, onWait func()) (*workLock, error) {
+	path := filepath.Join(workDir, workDirLock)
+	waiting := false
+
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+
+		if err == nil {
+			_, err = file.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write the lock of the work directory: %w", err)
+			}
+
+			lock := &workLock{path: path, stop: make(chan struct{}), done: make(chan struct{})}
+			go lock.refresh()
+
+			return lock, nil
+		}
+
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock the work directory: %w", err)
+		}
+
+		// Left by a run which was killed
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > workLockStale {
+			os.Remove(path)
+			continue
+		}
+
+		if !waiting && onWait != nil {
+			onWait()
+		}
+
+		waiting = true
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for the lock of the work directory: %w", ctx.Err())
+		case <-time.After(workLockPoll):
+		}
+	}
+}
+
+// refresh touches the lock file until it's released
+func (l *workLock) refresh() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(workLockRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			os.Chtimes(l.path, now, now)
+		}
+	}
+}
+
+// release removes the lock file, for the next run to take it
+func (l *workLock) release() {
+	if l == nil {
+		return
+	}
+
+	close(l.stop)
+	<-l.done
+
+	os.Remove(l.path)
+}